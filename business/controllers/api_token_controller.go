@@ -0,0 +1,346 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/business/services"
+	"github.com/GZ-Alinx/autops/internal/database"
+	"github.com/GZ-Alinx/autops/internal/logger"
+	"github.com/GZ-Alinx/autops/internal/middleware"
+	"github.com/GZ-Alinx/autops/internal/response"
+)
+
+// CreateAPITokenRequest 创建API令牌请求结构
+// @Description 创建API令牌的请求参数，scopes为空表示继承所属用户全部角色
+type CreateAPITokenRequest struct {
+	Name      string     `json:"name" binding:"required,max=100"` // 令牌名称
+	Scopes    []string   `json:"scopes"`                          // 限定的角色列表
+	ExpiresAt *time.Time `json:"expires_at"`                      // 过期时间，为空表示永不过期
+}
+
+// CreateAPITokenResponse 创建API令牌响应结构
+// @Description 令牌明文仅在创建时返回一次
+type CreateAPITokenResponse struct {
+	Token    string          `json:"token"`
+	APIToken models.APIToken `json:"api_token"`
+}
+
+// CreateServiceAccountRequest 创建服务账号请求结构
+// @Description 创建服务账号的请求参数
+type CreateServiceAccountRequest struct {
+	Name        string   `json:"name" binding:"required,min=2,max=50"` // 服务账号名称
+	Description string   `json:"description" binding:"max=50"`         // 描述
+	Roles       []string `json:"roles" binding:"required,min=1"`       // 角色名称列表
+}
+
+// APITokenController API令牌与服务账号控制器
+type APITokenController struct {
+	tokenService services.APITokenService
+	userService  services.UserService
+}
+
+// NewAPITokenController 创建API令牌控制器实例
+func NewAPITokenController(tokenService services.APITokenService, userService services.UserService) *APITokenController {
+	return &APITokenController{
+		tokenService: tokenService,
+		userService:  userService,
+	}
+}
+
+// currentUserID 获取当前登录用户ID
+func currentUserID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.GetString("userID"), 10, 64)
+	if err != nil || id == 0 {
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// createToken 为指定所属用户创建令牌
+func (tc *APITokenController) createToken(c *gin.Context, owner *models.User) {
+	var req CreateAPITokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, fmt.Errorf("请求参数验证失败: %v", err))
+		return
+	}
+
+	createdBy, _ := currentUserID(c)
+	raw, token, err := tc.tokenService.CreateToken(owner, req.Name, req.Scopes, req.ExpiresAt, createdBy)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidTokenScope) {
+			response.BadRequest(c, err)
+			return
+		}
+		response.InternalServerError(c, fmt.Errorf("创建API令牌失败: %v", err))
+		return
+	}
+
+	response.OkWithData(c, CreateAPITokenResponse{Token: raw, APIToken: *token})
+}
+
+// @Summary 创建个人访问令牌
+// @Description 为当前用户创建API令牌，令牌明文仅返回一次
+// @Tags API令牌
+// @Accept json
+// @Produce json
+// @Param data body CreateAPITokenRequest true "令牌信息"
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Response{data=CreateAPITokenResponse}
+// @Failure 400 {object} response.Response{msg=string}
+// @Failure 403 {object} response.Response{msg=string}
+// @Failure 500 {object} response.Response{msg=string}
+// @Router /me/tokens [post]
+func (tc *APITokenController) CreateMyToken(c *gin.Context) {
+	// 不允许用API令牌再签发新令牌，避免令牌泄露后被用于持久化访问
+	if middleware.IsAPITokenAuth(c) {
+		response.Forbidden(c, fmt.Errorf("不能使用API令牌创建新令牌"))
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		response.Unauthorized(c, fmt.Errorf("未登录"))
+		return
+	}
+	owner, err := tc.userService.GetUserByID(userID)
+	if err != nil {
+		response.InternalServerError(c, fmt.Errorf("查询用户失败: %v", err))
+		return
+	}
+
+	tc.createToken(c, owner)
+}
+
+// @Summary 获取个人访问令牌列表
+// @Description 获取当前用户的全部API令牌
+// @Tags API令牌
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Response{data=[]models.APIToken}
+// @Failure 500 {object} response.Response{msg=string}
+// @Router /me/tokens [get]
+func (tc *APITokenController) ListMyTokens(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		response.Unauthorized(c, fmt.Errorf("未登录"))
+		return
+	}
+
+	tokens, err := tc.tokenService.ListTokens(userID)
+	if err != nil {
+		response.InternalServerError(c, fmt.Errorf("获取API令牌列表失败: %v", err))
+		return
+	}
+	response.OkWithData(c, tokens)
+}
+
+// @Summary 吊销个人访问令牌
+// @Description 吊销当前用户的指定API令牌
+// @Tags API令牌
+// @Produce json
+// @Param id path int true "令牌ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Response{data=string}
+// @Failure 400 {object} response.Response{msg=string}
+// @Failure 404 {object} response.Response{msg=string}
+// @Failure 500 {object} response.Response{msg=string}
+// @Router /me/tokens/{id} [delete]
+func (tc *APITokenController) RevokeMyToken(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		response.Unauthorized(c, fmt.Errorf("未登录"))
+		return
+	}
+	tc.revokeToken(c, userID, c.Param("id"))
+}
+
+// revokeToken 吊销所属用户的指定令牌
+func (tc *APITokenController) revokeToken(c *gin.Context, ownerID uint, idStr string) {
+	tokenID, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		response.BadRequest(c, fmt.Errorf("无效的令牌ID: %v", err))
+		return
+	}
+
+	if err := tc.tokenService.RevokeToken(ownerID, uint(tokenID)); err != nil {
+		if errors.Is(err, services.ErrAPITokenNotFound) {
+			response.NotFound(c, err)
+			return
+		}
+		response.InternalServerError(c, fmt.Errorf("吊销API令牌失败: %v", err))
+		return
+	}
+	response.OkWithData(c, "API令牌已吊销")
+}
+
+// @Summary 创建服务账号
+// @Description 创建非人类服务账号，服务账号只能通过API令牌访问
+// @Tags 服务账号
+// @Accept json
+// @Produce json
+// @Param data body CreateServiceAccountRequest true "服务账号信息"
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Response{data=models.User}
+// @Failure 400 {object} response.Response{msg=string}
+// @Failure 500 {object} response.Response{msg=string}
+// @Router /service-accounts [post]
+func (tc *APITokenController) CreateServiceAccount(c *gin.Context) {
+	var req CreateServiceAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, fmt.Errorf("请求参数验证失败: %v", err))
+		return
+	}
+
+	account, err := tc.tokenService.CreateServiceAccount(req.Name, req.Description, req.Roles)
+	if err != nil {
+		logger.Logger.Error("创建服务账号失败", zap.String("name", req.Name), zap.Error(err))
+		response.BadRequest(c, fmt.Errorf("创建服务账号失败: %v", err))
+		return
+	}
+
+	// 同步服务账号的Casbin规则
+	if err := database.SyncCasbinPolicyScope(database.ScopeUsers(account.Username)); err != nil {
+		logger.Logger.Error("同步Casbin策略失败", zap.Error(err))
+	}
+
+	response.OkWithData(c, account)
+}
+
+// @Summary 获取服务账号列表
+// @Description 获取全部服务账号
+// @Tags 服务账号
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Response{data=[]models.User}
+// @Failure 500 {object} response.Response{msg=string}
+// @Router /service-accounts [get]
+func (tc *APITokenController) ListServiceAccounts(c *gin.Context) {
+	accounts, err := tc.tokenService.ListServiceAccounts()
+	if err != nil {
+		response.InternalServerError(c, fmt.Errorf("获取服务账号列表失败: %v", err))
+		return
+	}
+	response.OkWithData(c, accounts)
+}
+
+// @Summary 删除服务账号
+// @Description 删除服务账号并吊销其全部令牌
+// @Tags 服务账号
+// @Produce json
+// @Param id path int true "服务账号ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Response{data=string}
+// @Failure 400 {object} response.Response{msg=string}
+// @Failure 404 {object} response.Response{msg=string}
+// @Failure 500 {object} response.Response{msg=string}
+// @Router /service-accounts/{id} [delete]
+func (tc *APITokenController) DeleteServiceAccount(c *gin.Context) {
+	account, ok := tc.loadServiceAccount(c)
+	if !ok {
+		return
+	}
+
+	if err := tc.tokenService.DeleteServiceAccount(account.ID); err != nil {
+		response.InternalServerError(c, fmt.Errorf("删除服务账号失败: %v", err))
+		return
+	}
+
+	// 移除服务账号的Casbin规则
+	if err := database.SyncCasbinPolicyScope(database.ScopeUsers(account.Username)); err != nil {
+		logger.Logger.Error("同步Casbin策略失败", zap.Error(err))
+	}
+
+	response.OkWithData(c, "服务账号删除成功")
+}
+
+// @Summary 创建服务账号令牌
+// @Description 为服务账号创建API令牌，令牌明文仅返回一次
+// @Tags 服务账号
+// @Accept json
+// @Produce json
+// @Param id path int true "服务账号ID"
+// @Param data body CreateAPITokenRequest true "令牌信息"
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Response{data=CreateAPITokenResponse}
+// @Failure 400 {object} response.Response{msg=string}
+// @Failure 404 {object} response.Response{msg=string}
+// @Failure 500 {object} response.Response{msg=string}
+// @Router /service-accounts/{id}/tokens [post]
+func (tc *APITokenController) CreateServiceAccountToken(c *gin.Context) {
+	account, ok := tc.loadServiceAccount(c)
+	if !ok {
+		return
+	}
+	tc.createToken(c, account)
+}
+
+// @Summary 获取服务账号令牌列表
+// @Description 获取服务账号的全部API令牌
+// @Tags 服务账号
+// @Produce json
+// @Param id path int true "服务账号ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Response{data=[]models.APIToken}
+// @Failure 404 {object} response.Response{msg=string}
+// @Failure 500 {object} response.Response{msg=string}
+// @Router /service-accounts/{id}/tokens [get]
+func (tc *APITokenController) ListServiceAccountTokens(c *gin.Context) {
+	account, ok := tc.loadServiceAccount(c)
+	if !ok {
+		return
+	}
+
+	tokens, err := tc.tokenService.ListTokens(account.ID)
+	if err != nil {
+		response.InternalServerError(c, fmt.Errorf("获取API令牌列表失败: %v", err))
+		return
+	}
+	response.OkWithData(c, tokens)
+}
+
+// @Summary 吊销服务账号令牌
+// @Description 吊销服务账号的指定API令牌
+// @Tags 服务账号
+// @Produce json
+// @Param id path int true "服务账号ID"
+// @Param tokenId path int true "令牌ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Response{data=string}
+// @Failure 400 {object} response.Response{msg=string}
+// @Failure 404 {object} response.Response{msg=string}
+// @Failure 500 {object} response.Response{msg=string}
+// @Router /service-accounts/{id}/tokens/{tokenId} [delete]
+func (tc *APITokenController) RevokeServiceAccountToken(c *gin.Context) {
+	account, ok := tc.loadServiceAccount(c)
+	if !ok {
+		return
+	}
+	tc.revokeToken(c, account.ID, c.Param("tokenId"))
+}
+
+// loadServiceAccount 根据路径参数加载服务账号，失败时已写入响应
+func (tc *APITokenController) loadServiceAccount(c *gin.Context) (*models.User, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, fmt.Errorf("无效的服务账号ID: %v", err))
+		return nil, false
+	}
+
+	account, err := tc.tokenService.GetServiceAccount(uint(id))
+	if err != nil {
+		if errors.Is(err, services.ErrServiceAccountNotFound) {
+			response.NotFound(c, err)
+			return nil, false
+		}
+		response.InternalServerError(c, fmt.Errorf("查询服务账号失败: %v", err))
+		return nil, false
+	}
+	return account, true
+}
@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/GZ-Alinx/autops/business/repositories"
+	"github.com/GZ-Alinx/autops/business/services"
+	"github.com/GZ-Alinx/autops/internal/middleware"
+	"github.com/GZ-Alinx/autops/internal/response"
+)
+
+// AuditController 审计日志控制器
+type AuditController struct {
+	auditService services.AuditService
+}
+
+// NewAuditController 创建审计日志控制器实例
+func NewAuditController(auditService services.AuditService) *AuditController {
+	return &AuditController{auditService: auditService}
+}
+
+// currentActor 当前请求的操作人，用于写入审计日志；模拟登录时为真实操作人
+func currentActor(c *gin.Context) services.Actor {
+	id, _ := currentUserID(c)
+	if impersonator, ok := middleware.GetImpersonator(c); ok {
+		actorID, _ := strconv.ParseUint(impersonator.UserID, 10, 64)
+		return services.Actor{
+			ID:         uint(actorID),
+			Username:   impersonator.Username,
+			IP:         c.ClientIP(),
+			OnBehalfOf: id,
+		}
+	}
+	return services.Actor{
+		ID:       id,
+		Username: c.GetString("username"),
+		IP:       c.ClientIP(),
+	}
+}
+
+// @Summary 查询审计日志
+// @Description 分页查询审计日志，最新的在前，可按操作类型、操作人和操作对象过滤
+// @Tags 审计日志
+// @Produce json
+// @Param page query int false "页码(默认1)"
+// @Param page_size query int false "每页条数(默认20，最大100)"
+// @Param action query string false "操作类型，如user.status.change"
+// @Param actor_id query int false "操作人ID"
+// @Param target_type query string false "操作对象类型，如user"
+// @Param target_id query string false "操作对象ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Response{data=object}
+// @Failure 400 {object} response.Response{msg=string}
+// @Failure 500 {object} response.Response{msg=string}
+// @Router /audit-logs [get]
+func (ac *AuditController) List(c *gin.Context) {
+	page, _ := strconv.Atoi(c.Query("page"))
+	pageSize, _ := strconv.Atoi(c.Query("page_size"))
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	filter := repositories.AuditLogFilter{
+		Action:     c.Query("action"),
+		TargetType: c.Query("target_type"),
+		TargetID:   c.Query("target_id"),
+	}
+	if actorID := c.Query("actor_id"); actorID != "" {
+		id, err := strconv.ParseUint(actorID, 10, 64)
+		if err != nil {
+			response.BadRequest(c, fmt.Errorf("无效的操作人ID"))
+			return
+		}
+		filter.ActorID = uint(id)
+	}
+
+	logs, total, err := ac.auditService.List(filter, page, pageSize)
+	if err != nil {
+		response.InternalServerError(c, fmt.Errorf("查询审计日志失败: %v", err))
+		return
+	}
+	response.OkWithData(c, gin.H{
+		"list":  logs,
+		"total": total,
+		"page":  page,
+		"size":  pageSize,
+	})
+}
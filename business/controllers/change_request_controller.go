@@ -0,0 +1,201 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/business/services"
+	"github.com/GZ-Alinx/autops/internal/response"
+)
+
+// ReviewChangeRequest 审批变更请求结构体
+type ReviewChangeRequest struct {
+	Comment string `json:"comment" binding:"max=255"` // 审批意见
+}
+
+// ChangeRequestController 待审批变更控制器
+type ChangeRequestController struct {
+	changeService services.ChangeRequestService
+}
+
+// NewChangeRequestController 创建待审批变更控制器实例
+func NewChangeRequestController(changeService services.ChangeRequestService) *ChangeRequestController {
+	return &ChangeRequestController{changeService: changeService}
+}
+
+// respondChangeError 将待审批变更服务错误映射为响应
+func respondChangeError(c *gin.Context, err error, action string) {
+	switch {
+	case errors.Is(err, services.ErrChangeNotFound):
+		response.NotFound(c, err)
+	case errors.Is(err, services.ErrChangeForbidden),
+		errors.Is(err, services.ErrChangeSelfReview):
+		response.Forbidden(c, err)
+	case errors.Is(err, services.ErrChangeNotPending),
+		errors.Is(err, services.ErrChangeExpired),
+		errors.Is(err, services.ErrChangeDuplicate):
+		response.BadRequest(c, err)
+	default:
+		response.InternalServerError(c, fmt.Errorf("%s失败: %v", action, err))
+	}
+}
+
+// changeID 解析路径中的变更ID，无效时已写入响应
+func changeID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, fmt.Errorf("无效的变更ID"))
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// @Summary 获取我提交的变更
+// @Description 匹配permission.approval.rules的请求通过权限检查后返回202并保存为待审批变更
+// @Tags 变更审批
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Response{data=[]models.ChangeRequest}
+// @Failure 500 {object} response.Response{msg=string}
+// @Router /change-requests [get]
+func (cc *ChangeRequestController) ListMine(c *gin.Context) {
+	userID, _ := currentUserID(c)
+	changes, err := cc.changeService.ListMine(userID)
+	if err != nil {
+		respondChangeError(c, err, "获取变更")
+		return
+	}
+	response.OkWithData(c, changes)
+}
+
+// @Summary 获取待我审批的变更
+// @Description 当前用户拥有审批角色、不是申请人且尚未审批过的待审批变更
+// @Tags 变更审批
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Response{data=[]models.ChangeRequest}
+// @Failure 500 {object} response.Response{msg=string}
+// @Router /change-requests/reviews [get]
+func (cc *ChangeRequestController) ListReviewable(c *gin.Context) {
+	userID, _ := currentUserID(c)
+	changes, err := cc.changeService.ListReviewable(userID)
+	if err != nil {
+		respondChangeError(c, err, "获取待审批的变更")
+		return
+	}
+	response.OkWithData(c, changes)
+}
+
+// @Summary 获取变更详情
+// @Description 包含请求内容、审批记录和执行结果，只有申请人和拥有审批角色的用户可以查看
+// @Tags 变更审批
+// @Produce json
+// @Param id path int true "变更ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Response{data=models.ChangeRequest}
+// @Failure 403 {object} response.Response{msg=string}
+// @Failure 404 {object} response.Response{msg=string}
+// @Failure 500 {object} response.Response{msg=string}
+// @Router /change-requests/{id} [get]
+func (cc *ChangeRequestController) Get(c *gin.Context) {
+	id, ok := changeID(c)
+	if !ok {
+		return
+	}
+	userID, _ := currentUserID(c)
+	change, err := cc.changeService.Get(id, userID)
+	if err != nil {
+		respondChangeError(c, err, "获取变更")
+		return
+	}
+	response.OkWithData(c, change)
+}
+
+// @Summary 撤回变更
+// @Description 撤回自己提交的待审批变更
+// @Tags 变更审批
+// @Produce json
+// @Param id path int true "变更ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Response{data=string}
+// @Failure 400 {object} response.Response{msg=string}
+// @Failure 404 {object} response.Response{msg=string}
+// @Failure 500 {object} response.Response{msg=string}
+// @Router /change-requests/{id} [delete]
+func (cc *ChangeRequestController) Cancel(c *gin.Context) {
+	id, ok := changeID(c)
+	if !ok {
+		return
+	}
+	if err := cc.changeService.Cancel(id, currentActor(c)); err != nil {
+		respondChangeError(c, err, "撤回变更")
+		return
+	}
+	response.OkWithData(c, "变更已撤回")
+}
+
+// review 批准或拒绝变更
+func (cc *ChangeRequestController) review(c *gin.Context, approve bool) {
+	id, ok := changeID(c)
+	if !ok {
+		return
+	}
+	var req ReviewChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil && c.Request.ContentLength > 0 {
+		response.BadRequest(c, fmt.Errorf("请求参数验证失败: %v", err))
+		return
+	}
+
+	var change *models.ChangeRequest
+	var err error
+	if approve {
+		change, err = cc.changeService.Approve(id, req.Comment, currentActor(c))
+	} else {
+		change, err = cc.changeService.Reject(id, req.Comment, currentActor(c))
+	}
+	if err != nil {
+		respondChangeError(c, err, "审批变更")
+		return
+	}
+	response.OkWithData(c, change)
+}
+
+// @Summary 批准变更
+// @Description 达到需要的批准人数后以申请人的身份重新执行请求（重新检查申请人当前的权限），返回的变更包含执行结果；不能审批自己提交的变更
+// @Tags 变更审批
+// @Accept json
+// @Produce json
+// @Param id path int true "变更ID"
+// @Param data body ReviewChangeRequest false "审批意见"
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Response{data=models.ChangeRequest}
+// @Failure 400 {object} response.Response{msg=string}
+// @Failure 403 {object} response.Response{msg=string}
+// @Failure 404 {object} response.Response{msg=string}
+// @Failure 500 {object} response.Response{msg=string}
+// @Router /change-requests/{id}/approve [post]
+func (cc *ChangeRequestController) Approve(c *gin.Context) {
+	cc.review(c, true)
+}
+
+// @Summary 拒绝变更
+// @Description 任一审批人拒绝后变更结束，不再执行
+// @Tags 变更审批
+// @Accept json
+// @Produce json
+// @Param id path int true "变更ID"
+// @Param data body ReviewChangeRequest false "审批意见"
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Response{data=models.ChangeRequest}
+// @Failure 400 {object} response.Response{msg=string}
+// @Failure 403 {object} response.Response{msg=string}
+// @Failure 404 {object} response.Response{msg=string}
+// @Failure 500 {object} response.Response{msg=string}
+// @Router /change-requests/{id}/reject [post]
+func (cc *ChangeRequestController) Reject(c *gin.Context) {
+	cc.review(c, false)
+}
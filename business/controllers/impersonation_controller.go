@@ -0,0 +1,92 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/GZ-Alinx/autops/business/services"
+	"github.com/GZ-Alinx/autops/internal/middleware"
+	"github.com/GZ-Alinx/autops/internal/response"
+)
+
+// StartImpersonationRequest 发起模拟登录请求结构体
+// @Description reason写入审计日志，说明模拟的原因（如工单号）
+type StartImpersonationRequest struct {
+	UserID uint   `json:"user_id" binding:"required"`
+	Reason string `json:"reason" binding:"required,max=255"`
+}
+
+// ImpersonationController 模拟登录控制器
+type ImpersonationController struct {
+	impersonationService services.ImpersonationService
+}
+
+// NewImpersonationController 创建模拟登录控制器实例
+func NewImpersonationController(impersonationService services.ImpersonationService) *ImpersonationController {
+	return &ImpersonationController{impersonationService: impersonationService}
+}
+
+// @Summary 模拟用户登录
+// @Description 以指定用户的身份签发短期访问令牌（不可刷新），权限检查按被模拟用户进行；令牌的act声明、访问日志和审计日志记录真实操作人。只能模拟角色是自己角色子集的用户
+// @Tags 模拟登录
+// @Accept json
+// @Produce json
+// @Param body body StartImpersonationRequest true "被模拟的用户和原因"
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Response{data=services.ImpersonationToken}
+// @Failure 400 {object} response.Response{msg=string}
+// @Failure 403 {object} response.Response{msg=string}
+// @Failure 404 {object} response.Response{msg=string}
+// @Failure 500 {object} response.Response{msg=string}
+// @Router /impersonations [post]
+func (ic *ImpersonationController) Start(c *gin.Context) {
+	var req StartImpersonationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, fmt.Errorf("请求参数验证失败: %v", err))
+		return
+	}
+
+	actor := currentActor(c)
+	token, err := ic.impersonationService.Start(actor, req.UserID, req.Reason, clientInfo(c))
+	if err != nil {
+		var statusErr *services.AccountStatusError
+		switch {
+		case errors.Is(err, services.ErrImpersonationTargetNotFound):
+			response.NotFound(c, err)
+		case errors.Is(err, services.ErrImpersonateSelf),
+			errors.Is(err, services.ErrImpersonateServiceAccount),
+			errors.As(err, &statusErr):
+			response.BadRequest(c, err)
+		case errors.Is(err, services.ErrImpersonationEscalation):
+			response.Forbidden(c, err)
+		default:
+			response.InternalServerError(c, fmt.Errorf("模拟登录失败: %v", err))
+		}
+		return
+	}
+	response.OkWithData(c, token)
+}
+
+// @Summary 结束模拟登录
+// @Description 使用模拟登录令牌调用，吊销该令牌和模拟会话；被模拟用户也可以在会话列表中下线模拟会话
+// @Tags 模拟登录
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Response{data=string}
+// @Failure 400 {object} response.Response{msg=string}
+// @Failure 500 {object} response.Response{msg=string}
+// @Router /me/impersonation [delete]
+func (ic *ImpersonationController) End(c *gin.Context) {
+	claims, _ := middleware.GetClaims(c)
+	if err := ic.impersonationService.End(claims, currentActor(c)); err != nil {
+		if errors.Is(err, services.ErrNotImpersonating) {
+			response.BadRequest(c, err)
+			return
+		}
+		response.InternalServerError(c, fmt.Errorf("结束模拟登录失败: %v", err))
+		return
+	}
+	response.OkWithData(c, "已结束模拟登录")
+}
@@ -0,0 +1,240 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/business/services"
+	"github.com/GZ-Alinx/autops/internal/response"
+)
+
+// MFACodeRequest 两步验证码请求结构
+// @Description code为6位TOTP验证码，关闭或重新生成恢复码时也可使用恢复码
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required"` // 验证码
+}
+
+// MFARecoveryCodesResponse 恢复码响应结构
+// @Description 恢复码仅展示一次，每个只能使用一次
+type MFARecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// MFAController 两步验证控制器
+type MFAController struct {
+	mfaService  services.MFAService
+	userService services.UserService
+}
+
+// NewMFAController 创建两步验证控制器实例
+func NewMFAController(mfaService services.MFAService, userService services.UserService) *MFAController {
+	return &MFAController{
+		mfaService:  mfaService,
+		userService: userService,
+	}
+}
+
+// currentUser 获取当前登录用户
+func (mc *MFAController) currentUser(c *gin.Context) (*models.User, bool) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		response.Unauthorized(c, fmt.Errorf("未登录"))
+		return nil, false
+	}
+	user, err := mc.userService.GetUserByID(userID)
+	if err != nil {
+		response.InternalServerError(c, fmt.Errorf("查询用户失败: %v", err))
+		return nil, false
+	}
+	return user, true
+}
+
+// mfaFail 将两步验证错误转换为响应
+func mfaFail(c *gin.Context, err error, action string) {
+	switch {
+	case errors.Is(err, services.ErrInvalidMFACode):
+		response.Unauthorized(c, err)
+	case errors.Is(err, services.ErrMFANotEnabled),
+		errors.Is(err, services.ErrMFAAlreadyEnabled),
+		errors.Is(err, services.ErrMFANotEnrolling):
+		response.BadRequest(c, err)
+	default:
+		response.InternalServerError(c, fmt.Errorf("%s失败: %v", action, err))
+	}
+}
+
+// @Summary 获取两步验证状态
+// @Description 获取当前用户是否启用两步验证、角色是否要求以及剩余恢复码数量
+// @Tags 两步验证
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Response{data=services.MFAStatus}
+// @Failure 500 {object} response.Response{msg=string}
+// @Router /me/mfa [get]
+func (mc *MFAController) GetStatus(c *gin.Context) {
+	user, ok := mc.currentUser(c)
+	if !ok {
+		return
+	}
+
+	status, err := mc.mfaService.Status(user)
+	if err != nil {
+		mfaFail(c, err, "获取两步验证状态")
+		return
+	}
+	response.OkWithData(c, status)
+}
+
+// @Summary 开始绑定两步验证
+// @Description 生成TOTP密钥、otpauth URI和二维码内容，需再调用确认接口后才生效
+// @Tags 两步验证
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Response{data=services.MFAEnrollment}
+// @Failure 400 {object} response.Response{msg=string}
+// @Failure 500 {object} response.Response{msg=string}
+// @Router /me/mfa/enroll [post]
+func (mc *MFAController) Enroll(c *gin.Context) {
+	user, ok := mc.currentUser(c)
+	if !ok {
+		return
+	}
+
+	enrollment, err := mc.mfaService.BeginEnrollment(user)
+	if err != nil {
+		mfaFail(c, err, "生成两步验证密钥")
+		return
+	}
+	response.OkWithData(c, enrollment)
+}
+
+// @Summary 确认绑定两步验证
+// @Description 提交验证器App中的验证码，成功后启用两步验证并返回恢复码
+// @Tags 两步验证
+// @Accept json
+// @Produce json
+// @Param data body MFACodeRequest true "验证码"
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Response{data=MFARecoveryCodesResponse}
+// @Failure 400 {object} response.Response{msg=string}
+// @Failure 401 {object} response.Response{msg=string}
+// @Failure 500 {object} response.Response{msg=string}
+// @Router /me/mfa/verify [post]
+func (mc *MFAController) Verify(c *gin.Context) {
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, fmt.Errorf("请求参数验证失败: %v", err))
+		return
+	}
+	user, ok := mc.currentUser(c)
+	if !ok {
+		return
+	}
+
+	codes, err := mc.mfaService.ConfirmEnrollment(user, req.Code)
+	if err != nil {
+		mfaFail(c, err, "启用两步验证")
+		return
+	}
+	response.OkWithData(c, MFARecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// @Summary 关闭两步验证
+// @Description 提交验证码或恢复码后关闭当前用户的两步验证
+// @Tags 两步验证
+// @Accept json
+// @Produce json
+// @Param data body MFACodeRequest true "验证码"
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Response{msg=string}
+// @Failure 400 {object} response.Response{msg=string}
+// @Failure 401 {object} response.Response{msg=string}
+// @Failure 500 {object} response.Response{msg=string}
+// @Router /me/mfa [delete]
+func (mc *MFAController) Disable(c *gin.Context) {
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, fmt.Errorf("请求参数验证失败: %v", err))
+		return
+	}
+	user, ok := mc.currentUser(c)
+	if !ok {
+		return
+	}
+
+	// 角色强制要求时不允许自行关闭
+	if mc.mfaService.RequiredByRole(user) {
+		response.Forbidden(c, fmt.Errorf("当前角色要求启用两步验证，不能关闭"))
+		return
+	}
+
+	if err := mc.mfaService.Disable(user, req.Code); err != nil {
+		mfaFail(c, err, "关闭两步验证")
+		return
+	}
+	response.OkWithData(c, "两步验证已关闭")
+}
+
+// @Summary 重新生成恢复码
+// @Description 提交验证码后作废旧恢复码并生成新的恢复码
+// @Tags 两步验证
+// @Accept json
+// @Produce json
+// @Param data body MFACodeRequest true "验证码"
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Response{data=MFARecoveryCodesResponse}
+// @Failure 400 {object} response.Response{msg=string}
+// @Failure 401 {object} response.Response{msg=string}
+// @Failure 500 {object} response.Response{msg=string}
+// @Router /me/mfa/recovery-codes [post]
+func (mc *MFAController) RegenerateRecoveryCodes(c *gin.Context) {
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, fmt.Errorf("请求参数验证失败: %v", err))
+		return
+	}
+	user, ok := mc.currentUser(c)
+	if !ok {
+		return
+	}
+
+	codes, err := mc.mfaService.RegenerateRecoveryCodes(user, req.Code)
+	if err != nil {
+		mfaFail(c, err, "重新生成恢复码")
+		return
+	}
+	response.OkWithData(c, MFARecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// @Summary 重置用户两步验证
+// @Description 管理员清除指定用户的两步验证密钥和恢复码，用于设备丢失等场景
+// @Tags 两步验证
+// @Produce json
+// @Param id path int true "用户ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Response{msg=string}
+// @Failure 400 {object} response.Response{msg=string}
+// @Failure 404 {object} response.Response{msg=string}
+// @Failure 500 {object} response.Response{msg=string}
+// @Router /users/{id}/mfa [delete]
+func (mc *MFAController) ResetUserMFA(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, fmt.Errorf("无效的用户ID"))
+		return
+	}
+	if _, err := mc.userService.GetUserByID(uint(id)); err != nil {
+		response.NotFound(c, fmt.Errorf("用户不存在"))
+		return
+	}
+
+	if err := mc.mfaService.Reset(uint(id)); err != nil {
+		response.InternalServerError(c, fmt.Errorf("重置两步验证失败: %v", err))
+		return
+	}
+	response.OkWithData(c, "两步验证已重置")
+}
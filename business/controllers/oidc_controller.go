@@ -0,0 +1,149 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/GZ-Alinx/autops/business/services"
+	"github.com/GZ-Alinx/autops/internal/logger"
+	"github.com/GZ-Alinx/autops/internal/response"
+)
+
+// oidcStateCookie 保存state的Cookie，回调时比对，防止把他人发起的登录结果注入当前浏览器
+const oidcStateCookie = "autops_oidc_state"
+
+// OIDCCallbackRequest 单点登录回调请求结构体
+// @Description 前端页面作为回调地址时，将身份提供方返回的code和state提交给后端
+type OIDCCallbackRequest struct {
+	Code  string `json:"code" form:"code"`
+	State string `json:"state" form:"state"`
+}
+
+// OIDCController 单点登录控制器
+type OIDCController struct {
+	oidcService services.OIDCService
+	// userController 复用密码登录的两步验证和令牌签发流程
+	userController *UserController
+}
+
+// NewOIDCController 创建单点登录控制器实例
+func NewOIDCController(oidcService services.OIDCService, userController *UserController) *OIDCController {
+	return &OIDCController{
+		oidcService:    oidcService,
+		userController: userController,
+	}
+}
+
+// secureRequest 请求是否经由HTTPS到达
+func secureRequest(ctx *gin.Context) bool {
+	return ctx.Request.TLS != nil || strings.EqualFold(ctx.GetHeader("X-Forwarded-Proto"), "https")
+}
+
+// @Summary 发起单点登录
+// @Description 跳转到OIDC身份提供方的授权页面（授权码+PKCE）；请求头Accept为application/json时返回授权地址
+// @Tags 用户管理
+// @Produce json
+// @Success 200 {object} response.Response{data=services.OIDCLogin}
+// @Success 302 {string} string "跳转到身份提供方"
+// @Failure 404 {object} response.Response
+// @Failure 503 {object} response.Response
+// @Router /user/oidc/login [get]
+// Login 发起单点登录
+func (oc *OIDCController) Login(ctx *gin.Context) {
+	login, err := oc.oidcService.BeginLogin()
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrOIDCDisabled):
+			response.Fail(ctx, http.StatusNotFound, err)
+		case errors.Is(err, services.ErrAuthUnavailable):
+			logger.Logger.Error("发起单点登录失败: 身份提供方不可用", zap.Error(err))
+			response.Fail(ctx, http.StatusServiceUnavailable, errors.New("单点登录服务暂不可用"))
+		default:
+			logger.Logger.Error("发起单点登录失败", zap.Error(err))
+			response.Fail(ctx, http.StatusInternalServerError, errors.New("发起单点登录失败"))
+		}
+		return
+	}
+
+	ctx.SetSameSite(http.SameSiteLaxMode)
+	ctx.SetCookie(oidcStateCookie, login.State, int(login.ExpiresIn.Seconds()), "/", "", secureRequest(ctx), true)
+
+	if strings.Contains(ctx.GetHeader("Accept"), "application/json") {
+		response.Success(ctx, login)
+		return
+	}
+	ctx.Redirect(http.StatusFound, login.AuthorizationURL)
+}
+
+// @Summary 单点登录回调
+// @Description 校验state，使用授权码换取并校验ID令牌，首次登录自动创建账号；返回结果与用户名密码登录一致
+// @Tags 用户管理
+// @Accept json
+// @Produce json
+// @Param code query string false "授权码（GET回调）"
+// @Param state query string false "state（GET回调）"
+// @Param body body OIDCCallbackRequest false "授权码和state（POST回调）"
+// @Success 200 {object} response.Response{data=LoginResponse}
+// @Failure 400 {object} response.Response
+// @Failure 401 {object} response.Response
+// @Failure 409 {object} response.Response
+// @Failure 503 {object} response.Response
+// @Router /user/oidc/callback [get]
+// @Router /user/oidc/callback [post]
+// Callback 单点登录回调
+func (oc *OIDCController) Callback(ctx *gin.Context) {
+	var req OIDCCallbackRequest
+	if ctx.Request.Method == http.MethodPost {
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			response.Fail(ctx, http.StatusBadRequest, err)
+			return
+		}
+	} else {
+		// 身份提供方拒绝授权时回调中只有error参数
+		if idpErr := ctx.Query("error"); idpErr != "" {
+			logger.Logger.Warn("身份提供方拒绝授权", zap.String("error", idpErr), zap.String("description", ctx.Query("error_description")))
+			response.Fail(ctx, http.StatusUnauthorized, errors.New("身份提供方拒绝了登录请求"))
+			return
+		}
+		req.Code = ctx.Query("code")
+		req.State = ctx.Query("state")
+	}
+
+	// state必须与发起登录时写入当前浏览器的Cookie一致
+	cookieState, _ := ctx.Cookie(oidcStateCookie)
+	ctx.SetSameSite(http.SameSiteLaxMode)
+	ctx.SetCookie(oidcStateCookie, "", -1, "/", "", secureRequest(ctx), true)
+	if req.State == "" || subtle.ConstantTimeCompare([]byte(cookieState), []byte(req.State)) != 1 {
+		logger.GetBusinessLogger().Warn("单点登录回调的state与Cookie不一致", zap.String("ip", ctx.ClientIP()))
+		response.Fail(ctx, http.StatusBadRequest, services.ErrInvalidOIDCState)
+		return
+	}
+
+	result, err := oc.oidcService.CompleteLogin(req.State, req.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrOIDCDisabled):
+			response.Fail(ctx, http.StatusNotFound, err)
+		case errors.Is(err, services.ErrInvalidOIDCState):
+			response.Fail(ctx, http.StatusBadRequest, err)
+		case errors.Is(err, services.ErrOIDCLoginFailed):
+			response.Fail(ctx, http.StatusUnauthorized, services.ErrOIDCLoginFailed)
+		case errors.Is(err, services.ErrAccountConflict):
+			response.Fail(ctx, http.StatusConflict, err)
+		case errors.Is(err, services.ErrAuthUnavailable):
+			logger.Logger.Error("单点登录失败: 身份提供方不可用", zap.Error(err))
+			response.Fail(ctx, http.StatusServiceUnavailable, errors.New("单点登录服务暂不可用"))
+		default:
+			logger.Logger.Error("单点登录失败", zap.Error(err))
+			response.Fail(ctx, http.StatusInternalServerError, errors.New("登录失败，请稍后重试"))
+		}
+		return
+	}
+
+	oc.userController.completeLogin(ctx, result)
+}
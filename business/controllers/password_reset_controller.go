@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/GZ-Alinx/autops/business/services"
+	"github.com/GZ-Alinx/autops/internal/logger"
+	"github.com/GZ-Alinx/autops/internal/response"
+)
+
+// ForgotPasswordRequest 找回密码请求结构体
+// @Description 提交注册邮箱，系统向该邮箱发送重置链接
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ResetPasswordRequest 重置密码请求结构体
+// @Description 使用邮件中的令牌设置新密码
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// PasswordResetController 自助找回密码控制器
+type PasswordResetController struct {
+	resetService services.PasswordResetService
+	loginGuard   services.LoginGuard
+	resetGuard   services.LoginGuard // 按邮箱和IP限制申请频率
+}
+
+// NewPasswordResetController 创建找回密码控制器实例
+func NewPasswordResetController(resetService services.PasswordResetService, loginGuard, resetGuard services.LoginGuard) *PasswordResetController {
+	return &PasswordResetController{
+		resetService: resetService,
+		loginGuard:   loginGuard,
+		resetGuard:   resetGuard,
+	}
+}
+
+// @Summary 找回密码
+// @Description 向注册邮箱发送一次性重置链接；无论邮箱是否存在都返回相同结果，同一邮箱或IP申请过于频繁时返回429
+// @Tags 用户管理
+// @Accept json
+// @Produce json
+// @Param body body ForgotPasswordRequest true "注册邮箱"
+// @Success 200 {object} response.Response{data=string}
+// @Failure 400 {object} response.Response
+// @Failure 429 {object} response.Response
+// @Router /user/password/forgot [post]
+// Forgot 找回密码
+func (pc *PasswordResetController) Forgot(ctx *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response.Fail(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	// 不论邮箱是否注册都计数，限制对同一邮箱的邮件轰炸和按IP批量探测
+	ip := ctx.ClientIP()
+	if err := pc.resetGuard.Check(req.Email, ip); err != nil {
+		var locked *services.LoginLockedError
+		if errors.As(err, &locked) {
+			ctx.Header("Retry-After", strconv.Itoa(int(locked.RetryAfter.Seconds())+1))
+		}
+		response.Fail(ctx, http.StatusTooManyRequests, errors.New("申请过于频繁，请稍后重试"))
+		return
+	}
+	pc.resetGuard.RecordFailure(req.Email, ip)
+
+	// 查询账号、生成令牌和发送邮件在后台进行，响应时间不随邮箱是否注册而变化；失败只记录日志
+	go pc.requestReset(req.Email, ip)
+
+	response.Success(ctx, "如果该邮箱已注册，您将收到一封重置密码邮件")
+}
+
+// requestReset 后台处理找回密码申请
+func (pc *PasswordResetController) requestReset(email, ip string) {
+	if err := pc.resetService.RequestReset(email, ip); err != nil {
+		logger.Logger.Error("找回密码处理失败", zap.String("email", email), zap.Error(err))
+	}
+}
+
+// @Summary 重置密码
+// @Description 使用邮件中的一次性令牌设置新密码，成功后该用户的全部登录会话失效
+// @Tags 用户管理
+// @Accept json
+// @Produce json
+// @Param body body ResetPasswordRequest true "重置令牌和新密码"
+// @Success 200 {object} response.Response{data=string}
+// @Failure 400 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /user/password/reset [post]
+// Reset 重置密码
+func (pc *PasswordResetController) Reset(ctx *gin.Context) {
+	var req ResetPasswordRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response.Fail(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	user, err := pc.resetService.ResetPassword(req.Token, req.NewPassword)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidResetToken) {
+			response.Fail(ctx, http.StatusBadRequest, err)
+			return
+		}
+		logger.Logger.Warn("重置密码失败", zap.Error(err))
+		response.Fail(ctx, passwordErrorStatus(err), err)
+		return
+	}
+
+	// 已证明邮箱归属，清除登录失败锁定
+	pc.loginGuard.RecordSuccess(user.Username)
+
+	response.Success(ctx, "密码重置成功，请使用新密码登录")
+}
@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/business/repositories"
+	"github.com/GZ-Alinx/autops/business/services"
+	"github.com/GZ-Alinx/autops/internal/config"
+	"github.com/GZ-Alinx/autops/internal/logger"
+)
+
+// stubResetService 记录找回密码申请，block关闭前RequestReset一直阻塞
+type stubResetService struct {
+	requests chan string
+	block    chan struct{}
+}
+
+func (s *stubResetService) RequestReset(email, ip string) error {
+	<-s.block
+	s.requests <- email
+	return nil
+}
+
+func (s *stubResetService) ResetPassword(token, newPassword string) (*models.User, error) {
+	return nil, services.ErrInvalidResetToken
+}
+
+func TestForgotRateLimitAndAsync(t *testing.T) {
+	logger.Logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+
+	stub := &stubResetService{requests: make(chan string, 10), block: make(chan struct{})}
+	resetGuard := services.NewLoginGuard(repositories.NewMemoryLoginAttemptStore(), config.LoginGuardConfig{
+		MaxUserFailures: 2,
+		MaxIPFailures:   3,
+		WindowMinutes:   60,
+		LockoutMinutes:  60,
+	})
+	pc := NewPasswordResetController(stub, nil, resetGuard)
+	router := gin.New()
+	router.POST("/forgot", pc.Forgot)
+
+	forgot := func(email, ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/forgot", strings.NewReader(`{"email":"`+email+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = ip + ":12345"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// 邮件发送被阻塞时仍立即返回，响应与邮箱是否注册无关
+	first := forgot("alice@example.com", "10.0.0.1")
+	if first.Code != http.StatusOK {
+		t.Fatalf("状态码为%d: %s", first.Code, first.Body)
+	}
+	if w := forgot("nobody@example.com", "10.0.0.2"); w.Code != http.StatusOK || w.Body.String() != first.Body.String() {
+		t.Fatalf("未注册邮箱的响应不同: %d %s", w.Code, w.Body)
+	}
+	close(stub.block)
+	handled := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		select {
+		case email := <-stub.requests:
+			handled[email] = true
+		case <-time.After(2 * time.Second):
+			t.Fatalf("后台只处理了%d个申请", i)
+		}
+	}
+	if !handled["alice@example.com"] || !handled["nobody@example.com"] {
+		t.Fatalf("后台处理的申请为%v", handled)
+	}
+
+	// 同一邮箱超过上限后锁定，大小写不同视为同一邮箱
+	if w := forgot("Alice@example.com", "10.0.0.3"); w.Code != http.StatusOK {
+		t.Fatalf("第二次申请状态码为%d", w.Code)
+	}
+	w := forgot("alice@example.com", "10.0.0.4")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("超过邮箱上限后状态码为%d，Retry-After为%q", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	// 同一IP对不同邮箱的申请超过上限后锁定
+	for i, email := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		if w := forgot(email, "10.0.0.5"); w.Code != http.StatusOK {
+			t.Fatalf("第%d次申请状态码为%d", i+1, w.Code)
+		}
+	}
+	if w := forgot("d@example.com", "10.0.0.5"); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("超过IP上限后状态码为%d", w.Code)
+	}
+}
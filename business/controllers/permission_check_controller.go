@@ -0,0 +1,245 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/business/repositories"
+	"github.com/GZ-Alinx/autops/business/services"
+	"github.com/GZ-Alinx/autops/internal/condition"
+	"github.com/GZ-Alinx/autops/internal/middleware"
+	"github.com/GZ-Alinx/autops/internal/response"
+)
+
+// CheckSubjectRequest 权限检查的主体和请求属性
+// @Description user_id、username和role三选一；ip和time为空时使用当前请求的IP和当前时间
+type CheckSubjectRequest struct {
+	UserID   uint       `json:"user_id"`
+	Username string     `json:"username"`
+	Role     string     `json:"role"`
+	Tenant   string     `json:"tenant"` // 租户标识，为空时为默认租户
+	IP       string     `json:"ip"`
+	Time     *time.Time `json:"time"`
+}
+
+// PermissionCheckRequest 单个操作的权限检查请求
+type PermissionCheckRequest struct {
+	CheckSubjectRequest
+	services.CheckItem
+}
+
+// PermissionBatchCheckRequest 批量权限检查请求
+type PermissionBatchCheckRequest struct {
+	CheckSubjectRequest
+	Checks []services.CheckItem `json:"checks" binding:"required,min=1,max=100,dive"`
+}
+
+// MyPermissionCheckRequest 当前用户的批量权限检查请求
+type MyPermissionCheckRequest struct {
+	Checks []services.CheckItem `json:"checks" binding:"required,min=1,max=100,dive"`
+}
+
+// PermissionCheckController 权限检查控制器
+type PermissionCheckController struct {
+	checkService services.PermissionCheckService
+	userRepo     repositories.UserRepository
+	tenantRepo   repositories.TenantRepository
+}
+
+// NewPermissionCheckController 创建权限检查控制器实例
+func NewPermissionCheckController(checkService services.PermissionCheckService, userRepo repositories.UserRepository, tenantRepo repositories.TenantRepository) *PermissionCheckController {
+	return &PermissionCheckController{
+		checkService: checkService,
+		userRepo:     userRepo,
+		tenantRepo:   tenantRepo,
+	}
+}
+
+// resolveSubject 解析检查主体，失败时已写入响应
+func (pc *PermissionCheckController) resolveSubject(c *gin.Context, req CheckSubjectRequest) (services.CheckSubject, bool) {
+	subject := services.CheckSubject{
+		Tenant: models.DefaultTenantCode,
+		Attrs:  condition.Attributes{IP: req.IP, Time: time.Now()},
+	}
+	if subject.Attrs.IP == "" {
+		subject.Attrs.IP = c.ClientIP()
+	}
+	if req.Time != nil {
+		subject.Attrs.Time = *req.Time
+	}
+
+	var tenantID uint
+	if req.Tenant != "" && req.Tenant != models.DefaultTenantCode {
+		tenant, err := pc.tenantRepo.GetByCode(req.Tenant)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				response.NotFound(c, fmt.Errorf("租户不存在"))
+			} else {
+				response.InternalServerError(c, fmt.Errorf("查询租户失败: %v", err))
+			}
+			return subject, false
+		}
+		tenantID, subject.Tenant = tenant.ID, tenant.Code
+	}
+
+	subjects := 0
+	for _, set := range []bool{req.UserID != 0, req.Username != "", req.Role != ""} {
+		if set {
+			subjects++
+		}
+	}
+	if subjects != 1 {
+		response.BadRequest(c, fmt.Errorf("user_id、username和role必须且只能指定一个"))
+		return subject, false
+	}
+
+	if req.Role != "" {
+		subject.Roles = []string{req.Role}
+		return subject, true
+	}
+
+	var user *models.User
+	var err error
+	if req.UserID != 0 {
+		user, err = pc.userRepo.GetByID(req.UserID)
+	} else {
+		user, err = pc.userRepo.GetByUsername(req.Username)
+	}
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.NotFound(c, fmt.Errorf("用户不存在"))
+		} else {
+			response.InternalServerError(c, fmt.Errorf("查询用户失败: %v", err))
+		}
+		return subject, false
+	}
+	roles, err := middleware.LoadTenantRoles(user, tenantID)
+	if err != nil {
+		response.InternalServerError(c, fmt.Errorf("查询用户角色失败: %v", err))
+		return subject, false
+	}
+	for _, role := range roles {
+		subject.Roles = append(subject.Roles, role.Name)
+	}
+	subject.Attrs.UserID = fmt.Sprint(user.ID)
+	return subject, true
+}
+
+// @Summary 检查权限并解释原因
+// @Description 检查用户或角色能否访问指定路径和方法，返回结论、每个角色的结果和匹配的全部策略（包括条件不满足而未生效的策略）。owner条件需要通过params传入路径参数
+// @Tags 权限管理
+// @Accept json
+// @Produce json
+// @Param body body PermissionCheckRequest true "检查主体和操作"
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Response{data=services.CheckResult}
+// @Failure 400 {object} response.Response{msg=string}
+// @Failure 404 {object} response.Response{msg=string}
+// @Failure 500 {object} response.Response{msg=string}
+// @Router /permissions/check [post]
+func (pc *PermissionCheckController) Check(c *gin.Context) {
+	var req PermissionCheckRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, fmt.Errorf("请求参数验证失败: %v", err))
+		return
+	}
+	subject, ok := pc.resolveSubject(c, req.CheckSubjectRequest)
+	if !ok {
+		return
+	}
+
+	results, err := pc.checkService.Check(subject, []services.CheckItem{req.CheckItem}, true)
+	if err != nil {
+		response.InternalServerError(c, fmt.Errorf("权限检查失败: %v", err))
+		return
+	}
+	response.OkWithData(c, results[0])
+}
+
+// @Summary 批量检查权限并解释原因
+// @Description 一次检查同一用户或角色的多个操作（最多100个），每个结果与单个检查相同
+// @Tags 权限管理
+// @Accept json
+// @Produce json
+// @Param body body PermissionBatchCheckRequest true "检查主体和操作列表"
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Response{data=[]services.CheckResult}
+// @Failure 400 {object} response.Response{msg=string}
+// @Failure 404 {object} response.Response{msg=string}
+// @Failure 500 {object} response.Response{msg=string}
+// @Router /permissions/check/batch [post]
+func (pc *PermissionCheckController) BatchCheck(c *gin.Context) {
+	var req PermissionBatchCheckRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, fmt.Errorf("请求参数验证失败: %v", err))
+		return
+	}
+	subject, ok := pc.resolveSubject(c, req.CheckSubjectRequest)
+	if !ok {
+		return
+	}
+
+	results, err := pc.checkService.Check(subject, req.Checks, true)
+	if err != nil {
+		response.InternalServerError(c, fmt.Errorf("权限检查失败: %v", err))
+		return
+	}
+	response.OkWithData(c, results)
+}
+
+// @Summary 批量检查当前用户的权限
+// @Description 供前端决定显示哪些按钮：按当前租户（X-Tenant）内的角色和当前请求的属性检查多个操作（最多100个），只返回是否允许
+// @Tags 权限管理
+// @Accept json
+// @Produce json
+// @Param body body MyPermissionCheckRequest true "操作列表"
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Response{data=[]services.CheckResult}
+// @Failure 400 {object} response.Response{msg=string}
+// @Failure 500 {object} response.Response{msg=string}
+// @Router /me/permissions/check [post]
+func (pc *PermissionCheckController) CheckMine(c *gin.Context) {
+	var req MyPermissionCheckRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, fmt.Errorf("请求参数验证失败: %v", err))
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		response.Unauthorized(c, fmt.Errorf("未登录"))
+		return
+	}
+	user, err := pc.userRepo.GetByID(userID)
+	if err != nil {
+		response.InternalServerError(c, fmt.Errorf("查询用户失败: %v", err))
+		return
+	}
+	tenantID, tenant := middleware.GetTenant(c)
+	roles, err := middleware.LoadTenantRoles(user, tenantID)
+	if err != nil {
+		response.InternalServerError(c, fmt.Errorf("查询用户角色失败: %v", err))
+		return
+	}
+
+	// 与CasbinMiddleware一致：API令牌限定了角色范围时只使用范围内的角色
+	subject := services.CheckSubject{
+		Tenant: tenant,
+		Attrs:  *middleware.RequestAttributes(c),
+	}
+	for _, role := range middleware.ScopedRoles(c, roles) {
+		subject.Roles = append(subject.Roles, role.Name)
+	}
+
+	results, err := pc.checkService.Check(subject, req.Checks, false)
+	if err != nil {
+		response.InternalServerError(c, fmt.Errorf("权限检查失败: %v", err))
+		return
+	}
+	response.OkWithData(c, results)
+}
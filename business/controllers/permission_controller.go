@@ -3,6 +3,7 @@ package controllers
 import (
 	"errors"
 	"fmt"
+	"net/http"
 	"strconv"
 	"strings"
 
@@ -12,22 +13,116 @@ import (
 
 	"github.com/GZ-Alinx/autops/business/models"
 	"github.com/GZ-Alinx/autops/business/repositories"
+	"github.com/GZ-Alinx/autops/business/services"
+	"github.com/GZ-Alinx/autops/internal/condition"
 	"github.com/GZ-Alinx/autops/internal/database"
-	"github.com/GZ-Alinx/autops/internal/global"
 	"github.com/GZ-Alinx/autops/internal/logger"
 	"github.com/GZ-Alinx/autops/internal/response"
 )
 
 // PermissionController 权限管理控制器
-type PermissionController struct{}
+type PermissionController struct {
+	roleService services.RoleService
+}
 
 // NewPermissionController 创建权限控制器实例
 func NewPermissionController() *PermissionController {
-	return &PermissionController{}
+	return &PermissionController{
+		roleService: services.NewRoleService(repositories.NewRoleRepository()),
+	}
+}
+
+// policyTxError 修改权限的事务中需要以指定状态码返回的错误
+type policyTxError struct {
+	status int
+	err    error
+}
+
+func (e *policyTxError) Error() string {
+	return e.err.Error()
+}
+
+// txFail 中止事务并以status返回err
+func txFail(status int, err error) error {
+	return &policyTxError{status: status, err: err}
+}
+
+// respondTxError 事务失败时的响应，未指定状态码的错误返回500
+func respondTxError(c *gin.Context, err error) {
+	var txErr *policyTxError
+	if errors.As(err, &txErr) {
+		response.Fail(c, txErr.status, txErr.err)
+		return
+	}
+	response.InternalServerError(c, err)
+}
+
+// deleteUnusedPermission 权限不再关联任何角色时删除权限
+func deleteUnusedPermission(tx *gorm.DB, permission models.Permission) error {
+	var count int64
+	if err := tx.Model(&models.RolePermission{}).Where("permission_id = ?", permission.ID).Count(&count).Error; err != nil {
+		return fmt.Errorf("查询权限关联角色失败: %v", err)
+	}
+	if count > 0 {
+		logger.Logger.Info("权限仍有关联角色，不删除权限", zap.Uint("permissionID", permission.ID), zap.Int64("关联角色数", count))
+		return nil
+	}
+	if err := tx.Delete(&permission).Error; err != nil {
+		return fmt.Errorf("删除权限失败: %v", err)
+	}
+	logger.Logger.Info("权限无关联角色，已删除权限", zap.Uint("permissionID", permission.ID))
+	return nil
+}
+
+// roleParentTxError 设置父角色失败时事务返回的错误
+func roleParentTxError(err error) error {
+	if errors.Is(err, services.ErrRoleNotFound) || errors.Is(err, services.ErrRoleCycle) {
+		return txFail(http.StatusBadRequest, err)
+	}
+	return fmt.Errorf("设置父角色失败: %v", err)
+}
+
+// checkRoleOwner 校验角色负责人存在，未指定负责人时通过
+func checkRoleOwner(tx *gorm.DB, ownerID *uint) error {
+	if ownerID == nil {
+		return nil
+	}
+	var owner models.User
+	if err := tx.Select("id").First(&owner, *ownerID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return txFail(http.StatusBadRequest, fmt.Errorf("角色负责人不存在"))
+		}
+		return fmt.Errorf("查询角色负责人失败: %v", err)
+	}
+	return nil
+}
+
+// findRoleAndPermission 在事务中查询角色和权限，不存在时返回404
+func findRoleAndPermission(tx *gorm.DB, roleID, permissionID uint) (*models.Role, *models.Permission, error) {
+	var role models.Role
+	if err := tx.First(&role, roleID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			logger.Logger.Error("角色不存在", zap.Uint("roleID", roleID))
+			return nil, nil, txFail(http.StatusNotFound, fmt.Errorf("角色不存在"))
+		}
+		logger.Logger.Error("查询角色失败", zap.Uint("roleID", roleID), zap.Error(err))
+		return nil, nil, fmt.Errorf("查询角色失败: %v", err)
+	}
+
+	var permission models.Permission
+	if err := tx.First(&permission, permissionID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			logger.Logger.Error("权限不存在", zap.Uint("permissionID", permissionID))
+			return nil, nil, txFail(http.StatusNotFound, fmt.Errorf("权限不存在"))
+		}
+		logger.Logger.Error("查询权限失败", zap.Uint("permissionID", permissionID), zap.Error(err))
+		return nil, nil, fmt.Errorf("查询权限失败: %v", err)
+	}
+	return &role, &permission, nil
 }
 
 // @Summary 添加权限
-// @Description 添加资源访问权限
+// @Description 添加资源访问权限，effect为deny时添加拒绝规则；conditions为属性条件，相同路径和方法的不同条件是不同的权限
 // @Tags 权限管理
 // @Accept application/json
 // @Produce application/json
@@ -52,116 +147,84 @@ func (pc *PermissionController) AddPolicy(c *gin.Context) {
 		response.BadRequest(c, fmt.Errorf("无效的请求参数: 描述、路径不能为空且方法必须为GET/POST/PUT/DELETE/PATCH之一"))
 		return
 	}
-
-	logger.Logger.Info("开始添加权限策略", zap.String("describe", req.Describe), zap.String("path", req.Path), zap.String("method", req.Method))
-
-	if global.Enforcer == nil {
-		logger.Logger.Error("添加权限策略失败: 权限管理器未初始化")
-		response.InternalServerError(c, fmt.Errorf("权限管理器未初始化"))
+	if err := condition.Validate(req.Conditions); err != nil {
+		logger.Logger.Warn("添加权限策略失败: 条件表达式无效", zap.String("conditions", req.Conditions), zap.Error(err))
+		response.BadRequest(c, fmt.Errorf("条件表达式无效: %v", err))
 		return
 	}
 
-	// 检查权限是否已存在
-	var permission models.Permission
-	result := database.DB.Where("resource = ? AND action = ?", req.Path, req.Method).First(&permission)
-	if result.Error != nil {
-		if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+	logger.Logger.Info("开始添加权限策略", zap.String("describe", req.Describe), zap.String("path", req.Path), zap.String("method", req.Method))
+
+	// 权限、角色权限关联和casbin_rule在同一事务中修改
+	err := database.UpdatePolicy(func(tx *gorm.DB) (database.PolicyScope, error) {
+		// 检查权限是否已存在
+		var permission models.Permission
+		result := tx.Where("resource = ? AND action = ? AND conditions = ?", req.Path, req.Method, req.Conditions).First(&permission)
+		if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			logger.Logger.Error("查询权限失败", zap.String("path", req.Path), zap.String("method", req.Method), zap.Error(result.Error))
-			response.InternalServerError(c, fmt.Errorf("查询权限失败: %v", result.Error))
-			return
+			return database.PolicyScope{}, fmt.Errorf("查询权限失败: %v", result.Error)
 		}
-		logger.Logger.Info("权限不存在，将创建新权限", zap.String("path", req.Path), zap.String("method", req.Method))
-	} else {
-		logger.Logger.Info("权限已存在", zap.Int("permissionID", int(permission.ID)), zap.String("path", req.Path), zap.String("method", req.Method))
-	}
 
-	// 如果权限不存在则创建
-	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-		permission = models.Permission{
-			Resource:    req.Path,
-			Action:      req.Method,
-			Description: req.Describe,
-		}
-		if err := database.DB.Create(&permission).Error; err != nil {
-			logger.Logger.Error("创建权限失败", zap.String("path", req.Path), zap.String("method", req.Method), zap.Error(err))
-			response.InternalServerError(c, fmt.Errorf("创建权限失败: %v", err))
-			return
-		}
-		logger.Logger.Info("创建权限成功", zap.Int("permissionID", int(permission.ID)), zap.String("path", req.Path), zap.String("method", req.Method))
-	} else {
-		// 更新现有权限的描述
-		permission.Description = req.Describe
-		if err := database.DB.Save(&permission).Error; err != nil {
-			logger.Logger.Error("更新权限描述失败", zap.Int("permissionID", int(permission.ID)), zap.Error(err))
-			response.InternalServerError(c, fmt.Errorf("更新权限描述失败: %v", err))
-			return
+		// 如果权限不存在则创建，否则更新描述
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			permission = models.Permission{
+				Resource:    req.Path,
+				Action:      req.Method,
+				Conditions:  req.Conditions,
+				Description: req.Describe,
+			}
+			if err := tx.Create(&permission).Error; err != nil {
+				logger.Logger.Error("创建权限失败", zap.String("path", req.Path), zap.String("method", req.Method), zap.Error(err))
+				return database.PolicyScope{}, fmt.Errorf("创建权限失败: %v", err)
+			}
+			logger.Logger.Info("创建权限成功", zap.Int("permissionID", int(permission.ID)), zap.String("path", req.Path), zap.String("method", req.Method))
+		} else {
+			permission.Description = req.Describe
+			if err := tx.Save(&permission).Error; err != nil {
+				logger.Logger.Error("更新权限描述失败", zap.Int("permissionID", int(permission.ID)), zap.Error(err))
+				return database.PolicyScope{}, fmt.Errorf("更新权限描述失败: %v", err)
+			}
 		}
-		logger.Logger.Info("更新权限描述成功", zap.Int("permissionID", int(permission.ID)))
-	}
 
-	// 获取默认角色（user）
-	var role models.Role
-	if err := database.DB.Where("name = ?", "user").First(&role).Error; err != nil {
-		logger.Logger.Error("查询默认角色失败", zap.Error(err))
-		response.InternalServerError(c, fmt.Errorf("查询默认角色失败: %v", err))
-		return
-	}
-	logger.Logger.Info("查询默认角色成功", zap.Int("roleID", int(role.ID)), zap.String("roleName", role.Name))
-
-	// 检查角色权限关联是否已存在
-	var rolePermission models.RolePermission
-	result = database.DB.Where("role_id = ? AND permission_id = ?", role.ID, permission.ID).First(&rolePermission)
-	if result.Error != nil {
-		if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			logger.Logger.Error("查询角色权限关联失败", zap.Int("roleID", int(role.ID)), zap.Int("permissionID", int(permission.ID)), zap.Error(result.Error))
-			response.InternalServerError(c, fmt.Errorf("查询角色权限关联失败: %v", result.Error))
-			return
+		// 获取默认角色（user）
+		var role models.Role
+		if err := tx.Where("name = ?", "user").First(&role).Error; err != nil {
+			logger.Logger.Error("查询默认角色失败", zap.Error(err))
+			return database.PolicyScope{}, fmt.Errorf("查询默认角色失败: %v", err)
 		}
-		logger.Logger.Info("角色权限关联不存在，将创建新关联", zap.Int("roleID", int(role.ID)), zap.Int("permissionID", int(permission.ID)))
-	} else {
-		logger.Logger.Warn("角色权限关联已存在", zap.Int("roleID", int(role.ID)), zap.Int("permissionID", int(permission.ID)))
-	}
 
-	if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
-		logger.Logger.Warn("权限策略已存在", zap.String("role", req.Describe), zap.String("path", req.Path), zap.String("method", req.Method))
-		response.BadRequest(c, fmt.Errorf("权限策略已存在"))
-		return
-	}
-
-	// 创建角色权限关联
-	rolePermission = models.RolePermission{
-		RoleID:       role.ID,
-		PermissionID: permission.ID,
-	}
-	if err := database.DB.Create(&rolePermission).Error; err != nil {
-		logger.Logger.Error("创建角色权限关联失败", zap.Int("roleID", int(role.ID)), zap.Int("permissionID", int(permission.ID)), zap.Error(err))
-		response.InternalServerError(c, fmt.Errorf("创建角色权限关联失败: %v", err))
-		return
-	}
-	logger.Logger.Info("创建角色权限关联成功", zap.Int("roleID", int(role.ID)), zap.Int("permissionID", int(permission.ID)))
+		// 检查角色权限关联是否已存在
+		var count int64
+		if err := tx.Model(&models.RolePermission{}).Where("role_id = ? AND permission_id = ?", role.ID, permission.ID).Count(&count).Error; err != nil {
+			logger.Logger.Error("查询角色权限关联失败", zap.Int("roleID", int(role.ID)), zap.Int("permissionID", int(permission.ID)), zap.Error(err))
+			return database.PolicyScope{}, fmt.Errorf("查询角色权限关联失败: %v", err)
+		}
+		if count > 0 {
+			logger.Logger.Warn("权限策略已存在", zap.String("role", role.Name), zap.String("path", req.Path), zap.String("method", req.Method))
+			return database.PolicyScope{}, txFail(http.StatusBadRequest, fmt.Errorf("权限策略已存在"))
+		}
 
-	// 同步到casbin_rule
-	logger.Logger.Info("开始同步权限策略到casbin", zap.String("role", role.Name), zap.String("path", req.Path), zap.String("method", req.Method))
-	ok, err := global.Enforcer.AddPolicy(role.Name, req.Path, req.Method)
+		// 清理已软删除的关联后创建角色权限关联
+		if err := tx.Unscoped().Where("role_id = ? AND permission_id = ?", role.ID, permission.ID).Delete(&models.RolePermission{}).Error; err != nil {
+			return database.PolicyScope{}, fmt.Errorf("清理角色权限关联失败: %v", err)
+		}
+		rolePermission := models.RolePermission{
+			RoleID:       role.ID,
+			PermissionID: permission.ID,
+			Effect:       req.Effect,
+		}
+		rolePermission.Effect = rolePermission.Eft()
+		if err := tx.Create(&rolePermission).Error; err != nil {
+			logger.Logger.Error("创建角色权限关联失败", zap.Int("roleID", int(role.ID)), zap.Int("permissionID", int(permission.ID)), zap.Error(err))
+			return database.PolicyScope{}, fmt.Errorf("创建角色权限关联失败: %v", err)
+		}
+		return database.ScopeRoles(role.Name), nil
+	})
 	if err != nil {
-		logger.Logger.Error("添加权限策略失败", zap.String("role", req.Describe), zap.String("path", req.Path), zap.String("method", req.Method), zap.Error(err))
-		response.InternalServerError(c, fmt.Errorf("添加权限策略失败: %v", err))
-		return
-	}
-	if !ok {
-		logger.Logger.Warn("权限策略已存在于casbin", zap.String("role", role.Name), zap.String("path", req.Path), zap.String("method", req.Method))
-		response.BadRequest(c, fmt.Errorf("权限策略已存在"))
+		logger.Logger.Error("添加权限策略失败", zap.String("path", req.Path), zap.String("method", req.Method), zap.Error(err))
+		respondTxError(c, err)
 		return
 	}
-	logger.Logger.Info("添加权限策略到casbin成功", zap.String("role", role.Name), zap.String("path", req.Path), zap.String("method", req.Method))
-
-	// 保存策略变更
-	if err := global.Enforcer.SavePolicy(); err != nil {
-		logger.Logger.Error("保存权限策略失败", zap.Error(err))
-		response.InternalServerError(c, fmt.Errorf("保存权限策略失败: %v", err))
-		return
-	}
-	logger.Logger.Info("保存权限策略成功")
 
 	logger.Logger.Info("添加权限策略操作完成", zap.String("describe", req.Describe), zap.String("path", req.Path), zap.String("method", req.Method))
 	response.OkWithData(c, "添加权限策略成功")
@@ -195,108 +258,69 @@ func (pc *PermissionController) RemovePolicy(c *gin.Context) {
 
 	logger.Logger.Info("开始删除权限策略", zap.String("describe", req.Describe), zap.String("path", req.Path), zap.String("method", req.Method))
 
-	if global.Enforcer == nil {
-		logger.Logger.Error("删除权限策略失败: 权限管理器未初始化")
-		response.InternalServerError(c, fmt.Errorf("权限管理器未初始化"))
-		return
-	}
-
-	// 查询权限
-	var permission models.Permission
-	if err := database.DB.Where("resource = ? AND action = ?", req.Path, req.Method).First(&permission).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			logger.Logger.Warn("权限不存在", zap.String("path", req.Path), zap.String("method", req.Method))
-			response.NotFound(c, fmt.Errorf("权限不存在"))
-			return
+	// 角色权限关联、权限和casbin_rule在同一事务中修改
+	err := database.UpdatePolicy(func(tx *gorm.DB) (database.PolicyScope, error) {
+		// 查询权限
+		var permission models.Permission
+		if err := tx.Where("resource = ? AND action = ? AND conditions = ?", req.Path, req.Method, req.Conditions).First(&permission).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return database.PolicyScope{}, txFail(http.StatusNotFound, fmt.Errorf("权限不存在"))
+			}
+			return database.PolicyScope{}, fmt.Errorf("查询权限失败: %v", err)
 		}
-		logger.Logger.Error("查询权限失败", zap.String("path", req.Path), zap.String("method", req.Method), zap.Error(err))
-		response.InternalServerError(c, fmt.Errorf("查询权限失败: %v", err))
-		return
-	}
-	logger.Logger.Info("查询权限成功", zap.Int("permissionID", int(permission.ID)), zap.String("path", req.Path), zap.String("method", req.Method))
 
-	// 获取默认角色（user）
-	var role models.Role
-	if err := database.DB.Where("name = ?", "user").First(&role).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			logger.Logger.Warn("默认角色不存在")
-			response.NotFound(c, fmt.Errorf("默认角色不存在"))
-			return
+		// 获取默认角色（user）
+		var role models.Role
+		if err := tx.Where("name = ?", "user").First(&role).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return database.PolicyScope{}, txFail(http.StatusNotFound, fmt.Errorf("默认角色不存在"))
+			}
+			return database.PolicyScope{}, fmt.Errorf("查询默认角色失败: %v", err)
 		}
-		logger.Logger.Error("查询默认角色失败", zap.Error(err))
-		response.InternalServerError(c, fmt.Errorf("查询默认角色失败: %v", err))
-		return
-	}
-	logger.Logger.Info("查询默认角色成功", zap.Int("roleID", int(role.ID)), zap.String("roleName", role.Name))
 
-	// 检查角色权限关联是否存在
-	var rolePermission models.RolePermission
-	if err := database.DB.Where("role_id = ? AND permission_id = ?", role.ID, permission.ID).First(&rolePermission).Error; err != nil {
-		if !errors.Is(err, gorm.ErrRecordNotFound) {
-			logger.Logger.Error("查询角色权限关联失败", zap.Int("roleID", int(role.ID)), zap.Int("permissionID", int(permission.ID)), zap.Error(err))
-			response.InternalServerError(c, fmt.Errorf("查询角色权限关联失败: %v", err))
-			return
+		// 物理删除角色权限关联
+		result := tx.Unscoped().Where("role_id = ? AND permission_id = ?", role.ID, permission.ID).Delete(&models.RolePermission{})
+		if result.Error != nil {
+			return database.PolicyScope{}, fmt.Errorf("删除角色权限关联失败: %v", result.Error)
 		}
-		logger.Logger.Warn("角色权限关联不存在", zap.Int("roleID", int(role.ID)), zap.Int("permissionID", int(permission.ID)))
-		response.NotFound(c, fmt.Errorf("角色权限关联不存在"))
-		return
-	}
-	// 删除角色权限关联
-	if err := database.DB.Where("role_id = ? AND permission_id = ?", role.ID, permission.ID).Delete(&models.RolePermission{}).Error; err != nil {
-		logger.Logger.Error("删除角色权限关联失败", zap.Int("roleID", int(role.ID)), zap.Int("permissionID", int(permission.ID)), zap.Error(err))
-		response.InternalServerError(c, fmt.Errorf("删除角色权限关联失败: %v", err))
-		return
-	}
-	logger.Logger.Info("删除角色权限关联成功", zap.Int("roleID", int(role.ID)), zap.Int("permissionID", int(permission.ID)))
-
-	// 如果权限无关联角色，删除权限
-	var count int64
-	database.DB.Model(&models.RolePermission{}).Where("permission_id = ?", permission.ID).Count(&count)
-	logger.Logger.Info("检查权限关联角色数量", zap.Int64("count", count), zap.Int("permissionID", int(permission.ID)))
-	if count == 0 {
-		logger.Logger.Info("权限无关联角色，将删除权限", zap.Int("permissionID", int(permission.ID)))
-		if err := database.DB.Delete(&permission).Error; err != nil {
-			logger.Logger.Error("删除权限失败", zap.Int("permissionID", int(permission.ID)), zap.Error(err))
-			response.InternalServerError(c, fmt.Errorf("删除权限失败: %v", err))
-			return
+		if result.RowsAffected == 0 {
+			return database.PolicyScope{}, txFail(http.StatusNotFound, fmt.Errorf("角色权限关联不存在"))
 		}
-		logger.Logger.Info("删除权限成功", zap.Int("permissionID", int(permission.ID)))
-	} else {
-		logger.Logger.Info("权限仍有关联角色，不删除权限", zap.Int("permissionID", int(permission.ID)), zap.Int64("关联角色数", count))
-	}
+		logger.Logger.Info("删除角色权限关联成功", zap.Int("roleID", int(role.ID)), zap.Int("permissionID", int(permission.ID)))
 
-	// 从casbin_rule删除策略
-	logger.Logger.Info("开始从casbin删除权限策略", zap.String("role", role.Name), zap.String("path", req.Path), zap.String("method", req.Method))
-	ok, err := global.Enforcer.RemovePolicy(role.Name, req.Path, req.Method)
+		// 如果权限无关联角色，删除权限
+		if err := deleteUnusedPermission(tx, permission); err != nil {
+			return database.PolicyScope{}, err
+		}
+		return database.ScopeRoles(role.Name), nil
+	})
 	if err != nil {
-		logger.Logger.Error("删除权限策略失败", zap.String("role", role.Name), zap.String("path", req.Path), zap.String("method", req.Method), zap.Error(err))
-		response.InternalServerError(c, fmt.Errorf("删除权限策略失败: %v", err))
-		return
-	}
-	if !ok {
-		logger.Logger.Warn("权限策略不存在于casbin", zap.String("role", role.Name), zap.String("path", req.Path), zap.String("method", req.Method))
-		response.BadRequest(c, fmt.Errorf("权限策略不存在"))
+		logger.Logger.Error("删除权限策略失败", zap.String("path", req.Path), zap.String("method", req.Method), zap.Error(err))
+		respondTxError(c, err)
 		return
 	}
-	logger.Logger.Info("从casbin删除权限策略成功", zap.String("role", role.Name), zap.String("path", req.Path), zap.String("method", req.Method))
-
-	// 保存策略变更
-	if err := global.Enforcer.SavePolicy(); err != nil {
-		logger.Logger.Error("保存权限策略失败", zap.Error(err))
-		response.InternalServerError(c, fmt.Errorf("保存权限策略失败: %v", err))
-		return
-	}
-	logger.Logger.Info("保存权限策略成功")
 
 	logger.Logger.Info("删除权限策略操作完成", zap.String("describe", req.Describe), zap.String("path", req.Path), zap.String("method", req.Method))
 	response.OkWithData(c, "删除权限策略成功")
 }
 
+// PolicyEffect 角色对权限的授权效果
+type PolicyEffect struct {
+	Role   string `json:"role"`
+	Effect string `json:"effect"` // allow或deny
+}
+
+// PermissionPolicy 权限及其授权给各角色的效果
+type PermissionPolicy struct {
+	models.Permission
+	Policies []PolicyEffect `json:"policies"`
+}
+
 // @Summary 获取所有权限策略
-// @Description 获取系统中所有的RBAC权限策略
+// @Description 获取系统中所有的RBAC权限策略，policies为授权给各角色的效果（allow或deny）
 // @Tags 权限管理
 // @Produce application/json
-// @Success 200 {object} response.Response{data=[]models.Permission}
+// @Success 200 {object} response.Response{data=[]PermissionPolicy}
 // @Failure 500 {object} response.Response{msg=string}
 // @Security ApiKeyAuth
 // @Router /permissions/policies [get]
@@ -309,11 +333,75 @@ func (pc *PermissionController) GetPolicies(c *gin.Context) {
 		response.InternalServerError(c, fmt.Errorf("获取权限策略失败: %v", err))
 		return
 	}
-	response.OkWithData(c, permissions)
+
+	var rolePermissions []models.RolePermission
+	if err := database.DB.Preload("Role").Find(&rolePermissions).Error; err != nil {
+		logger.Logger.Error("获取角色权限关联失败: " + err.Error())
+		response.InternalServerError(c, fmt.Errorf("获取权限策略失败: %v", err))
+		return
+	}
+	effects := make(map[uint][]PolicyEffect, len(permissions))
+	for _, rp := range rolePermissions {
+		if rp.Role.ID == 0 {
+			continue
+		}
+		effects[rp.PermissionID] = append(effects[rp.PermissionID], PolicyEffect{Role: rp.Role.Name, Effect: rp.Eft()})
+	}
+
+	policies := make([]PermissionPolicy, 0, len(permissions))
+	for _, permission := range permissions {
+		policy := PermissionPolicy{Permission: permission, Policies: effects[permission.ID]}
+		if policy.Policies == nil {
+			policy.Policies = []PolicyEffect{}
+		}
+		policies = append(policies, policy)
+	}
+	response.OkWithData(c, policies)
+}
+
+// @Summary 检查策略漂移
+// @Description 按用户角色、角色继承和角色权限比对casbin_rule及本实例内存中的策略，只报告不修改
+// @Tags 权限管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Response{data=database.PolicyDrift}
+// @Failure 500 {object} response.Response{msg=string}
+// @Router /permissions/reconcile [get]
+func (pc *PermissionController) CheckPolicyDrift(c *gin.Context) {
+	drift, err := database.ReconcilePolicy(false)
+	if err != nil {
+		response.InternalServerError(c, fmt.Errorf("检查策略漂移失败: %v", err))
+		return
+	}
+	response.OkWithData(c, drift)
+}
+
+// @Summary 修复策略漂移
+// @Description 按业务表修正casbin_rule中缺少、多余和重复的规则，应用到内存并通知其他实例
+// @Tags 权限管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Response{data=database.PolicyDrift}
+// @Failure 500 {object} response.Response{msg=string}
+// @Router /permissions/reconcile [post]
+func (pc *PermissionController) ReconcilePolicy(c *gin.Context) {
+	drift, err := database.ReconcilePolicy(true)
+	if err != nil {
+		logger.Logger.Error("修复策略漂移失败", zap.Error(err))
+		response.InternalServerError(c, fmt.Errorf("修复策略漂移失败: %v", err))
+		return
+	}
+	if drift.Fixed {
+		logger.Logger.Warn("已修复策略漂移",
+			zap.Strings("missing", drift.Missing),
+			zap.Strings("extra", drift.Extra),
+			zap.Int("duplicates", drift.Duplicates))
+	}
+	response.OkWithData(c, drift)
 }
 
 // @Summary 创建角色
-// @Description 创建新的角色
+// @Description 创建新的角色，可通过parents指定继承的父角色
 // @Tags 角色管理
 // @Accept json
 // @Produce json
@@ -330,35 +418,46 @@ func (pc *PermissionController) CreateRole(c *gin.Context) {
 		return
 	}
 
-	// 检查角色是否已存在
-	roleRepo := repositories.NewRoleRepository()
-	roles, err := roleRepo.GetByNameIn([]string{req.Name})
-	if err != nil {
-		if !errors.Is(err, gorm.ErrRecordNotFound) {
+	// 角色、父角色和casbin_rule在同一事务中创建，父角色无效时不会留下半成品角色
+	var newRole *models.Role
+	err := database.UpdatePolicy(func(tx *gorm.DB) (database.PolicyScope, error) {
+		roleRepo := repositories.NewRoleRepository().WithTx(tx)
+
+		// 检查角色是否已存在
+		roles, err := roleRepo.GetByNameIn([]string{req.Name})
+		if err != nil {
 			logger.Logger.Error("查询角色失败", zap.String("roleName", req.Name), zap.Error(err))
-			response.InternalServerError(c, fmt.Errorf("查询角色失败: %v", err))
-			return
+			return database.PolicyScope{}, fmt.Errorf("查询角色失败: %v", err)
+		}
+		if len(roles) > 0 {
+			return database.PolicyScope{}, txFail(http.StatusBadRequest, fmt.Errorf("角色已存在"))
+		}
+		if err := checkRoleOwner(tx, req.OwnerID); err != nil {
+			return database.PolicyScope{}, err
 		}
-	} else if len(roles) > 0 {
-		response.BadRequest(c, fmt.Errorf("角色已存在"))
-		return
-	}
 
-	// 创建新角色
-	newRole := &models.Role{
-		Name:        req.Name,
-		Description: req.Description,
-	}
-	if err := roleRepo.Create(newRole); err != nil {
-		response.InternalServerError(c, fmt.Errorf("创建角色失败: %v", err))
+		// 创建新角色
+		newRole = &models.Role{
+			Name:        req.Name,
+			Description: req.Description,
+			RequireMFA:  req.RequireMFA,
+			OwnerID:     req.OwnerID,
+		}
+		if err := roleRepo.Create(newRole); err != nil {
+			return database.PolicyScope{}, fmt.Errorf("创建角色失败: %v", err)
+		}
+		if len(req.Parents) > 0 {
+			if err := services.NewRoleService(roleRepo).SetParents(newRole, req.Parents); err != nil {
+				return database.PolicyScope{}, roleParentTxError(err)
+			}
+		}
+		return database.ScopeRoles(newRole.Name), nil
+	})
+	if err != nil {
+		respondTxError(c, err)
 		return
 	}
 
-	// 同步Casbin策略
-	if err := database.SyncCasbinPolicy(); err != nil {
-		logger.Logger.Error("同步Casbin策略失败", zap.Error(err))
-	}
-
 	response.OkWithData(c, newRole)
 }
 
@@ -411,16 +510,11 @@ func (pc *PermissionController) GetRoleByID(c *gin.Context) {
 		return
 	}
 
-	// 同步Casbin策略
-	if err := database.SyncCasbinPolicy(); err != nil {
-		logger.Logger.Error("同步Casbin策略失败", zap.Error(err))
-	}
-
 	response.OkWithData(c, role)
 }
 
 // @Summary 更新角色
-// @Description 更新角色信息
+// @Description 更新角色信息；传入parents时替换父角色（空数组表示不再继承），不传保持不变
 // @Tags 角色管理
 // @Accept json
 // @Produce json
@@ -439,42 +533,88 @@ func (pc *PermissionController) UpdateRole(c *gin.Context) {
 		return
 	}
 
-	roleID := req.ID
-	roleRepo := repositories.NewRoleRepository()
-	// 需要实现GetByID方法
-	role, err := roleRepo.GetByID(uint(roleID))
+	// 角色、父角色和casbin_rule在同一事务中修改
+	var role *models.Role
+	err := database.UpdatePolicy(func(tx *gorm.DB) (database.PolicyScope, error) {
+		roleRepo := repositories.NewRoleRepository().WithTx(tx)
+		var err error
+		role, err = roleRepo.GetByID(uint(req.ID))
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return database.PolicyScope{}, txFail(http.StatusNotFound, fmt.Errorf("角色不存在"))
+			}
+			return database.PolicyScope{}, fmt.Errorf("查询角色失败: %v", err)
+		}
+		oldName := role.Name
+
+		// 检查名称是否已被其他角色使用
+		if req.Name != role.Name {
+			roles, err := roleRepo.GetByNameIn([]string{req.Name})
+			if err != nil {
+				return database.PolicyScope{}, fmt.Errorf("查询角色失败: %v", err)
+			}
+			if len(roles) > 0 {
+				return database.PolicyScope{}, txFail(http.StatusBadRequest, fmt.Errorf("角色名称已存在"))
+			}
+		}
+
+		if err := checkRoleOwner(tx, req.OwnerID); err != nil {
+			return database.PolicyScope{}, err
+		}
+
+		// 更新角色信息
+		role.Name = req.Name
+		role.Description = req.Description
+		role.RequireMFA = req.RequireMFA
+		role.OwnerID = req.OwnerID
+		if req.Parents != nil {
+			if err := services.NewRoleService(roleRepo).SetParents(role, *req.Parents); err != nil {
+				return database.PolicyScope{}, roleParentTxError(err)
+			}
+		}
+		if err := roleRepo.Update(role); err != nil {
+			return database.PolicyScope{}, fmt.Errorf("更新角色失败: %v", err)
+		}
+
+		// 改名时旧名称的规则一并删除
+		return database.ScopeRoles(oldName, role.Name), nil
+	})
 	if err != nil {
-		response.InternalServerError(c, fmt.Errorf("查询角色失败: %v", err))
+		respondTxError(c, err)
 		return
 	}
-	if role.ID == 0 {
-		response.NotFound(c, fmt.Errorf("角色不存在"))
+
+	response.OkWithData(c, role)
+}
+
+// @Summary 获取角色的有效权限
+// @Description 获取角色直接授予和从父角色（含间接继承）继承的全部权限，from_role为权限来源角色
+// @Tags 角色管理
+// @Produce json
+// @Param id path int true "角色ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Response{data=services.EffectivePermissions}
+// @Failure 400 {object} response.Response{msg=string}
+// @Failure 404 {object} response.Response{msg=string}
+// @Failure 500 {object} response.Response{msg=string}
+// @Router /roles/{id}/permissions [get]
+func (pc *PermissionController) GetRoleEffectivePermissions(c *gin.Context) {
+	roleID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, fmt.Errorf("无效的角色ID: %v", err))
 		return
 	}
 
-	// 检查名称是否已被其他角色使用
-	if req.Name != role.Name {
-		roles, err := roleRepo.GetByNameIn([]string{req.Name})
-		if err != nil {
-			response.InternalServerError(c, fmt.Errorf("查询角色失败: %v", err))
-			return
-		}
-		if len(roles) > 0 {
-			response.BadRequest(c, fmt.Errorf("角色名称已存在"))
+	result, err := pc.roleService.EffectivePermissions(uint(roleID))
+	if err != nil {
+		if errors.Is(err, services.ErrRoleNotFound) {
+			response.NotFound(c, err)
 			return
 		}
-	}
-
-	// 更新角色信息
-	role.Name = req.Name
-	role.Description = req.Description
-	// 需要实现Update方法
-	if err := roleRepo.Update(role); err != nil {
-		response.InternalServerError(c, fmt.Errorf("更新角色失败: %v", err))
+		response.InternalServerError(c, fmt.Errorf("获取角色权限失败: %v", err))
 		return
 	}
-
-	response.OkWithData(c, role)
+	response.OkWithData(c, result)
 }
 
 // @Summary 删除角色
@@ -496,38 +636,35 @@ func (pc *PermissionController) DeleteRole(c *gin.Context) {
 		return
 	}
 
-	roleRepo := repositories.NewRoleRepository()
-	// 需要实现GetByID方法
-	role, err := roleRepo.GetByID(uint(roleID))
-	if err != nil {
-		response.InternalServerError(c, fmt.Errorf("查询角色失败: %v", err))
-		return
-	}
-	if role.ID == 0 {
-		response.NotFound(c, fmt.Errorf("角色不存在"))
-		return
-	}
+	// 角色及其关联与casbin_rule在同一事务中删除
+	err = database.UpdatePolicy(func(tx *gorm.DB) (database.PolicyScope, error) {
+		roleRepo := repositories.NewRoleRepository().WithTx(tx)
+		role, err := roleRepo.GetByID(uint(roleID))
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return database.PolicyScope{}, txFail(http.StatusNotFound, fmt.Errorf("角色不存在"))
+			}
+			return database.PolicyScope{}, fmt.Errorf("查询角色失败: %v", err)
+		}
 
-	// 需要实现Delete方法
-	if err := roleRepo.Delete(uint(roleID)); err != nil {
-		if strings.Contains(err.Error(), "系统内置角色，无法删除") {
-			response.BadRequest(c, err)
-		} else {
-			response.Forbidden(c, fmt.Errorf("删除角色失败: %v", err))
+		if err := roleRepo.Delete(uint(roleID)); err != nil {
+			if strings.Contains(err.Error(), "系统内置角色，无法删除") {
+				return database.PolicyScope{}, txFail(http.StatusBadRequest, err)
+			}
+			return database.PolicyScope{}, txFail(http.StatusForbidden, fmt.Errorf("删除角色失败: %v", err))
 		}
+		return database.ScopeRoles(role.Name), nil
+	})
+	if err != nil {
+		respondTxError(c, err)
 		return
 	}
 
-	// 同步Casbin策略
-	if err := database.SyncCasbinPolicy(); err != nil {
-		logger.Logger.Error("同步Casbin策略失败", zap.Error(err))
-	}
-
 	response.OkWithData(c, "角色删除成功")
 }
 
 // @Summary 分配权限给角色
-// @Description 为指定角色分配权限，仅更新角色权限关联关系
+// @Description 为指定角色分配权限，仅更新角色权限关联关系；effect为deny时拒绝该权限，且优先于任何角色的允许
 // @Tags 权限管理
 // @Accept json
 // @Produce json
@@ -548,80 +685,34 @@ func (pc *PermissionController) AssignPermissionToRole(c *gin.Context) {
 
 	logger.Logger.Info("开始分配权限给角色", zap.Uint("roleID", req.RoleID), zap.Uint("permissionID", req.PermissionID))
 
-	// 检查角色是否存在
-	var role models.Role
-	if err := database.DB.First(&role, req.RoleID).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			logger.Logger.Error("角色不存在", zap.Uint("roleID", req.RoleID))
-			response.NotFound(c, fmt.Errorf("角色不存在"))
-			return
+	// 角色权限关联和casbin_rule在同一事务中修改
+	err := database.UpdatePolicy(func(tx *gorm.DB) (database.PolicyScope, error) {
+		role, permission, err := findRoleAndPermission(tx, req.RoleID, req.PermissionID)
+		if err != nil {
+			return database.PolicyScope{}, err
 		}
-		logger.Logger.Error("查询角色失败", zap.Uint("roleID", req.RoleID), zap.Error(err))
-		response.InternalServerError(c, fmt.Errorf("查询角色失败: %v", err))
-		return
-	}
 
-	// 检查权限是否存在
-	var permission models.Permission
-	if err := database.DB.First(&permission, req.PermissionID).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			logger.Logger.Error("权限不存在", zap.Uint("permissionID", req.PermissionID))
-			response.NotFound(c, fmt.Errorf("权限不存在"))
-			return
+		// 已存在的关联（包括软删除的）以新的效果替换
+		if err := tx.Unscoped().Where("role_id = ? AND permission_id = ?", req.RoleID, req.PermissionID).Delete(&models.RolePermission{}).Error; err != nil {
+			logger.Logger.Error("删除已存在的角色权限关联失败", zap.Uint("roleID", req.RoleID), zap.Uint("permissionID", req.PermissionID), zap.Error(err))
+			return database.PolicyScope{}, fmt.Errorf("删除已存在的角色权限关联失败: %v", err)
 		}
-		logger.Logger.Error("查询权限失败", zap.Uint("permissionID", req.PermissionID), zap.Error(err))
-		response.InternalServerError(c, fmt.Errorf("查询权限失败: %v", err))
-		return
-	}
-
-	// 检查并创建/更新角色权限关联
-	rolePermission := models.RolePermission{
-		RoleID:       req.RoleID,
-		PermissionID: req.PermissionID,
-	}
-
-	// 首先尝试删除已存在的关联（包括软删除的）
-	if err := database.DB.Unscoped().Where("role_id = ? AND permission_id = ?", req.RoleID, req.PermissionID).Delete(&models.RolePermission{}).Error; err != nil {
-		logger.Logger.Error("删除已存在的角色权限关联失败", zap.Uint("roleID", req.RoleID), zap.Uint("permissionID", req.PermissionID), zap.Error(err))
-		response.InternalServerError(c, fmt.Errorf("删除已存在的角色权限关联失败: %v", err))
-		return
-	}
-
-	// 创建新的角色权限关联
-	if err := database.DB.Create(&rolePermission).Error; err != nil {
-		logger.Logger.Error("创建角色权限关联失败", zap.Uint("roleID", req.RoleID), zap.Uint("permissionID", req.PermissionID), zap.Error(err))
-		response.InternalServerError(c, fmt.Errorf("创建角色权限关联失败: %v", err))
-		return
-	}
-	logger.Logger.Info("创建角色权限关联成功", zap.Uint("roleID", req.RoleID), zap.Uint("permissionID", req.PermissionID))
-
-	// 同步到casbin_rule
-	logger.Logger.Info("开始同步权限策略到casbin", zap.String("role", role.Name), zap.String("path", permission.Resource), zap.String("method", permission.Action))
-	ok, err := global.Enforcer.AddPolicy(role.Name, permission.Resource, permission.Action)
-	if err != nil {
-		logger.Logger.Error("添加权限策略失败", zap.String("role", role.Name), zap.String("path", permission.Resource), zap.String("method", permission.Action), zap.Error(err))
-		// 回滚角色权限关联创建（物理删除）
-		if err := database.DB.Unscoped().Delete(&rolePermission).Error; err != nil {
-			logger.Logger.Error("回滚角色权限关联失败", zap.Uint("roleID", req.RoleID), zap.Uint("permissionID", req.PermissionID), zap.Error(err))
+		rolePermission := models.RolePermission{
+			RoleID:       role.ID,
+			PermissionID: permission.ID,
+			Effect:       req.Effect,
 		}
-		response.InternalServerError(c, fmt.Errorf("同步权限策略失败: %v", err))
-		return
-	}
-	if !ok {
-		logger.Logger.Warn("权限策略已存在于casbin", zap.String("role", role.Name), zap.String("path", permission.Resource), zap.String("method", permission.Action))
-	}
-
-	// 保存策略变更
-	if err := global.Enforcer.SavePolicy(); err != nil {
-		logger.Logger.Error("保存权限策略失败", zap.Error(err))
-		// 回滚角色权限关联创建（物理删除）
-		if err := database.DB.Unscoped().Delete(&rolePermission).Error; err != nil {
-			logger.Logger.Error("回滚角色权限关联失败", zap.Uint("roleID", req.RoleID), zap.Uint("permissionID", req.PermissionID), zap.Error(err))
+		rolePermission.Effect = rolePermission.Eft()
+		if err := tx.Create(&rolePermission).Error; err != nil {
+			logger.Logger.Error("创建角色权限关联失败", zap.Uint("roleID", req.RoleID), zap.Uint("permissionID", req.PermissionID), zap.Error(err))
+			return database.PolicyScope{}, fmt.Errorf("创建角色权限关联失败: %v", err)
 		}
-		response.InternalServerError(c, fmt.Errorf("保存权限策略失败: %v", err))
+		return database.ScopeRoles(role.Name), nil
+	})
+	if err != nil {
+		respondTxError(c, err)
 		return
 	}
-	logger.Logger.Info("保存权限策略成功")
 
 	logger.Logger.Info("分配权限给角色操作完成", zap.Uint("roleID", req.RoleID), zap.Uint("permissionID", req.PermissionID))
 	response.OkWithData(c, "分配权限给角色成功")
@@ -649,95 +740,40 @@ func (pc *PermissionController) RemovePermissionFromRole(c *gin.Context) {
 
 	logger.Logger.Info("开始移除角色权限", zap.Uint("roleID", req.RoleID), zap.Uint("permissionID", req.PermissionID))
 
-	// 检查角色是否存在
-	var role models.Role
-	if err := database.DB.First(&role, req.RoleID).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			logger.Logger.Error("角色不存在", zap.Uint("roleID", req.RoleID))
-			response.NotFound(c, fmt.Errorf("角色不存在"))
-			return
+	// 角色权限关联、权限和casbin_rule在同一事务中修改
+	err := database.UpdatePolicy(func(tx *gorm.DB) (database.PolicyScope, error) {
+		role, permission, err := findRoleAndPermission(tx, req.RoleID, req.PermissionID)
+		if err != nil {
+			return database.PolicyScope{}, err
 		}
-		logger.Logger.Error("查询角色失败", zap.Uint("roleID", req.RoleID), zap.Error(err))
-		response.InternalServerError(c, fmt.Errorf("查询角色失败: %v", err))
-		return
-	}
 
-	// 检查权限是否存在
-	var permission models.Permission
-	if err := database.DB.First(&permission, req.PermissionID).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			logger.Logger.Error("权限不存在", zap.Uint("permissionID", req.PermissionID))
-			response.NotFound(c, fmt.Errorf("权限不存在"))
-			return
+		// 物理删除角色权限关联（包括已软删除的）
+		result := tx.Unscoped().Where("role_id = ? AND permission_id = ?", req.RoleID, req.PermissionID).Delete(&models.RolePermission{})
+		if result.Error != nil {
+			logger.Logger.Error("删除角色权限关联失败", zap.Uint("roleID", req.RoleID), zap.Uint("permissionID", req.PermissionID), zap.Error(result.Error))
+			return database.PolicyScope{}, fmt.Errorf("删除角色权限关联失败: %v", result.Error)
 		}
-		logger.Logger.Error("查询权限失败", zap.Uint("permissionID", req.PermissionID), zap.Error(err))
-		response.InternalServerError(c, fmt.Errorf("查询权限失败: %v", err))
-		return
-	}
-
-	// 检查角色权限关联是否存在（包括已软删除的）
-	var rolePermission models.RolePermission
-	if err := database.DB.Unscoped().Where("role_id = ? AND permission_id = ?", req.RoleID, req.PermissionID).First(&rolePermission).Error; err != nil {
-		if !errors.Is(err, gorm.ErrRecordNotFound) {
-			logger.Logger.Error("查询角色权限关联失败", zap.Uint("roleID", req.RoleID), zap.Uint("permissionID", req.PermissionID), zap.Error(err))
-			response.InternalServerError(c, fmt.Errorf("查询角色权限关联失败: %v", err))
-			return
+		if result.RowsAffected == 0 {
+			return database.PolicyScope{}, txFail(http.StatusNotFound, fmt.Errorf("角色权限关联不存在"))
 		}
-		logger.Logger.Warn("角色权限关联不存在", zap.Uint("roleID", req.RoleID), zap.Uint("permissionID", req.PermissionID))
-		response.NotFound(c, fmt.Errorf("角色权限关联不存在"))
-		return
-	}
-
-	// 物理删除角色权限关联
-	if err := database.DB.Unscoped().Delete(&rolePermission).Error; err != nil {
-		logger.Logger.Error("删除角色权限关联失败", zap.Uint("roleID", req.RoleID), zap.Uint("permissionID", req.PermissionID), zap.Error(err))
-		response.InternalServerError(c, fmt.Errorf("删除角色权限关联失败: %v", err))
-		return
-	}
-	logger.Logger.Info("删除角色权限关联成功", zap.Uint("roleID", req.RoleID), zap.Uint("permissionID", req.PermissionID))
 
-	// 如果权限无关联角色，删除权限
-	var count int64
-	database.DB.Model(&models.RolePermission{}).Where("permission_id = ?", req.PermissionID).Count(&count)
-	logger.Logger.Info("检查权限关联角色数量", zap.Int64("count", count), zap.Uint("permissionID", req.PermissionID))
-	if count == 0 {
-		logger.Logger.Info("权限无关联角色，将删除权限", zap.Uint("permissionID", req.PermissionID))
-		if err := database.DB.Delete(&permission).Error; err != nil {
-			logger.Logger.Error("删除权限失败", zap.Uint("permissionID", req.PermissionID), zap.Error(err))
-			response.InternalServerError(c, fmt.Errorf("删除权限失败: %v", err))
-			return
+		// 如果权限无关联角色，删除权限
+		if err := deleteUnusedPermission(tx, *permission); err != nil {
+			return database.PolicyScope{}, err
 		}
-		logger.Logger.Info("删除权限成功", zap.Uint("permissionID", req.PermissionID))
-	} else {
-		logger.Logger.Info("权限仍有关联角色，不删除权限", zap.Uint("permissionID", req.PermissionID), zap.Int64("关联角色数", count))
-	}
-
-	// 从casbin_rule删除策略
-	logger.Logger.Info("开始从casbin删除权限策略", zap.String("role", role.Name), zap.String("path", permission.Resource), zap.String("method", permission.Action))
-	ok, err := global.Enforcer.RemovePolicy(role.Name, permission.Resource, permission.Action)
+		return database.ScopeRoles(role.Name), nil
+	})
 	if err != nil {
-		logger.Logger.Error("删除权限策略失败", zap.String("role", role.Name), zap.String("path", permission.Resource), zap.String("method", permission.Action), zap.Error(err))
-		response.InternalServerError(c, fmt.Errorf("删除权限策略失败: %v", err))
+		respondTxError(c, err)
 		return
 	}
-	if !ok {
-		logger.Logger.Warn("权限策略不存在于casbin", zap.String("role", role.Name), zap.String("path", permission.Resource), zap.String("method", permission.Action))
-	}
-
-	// 保存策略变更
-	if err := global.Enforcer.SavePolicy(); err != nil {
-		logger.Logger.Error("保存权限策略失败", zap.Error(err))
-		response.InternalServerError(c, fmt.Errorf("保存权限策略失败: %v", err))
-		return
-	}
-	logger.Logger.Info("保存权限策略成功")
 
 	logger.Logger.Info("移除角色权限操作完成", zap.Uint("roleID", req.RoleID), zap.Uint("permissionID", req.PermissionID))
 	response.OkWithData(c, "移除角色权限成功")
 }
 
 // @Summary 更新用户角色权限对接
-// @Description 更新指定用户的角色列表（会替换/增加现有角色）
+// @Description 更新指定用户的长期角色列表（会替换/增加现有角色）；列表中原为临时授权的角色转为长期，其他临时授权到期前保持不变
 // @Tags 权限管理
 // @Accept json
 // @Produce json
@@ -755,39 +791,38 @@ func (pc *PermissionController) UpdateUserRole(c *gin.Context) {
 		return
 	}
 
-	// 查询用户
-	userRepo := repositories.NewUserRepository()
-	user, err := userRepo.GetByID(req.UserID)
-	if err != nil {
-		response.InternalServerError(c, fmt.Errorf("查询用户失败: %v", err))
-		return
-	}
-	if user.ID == 0 {
-		response.NotFound(c, fmt.Errorf("用户不存在"))
-		return
-	}
+	// 用户角色关联和casbin_rule在同一事务中修改
+	var roles []models.Role
+	err := database.UpdatePolicy(func(tx *gorm.DB) (database.PolicyScope, error) {
+		// 查询用户
+		var user models.User
+		if err := tx.First(&user, req.UserID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return database.PolicyScope{}, txFail(http.StatusNotFound, fmt.Errorf("用户不存在"))
+			}
+			return database.PolicyScope{}, fmt.Errorf("查询用户失败: %v", err)
+		}
 
-	// 查询角色是否存在
-	roleRepo := repositories.NewRoleRepository()
-	roles, err := roleRepo.GetByNameIn(req.Roles)
+		// 查询角色是否存在
+		roleRepo := repositories.NewRoleRepository().WithTx(tx)
+		var err error
+		if roles, err = roleRepo.GetByNameIn(req.Roles); err != nil {
+			return database.PolicyScope{}, fmt.Errorf("查询角色失败: %v", err)
+		}
+		if len(roles) != len(req.Roles) {
+			return database.PolicyScope{}, txFail(http.StatusBadRequest, fmt.Errorf("部分角色不存在"))
+		}
+
+		// 更新用户角色关联，临时授权保持不变
+		if err := repositories.ReplaceUserRoles(tx, user.ID, roles); err != nil {
+			return database.PolicyScope{}, fmt.Errorf("更新用户角色失败: %v", err)
+		}
+		return database.ScopeUsers(user.Username), nil
+	})
 	if err != nil {
-		response.InternalServerError(c, fmt.Errorf("查询角色失败: %v", err))
-		return
-	}
-	if len(roles) != len(req.Roles) {
-		response.BadRequest(c, fmt.Errorf("部分角色不存在"))
+		respondTxError(c, err)
 		return
 	}
-	// 更新用户角色关联
-	if err := database.DB.Model(&user).Association("Roles").Replace(roles); err != nil {
-		response.InternalServerError(c, fmt.Errorf("更新用户角色失败: %v", err))
-		return
-	}
-
-	// 同步Casbin策略
-	if err := database.SyncCasbinPolicy(); err != nil {
-		logger.Logger.Error("同步Casbin策略失败", zap.Error(err))
-	}
 
 	response.OkWithData(c, fmt.Sprintf("成功为用户分配 %d 个角色", len(roles)))
 }
@@ -795,9 +830,11 @@ func (pc *PermissionController) UpdateUserRole(c *gin.Context) {
 // PolicyRequest 权限策略请求结构
 // @Description 权限策略请求参数，包含权限描述、资源路径和HTTP方法
 type PolicyRequest struct {
-	Describe string `json:"description" binding:"required"` // 权限描述
-	Path     string `json:"path" binding:"required"`        // 资源路径
-	Method   string `json:"method" binding:"required"`      // HTTP方法
+	Describe   string `json:"description" binding:"required"`              // 权限描述
+	Path       string `json:"path" binding:"required"`                     // 资源路径；template模式下为路由模板
+	Method     string `json:"method" binding:"required"`                   // HTTP方法
+	Effect     string `json:"effect" binding:"omitempty,oneof=allow deny"` // 效果：allow（默认）或deny，仅添加时使用
+	Conditions string `json:"conditions" binding:"max=512"`                // 属性条件表达式，如owner、ip(10.0.0.0/8) && time(09:00-18:00)
 }
 
 // RolePermissionRequest 角色权限关联请求结构
@@ -805,8 +842,9 @@ type PolicyRequest struct {
 // @Param RoleID body int true "角色ID"
 // @Param PermissionID body int true "权限ID"
 type RolePermissionRequest struct {
-	RoleID       uint `json:"role_id" binding:"required"`       // 角色ID
-	PermissionID uint `json:"permission_id" binding:"required"` // 权限ID
+	RoleID       uint   `json:"role_id" binding:"required"`                  // 角色ID
+	PermissionID uint   `json:"permission_id" binding:"required"`            // 权限ID
+	Effect       string `json:"effect" binding:"omitempty,oneof=allow deny"` // 效果：allow（默认）或deny，仅分配时使用
 }
 
 // CreateRoleRequest 创建角色请求结构
@@ -814,8 +852,11 @@ type RolePermissionRequest struct {
 // @Param Name body string true "角色名称"
 // @Param Description body string false "角色描述"
 type CreateRoleRequest struct {
-	Name        string `json:"name" binding:"required,min=2,max=50"` // 角色名称
-	Description string `json:"description" binding:"max=255"`        // 角色描述
+	Name        string   `json:"name" binding:"required,min=2,max=50"` // 角色名称
+	Description string   `json:"description" binding:"max=255"`        // 角色描述
+	RequireMFA  bool     `json:"require_mfa"`                          // 是否要求两步验证
+	Parents     []string `json:"parents"`                              // 父角色名称，继承其全部权限
+	OwnerID     *uint    `json:"owner_id"`                             // 角色负责人的用户ID，审批该角色的临时提权申请
 }
 
 // UpdateRoleRequest 更新角色请求结构
@@ -824,9 +865,12 @@ type CreateRoleRequest struct {
 // @Param Name body string true "角色名称"
 // @Param Description body string false "角色描述"
 type UpdateRoleRequest struct {
-	ID          uint   `json:"id" binding:"required"`
-	Name        string `json:"name" binding:"required,min=2,max=50"` // 角色名称
-	Description string `json:"description" binding:"max=255"`        // 角色描述
+	ID          uint      `json:"id" binding:"required"`
+	Name        string    `json:"name" binding:"required,min=2,max=50"` // 角色名称
+	Description string    `json:"description" binding:"max=255"`        // 角色描述
+	RequireMFA  bool      `json:"require_mfa"`                          // 是否要求两步验证
+	Parents     *[]string `json:"parents"`                              // 父角色名称，不传保持不变
+	OwnerID     *uint     `json:"owner_id"`                             // 角色负责人的用户ID，为空表示不设负责人
 }
 
 // UpdateUserRoleRequest 更新用户角色请求结构
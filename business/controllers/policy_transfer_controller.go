@@ -0,0 +1,122 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/GZ-Alinx/autops/business/services"
+	"github.com/GZ-Alinx/autops/internal/response"
+)
+
+// maxPolicyDocumentSize 导入文档的最大长度
+const maxPolicyDocumentSize = 10 << 20
+
+// policyContentTypes 各格式导出时的Content-Type
+var policyContentTypes = map[string]string{
+	services.PolicyFormatYAML: "application/yaml; charset=utf-8",
+	services.PolicyFormatCSV:  "text/csv; charset=utf-8",
+}
+
+// PolicyTransferController 权限配置导入导出控制器
+type PolicyTransferController struct {
+	transferService services.PolicyTransferService
+}
+
+// NewPolicyTransferController 创建权限配置导入导出控制器实例
+func NewPolicyTransferController(transferService services.PolicyTransferService) *PolicyTransferController {
+	return &PolicyTransferController{transferService: transferService}
+}
+
+// policyFormat 读取format参数，默认为yaml
+func policyFormat(c *gin.Context) (string, bool) {
+	format := c.DefaultQuery("format", services.PolicyFormatYAML)
+	if _, ok := policyContentTypes[format]; !ok {
+		response.BadRequest(c, services.ErrPolicyFormat)
+		return "", false
+	}
+	return format, true
+}
+
+// @Summary 导出权限配置
+// @Description 以yaml或csv导出全部角色、权限和角色权限关联，include_users=true时同时导出默认租户的用户角色；导出结果可直接用于导入
+// @Tags 权限管理
+// @Produce plain
+// @Param format query string false "格式：yaml（默认）或csv"
+// @Param include_users query bool false "是否导出用户角色"
+// @Security ApiKeyAuth
+// @Success 200 {string} string "权限配置文档"
+// @Failure 400 {object} response.Response{msg=string}
+// @Failure 500 {object} response.Response{msg=string}
+// @Router /permissions/export [get]
+func (pc *PolicyTransferController) Export(c *gin.Context) {
+	format, ok := policyFormat(c)
+	if !ok {
+		return
+	}
+	includeUsers, _ := strconv.ParseBool(c.Query("include_users"))
+
+	doc, err := pc.transferService.Export(includeUsers)
+	if err != nil {
+		response.InternalServerError(c, fmt.Errorf("导出权限配置失败: %v", err))
+		return
+	}
+	data, err := services.EncodePolicyDocument(format, doc)
+	if err != nil {
+		response.InternalServerError(c, fmt.Errorf("导出权限配置失败: %v", err))
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=policy.%s", format))
+	c.Data(http.StatusOK, policyContentTypes[format], data)
+}
+
+// @Summary 导入权限配置
+// @Description 请求体为yaml或csv格式的权限配置文档。默认只返回与数据库的差异（dry-run）；apply=true时在一个事务中按文档创建、更新和删除角色、权限和角色权限关联（文档包含user_roles时同时设置其中用户的角色），并同步Casbin策略
+// @Tags 权限管理
+// @Accept plain
+// @Produce json
+// @Param format query string false "格式：yaml（默认）或csv"
+// @Param apply query bool false "是否写入数据库"
+// @Param body body string true "权限配置文档"
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Response{data=services.PolicyImportResult}
+// @Failure 400 {object} response.Response{msg=string}
+// @Failure 500 {object} response.Response{msg=string}
+// @Router /permissions/import [post]
+func (pc *PolicyTransferController) Import(c *gin.Context) {
+	format, ok := policyFormat(c)
+	if !ok {
+		return
+	}
+	apply, _ := strconv.ParseBool(c.Query("apply"))
+
+	data, err := io.ReadAll(io.LimitReader(c.Request.Body, maxPolicyDocumentSize+1))
+	if err != nil {
+		response.BadRequest(c, fmt.Errorf("读取请求体失败: %v", err))
+		return
+	}
+	if len(data) > maxPolicyDocumentSize {
+		response.BadRequest(c, fmt.Errorf("文档不能超过%dMB", maxPolicyDocumentSize>>20))
+		return
+	}
+
+	doc, err := services.DecodePolicyDocument(format, data)
+	if err != nil {
+		response.BadRequest(c, err)
+		return
+	}
+	result, err := pc.transferService.Import(currentActor(c), doc, apply)
+	if err != nil {
+		if errors.Is(err, services.ErrPolicyInvalid) {
+			response.BadRequest(c, err)
+			return
+		}
+		response.InternalServerError(c, fmt.Errorf("导入权限配置失败: %v", err))
+		return
+	}
+	response.OkWithData(c, result)
+}
@@ -0,0 +1,277 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/business/services"
+	"github.com/GZ-Alinx/autops/internal/response"
+)
+
+// RoleElevationRequest 申请临时提权请求结构体
+// @Description not_before为空时批准后立即生效，minutes不能超过permission.elevation.max_minutes
+type RoleElevationRequest struct {
+	Role      string     `json:"role" binding:"required"`           // 申请的角色
+	Minutes   int        `json:"minutes" binding:"required,min=1"`  // 时长（分钟）
+	Reason    string     `json:"reason" binding:"required,max=255"` // 申请原因，如值班处理的工单
+	NotBefore *time.Time `json:"not_before"`                        // 期望的生效时间
+}
+
+// ReviewElevationRequest 审批临时提权请求结构体
+type ReviewElevationRequest struct {
+	Comment string `json:"comment" binding:"max=255"` // 审批意见
+}
+
+// GrantRoleRequest 直接临时授权请求结构体
+// @Description 不经过审批为用户临时授予角色，到期后自动回收；用户已有该角色的临时授权时覆盖有效期
+type GrantRoleRequest struct {
+	UserID    uint       `json:"user_id" binding:"required"`
+	Role      string     `json:"role" binding:"required"`
+	Minutes   int        `json:"minutes" binding:"required,min=1"`
+	Reason    string     `json:"reason" binding:"required,max=255"`
+	NotBefore *time.Time `json:"not_before"`
+}
+
+// RoleElevationController 临时提权控制器
+type RoleElevationController struct {
+	elevationService services.RoleElevationService
+}
+
+// NewRoleElevationController 创建临时提权控制器实例
+func NewRoleElevationController(elevationService services.RoleElevationService) *RoleElevationController {
+	return &RoleElevationController{elevationService: elevationService}
+}
+
+// respondElevationError 将临时提权服务错误映射为响应
+func respondElevationError(c *gin.Context, err error, action string) {
+	switch {
+	case errors.Is(err, services.ErrElevationNotFound),
+		errors.Is(err, services.ErrElevationUserNotFound):
+		response.NotFound(c, err)
+	case errors.Is(err, services.ErrElevationForbidden),
+		errors.Is(err, services.ErrElevationSelfReview):
+		response.Forbidden(c, err)
+	case errors.Is(err, services.ErrElevationNotPending),
+		errors.Is(err, services.ErrElevationDuration),
+		errors.Is(err, services.ErrElevationPermanent),
+		errors.Is(err, services.ErrElevationDuplicate),
+		errors.Is(err, services.ErrRoleNotFound):
+		response.BadRequest(c, err)
+	default:
+		response.InternalServerError(c, fmt.Errorf("%s失败: %v", action, err))
+	}
+}
+
+// elevationID 解析路径中的申请ID，无效时已写入响应
+func elevationID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, fmt.Errorf("无效的申请ID"))
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// @Summary 申请临时提权
+// @Description 当前用户申请在一段时间内拥有某个角色，由角色负责人审批（角色未设置负责人时由admin审批）
+// @Tags 临时提权
+// @Accept json
+// @Produce json
+// @Param data body RoleElevationRequest true "角色、时长和原因"
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Response{data=models.RoleElevation}
+// @Failure 400 {object} response.Response{msg=string}
+// @Failure 500 {object} response.Response{msg=string}
+// @Router /role-elevations [post]
+func (ec *RoleElevationController) Request(c *gin.Context) {
+	var req RoleElevationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, fmt.Errorf("请求参数验证失败: %v", err))
+		return
+	}
+
+	elevation, err := ec.elevationService.Request(services.ElevationRequest{
+		Role:      req.Role,
+		Reason:    req.Reason,
+		Minutes:   req.Minutes,
+		NotBefore: req.NotBefore,
+	}, currentActor(c))
+	if err != nil {
+		respondElevationError(c, err, "申请临时提权")
+		return
+	}
+	response.OkWithData(c, elevation)
+}
+
+// @Summary 获取我的提权申请
+// @Tags 临时提权
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Response{data=[]models.RoleElevation}
+// @Failure 500 {object} response.Response{msg=string}
+// @Router /role-elevations [get]
+func (ec *RoleElevationController) ListMine(c *gin.Context) {
+	userID, _ := currentUserID(c)
+	elevations, err := ec.elevationService.ListMine(userID)
+	if err != nil {
+		respondElevationError(c, err, "获取提权申请")
+		return
+	}
+	response.OkWithData(c, elevations)
+}
+
+// @Summary 撤回提权申请
+// @Description 撤回自己待审批的申请
+// @Tags 临时提权
+// @Produce json
+// @Param id path int true "申请ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Response{data=string}
+// @Failure 400 {object} response.Response{msg=string}
+// @Failure 404 {object} response.Response{msg=string}
+// @Failure 500 {object} response.Response{msg=string}
+// @Router /role-elevations/{id} [delete]
+func (ec *RoleElevationController) Cancel(c *gin.Context) {
+	id, ok := elevationID(c)
+	if !ok {
+		return
+	}
+	if err := ec.elevationService.Cancel(id, currentActor(c)); err != nil {
+		respondElevationError(c, err, "撤回提权申请")
+		return
+	}
+	response.OkWithData(c, "申请已撤回")
+}
+
+// @Summary 获取待我审批的提权申请
+// @Description 当前用户作为角色负责人可以审批的申请；未设置负责人的角色的申请由admin审批
+// @Tags 临时提权
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Response{data=[]models.RoleElevation}
+// @Failure 500 {object} response.Response{msg=string}
+// @Router /role-elevations/reviews [get]
+func (ec *RoleElevationController) ListReviewable(c *gin.Context) {
+	userID, _ := currentUserID(c)
+	elevations, err := ec.elevationService.ListReviewable(userID)
+	if err != nil {
+		respondElevationError(c, err, "获取待审批的提权申请")
+		return
+	}
+	response.OkWithData(c, elevations)
+}
+
+// review 批准或拒绝申请
+func (ec *RoleElevationController) review(c *gin.Context, approve bool) {
+	id, ok := elevationID(c)
+	if !ok {
+		return
+	}
+	var req ReviewElevationRequest
+	if err := c.ShouldBindJSON(&req); err != nil && c.Request.ContentLength > 0 {
+		response.BadRequest(c, fmt.Errorf("请求参数验证失败: %v", err))
+		return
+	}
+
+	var elevation *models.RoleElevation
+	var err error
+	if approve {
+		elevation, err = ec.elevationService.Approve(id, req.Comment, currentActor(c))
+	} else {
+		elevation, err = ec.elevationService.Reject(id, req.Comment, currentActor(c))
+	}
+	if err != nil {
+		respondElevationError(c, err, "审批提权申请")
+		return
+	}
+	response.OkWithData(c, elevation)
+}
+
+// @Summary 批准提权申请
+// @Description 角色负责人批准后写入带有效期的用户角色并立即同步权限，到期后自动回收；不能审批自己的申请
+// @Tags 临时提权
+// @Accept json
+// @Produce json
+// @Param id path int true "申请ID"
+// @Param data body ReviewElevationRequest false "审批意见"
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Response{data=models.RoleElevation}
+// @Failure 400 {object} response.Response{msg=string}
+// @Failure 403 {object} response.Response{msg=string}
+// @Failure 404 {object} response.Response{msg=string}
+// @Failure 500 {object} response.Response{msg=string}
+// @Router /role-elevations/{id}/approve [post]
+func (ec *RoleElevationController) Approve(c *gin.Context) {
+	ec.review(c, true)
+}
+
+// @Summary 拒绝提权申请
+// @Tags 临时提权
+// @Accept json
+// @Produce json
+// @Param id path int true "申请ID"
+// @Param data body ReviewElevationRequest false "审批意见"
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Response{data=models.RoleElevation}
+// @Failure 400 {object} response.Response{msg=string}
+// @Failure 403 {object} response.Response{msg=string}
+// @Failure 404 {object} response.Response{msg=string}
+// @Failure 500 {object} response.Response{msg=string}
+// @Router /role-elevations/{id}/reject [post]
+func (ec *RoleElevationController) Reject(c *gin.Context) {
+	ec.review(c, false)
+}
+
+// @Summary 直接临时授权
+// @Description 管理员不经过审批为用户临时授予角色（默认租户），到期后自动回收
+// @Tags 权限管理
+// @Accept json
+// @Produce json
+// @Param data body GrantRoleRequest true "用户、角色、时长和原因"
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Response{data=services.TemporaryGrant}
+// @Failure 400 {object} response.Response{msg=string}
+// @Failure 404 {object} response.Response{msg=string}
+// @Failure 500 {object} response.Response{msg=string}
+// @Router /permissions/role-grants [post]
+func (ec *RoleElevationController) Grant(c *gin.Context) {
+	var req GrantRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, fmt.Errorf("请求参数验证失败: %v", err))
+		return
+	}
+
+	grant, err := ec.elevationService.Grant(req.UserID, services.ElevationRequest{
+		Role:      req.Role,
+		Reason:    req.Reason,
+		Minutes:   req.Minutes,
+		NotBefore: req.NotBefore,
+	}, currentActor(c))
+	if err != nil {
+		respondElevationError(c, err, "临时授权")
+		return
+	}
+	response.OkWithData(c, grant)
+}
+
+// @Summary 获取临时授权列表
+// @Description 全部尚未回收的临时授权，active表示当前是否已生效
+// @Tags 权限管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Response{data=[]services.TemporaryGrant}
+// @Failure 500 {object} response.Response{msg=string}
+// @Router /permissions/role-grants [get]
+func (ec *RoleElevationController) ListGrants(c *gin.Context) {
+	grants, err := ec.elevationService.ListGrants()
+	if err != nil {
+		respondElevationError(c, err, "获取临时授权")
+		return
+	}
+	response.OkWithData(c, grants)
+}
@@ -0,0 +1,175 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/business/services"
+	"github.com/GZ-Alinx/autops/internal/middleware"
+	"github.com/GZ-Alinx/autops/internal/response"
+)
+
+// SessionResponse 登录会话响应结构
+// @Description current为true表示发起本次请求的会话
+type SessionResponse struct {
+	*models.UserSession
+	Current bool `json:"current"`
+}
+
+// SessionController 登录会话控制器
+type SessionController struct {
+	tokenService services.TokenService
+	userService  services.UserService
+}
+
+// NewSessionController 创建登录会话控制器实例
+func NewSessionController(tokenService services.TokenService, userService services.UserService) *SessionController {
+	return &SessionController{
+		tokenService: tokenService,
+		userService:  userService,
+	}
+}
+
+// currentSessionID 当前请求所属的会话ID，API令牌认证时为空
+func currentSessionID(c *gin.Context) string {
+	if claims, ok := middleware.GetClaims(c); ok {
+		return claims.SessionID
+	}
+	return ""
+}
+
+// @Summary 获取我的登录会话
+// @Description 获取当前用户全部有效的登录会话，包括登录IP、User-Agent和最近访问时间
+// @Tags 登录会话
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Response{data=[]SessionResponse}
+// @Failure 500 {object} response.Response{msg=string}
+// @Router /me/sessions [get]
+func (sc *SessionController) ListMySessions(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		response.Unauthorized(c, fmt.Errorf("未登录"))
+		return
+	}
+
+	sessions, err := sc.tokenService.ListSessions(userID)
+	if err != nil {
+		response.InternalServerError(c, fmt.Errorf("获取会话列表失败: %v", err))
+		return
+	}
+
+	current := currentSessionID(c)
+	items := make([]SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		items = append(items, SessionResponse{
+			UserSession: session,
+			Current:     current != "" && session.SessionID == current,
+		})
+	}
+	response.OkWithData(c, items)
+}
+
+// @Summary 下线我的登录会话
+// @Description 吊销当前用户的指定会话，该会话的访问令牌和刷新令牌立即失效
+// @Tags 登录会话
+// @Produce json
+// @Param sid path string true "会话ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Response{data=string}
+// @Failure 404 {object} response.Response{msg=string}
+// @Failure 500 {object} response.Response{msg=string}
+// @Router /me/sessions/{sid} [delete]
+func (sc *SessionController) RevokeMySession(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		response.Unauthorized(c, fmt.Errorf("未登录"))
+		return
+	}
+
+	if err := sc.tokenService.RevokeSession(userID, c.Param("sid"), userID); err != nil {
+		if errors.Is(err, services.ErrSessionNotFound) {
+			response.NotFound(c, err)
+			return
+		}
+		response.InternalServerError(c, fmt.Errorf("下线会话失败: %v", err))
+		return
+	}
+	response.OkWithData(c, "会话已下线")
+}
+
+// @Summary 下线我的其他登录会话
+// @Description 吊销当前用户除本次请求所属会话之外的全部会话
+// @Tags 登录会话
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Response{data=string}
+// @Failure 500 {object} response.Response{msg=string}
+// @Router /me/sessions [delete]
+func (sc *SessionController) RevokeMyOtherSessions(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		response.Unauthorized(c, fmt.Errorf("未登录"))
+		return
+	}
+
+	sessions, err := sc.tokenService.ListSessions(userID)
+	if err != nil {
+		response.InternalServerError(c, fmt.Errorf("获取会话列表失败: %v", err))
+		return
+	}
+	current := currentSessionID(c)
+	for _, session := range sessions {
+		if session.SessionID == current {
+			continue
+		}
+		if err := sc.tokenService.RevokeSession(userID, session.SessionID, userID); err != nil && !errors.Is(err, services.ErrSessionNotFound) {
+			response.InternalServerError(c, fmt.Errorf("下线会话失败: %v", err))
+			return
+		}
+	}
+	response.OkWithData(c, "其他会话已全部下线")
+}
+
+// parseUserID 解析路径中的用户ID并确认用户存在，失败时已写入响应
+func (sc *SessionController) parseUserID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, fmt.Errorf("无效的用户ID"))
+		return 0, false
+	}
+	if _, err := sc.userService.GetUserByID(uint(id)); err != nil {
+		response.NotFound(c, fmt.Errorf("用户不存在"))
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// @Summary 强制用户下线
+// @Description 管理员吊销指定用户的全部登录会话和刷新令牌，用户需重新登录
+// @Tags 登录会话
+// @Produce json
+// @Param id path int true "用户ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Response{data=string}
+// @Failure 400 {object} response.Response{msg=string}
+// @Failure 404 {object} response.Response{msg=string}
+// @Failure 500 {object} response.Response{msg=string}
+// @Router /users/{id}/sessions [delete]
+func (sc *SessionController) ForceLogout(c *gin.Context) {
+	userID, ok := sc.parseUserID(c)
+	if !ok {
+		return
+	}
+	operatorID, _ := currentUserID(c)
+
+	if err := sc.tokenService.RevokeAllForUser(userID, operatorID); err != nil {
+		response.InternalServerError(c, fmt.Errorf("强制下线失败: %v", err))
+		return
+	}
+	response.OkWithData(c, "用户已被强制下线")
+}
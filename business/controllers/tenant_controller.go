@@ -0,0 +1,196 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/business/services"
+	"github.com/GZ-Alinx/autops/internal/middleware"
+	"github.com/GZ-Alinx/autops/internal/response"
+)
+
+// CreateTenantRequest 创建租户请求结构体
+// @Description code不能包含*、/和空格，不能为default或*
+type CreateTenantRequest struct {
+	Code        string `json:"code" binding:"required,max=50,excludesall=*/ "`
+	Name        string `json:"name" binding:"required,max=100"`
+	Description string `json:"description" binding:"max=255"`
+}
+
+// SetTenantMemberRequest 设置租户成员角色请求结构体
+// @Description roles为空时将用户移出当前租户
+type SetTenantMemberRequest struct {
+	UserID uint     `json:"user_id" binding:"required"`
+	Roles  []string `json:"roles"`
+}
+
+// TenantController 租户控制器
+type TenantController struct {
+	tenantService services.TenantService
+}
+
+// NewTenantController 创建租户控制器实例
+func NewTenantController(tenantService services.TenantService) *TenantController {
+	return &TenantController{tenantService: tenantService}
+}
+
+// respondTenantError 将租户服务错误映射为响应
+func respondTenantError(c *gin.Context, err error, action string) {
+	switch {
+	case errors.Is(err, services.ErrTenantNotFound),
+		errors.Is(err, services.ErrTenantMemberNotFound):
+		response.NotFound(c, err)
+	case errors.Is(err, services.ErrTenantCodeReserved),
+		errors.Is(err, services.ErrTenantCodeExists),
+		errors.Is(err, services.ErrDefaultTenantMembers),
+		errors.Is(err, services.ErrRoleNotFound):
+		response.BadRequest(c, err)
+	default:
+		response.InternalServerError(c, fmt.Errorf("%s失败: %v", action, err))
+	}
+}
+
+// @Summary 创建租户
+// @Description 创建租户（项目/团队），创建人成为该租户的admin
+// @Tags 租户管理
+// @Accept json
+// @Produce json
+// @Param body body CreateTenantRequest true "租户信息"
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Response{data=models.Tenant}
+// @Failure 400 {object} response.Response{msg=string}
+// @Failure 500 {object} response.Response{msg=string}
+// @Router /tenants [post]
+func (tc *TenantController) Create(c *gin.Context) {
+	var req CreateTenantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, fmt.Errorf("请求参数验证失败: %v", err))
+		return
+	}
+
+	tenant := &models.Tenant{Code: req.Code, Name: req.Name, Description: req.Description}
+	if err := tc.tenantService.Create(tenant, currentActor(c)); err != nil {
+		respondTenantError(c, err, "创建租户")
+		return
+	}
+
+	response.OkWithData(c, tenant)
+}
+
+// @Summary 获取租户列表
+// @Tags 租户管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Response{data=[]models.Tenant}
+// @Failure 500 {object} response.Response{msg=string}
+// @Router /tenants [get]
+func (tc *TenantController) List(c *gin.Context) {
+	tenants, err := tc.tenantService.List()
+	if err != nil {
+		response.InternalServerError(c, fmt.Errorf("获取租户列表失败: %v", err))
+		return
+	}
+	response.OkWithData(c, tenants)
+}
+
+// @Summary 获取租户详情
+// @Tags 租户管理
+// @Produce json
+// @Param id path int true "租户ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Response{data=models.Tenant}
+// @Failure 400 {object} response.Response{msg=string}
+// @Failure 404 {object} response.Response{msg=string}
+// @Failure 500 {object} response.Response{msg=string}
+// @Router /tenants/{id} [get]
+func (tc *TenantController) Get(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, fmt.Errorf("无效的租户ID"))
+		return
+	}
+	tenant, err := tc.tenantService.Get(uint(id))
+	if err != nil {
+		respondTenantError(c, err, "获取租户")
+		return
+	}
+	response.OkWithData(c, tenant)
+}
+
+// @Summary 删除租户
+// @Description 删除租户及其全部成员角色
+// @Tags 租户管理
+// @Produce json
+// @Param id path int true "租户ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Response{data=string}
+// @Failure 400 {object} response.Response{msg=string}
+// @Failure 404 {object} response.Response{msg=string}
+// @Failure 500 {object} response.Response{msg=string}
+// @Router /tenants/{id} [delete]
+func (tc *TenantController) Delete(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, fmt.Errorf("无效的租户ID"))
+		return
+	}
+	if err := tc.tenantService.Delete(uint(id)); err != nil {
+		respondTenantError(c, err, "删除租户")
+		return
+	}
+
+	response.OkWithData(c, "租户删除成功")
+}
+
+// @Summary 获取当前租户成员
+// @Description 当前租户由X-Tenant请求头指定
+// @Tags 租户管理
+// @Produce json
+// @Param X-Tenant header string true "租户标识"
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Response{data=[]services.TenantMember}
+// @Failure 400 {object} response.Response{msg=string}
+// @Failure 500 {object} response.Response{msg=string}
+// @Router /tenant-members [get]
+func (tc *TenantController) ListMembers(c *gin.Context) {
+	tenantID, _ := middleware.GetTenant(c)
+	members, err := tc.tenantService.ListMembers(tenantID)
+	if err != nil {
+		respondTenantError(c, err, "获取租户成员")
+		return
+	}
+	response.OkWithData(c, members)
+}
+
+// @Summary 设置当前租户成员的角色
+// @Description 替换用户在当前租户内的角色，roles为空时将用户移出租户；当前租户由X-Tenant请求头指定
+// @Tags 租户管理
+// @Accept json
+// @Produce json
+// @Param X-Tenant header string true "租户标识"
+// @Param body body SetTenantMemberRequest true "用户和角色"
+// @Security ApiKeyAuth
+// @Success 200 {object} response.Response{data=string}
+// @Failure 400 {object} response.Response{msg=string}
+// @Failure 404 {object} response.Response{msg=string}
+// @Failure 500 {object} response.Response{msg=string}
+// @Router /tenant-members [put]
+func (tc *TenantController) SetMember(c *gin.Context) {
+	var req SetTenantMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, fmt.Errorf("请求参数验证失败: %v", err))
+		return
+	}
+
+	tenantID, _ := middleware.GetTenant(c)
+	if err := tc.tenantService.SetMemberRoles(tenantID, req.UserID, req.Roles, currentActor(c)); err != nil {
+		respondTenantError(c, err, "设置租户成员角色")
+		return
+	}
+
+	response.OkWithData(c, "租户成员角色更新成功")
+}
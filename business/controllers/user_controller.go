@@ -3,14 +3,17 @@ package controllers
 import (
 	"net/http"
 	"strconv"
+	"time"
 
 	"errors"
 
 	"github.com/GZ-Alinx/autops/business/models"
 	"github.com/GZ-Alinx/autops/business/services"
 
+	"github.com/GZ-Alinx/autops/internal/database"
 	"github.com/GZ-Alinx/autops/internal/logger"
 	"github.com/GZ-Alinx/autops/internal/middleware"
+	"github.com/GZ-Alinx/autops/internal/password"
 	"github.com/GZ-Alinx/autops/internal/response"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -21,7 +24,7 @@ import (
 // @Description 用户密码修改请求参数
 type PasswordUpdateRequest struct {
 	OldPassword string `json:"old_password" binding:"required"`
-	NewPassword string `json:"new_password" binding:"required,min=6"`
+	NewPassword string `json:"new_password" binding:"required"`
 }
 
 // LoginRequest 登录请求结构体
@@ -35,7 +38,7 @@ type LoginRequest struct {
 // @Description 用户注册请求参数
 type RegisterRequest struct {
 	Username string  `json:"username" binding:"required"`
-	Password string  `json:"password" binding:"required,min=6"`
+	Password string  `json:"password" binding:"required"`
 	Email    string  `json:"email" binding:"required,email"`
 	Phone    *string `json:"phone"`
 	Nickname string  `json:"nickname"`
@@ -44,8 +47,49 @@ type RegisterRequest struct {
 // LoginResponse 登录响应结构体
 // @Description 用户登录响应数据
 type LoginResponse struct {
-	Token    string      `json:"token"`
-	UserInfo models.User `json:"user_info"`
+	Token        string      `json:"token"`
+	RefreshToken string      `json:"refresh_token"`
+	ExpiresAt    string      `json:"expires_at"`
+	UserInfo     models.User `json:"user"`
+}
+
+// RefreshRequest 刷新令牌请求结构体
+// @Description 刷新令牌请求参数
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// LogoutRequest 登出请求结构体
+// @Description 登出请求参数，refresh_token可选
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// LoginMFARequest 两步验证登录请求结构体
+// @Description 登录第二步请求参数，code为6位验证码或恢复码
+type LoginMFARequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required"`
+}
+
+// LoginMFAEnrollRequest 登录时绑定两步验证请求结构体
+// @Description 角色要求两步验证但尚未绑定时，使用挑战令牌获取密钥
+type LoginMFAEnrollRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+}
+
+// PasswordChangeRequest 登录时修改过期密码请求结构体
+// @Description 密码过期或被管理员重置后，使用挑战令牌设置新密码
+type PasswordChangeRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	NewPassword    string `json:"new_password" binding:"required"`
+}
+
+// PasswordResetRequest 管理员重置密码请求结构体
+// @Description must_change默认为true，用户下次登录必须修改密码
+type PasswordResetRequest struct {
+	NewPassword string `json:"new_password" binding:"required"`
+	MustChange  *bool  `json:"must_change"`
 }
 
 // ListResponse 列表响应结构体
@@ -62,20 +106,86 @@ type UpdateRequest struct {
 	Phone    *string `json:"phone"`
 	Nickname string  `json:"nickname"`
 	Avatar   string  `json:"avatar"`
-	Status   int     `json:"status" binding:"omitempty,oneof=0 1"`
+	Status   *int    `json:"status" binding:"omitempty,oneof=0 1 2 3 4"`
+}
+
+// UserStatusRequest 账号状态变更请求结构体
+// @Description status取值 0:禁用, 1:正常, 2:锁定, 3:待激活, 4:过期；valid_until为空表示长期有效
+type UserStatusRequest struct {
+	Status     *int       `json:"status" binding:"required,oneof=0 1 2 3 4"`
+	ValidUntil *time.Time `json:"valid_until"`
+	Reason     string     `json:"reason" binding:"max=255"`
 }
 
 type UserController struct {
-	userService services.UserService
+	userService   services.UserService
+	tokenService  services.TokenService
+	mfaService    services.MFAService
+	loginGuard    services.LoginGuard
+	authenticator services.Authenticator
 }
 
 // NewUserController 创建用户控制器实例
-func NewUserController(userService services.UserService) *UserController {
+func NewUserController(userService services.UserService, tokenService services.TokenService, mfaService services.MFAService, loginGuard services.LoginGuard, authenticator services.Authenticator) *UserController {
 	return &UserController{
-		userService: userService,
+		userService:   userService,
+		tokenService:  tokenService,
+		mfaService:    mfaService,
+		loginGuard:    loginGuard,
+		authenticator: authenticator,
 	}
 }
 
+// passwordErrorStatus 密码策略和历史校验失败返回400，其余返回500
+func passwordErrorStatus(err error) int {
+	var policyErr *password.PolicyError
+	if errors.As(err, &policyErr) || errors.Is(err, services.ErrPasswordReused) || errors.Is(err, services.ErrExternalPassword) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// clientInfo 当前请求的客户端信息
+func clientInfo(ctx *gin.Context) services.ClientInfo {
+	return services.ClientInfo{
+		IP:        ctx.ClientIP(),
+		UserAgent: ctx.Request.UserAgent(),
+	}
+}
+
+// checkAccountStatus 校验账号状态允许登录，不允许时返回403
+func (uc *UserController) checkAccountStatus(ctx *gin.Context, user *models.User) bool {
+	err := uc.userService.CheckAccountStatus(user)
+	if err == nil {
+		return true
+	}
+
+	var statusErr *services.AccountStatusError
+	if errors.As(err, &statusErr) {
+		logger.Logger.Warn("用户登录失败: 账号不可用", zap.String("username", user.Username), zap.Int("status", statusErr.Status))
+		response.Fail(ctx, http.StatusForbidden, err)
+		return false
+	}
+	logger.Logger.Error("用户登录失败: 校验账号状态出错", zap.String("username", user.Username), zap.Error(err))
+	response.Fail(ctx, http.StatusInternalServerError, errors.New("登录失败，请稍后重试"))
+	return false
+}
+
+// checkLoginGuard 检查登录是否被锁定，锁定时返回429并设置Retry-After
+func (uc *UserController) checkLoginGuard(ctx *gin.Context, username string) bool {
+	err := uc.loginGuard.Check(username, ctx.ClientIP())
+	if err == nil {
+		return true
+	}
+
+	var locked *services.LoginLockedError
+	if errors.As(err, &locked) {
+		ctx.Header("Retry-After", strconv.Itoa(int(locked.RetryAfter.Seconds())+1))
+	}
+	response.Fail(ctx, http.StatusTooManyRequests, err)
+	return false
+}
+
 // @Summary 用户登录
 // @Description 用户登录获取JWT令牌
 // @Tags 用户管理
@@ -104,34 +214,358 @@ func (uc *UserController) Login(ctx *gin.Context) {
 
 	logger.Logger.Info("用户登录参数验证通过", zap.String("username", req.Username))
 
-	user, err := uc.userService.GetUserByUsername(req.Username)
+	if !uc.checkLoginGuard(ctx, req.Username) {
+		return
+	}
+
+	// 按配置依次使用LDAP、本地账号等认证源校验密码
+	result, err := uc.authenticator.Authenticate(req.Username, req.Password)
 	if err != nil {
-		logger.Logger.Error("获取用户失败", zap.Error(err))
-		response.Fail(ctx, http.StatusUnauthorized, errors.New("用户名或密码错误"))
+		if errors.Is(err, services.ErrInvalidCredentials) {
+			logger.Logger.Warn("用户登录失败: 用户名或密码错误", zap.String("username", req.Username))
+			uc.loginGuard.RecordFailure(req.Username, ctx.ClientIP())
+			response.Fail(ctx, http.StatusUnauthorized, errors.New("用户名或密码错误"))
+			return
+		}
+		logger.Logger.Error("用户登录失败: 认证出错", zap.String("username", req.Username), zap.Error(err))
+		response.Fail(ctx, http.StatusInternalServerError, errors.New("登录失败，请稍后重试"))
 		return
 	}
+	uc.completeLogin(ctx, result)
+}
 
-	if !uc.userService.VerifyPassword(user, req.Password) {
-		response.Fail(ctx, http.StatusUnauthorized, errors.New("用户名或密码错误"))
+// completeLogin 认证通过后的后续步骤：同步策略、两步验证、强制修改密码，最后签发令牌
+func (uc *UserController) completeLogin(ctx *gin.Context, result *services.AuthResult) {
+	user := result.User
+
+	// 外部认证源同步了角色时刷新该用户的Casbin规则
+	if result.RolesChanged {
+		if err := database.SyncCasbinPolicyScope(database.ScopeUsers(user.Username)); err != nil {
+			logger.Logger.Error("同步Casbin策略失败", zap.Error(err))
+		}
+	}
+
+	// 禁用、锁定、待激活或已过期的账号不能登录
+	if !uc.checkAccountStatus(ctx, user) {
+		return
+	}
+
+	// 已启用两步验证，返回挑战令牌等待提交验证码
+	if user.MFAEnabled {
+		uc.respondChallenge(ctx, user, middleware.PurposeMFA, nil)
+		return
+	}
+
+	// 角色要求两步验证但尚未绑定，必须先完成绑定
+	if uc.mfaService.RequiredByRole(user) {
+		uc.respondChallenge(ctx, user, middleware.PurposeMFAEnroll, nil)
+		return
+	}
+
+	uc.respondTokens(ctx, user, nil)
+}
+
+// respondChallenge 返回登录下一步的挑战令牌，recoveryCodes为刚完成绑定时生成的恢复码
+func (uc *UserController) respondChallenge(ctx *gin.Context, user *models.User, purpose string, recoveryCodes []string) {
+	challenge, err := uc.tokenService.IssueChallenge(user, purpose)
+	if err != nil {
+		logger.Logger.Error("生成挑战令牌失败", zap.Error(err))
+		response.Fail(ctx, http.StatusInternalServerError, errors.New("生成令牌失败"))
+		return
+	}
+
+	logger.Logger.Info("用户密码验证通过，等待两步验证", zap.Uint("userID", user.ID), zap.String("purpose", purpose))
+
+	data := gin.H{"challenge_token": challenge}
+	switch purpose {
+	case middleware.PurposeMFAEnroll:
+		data["mfa_enroll_required"] = true
+	case middleware.PurposePasswordChange:
+		data["password_change_required"] = true
+	default:
+		data["mfa_required"] = true
+	}
+	if len(recoveryCodes) > 0 {
+		data["recovery_codes"] = recoveryCodes
+	}
+	response.Success(ctx, data)
+}
+
+// respondTokens 签发访问令牌和刷新令牌并返回登录结果
+func (uc *UserController) respondTokens(ctx *gin.Context, user *models.User, recoveryCodes []string) {
+	// 两步验证或修改密码期间账号可能已被停用
+	if !uc.checkAccountStatus(ctx, user) {
 		return
 	}
 
-	// 生成JWT令牌
-	token, err := middleware.GenerateToken(strconv.Itoa(int(user.ID)), user.Username)
+	// 密码过期或被要求修改时，先修改密码再签发令牌
+	if uc.userService.PasswordChangeRequired(user) {
+		uc.respondChallenge(ctx, user, middleware.PurposePasswordChange, recoveryCodes)
+		return
+	}
+
+	// 生成访问令牌和刷新令牌
+	pair, err := uc.tokenService.IssueTokens(user, clientInfo(ctx))
 	if err != nil {
 		logger.Logger.Error("生成令牌失败", zap.Error(err))
 		response.Fail(ctx, http.StatusInternalServerError, errors.New("生成令牌失败"))
 		return
 	}
 
+	uc.loginGuard.RecordSuccess(user.Username)
 	logger.Logger.Info("用户登录成功", zap.Uint("userID", user.ID), zap.String("username", user.Username))
 
+	data := gin.H{
+		"token":         pair.AccessToken,
+		"refresh_token": pair.RefreshToken,
+		"expires_at":    pair.ExpiresAt,
+		"user":          user,
+	}
+	if len(recoveryCodes) > 0 {
+		data["recovery_codes"] = recoveryCodes
+	}
+	response.Success(ctx, data)
+}
+
+// @Summary 两步验证登录
+// @Description 提交挑战令牌和TOTP验证码（或恢复码）完成登录；绑定流程中提交验证码即确认绑定并返回恢复码
+// @Tags 用户管理
+// @Accept json
+// @Produce json
+// @Param body body LoginMFARequest true "挑战令牌和验证码"
+// @Success 200 {object} response.Response{data=LoginResponse}
+// @Failure 400 {object} response.Response
+// @Failure 401 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /user/login/mfa [post]
+// LoginMFA 两步验证登录
+func (uc *UserController) LoginMFA(ctx *gin.Context) {
+	var req LoginMFARequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		logger.Logger.Warn("两步验证登录失败: 请求参数验证失败", zap.Error(err))
+		response.Fail(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	purpose := middleware.PurposeMFA
+	claims, user, err := uc.tokenService.ParseChallenge(req.ChallengeToken, purpose)
+	if errors.Is(err, middleware.ErrInvalidChallenge) {
+		purpose = middleware.PurposeMFAEnroll
+		claims, user, err = uc.tokenService.ParseChallenge(req.ChallengeToken, purpose)
+	}
+	if err != nil {
+		if errors.Is(err, middleware.ErrInvalidChallenge) {
+			response.Fail(ctx, http.StatusUnauthorized, err)
+			return
+		}
+		logger.Logger.Error("校验挑战令牌失败", zap.Error(err))
+		response.Fail(ctx, http.StatusInternalServerError, errors.New("两步验证失败"))
+		return
+	}
+
+	// 验证码同样计入失败次数，防止暴力猜测
+	if !uc.checkLoginGuard(ctx, user.Username) {
+		return
+	}
+
+	var recoveryCodes []string
+	if purpose == middleware.PurposeMFAEnroll {
+		recoveryCodes, err = uc.mfaService.ConfirmEnrollment(user, req.Code)
+	} else {
+		err = uc.mfaService.Verify(user, req.Code)
+	}
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidMFACode) || errors.Is(err, services.ErrMFANotEnrolling) {
+			logger.Logger.Warn("两步验证登录失败", zap.Uint("userID", user.ID), zap.Error(err))
+			uc.loginGuard.RecordFailure(user.Username, ctx.ClientIP())
+			response.Fail(ctx, http.StatusUnauthorized, err)
+			return
+		}
+		logger.Logger.Error("两步验证登录失败", zap.Uint("userID", user.ID), zap.Error(err))
+		response.Fail(ctx, http.StatusInternalServerError, errors.New("两步验证失败"))
+		return
+	}
+
+	if err := uc.tokenService.CompleteChallenge(claims); err != nil {
+		logger.Logger.Error("挑战令牌失效处理失败", zap.Uint("userID", user.ID), zap.Error(err))
+		response.Fail(ctx, http.StatusInternalServerError, errors.New("两步验证失败"))
+		return
+	}
+
+	uc.respondTokens(ctx, user, recoveryCodes)
+}
+
+// @Summary 登录时绑定两步验证
+// @Description 角色要求两步验证但尚未绑定时，使用挑战令牌获取TOTP密钥和二维码内容
+// @Tags 用户管理
+// @Accept json
+// @Produce json
+// @Param body body LoginMFAEnrollRequest true "挑战令牌"
+// @Success 200 {object} response.Response{data=services.MFAEnrollment}
+// @Failure 400 {object} response.Response
+// @Failure 401 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /user/login/mfa/enroll [post]
+// LoginMFAEnroll 登录时绑定两步验证
+func (uc *UserController) LoginMFAEnroll(ctx *gin.Context) {
+	var req LoginMFAEnrollRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response.Fail(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	_, user, err := uc.tokenService.ParseChallenge(req.ChallengeToken, middleware.PurposeMFAEnroll)
+	if err != nil {
+		if errors.Is(err, middleware.ErrInvalidChallenge) {
+			response.Fail(ctx, http.StatusUnauthorized, err)
+			return
+		}
+		response.Fail(ctx, http.StatusInternalServerError, errors.New("获取两步验证密钥失败"))
+		return
+	}
+
+	enrollment, err := uc.mfaService.BeginEnrollment(user)
+	if err != nil {
+		if errors.Is(err, services.ErrMFAAlreadyEnabled) {
+			response.Fail(ctx, http.StatusBadRequest, err)
+			return
+		}
+		response.Fail(ctx, http.StatusInternalServerError, errors.New("获取两步验证密钥失败"))
+		return
+	}
+
+	response.Success(ctx, enrollment)
+}
+
+// @Summary 登录时修改密码
+// @Description 密码过期或被管理员重置后，提交挑战令牌和新密码完成登录
+// @Tags 用户管理
+// @Accept json
+// @Produce json
+// @Param body body PasswordChangeRequest true "挑战令牌和新密码"
+// @Success 200 {object} response.Response{data=LoginResponse}
+// @Failure 400 {object} response.Response
+// @Failure 401 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /user/password/change [post]
+// ChangeExpiredPassword 登录时修改密码
+func (uc *UserController) ChangeExpiredPassword(ctx *gin.Context) {
+	var req PasswordChangeRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response.Fail(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	claims, user, err := uc.tokenService.ParseChallenge(req.ChallengeToken, middleware.PurposePasswordChange)
+	if err != nil {
+		if errors.Is(err, middleware.ErrInvalidChallenge) {
+			response.Fail(ctx, http.StatusUnauthorized, err)
+			return
+		}
+		logger.Logger.Error("校验挑战令牌失败", zap.Error(err))
+		response.Fail(ctx, http.StatusInternalServerError, errors.New("修改密码失败"))
+		return
+	}
+
+	if err := uc.userService.UpdatePassword(user, req.NewPassword); err != nil {
+		logger.Logger.Warn("登录时修改密码失败", zap.Uint("userID", user.ID), zap.Error(err))
+		response.Fail(ctx, passwordErrorStatus(err), err)
+		return
+	}
+
+	if err := uc.tokenService.CompleteChallenge(claims); err != nil {
+		logger.Logger.Error("挑战令牌失效处理失败", zap.Uint("userID", user.ID), zap.Error(err))
+		response.Fail(ctx, http.StatusInternalServerError, errors.New("修改密码失败"))
+		return
+	}
+
+	logger.Logger.Info("登录时修改密码成功", zap.Uint("userID", user.ID))
+	uc.respondTokens(ctx, user, nil)
+}
+
+// @Summary 刷新令牌
+// @Description 使用刷新令牌换取新的访问令牌，旧刷新令牌随即失效；密码过期或被要求修改时返回修改密码的challenge_token
+// @Tags 用户管理
+// @Accept json
+// @Produce json
+// @Param body body RefreshRequest true "刷新令牌"
+// @Success 200 {object} response.Response{data=LoginResponse}
+// @Failure 400 {object} response.Response
+// @Failure 401 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /user/refresh [post]
+// Refresh 刷新令牌
+func (uc *UserController) Refresh(ctx *gin.Context) {
+	var req RefreshRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		logger.Logger.Warn("刷新令牌失败: 请求参数验证失败", zap.Error(err))
+		response.Fail(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	pair, user, err := uc.tokenService.Refresh(req.RefreshToken, clientInfo(ctx))
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidRefreshToken) {
+			logger.Logger.Warn("刷新令牌失败: 刷新令牌无效")
+			response.Fail(ctx, http.StatusUnauthorized, err)
+			return
+		}
+		// 密码过期或被管理员要求修改时，与登录一样返回修改密码的挑战令牌
+		if errors.Is(err, services.ErrPasswordChangeRequired) {
+			uc.respondChallenge(ctx, user, middleware.PurposePasswordChange, nil)
+			return
+		}
+		var statusErr *services.AccountStatusError
+		if errors.As(err, &statusErr) {
+			logger.Logger.Warn("刷新令牌失败: 账号不可用", zap.Int("status", statusErr.Status))
+			response.Fail(ctx, http.StatusForbidden, err)
+			return
+		}
+		logger.Logger.Error("刷新令牌失败", zap.Error(err))
+		response.Fail(ctx, http.StatusInternalServerError, errors.New("刷新令牌失败"))
+		return
+	}
+
 	response.Success(ctx, gin.H{
-		"token": token,
-		"user":  user,
+		"token":         pair.AccessToken,
+		"refresh_token": pair.RefreshToken,
+		"expires_at":    pair.ExpiresAt,
+		"user":          user,
 	})
 }
 
+// @Summary 用户登出
+// @Description 吊销当前访问令牌及其刷新令牌
+// @Tags 用户管理
+// @Accept json
+// @Produce json
+// @Param body body LogoutRequest false "刷新令牌（可选）"
+// @Success 200 {object} response.Response{data=string}
+// @Failure 401 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Security BearerAuth
+// @Router /user/logout [post]
+// Logout 用户登出
+func (uc *UserController) Logout(ctx *gin.Context) {
+	claims, ok := middleware.GetClaims(ctx)
+	if !ok {
+		response.Unauthorized(ctx, errors.New("未登录"))
+		return
+	}
+
+	// 请求体可选，解析失败时仅吊销当前令牌
+	var req LogoutRequest
+	_ = ctx.ShouldBindJSON(&req)
+
+	if err := uc.tokenService.Logout(claims, req.RefreshToken); err != nil {
+		logger.Logger.Error("用户登出失败", zap.String("username", claims.Username), zap.Error(err))
+		response.Fail(ctx, http.StatusInternalServerError, errors.New("登出失败"))
+		return
+	}
+
+	response.Success(ctx, "登出成功")
+}
+
 // @Summary 用户添加
 // @Description 创建新用户账号
 // @Tags 用户管理
@@ -146,7 +580,7 @@ func (uc *UserController) Login(ctx *gin.Context) {
 func (uc *UserController) Register(ctx *gin.Context) {
 	var req struct {
 		Username string  `json:"username" binding:"required"`
-		Password string  `json:"password" binding:"required,min=6"`
+		Password string  `json:"password" binding:"required"`
 		Email    string  `json:"email" binding:"required,email"`
 		Phone    *string `json:"phone"`
 	}
@@ -172,7 +606,7 @@ func (uc *UserController) Register(ctx *gin.Context) {
 	user, err := uc.userService.CreateUser(req.Username, req.Password, req.Email, phone)
 	if err != nil {
 		logger.Logger.Error("创建用户失败", zap.Error(err))
-		response.Fail(ctx, http.StatusInternalServerError, err)
+		response.Fail(ctx, passwordErrorStatus(err), err)
 		return
 	}
 
@@ -282,9 +716,6 @@ func (uc *UserController) UpdateUser(ctx *gin.Context) {
 	if req.Avatar != "" {
 		user.Avatar = req.Avatar
 	}
-	if req.Status != 0 {
-		user.Status = req.Status
-	}
 
 	if err := uc.userService.UpdateUser(user); err != nil {
 		logger.Logger.Error("更新用户失败", zap.Error(err))
@@ -292,6 +723,14 @@ func (uc *UserController) UpdateUser(ctx *gin.Context) {
 		return
 	}
 
+	// 状态变更需要审计并使会话失效，有效期保持不变
+	if req.Status != nil && *req.Status != user.Status {
+		change := services.UserStatusChange{Status: *req.Status, ValidUntil: user.ValidUntil, Reason: user.StatusReason}
+		if !uc.changeStatus(ctx, user, change) {
+			return
+		}
+	}
+
 	response.Success(ctx, user)
 }
 
@@ -333,6 +772,115 @@ func (uc *UserController) DeleteUser(ctx *gin.Context) {
 	response.Success(ctx, "密码修改成功")
 }
 
+// @Summary 解除登录锁定
+// @Description 清除用户因连续登录失败产生的锁定和退避计数，可通过ip参数同时解除客户端IP的锁定
+// @Tags 用户管理
+// @Accept json
+// @Produce json
+// @Param id path int true "用户ID"
+// @Param ip query string false "同时解除锁定的客户端IP"
+// @Success 200 {object} response.Response
+// @Failure 400 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Security BearerAuth
+// @Router /users/{id}/lockout [delete]
+// UnlockUser 解除登录锁定
+func (uc *UserController) UnlockUser(ctx *gin.Context) {
+	idStr := ctx.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		logger.Logger.Warn("解除登录锁定失败: 无效的用户ID", zap.String("idStr", idStr), zap.Error(err))
+		response.Fail(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	user, err := uc.userService.GetUserByID(uint(id))
+	if err != nil {
+		response.Fail(ctx, http.StatusNotFound, errors.New("用户不存在"))
+		return
+	}
+
+	if err := uc.loginGuard.Unlock(user.Username, ctx.Query("ip")); err != nil {
+		logger.Logger.Error("解除登录锁定失败", zap.Uint64("id", id), zap.Error(err))
+		response.Fail(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
+	logger.GetBusinessLogger().Info("解除登录锁定成功",
+		zap.Uint64("id", id),
+		zap.String("username", user.Username),
+		zap.String("operator", ctx.GetString("username")))
+	response.Success(ctx, "解除锁定成功")
+}
+
+// changeStatus 变更账号状态，账号不再可用时吊销全部会话，失败时已写入响应
+func (uc *UserController) changeStatus(ctx *gin.Context, user *models.User, change services.UserStatusChange) bool {
+	actor := currentActor(ctx)
+	if err := uc.userService.ChangeStatus(user, change, actor); err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidUserStatus),
+			errors.Is(err, services.ErrValidUntilPassed),
+			errors.Is(err, services.ErrSelfDeactivate):
+			response.Fail(ctx, http.StatusBadRequest, err)
+		default:
+			logger.Logger.Error("变更账号状态失败", zap.Uint("userID", user.ID), zap.Error(err))
+			response.Fail(ctx, http.StatusInternalServerError, err)
+		}
+		return false
+	}
+
+	if user.EffectiveStatus(time.Now()) != models.UserStatusActive {
+		if err := uc.tokenService.RevokeAllForUser(user.ID, actor.ID); err != nil {
+			response.Fail(ctx, http.StatusInternalServerError, err)
+			return false
+		}
+	}
+	return true
+}
+
+// @Summary 变更账号状态
+// @Description 设置账号状态（禁用、正常、锁定、待激活、过期）和有效期；账号不再可用时立即吊销全部会话，变更写入审计日志
+// @Tags 用户管理
+// @Accept json
+// @Produce json
+// @Param id path int true "用户ID"
+// @Param body body UserStatusRequest true "状态和有效期"
+// @Success 200 {object} response.Response{data=models.User}
+// @Failure 400 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Security BearerAuth
+// @Router /users/{id}/status [put]
+// UpdateUserStatus 变更账号状态
+func (uc *UserController) UpdateUserStatus(ctx *gin.Context) {
+	idStr := ctx.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		logger.Logger.Warn("变更账号状态失败: 无效的用户ID", zap.String("idStr", idStr), zap.Error(err))
+		response.Fail(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	var req UserStatusRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response.Fail(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	user, err := uc.userService.GetUserByID(uint(id))
+	if err != nil {
+		response.Fail(ctx, http.StatusNotFound, errors.New("用户不存在"))
+		return
+	}
+
+	change := services.UserStatusChange{Status: *req.Status, ValidUntil: req.ValidUntil, Reason: req.Reason}
+	if !uc.changeStatus(ctx, user, change) {
+		return
+	}
+	response.Success(ctx, user)
+}
+
 // @Summary 用户列表
 // @Description 分页获取用户列表
 // @Tags 用户管理
@@ -368,7 +916,9 @@ func (c *UserController) ListUsers(ctx *gin.Context) {
 
 	logger.Logger.Info("分页参数验证通过", zap.Int("page", page), zap.Int("pageSize", pageSize))
 
-	users, total, err := c.userService.ListUsers(page, pageSize)
+	// 非默认租户只列出租户成员，角色为成员在该租户内的角色
+	tenantID, _ := middleware.GetTenant(ctx)
+	users, total, err := c.userService.ListUsers(tenantID, page, pageSize)
 	if err != nil {
 		logger.Logger.Error("获取用户列表失败", zap.Error(err))
 		response.Fail(ctx, http.StatusInternalServerError, err)
@@ -442,10 +992,71 @@ func (uc *UserController) UpdatePassword(ctx *gin.Context) {
 	logger.Logger.Info("开始更新密码")
 	if err := uc.userService.UpdatePassword(user, req.NewPassword); err != nil {
 		logger.Logger.Error("修改密码失败: 更新密码出错", zap.Uint("userID", user.ID), zap.Error(err))
-		response.Fail(ctx, http.StatusInternalServerError, err)
+		response.Fail(ctx, passwordErrorStatus(err), err)
 		return
 	}
 
 	logger.Logger.Info("密码更新成功", zap.Uint("userID", user.ID))
 	response.Success(ctx, "密码修改成功")
 }
+
+// @Summary 重置用户密码
+// @Description 管理员直接为用户设置新密码（同样需符合密码策略），默认要求用户下次登录时修改并吊销其全部会话
+// @Tags 用户管理
+// @Accept json
+// @Produce json
+// @Param id path int true "用户ID"
+// @Param body body PasswordResetRequest true "新密码"
+// @Success 200 {object} response.Response{data=string}
+// @Failure 400 {object} response.Response{data=string}
+// @Failure 404 {object} response.Response{data=string}
+// @Failure 500 {object} response.Response{data=string}
+// @Security BearerAuth
+// @Router /users/{id}/password/reset [put]
+// ResetPassword 管理员重置密码
+func (uc *UserController) ResetPassword(ctx *gin.Context) {
+	idStr := ctx.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		logger.Logger.Warn("重置密码失败: 无效的用户ID", zap.String("idStr", idStr), zap.Error(err))
+		response.Fail(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	var req PasswordResetRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		logger.Logger.Warn("重置密码失败: 请求参数验证失败", zap.Error(err))
+		response.Fail(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	user, err := uc.userService.GetUserByID(uint(id))
+	if err != nil {
+		response.Fail(ctx, http.StatusNotFound, errors.New("用户不存在"))
+		return
+	}
+
+	mustChange := true
+	if req.MustChange != nil {
+		mustChange = *req.MustChange
+	}
+	if err := uc.userService.ResetPassword(user, req.NewPassword, mustChange); err != nil {
+		logger.Logger.Error("重置密码失败", zap.Uint("userID", user.ID), zap.Error(err))
+		response.Fail(ctx, passwordErrorStatus(err), err)
+		return
+	}
+
+	// 要求用户修改密码时吊销其全部会话和刷新令牌，旧登录不能绕过修改密码
+	if mustChange {
+		if err := uc.tokenService.RevokeAllForUser(user.ID, currentActor(ctx).ID); err != nil {
+			response.Fail(ctx, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	logger.GetBusinessLogger().Info("管理员重置用户密码",
+		zap.Uint("userID", user.ID),
+		zap.String("operator", ctx.GetString("username")),
+		zap.Bool("mustChange", mustChange))
+	response.Success(ctx, "密码重置成功")
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// APIToken 个人访问令牌/服务账号令牌（仅保存令牌哈希）
+type APIToken struct {
+	ID         uint       `gorm:"primarykey" json:"id"`
+	Name       string     `gorm:"size:100;not null" json:"name"`         // 令牌名称，便于识别用途
+	UserID     uint       `gorm:"index;not null" json:"user_id"`         // 令牌所属用户或服务账号
+	Prefix     string     `gorm:"size:20" json:"prefix"`                 // 令牌明文前缀，用于展示和识别
+	TokenHash  string     `gorm:"size:64;uniqueIndex;not null" json:"-"` // 令牌SHA-256哈希
+	Scopes     string     `gorm:"size:500" json:"scopes"`                // 限定的角色列表（逗号分隔），为空表示继承所属用户全部角色
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`                  // 过期时间，为空表示永不过期
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP string     `gorm:"size:64" json:"last_used_ip,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedBy  uint       `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// ScopeList 返回令牌限定的角色列表
+func (t *APIToken) ScopeList() []string {
+	if t.Scopes == "" {
+		return nil
+	}
+	var scopes []string
+	for _, scope := range strings.Split(t.Scopes, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+// IsActive 令牌是否可用（未吊销且未过期）
+func (t *APIToken) IsActive(now time.Time) bool {
+	if t.RevokedAt != nil {
+		return false
+	}
+	return t.ExpiresAt == nil || now.Before(*t.ExpiresAt)
+}
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// 审计事件类型
+const (
+	AuditUserStatusChange   = "user.status.change"       // 账号状态变更
+	AuditImpersonationStart = "user.impersonation.start" // 开始模拟登录
+	AuditImpersonationEnd   = "user.impersonation.end"   // 结束模拟登录
+	AuditTenantMemberChange = "tenant.member.change"     // 租户成员角色变更
+	AuditPolicyImport       = "policy.import"            // 导入权限配置
+	AuditElevationRequest   = "role.elevation.request"   // 申请临时提权
+	AuditElevationApprove   = "role.elevation.approve"   // 批准临时提权
+	AuditElevationReject    = "role.elevation.reject"    // 拒绝临时提权
+	AuditElevationCancel    = "role.elevation.cancel"    // 撤回临时提权申请
+	AuditRoleGrant          = "role.grant"               // 管理员直接临时授权
+	AuditRoleGrantExpire    = "role.grant.expire"        // 临时授权到期回收
+	AuditChangeSubmit       = "change.submit"            // 提交待审批变更
+	AuditChangeApprove      = "change.approve"           // 批准变更
+	AuditChangeReject       = "change.reject"            // 拒绝变更
+	AuditChangeCancel       = "change.cancel"            // 撤回变更
+	AuditChangeExecute      = "change.execute"           // 执行已批准的变更
+)
+
+// AuditLog 审计日志，记录安全相关的操作，只增不改
+type AuditLog struct {
+	ID         uint      `gorm:"primarykey" json:"id"`
+	ActorID    uint      `gorm:"index" json:"actor_id"`                // 操作人ID，0表示系统
+	ActorName  string    `gorm:"size:50" json:"actor_name"`            // 操作人用户名
+	OnBehalfOf uint      `gorm:"index" json:"on_behalf_of,omitempty"`  // 模拟登录期间的操作，记录被模拟的用户ID
+	Action     string    `gorm:"size:64;index;not null" json:"action"` // 事件类型，如user.status.change
+	TargetType string    `gorm:"size:32;index" json:"target_type"`     // 操作对象类型，如user
+	TargetID   string    `gorm:"size:64;index" json:"target_id"`       // 操作对象ID
+	Detail     string    `gorm:"type:text" json:"detail"`              // 事件详情（JSON）
+	IP         string    `gorm:"size:64" json:"ip"`                    // 操作人IP
+	CreatedAt  time.Time `gorm:"index" json:"created_at"`
+}
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// 变更状态
+const (
+	ChangePending   = "pending"   // 待审批
+	ChangeRejected  = "rejected"  // 已拒绝
+	ChangeCancelled = "cancelled" // 申请人已撤回
+	ChangeExpired   = "expired"   // 超过有效期未审批
+	ChangeApproved  = "approved"  // 已批准，正在执行
+	ChangeExecuted  = "executed"  // 已执行，接口返回成功
+	ChangeFailed    = "failed"    // 已执行，接口返回失败
+)
+
+// 审批结果
+const (
+	DecisionApprove = "approve"
+	DecisionReject  = "reject"
+)
+
+// ChangeRequest 待审批变更：匹配审批规则的请求通过权限检查后不立即执行，保存请求内容，
+// 达到需要的批准人数后以申请人的身份重新执行
+type ChangeRequest struct {
+	ID                uint             `gorm:"primarykey" json:"id"`
+	RequesterID       uint             `gorm:"index;not null" json:"requester_id"`        // 申请人
+	Method            string           `gorm:"size:10;not null" json:"method"`            // 请求方法
+	Path              string           `gorm:"size:255;not null" json:"path"`             // 请求路径
+	Query             string           `gorm:"size:1024" json:"query,omitempty"`          // 查询参数
+	ContentType       string           `gorm:"size:100" json:"content_type,omitempty"`    // 请求体类型
+	Body              string           `gorm:"type:text" json:"body,omitempty"`           // 请求体，密码、令牌等敏感字段已替换为******
+	SealedBody        string           `gorm:"type:mediumtext" json:"-"`                  // 包含敏感字段时加密保存的原始请求体，执行时解密
+	RedactedFields    string           `gorm:"size:255" json:"redacted_fields,omitempty"` // 请求体中被替换的敏感字段（逗号分隔）
+	Tenant            string           `gorm:"size:64" json:"tenant"`                     // 请求的租户
+	IP                string           `gorm:"size:64" json:"ip"`                         // 申请人IP，执行时用于ip条件
+	AuthType          string           `gorm:"size:20" json:"auth_type,omitempty"`        // 提交时的认证方式：jwt或api_token
+	APITokenID        uint             `json:"api_token_id,omitempty"`                    // 通过API令牌提交时的令牌，执行时令牌必须仍然有效
+	TokenScopes       string           `gorm:"size:500" json:"token_scopes,omitempty"`    // 提交时API令牌限定的角色（逗号分隔），执行时同样只使用这些角色
+	Reason            string           `gorm:"size:255" json:"reason,omitempty"`          // 变更原因，来自X-Change-Reason请求头
+	Description       string           `gorm:"size:255" json:"description,omitempty"`     // 审批规则的说明
+	ApproverRoles     string           `gorm:"size:255;not null" json:"approver_roles"`   // 可以审批的角色（逗号分隔）
+	RequiredApprovals int              `gorm:"not null" json:"required_approvals"`        // 需要的批准人数
+	Status            string           `gorm:"size:20;index;not null" json:"status"`      // 见变更状态
+	ExpiresAt         time.Time        `gorm:"index" json:"expires_at"`                   // 审批截止时间
+	ExecutedAt        *time.Time       `json:"executed_at,omitempty"`                     // 执行时间
+	ResultStatus      int              `json:"result_status,omitempty"`                   // 执行时接口返回的HTTP状态码
+	ResultBody        string           `gorm:"type:text" json:"result_body,omitempty"`    // 执行时接口返回的内容，敏感字段已替换为******
+	Requester         User             `gorm:"foreignKey:RequesterID" json:"requester,omitempty"`
+	Decisions         []ChangeDecision `gorm:"foreignKey:ChangeRequestID" json:"decisions,omitempty"`
+	CreatedAt         time.Time        `json:"created_at"`
+	UpdatedAt         time.Time        `json:"updated_at"`
+}
+
+// ApproverRoleList 返回可以审批的角色列表
+func (r *ChangeRequest) ApproverRoleList() []string {
+	var roles []string
+	for _, role := range strings.Split(r.ApproverRoles, ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// TokenScopeList 返回提交时API令牌限定的角色列表
+func (r *ChangeRequest) TokenScopeList() []string {
+	var scopes []string
+	for _, scope := range strings.Split(r.TokenScopes, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+// ChangeDecision 审批记录，每个审批人对同一变更只能审批一次
+type ChangeDecision struct {
+	ID              uint      `gorm:"primarykey" json:"id"`
+	ChangeRequestID uint      `gorm:"uniqueIndex:idx_change_approver;not null" json:"change_request_id"`
+	ApproverID      uint      `gorm:"uniqueIndex:idx_change_approver;not null" json:"approver_id"`
+	Decision        string    `gorm:"size:10;not null" json:"decision"` // approve或reject
+	Comment         string    `gorm:"size:255" json:"comment,omitempty"`
+	Approver        User      `gorm:"foreignKey:ApproverID" json:"approver,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+}
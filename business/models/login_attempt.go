@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+// LoginAttempt 登录失败计数（按用户名或客户端IP统计）
+type LoginAttempt struct {
+	Identifier  string     `gorm:"primarykey;size:191" json:"identifier"` // user:<用户名> 或 ip:<客户端IP>
+	Failures    int        `gorm:"not null;default:0" json:"failures"`    // 当前窗口内的失败次数
+	LockCount   int        `gorm:"not null;default:0" json:"lock_count"`  // 累计锁定次数，用于指数退避
+	WindowStart time.Time  `json:"window_start"`                          // 当前统计窗口开始时间
+	LockedUntil *time.Time `gorm:"index" json:"locked_until,omitempty"`   // 锁定截止时间
+	UpdatedAt   time.Time  `gorm:"index" json:"updated_at"`
+}
+
+// IsLocked 是否处于锁定状态
+func (a *LoginAttempt) IsLocked(now time.Time) bool {
+	return a.LockedUntil != nil && a.LockedUntil.After(now)
+}
@@ -9,9 +9,11 @@ import (
 // Permission 权限模型
 type Permission struct {
 	ID          uint           `gorm:"primarykey" json:"id"`
-	Resource    string         `gorm:"size:255;not null" json:"resource"` // API资源路径
-	Action      string         `gorm:"size:50;not null" json:"action"`    // HTTP方法
-	Description string         `gorm:"size:255" json:"description"`       // 权限描述
+	Resource    string         `gorm:"size:255;not null" json:"resource"`              // API资源路径
+	Action      string         `gorm:"size:50;not null" json:"action"`                 // HTTP方法
+	Description string         `gorm:"size:255" json:"description"`                    // 权限描述
+	Conditions  string         `gorm:"size:512;not null;default:''" json:"conditions"` // 属性条件表达式，为空时不限制，语法见internal/condition
+	Stale       bool           `gorm:"default:false" json:"stale"`                     // 自动注册时没有对应的路由
 	CreatedAt   time.Time      `json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `gorm:"index,softDelete:deleted_at" json:"deleted_at,omitempty"`
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// PolicyEvent 策略变更记录，自增ID即策略版本，各实例轮询比自己版本新的记录
+type PolicyEvent struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	Origin    string    `gorm:"size:100;not null" json:"origin"` // 发出变更的实例
+	Payload   string    `gorm:"type:text;not null" json:"payload"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+}
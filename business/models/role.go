@@ -11,6 +11,8 @@ type Role struct {
 	ID          uint      `gorm:"primarykey" json:"id"`
 	Name        string    `gorm:"size:50;uniqueIndex;not null" json:"name"` // 角色名称，如admin, editor
 	Description string    `gorm:"size:255" json:"description"`              // 角色描述
+	RequireMFA  bool      `gorm:"default:false" json:"require_mfa"`         // 拥有该角色的用户必须启用两步验证
+	OwnerID     *uint     `gorm:"index" json:"owner_id,omitempty"`          // 角色负责人，审批该角色的临时提权申请
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 	// DeletedAt 软删除字段
@@ -21,15 +23,38 @@ type Role struct {
 	DeletedAt   gorm.DeletedAt `gorm:"index,softDelete:deleted_at" json:"deleted_at,omitempty"`
 	Users       []User         `gorm:"many2many:user_roles;foreignKey:ID;joinForeignKey:RoleID;References:ID;joinReferences:UserID" json:"users,omitempty"`                   // 多对多关联用户
 	Permissions []Permission   `gorm:"many2many:role_permissions;foreignKey:ID;joinForeignKey:RoleID;References:ID;joinReferences:PermissionID" json:"permissions,omitempty"` // 多对多关联权限
+	Parents     []Role         `gorm:"many2many:role_parents;foreignKey:ID;joinForeignKey:RoleID;References:ID;joinReferences:ParentID" json:"parents,omitempty"`             // 父角色，继承父角色的全部权限
 }
 
-// UserRole 用户角色关联表
+// RoleParent 角色继承关系，RoleID继承ParentID的权限
+type RoleParent struct {
+	RoleID   uint `gorm:"primarykey" json:"role_id"`
+	ParentID uint `gorm:"primarykey" json:"parent_id"`
+}
+
+// UserRole 用户角色关联表；设置了有效期的为临时授权，只在[NotBefore, ExpiresAt)内生效，到期后由回收任务删除
 type UserRole struct {
 	UserID    uint           `gorm:"primarykey" json:"user_id"`
 	RoleID    uint           `gorm:"primarykey" json:"role_id"`
+	NotBefore *time.Time     `json:"not_before,omitempty"`              // 临时授权的生效时间，为空表示立即生效
+	ExpiresAt *time.Time     `gorm:"index" json:"expires_at,omitempty"` // 临时授权的到期时间，为空表示长期有效
+	Reason    string         `gorm:"size:255" json:"reason,omitempty"`  // 授权原因
 	User      User           `gorm:"foreignKey:UserID" json:"-"`
 	Role      Role           `gorm:"foreignKey:RoleID" json:"-"`
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
 }
+
+// Temporary 是否为临时授权
+func (ur *UserRole) Temporary() bool {
+	return ur.ExpiresAt != nil
+}
+
+// ActiveUserRoles 查询条件：只保留now时已生效且未到期的user_roles
+func ActiveUserRoles(now time.Time) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("user_roles.not_before IS NULL OR user_roles.not_before <= ?", now).
+			Where("user_roles.expires_at IS NULL OR user_roles.expires_at > ?", now)
+	}
+}
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// 临时提权申请状态
+const (
+	ElevationPending   = "pending"   // 待审批
+	ElevationApproved  = "approved"  // 已批准，已写入带有效期的用户角色
+	ElevationRejected  = "rejected"  // 已拒绝
+	ElevationCancelled = "cancelled" // 申请人已撤回
+)
+
+// RoleElevation 临时提权申请：用户申请在一段时间内拥有某个角色，角色负责人批准后写入带有效期的user_roles
+type RoleElevation struct {
+	ID            uint       `gorm:"primarykey" json:"id"`
+	UserID        uint       `gorm:"index;not null" json:"user_id"`            // 申请人
+	RoleID        uint       `gorm:"index;not null" json:"role_id"`            // 申请的角色
+	Reason        string     `gorm:"size:255;not null" json:"reason"`          // 申请原因，如值班处理的工单
+	Minutes       int        `gorm:"not null" json:"minutes"`                  // 申请的时长（分钟）
+	NotBefore     *time.Time `json:"not_before,omitempty"`                     // 期望的生效时间，为空表示批准后立即生效
+	Status        string     `gorm:"size:20;index;not null" json:"status"`     // pending、approved、rejected或cancelled
+	ReviewerID    *uint      `json:"reviewer_id,omitempty"`                    // 审批人
+	ReviewComment string     `gorm:"size:255" json:"review_comment,omitempty"` // 审批意见
+	ReviewedAt    *time.Time `json:"reviewed_at,omitempty"`                    // 审批时间
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`                     // 批准后授权的到期时间
+	User          User       `gorm:"foreignKey:UserID" json:"user,omitempty"`  // 申请人
+	Role          Role       `gorm:"foreignKey:RoleID" json:"role,omitempty"`  // 申请的角色
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
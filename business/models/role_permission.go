@@ -6,13 +6,28 @@ import (
 	"gorm.io/gorm"
 )
 
+// 角色权限的效果，同一请求同时匹配允许和拒绝时拒绝优先
+const (
+	EffectAllow = "allow" // 允许
+	EffectDeny  = "deny"  // 拒绝，用于从较宽的授权中排除特定资源
+)
+
 // RolePermission 角色权限关联模型
 type RolePermission struct {
 	RoleID       uint           `gorm:"primarykey" json:"role_id"`
 	PermissionID uint           `gorm:"primarykey" json:"permission_id"`
+	Effect       string         `gorm:"size:10;not null;default:allow" json:"effect"` // 效果：allow或deny
 	CreatedAt    time.Time      `json:"created_at"`
 	UpdatedAt    time.Time      `json:"updated_at"`
 	DeletedAt    gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
 	Role         Role           `gorm:"foreignKey:RoleID" json:"role,omitempty"`
 	Permission   Permission     `gorm:"foreignKey:PermissionID" json:"permission,omitempty"`
 }
+
+// Eft 返回关联的效果，未设置时为允许
+func (rp RolePermission) Eft() string {
+	if rp.Effect == EffectDeny {
+		return EffectDeny
+	}
+	return EffectAllow
+}
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// SessionSourceImpersonation 模拟登录会话的登录方式
+const SessionSourceImpersonation = "impersonation"
+
+// UserSession 用户登录会话，每次登录成功创建一条，刷新令牌轮换时沿用
+type UserSession struct {
+	ID         uint       `gorm:"primarykey" json:"id"`
+	SessionID  string     `gorm:"size:36;uniqueIndex;not null" json:"session_id"` // 会话ID，即访问令牌的sid声明和刷新令牌族ID
+	UserID     uint       `gorm:"index;not null" json:"user_id"`
+	AuthSource string     `gorm:"size:20" json:"auth_source"`  // 登录方式，如local、ldap、oidc、impersonation
+	AccessJTI  string     `gorm:"size:36" json:"access_jti"`   // 最近一次签发的访问令牌ID
+	IP         string     `gorm:"size:64" json:"ip"`           // 登录IP
+	UserAgent  string     `gorm:"size:255" json:"user_agent"`  // 登录时的User-Agent
+	LastSeenIP string     `gorm:"size:64" json:"last_seen_ip"` // 最近一次访问的IP
+	LastSeenAt time.Time  `json:"last_seen_at"`                // 最近一次访问时间，按间隔更新
+	ExpiresAt  time.Time  `gorm:"index" json:"expires_at"`     // 刷新令牌过期时间，过期后会话失效
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`        // 登出或被吊销的时间
+	RevokedBy  uint       `json:"revoked_by,omitempty"`        // 吊销操作人，0表示用户自己登出或系统吊销
+	// ImpersonatorID 模拟登录的发起人，0表示用户本人登录
+	ImpersonatorID uint      `gorm:"index" json:"impersonator_id,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// IsActive 会话是否有效（未吊销且未过期）
+func (s *UserSession) IsActive(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
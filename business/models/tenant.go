@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// 租户（Casbin域）
+const (
+	DefaultTenantCode = "default" // 默认租户，成员和角色即全局的用户角色（user_roles）
+	AllTenants        = "*"       // 对全部租户生效的策略域，用于角色权限和角色继承
+)
+
+// Tenant 租户（项目/团队），各租户的成员和角色相互隔离
+type Tenant struct {
+	ID          uint      `gorm:"primarykey" json:"id"`
+	Code        string    `gorm:"size:50;uniqueIndex;not null" json:"code"` // 租户标识，通过X-Tenant请求头或路径参数指定
+	Name        string    `gorm:"size:100;not null" json:"name"`
+	Description string    `gorm:"size:255" json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// TenantUserRole 用户在租户内的角色，默认租户使用user_roles
+type TenantUserRole struct {
+	TenantID  uint      `gorm:"primarykey" json:"tenant_id"`
+	UserID    uint      `gorm:"primarykey;index" json:"user_id"`
+	RoleID    uint      `gorm:"primarykey" json:"role_id"`
+	CreatedAt time.Time `json:"created_at"`
+	User      User      `gorm:"foreignKey:UserID" json:"-"`
+	Role      Role      `gorm:"foreignKey:RoleID" json:"-"`
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+)
+
+// RefreshToken 刷新令牌模型（仅保存令牌哈希）
+type RefreshToken struct {
+	ID         uint       `gorm:"primarykey" json:"id"`
+	UserID     uint       `gorm:"index;not null" json:"user_id"`
+	TokenHash  string     `gorm:"size:64;uniqueIndex;not null" json:"-"`   // 刷新令牌SHA-256哈希
+	FamilyID   string     `gorm:"size:36;index;not null" json:"family_id"` // 令牌族ID，同一次登录轮换产生的令牌共享
+	AccessJTI  string     `gorm:"size:36;index" json:"access_jti"`         // 与之配对的访问令牌ID
+	ExpiresAt  time.Time  `gorm:"index" json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	ReplacedBy *uint      `json:"replaced_by,omitempty"` // 轮换后的新令牌ID
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// RevokedToken 已吊销的访问令牌（按jti记录，过期后可清理）
+type RevokedToken struct {
+	JTI       string    `gorm:"primarykey;size:36" json:"jti"`
+	UserID    uint      `gorm:"index" json:"user_id"`
+	ExpiresAt time.Time `gorm:"index" json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PasswordResetToken 找回密码令牌（仅保存令牌哈希，一次性使用）
+type PasswordResetToken struct {
+	ID        uint       `gorm:"primarykey" json:"id"`
+	UserID    uint       `gorm:"index;not null" json:"user_id"`
+	TokenHash string     `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	ExpiresAt time.Time  `gorm:"index" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	RequestIP string     `gorm:"size:64" json:"request_ip"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// OIDCLoginState 单点登录发起时保存的state、nonce和PKCE校验码（一次性使用）
+type OIDCLoginState struct {
+	ID           uint      `gorm:"primarykey" json:"id"`
+	StateHash    string    `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	Nonce        string    `gorm:"size:128;not null" json:"-"`
+	CodeVerifier string    `gorm:"size:128;not null" json:"-"`
+	ExpiresAt    time.Time `gorm:"index" json:"expires_at"`
+	CreatedAt    time.Time `json:"created_at"`
+}
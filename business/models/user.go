@@ -6,18 +6,100 @@ import (
 	"gorm.io/gorm"
 )
 
+// 用户类型
+const (
+	UserTypeHuman   = "human"   // 普通用户，可通过密码登录
+	UserTypeService = "service" // 服务账号，只能通过API令牌访问
+)
+
+// 用户来源
+const (
+	UserSourceLocal = "local" // 本地账号，使用数据库中的密码登录
+	UserSourceLDAP  = "ldap"  // LDAP账号，首次登录时自动创建，密码由目录校验
+	UserSourceOIDC  = "oidc"  // OIDC单点登录账号，首次登录时自动创建，按ExternalID（sub）关联
+)
+
+// 账号状态
+const (
+	UserStatusDisabled = 0 // 已禁用，由管理员停用
+	UserStatusActive   = 1 // 正常
+	UserStatusLocked   = 2 // 已锁定（如疑似被盗），需管理员解锁
+	UserStatusPending  = 3 // 待激活，账号已创建但尚未启用
+	UserStatusExpired  = 4 // 已过期，超过有效期valid_until
+)
+
 // User 用户模型
 type User struct {
-	ID        uint           `gorm:"primarykey" json:"id"`
-	Username  string         `gorm:"size:50;uniqueIndex;not null" json:"username"`
-	Password  string         `gorm:"size:100;not null" json:"-"` // 密码不返回给前端
-	Email     string         `gorm:"size:100;uniqueIndex" json:"email"`
-	Phone     *string        `gorm:"size:20;uniqueIndex:idx_users_phone,uniqueWhere:phone IS NOT NULL" json:"phone,omitempty"`
-	Nickname  string         `gorm:"size:50" json:"nickname"`
-	Avatar    string         `gorm:"size:255" json:"avatar"`
-	Status    int            `gorm:"default:1" json:"status"` // 1:正常, 0:禁用
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
-	Roles     []Role         `gorm:"many2many:user_roles;foreignKey:ID;joinForeignKey:UserID;References:ID;joinReferences:RoleID" json:"roles,omitempty"` // 多对多关联角色
+	ID                 uint           `gorm:"primarykey" json:"id"`
+	Username           string         `gorm:"size:50;uniqueIndex;not null" json:"username"`
+	Password           string         `gorm:"size:100;not null" json:"-"` // 密码不返回给前端
+	Email              string         `gorm:"size:100;uniqueIndex" json:"email"`
+	Phone              *string        `gorm:"size:20;uniqueIndex:idx_users_phone,uniqueWhere:phone IS NOT NULL" json:"phone,omitempty"`
+	Nickname           string         `gorm:"size:50" json:"nickname"`
+	Avatar             string         `gorm:"size:255" json:"avatar"`
+	Status             int            `gorm:"default:1" json:"status"`                     // 0:禁用, 1:正常, 2:锁定, 3:待激活, 4:过期
+	StatusReason       string         `gorm:"size:255" json:"status_reason,omitempty"`     // 最近一次变更状态的原因
+	ValidUntil         *time.Time     `json:"valid_until,omitempty"`                       // 账号有效期，为空表示长期有效
+	Type               string         `gorm:"size:20;default:human;index" json:"type"`     // human:普通用户, service:服务账号
+	Source             string         `gorm:"size:20;default:local;index" json:"source"`   // local:本地账号, ldap:LDAP账号, oidc:单点登录账号
+	ExternalID         string         `gorm:"size:191;index" json:"external_id,omitempty"` // 外部认证源中的唯一标识，如OIDC的sub
+	MFAEnabled         bool           `gorm:"default:false" json:"mfa_enabled"`            // 是否已启用TOTP两步验证
+	MFASecret          string         `gorm:"size:64" json:"-"`                            // TOTP密钥，启用前为待确认的密钥
+	MFALastStep        int64          `json:"-"`                                           // 最近一次通过验证的时间步，防止验证码重放
+	PasswordChangedAt  *time.Time     `json:"password_changed_at,omitempty"`               // 最近一次修改密码时间
+	MustChangePassword bool           `gorm:"default:false" json:"must_change_password"`   // 下次登录必须修改密码（如管理员重置后）
+	CreatedAt          time.Time      `json:"created_at"`
+	UpdatedAt          time.Time      `json:"updated_at"`
+	DeletedAt          gorm.DeletedAt `gorm:"index" json:"-"`
+	Roles              []Role         `gorm:"many2many:user_roles;foreignKey:ID;joinForeignKey:UserID;References:ID;joinReferences:RoleID" json:"roles,omitempty"` // 多对多关联角色
+}
+
+// MFARecoveryCode 两步验证恢复码（仅保存哈希，每个恢复码只能使用一次）
+type MFARecoveryCode struct {
+	ID        uint       `gorm:"primarykey" json:"id"`
+	UserID    uint       `gorm:"index;not null" json:"user_id"`
+	CodeHash  string     `gorm:"size:64;not null" json:"-"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// PasswordHistory 历史密码哈希，用于禁止重复使用最近的密码
+type PasswordHistory struct {
+	ID           uint      `gorm:"primarykey" json:"id"`
+	UserID       uint      `gorm:"index;not null" json:"user_id"`
+	PasswordHash string    `gorm:"size:100;not null" json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// ValidUserStatus 是否为有效的账号状态值
+func ValidUserStatus(status int) bool {
+	return status >= UserStatusDisabled && status <= UserStatusExpired
+}
+
+// EffectiveUserStatus 计算账号当前实际状态，正常账号超过有效期时视为已过期
+func EffectiveUserStatus(status int, validUntil *time.Time, now time.Time) int {
+	if status == UserStatusActive && validUntil != nil && !now.Before(*validUntil) {
+		return UserStatusExpired
+	}
+	return status
+}
+
+// EffectiveStatus 账号当前实际状态
+func (u *User) EffectiveStatus(now time.Time) int {
+	return EffectiveUserStatus(u.Status, u.ValidUntil, now)
+}
+
+// UserStatusMessage 账号不可用时返回给用户的提示
+func UserStatusMessage(status int) string {
+	switch status {
+	case UserStatusDisabled:
+		return "账号已被禁用，请联系管理员"
+	case UserStatusLocked:
+		return "账号已被锁定，请联系管理员"
+	case UserStatusPending:
+		return "账号尚未激活"
+	case UserStatusExpired:
+		return "账号已过期，请联系管理员"
+	}
+	return "账号状态异常，请联系管理员"
 }
@@ -0,0 +1,92 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/internal/database"
+	"gorm.io/gorm"
+)
+
+// APITokenRepository API令牌仓库接口
+type APITokenRepository interface {
+	// Create 保存令牌
+	Create(token *models.APIToken) error
+	// GetByHash 根据哈希获取令牌
+	GetByHash(hash string) (*models.APIToken, error)
+	// GetByID 根据ID获取令牌
+	GetByID(id uint) (*models.APIToken, error)
+	// ListByUser 获取用户的全部令牌
+	ListByUser(userID uint) ([]models.APIToken, error)
+	// Revoke 吊销令牌
+	Revoke(id uint) error
+	// RevokeByUser 吊销用户的全部令牌
+	RevokeByUser(userID uint) error
+	// TouchLastUsed 更新最近使用时间和IP
+	TouchLastUsed(id uint, ip string, at time.Time) error
+}
+
+// apiTokenRepository GORM实现
+type apiTokenRepository struct {
+	db *gorm.DB
+}
+
+// NewAPITokenRepository 创建API令牌仓库实例
+func NewAPITokenRepository() APITokenRepository {
+	return &apiTokenRepository{
+		db: database.DB,
+	}
+}
+
+// Create 保存令牌
+func (r *apiTokenRepository) Create(token *models.APIToken) error {
+	return r.db.Create(token).Error
+}
+
+// GetByHash 根据哈希获取令牌
+func (r *apiTokenRepository) GetByHash(hash string) (*models.APIToken, error) {
+	var token models.APIToken
+	if err := r.db.Where("token_hash = ?", hash).First(&token).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// GetByID 根据ID获取令牌
+func (r *apiTokenRepository) GetByID(id uint) (*models.APIToken, error) {
+	var token models.APIToken
+	if err := r.db.First(&token, id).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// ListByUser 获取用户的全部令牌
+func (r *apiTokenRepository) ListByUser(userID uint) ([]models.APIToken, error) {
+	var tokens []models.APIToken
+	if err := r.db.Where("user_id = ?", userID).Order("id DESC").Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// Revoke 吊销令牌
+func (r *apiTokenRepository) Revoke(id uint) error {
+	return r.db.Model(&models.APIToken{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RevokeByUser 吊销用户的全部令牌
+func (r *apiTokenRepository) RevokeByUser(userID uint) error {
+	return r.db.Model(&models.APIToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// TouchLastUsed 更新最近使用时间和IP
+func (r *apiTokenRepository) TouchLastUsed(id uint, ip string, at time.Time) error {
+	return r.db.Model(&models.APIToken{}).
+		Where("id = ?", id).
+		UpdateColumns(map[string]interface{}{"last_used_at": at, "last_used_ip": ip}).Error
+}
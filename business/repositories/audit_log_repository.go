@@ -0,0 +1,66 @@
+package repositories
+
+import (
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/internal/database"
+	"gorm.io/gorm"
+)
+
+// AuditLogFilter 审计日志查询条件，零值表示不过滤
+type AuditLogFilter struct {
+	ActorID    uint
+	Action     string
+	TargetType string
+	TargetID   string
+}
+
+// AuditLogRepository 审计日志仓库接口
+type AuditLogRepository interface {
+	// Create 写入审计日志
+	Create(log *models.AuditLog) error
+	// List 按条件分页查询，最新的在前
+	List(filter AuditLogFilter, page, pageSize int) ([]*models.AuditLog, int64, error)
+}
+
+// auditLogRepository GORM实现
+type auditLogRepository struct {
+	db *gorm.DB
+}
+
+// NewAuditLogRepository 创建审计日志仓库实例
+func NewAuditLogRepository() AuditLogRepository {
+	return &auditLogRepository{
+		db: database.DB,
+	}
+}
+
+// Create 写入审计日志
+func (r *auditLogRepository) Create(log *models.AuditLog) error {
+	return r.db.Create(log).Error
+}
+
+// List 按条件分页查询
+func (r *auditLogRepository) List(filter AuditLogFilter, page, pageSize int) ([]*models.AuditLog, int64, error) {
+	query := r.db.Model(&models.AuditLog{})
+	if filter.ActorID > 0 {
+		query = query.Where("actor_id = ?", filter.ActorID)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.TargetType != "" {
+		query = query.Where("target_type = ?", filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		query = query.Where("target_id = ?", filter.TargetID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var logs []*models.AuditLog
+	err := query.Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&logs).Error
+	return logs, total, err
+}
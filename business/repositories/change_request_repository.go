@@ -0,0 +1,145 @@
+package repositories
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/internal/database"
+)
+
+// ErrDecisionExists 审批人已审批过该变更
+var ErrDecisionExists = errors.New("已审批过该变更")
+
+// ChangeRequestRepository 待审批变更仓库接口
+type ChangeRequestRepository interface {
+	// Create 创建待审批变更
+	Create(change *models.ChangeRequest) error
+	// GetByID 根据ID获取变更（包含申请人和审批记录）
+	GetByID(id uint) (*models.ChangeRequest, error)
+	// ListByRequester 获取用户提交的全部变更，最新的在前
+	ListByRequester(requesterID uint) ([]models.ChangeRequest, error)
+	// ListPending 获取全部待审批的变更（包含申请人和审批记录），最早的在前
+	ListPending() ([]models.ChangeRequest, error)
+	// ExpirePending 将now时已过审批截止时间的待审批变更标记为过期
+	ExpirePending(now time.Time) error
+	// AddDecision 记录审批并返回该变更的批准人数；变更已不是待审批状态时返回false，
+	// 审批人已审批过时返回ErrDecisionExists
+	AddDecision(decision *models.ChangeDecision) (approvals int, ok bool, err error)
+	// Transition 将变更从from状态改为to状态并更新fields，返回是否修改成功
+	Transition(id uint, from, to string, fields map[string]interface{}) (bool, error)
+	// HasAnyActiveRole 用户在默认租户内当前是否拥有任一角色（包括有效期内的临时授权）
+	HasAnyActiveRole(userID uint, roleNames []string) (bool, error)
+}
+
+// changeRequestRepository GORM实现
+type changeRequestRepository struct {
+	db *gorm.DB
+}
+
+// NewChangeRequestRepository 创建待审批变更仓库实例
+func NewChangeRequestRepository() ChangeRequestRepository {
+	return &changeRequestRepository{
+		db: database.DB,
+	}
+}
+
+// Create 创建待审批变更
+func (r *changeRequestRepository) Create(change *models.ChangeRequest) error {
+	return r.db.Create(change).Error
+}
+
+// GetByID 根据ID获取变更
+func (r *changeRequestRepository) GetByID(id uint) (*models.ChangeRequest, error) {
+	var change models.ChangeRequest
+	if err := r.db.Preload("Requester").Preload("Decisions.Approver").First(&change, id).Error; err != nil {
+		return nil, err
+	}
+	return &change, nil
+}
+
+// ListByRequester 获取用户提交的全部变更
+func (r *changeRequestRepository) ListByRequester(requesterID uint) ([]models.ChangeRequest, error) {
+	var changes []models.ChangeRequest
+	err := r.db.Preload("Decisions.Approver").Where("requester_id = ?", requesterID).Order("id DESC").Find(&changes).Error
+	return changes, err
+}
+
+// ListPending 获取全部待审批的变更
+func (r *changeRequestRepository) ListPending() ([]models.ChangeRequest, error) {
+	var changes []models.ChangeRequest
+	err := r.db.Preload("Requester").Preload("Decisions.Approver").
+		Where("status = ?", models.ChangePending).Order("id").Find(&changes).Error
+	return changes, err
+}
+
+// ExpirePending 标记过期的待审批变更
+func (r *changeRequestRepository) ExpirePending(now time.Time) error {
+	return r.db.Model(&models.ChangeRequest{}).
+		Where("status = ? AND expires_at <= ?", models.ChangePending, now).
+		Update("status", models.ChangeExpired).Error
+}
+
+// AddDecision 记录审批
+func (r *changeRequestRepository) AddDecision(decision *models.ChangeDecision) (int, bool, error) {
+	var approvals int64
+	ok := true
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// 锁定变更，保证同时审批时只有一个请求看到最终的批准人数
+		var change models.ChangeRequest
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "status").First(&change, decision.ChangeRequestID).Error; err != nil {
+			return err
+		}
+		if change.Status != models.ChangePending {
+			ok = false
+			return nil
+		}
+
+		var count int64
+		if err := tx.Model(&models.ChangeDecision{}).
+			Where("change_request_id = ? AND approver_id = ?", decision.ChangeRequestID, decision.ApproverID).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrDecisionExists
+		}
+		if err := tx.Create(decision).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.ChangeDecision{}).
+			Where("change_request_id = ? AND decision = ?", decision.ChangeRequestID, models.DecisionApprove).
+			Count(&approvals).Error
+	})
+	if err != nil {
+		return 0, false, err
+	}
+	return int(approvals), ok, nil
+}
+
+// Transition 修改变更状态
+func (r *changeRequestRepository) Transition(id uint, from, to string, fields map[string]interface{}) (bool, error) {
+	updates := map[string]interface{}{"status": to}
+	for k, v := range fields {
+		updates[k] = v
+	}
+	result := r.db.Model(&models.ChangeRequest{}).Where("id = ? AND status = ?", id, from).Updates(updates)
+	return result.RowsAffected > 0, result.Error
+}
+
+// HasAnyActiveRole 用户当前是否拥有任一角色
+func (r *changeRequestRepository) HasAnyActiveRole(userID uint, roleNames []string) (bool, error) {
+	if len(roleNames) == 0 {
+		return false, nil
+	}
+	var count int64
+	err := r.db.Model(&models.UserRole{}).
+		Joins("JOIN roles ON roles.id = user_roles.role_id AND roles.deleted_at IS NULL").
+		Where("user_roles.user_id = ? AND roles.name IN ?", userID, roleNames).
+		Scopes(models.ActiveUserRoles(time.Now())).
+		Count(&count).Error
+	return count > 0, err
+}
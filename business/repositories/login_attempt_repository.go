@@ -0,0 +1,148 @@
+package repositories
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/internal/database"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LoginAttemptStore 登录失败计数存储接口
+// 单实例部署可使用内存实现，多副本部署需使用共享存储实现
+type LoginAttemptStore interface {
+	// Get 获取计数记录，不存在时返回零值记录
+	Get(identifier string) (*models.LoginAttempt, error)
+	// Update 原子地读取并修改计数记录，返回修改后的记录
+	Update(identifier string, fn func(attempt *models.LoginAttempt)) (*models.LoginAttempt, error)
+	// Delete 删除计数记录
+	Delete(identifier string) error
+	// Purge 清理指定时间之前未更新且未锁定的记录
+	Purge(before time.Time) error
+}
+
+// memoryLoginAttemptStore 内存实现
+type memoryLoginAttemptStore struct {
+	mu       sync.Mutex
+	attempts map[string]*models.LoginAttempt
+}
+
+// NewMemoryLoginAttemptStore 创建内存计数存储
+func NewMemoryLoginAttemptStore() LoginAttemptStore {
+	return &memoryLoginAttemptStore{
+		attempts: make(map[string]*models.LoginAttempt),
+	}
+}
+
+// Get 获取计数记录
+func (s *memoryLoginAttemptStore) Get(identifier string) (*models.LoginAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if attempt, ok := s.attempts[identifier]; ok {
+		copied := *attempt
+		return &copied, nil
+	}
+	return &models.LoginAttempt{Identifier: identifier}, nil
+}
+
+// Update 在互斥锁内修改计数记录
+func (s *memoryLoginAttemptStore) Update(identifier string, fn func(attempt *models.LoginAttempt)) (*models.LoginAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempt, ok := s.attempts[identifier]
+	if !ok {
+		attempt = &models.LoginAttempt{Identifier: identifier}
+		s.attempts[identifier] = attempt
+	}
+	fn(attempt)
+	attempt.UpdatedAt = time.Now()
+
+	copied := *attempt
+	return &copied, nil
+}
+
+// Delete 删除计数记录
+func (s *memoryLoginAttemptStore) Delete(identifier string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.attempts, identifier)
+	return nil
+}
+
+// Purge 清理过期记录
+func (s *memoryLoginAttemptStore) Purge(before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for identifier, attempt := range s.attempts {
+		if attempt.UpdatedAt.Before(before) && !attempt.IsLocked(now) {
+			delete(s.attempts, identifier)
+		}
+	}
+	return nil
+}
+
+// dbLoginAttemptStore 数据库实现，多副本共享计数
+type dbLoginAttemptStore struct {
+	db *gorm.DB
+}
+
+// NewDBLoginAttemptStore 创建数据库计数存储
+func NewDBLoginAttemptStore() LoginAttemptStore {
+	return &dbLoginAttemptStore{
+		db: database.DB,
+	}
+}
+
+// Get 获取计数记录
+func (s *dbLoginAttemptStore) Get(identifier string) (*models.LoginAttempt, error) {
+	var attempt models.LoginAttempt
+	err := s.db.Where("identifier = ?", identifier).First(&attempt).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &models.LoginAttempt{Identifier: identifier}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &attempt, nil
+}
+
+// Update 在事务中加行锁修改计数记录，保证多副本并发时计数准确
+func (s *dbLoginAttemptStore) Update(identifier string, fn func(attempt *models.LoginAttempt)) (*models.LoginAttempt, error) {
+	var attempt models.LoginAttempt
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// 记录不存在时先插入空记录，避免并发插入冲突
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&models.LoginAttempt{Identifier: identifier, WindowStart: time.Now()}).Error; err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("identifier = ?", identifier).First(&attempt).Error; err != nil {
+			return err
+		}
+		fn(&attempt)
+		return tx.Save(&attempt).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &attempt, nil
+}
+
+// Delete 删除计数记录
+func (s *dbLoginAttemptStore) Delete(identifier string) error {
+	return s.db.Where("identifier = ?", identifier).Delete(&models.LoginAttempt{}).Error
+}
+
+// Purge 清理过期记录
+func (s *dbLoginAttemptStore) Purge(before time.Time) error {
+	return s.db.Where("updated_at < ? AND (locked_until IS NULL OR locked_until < ?)", before, time.Now()).
+		Delete(&models.LoginAttempt{}).Error
+}
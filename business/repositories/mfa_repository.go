@@ -0,0 +1,114 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/internal/database"
+	"gorm.io/gorm"
+)
+
+// MFARepository 两步验证仓库接口
+type MFARepository interface {
+	// SaveSecret 保存待确认的TOTP密钥
+	SaveSecret(userID uint, secret string) error
+	// Enable 启用两步验证并替换恢复码
+	Enable(userID uint, step int64, codeHashes []string) error
+	// Disable 关闭两步验证并清除密钥和恢复码
+	Disable(userID uint) error
+	// AdvanceStep 记录已使用的时间步，时间步未前进时返回false（验证码重放）
+	AdvanceStep(userID uint, step int64) (bool, error)
+	// ReplaceRecoveryCodes 替换用户的全部恢复码
+	ReplaceRecoveryCodes(userID uint, codeHashes []string) error
+	// UseRecoveryCode 使用恢复码，恢复码不存在或已使用时返回false
+	UseRecoveryCode(userID uint, codeHash string) (bool, error)
+	// CountRecoveryCodes 统计未使用的恢复码数量
+	CountRecoveryCodes(userID uint) (int64, error)
+}
+
+// mfaRepository GORM实现
+type mfaRepository struct {
+	db *gorm.DB
+}
+
+// NewMFARepository 创建两步验证仓库实例
+func NewMFARepository() MFARepository {
+	return &mfaRepository{
+		db: database.DB,
+	}
+}
+
+// SaveSecret 保存待确认的TOTP密钥
+func (r *mfaRepository) SaveSecret(userID uint, secret string) error {
+	return r.db.Model(&models.User{}).Where("id = ?", userID).
+		UpdateColumns(map[string]interface{}{"mfa_secret": secret, "mfa_enabled": false}).Error
+}
+
+// Enable 启用两步验证并替换恢复码
+func (r *mfaRepository) Enable(userID uint, step int64, codeHashes []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).
+			UpdateColumns(map[string]interface{}{"mfa_enabled": true, "mfa_last_step": step}).Error; err != nil {
+			return err
+		}
+		return replaceRecoveryCodes(tx, userID, codeHashes)
+	})
+}
+
+// Disable 关闭两步验证并清除密钥和恢复码
+func (r *mfaRepository) Disable(userID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).
+			UpdateColumns(map[string]interface{}{"mfa_enabled": false, "mfa_secret": "", "mfa_last_step": 0}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error
+	})
+}
+
+// AdvanceStep 记录已使用的时间步，时间步未前进时返回false（验证码重放）
+func (r *mfaRepository) AdvanceStep(userID uint, step int64) (bool, error) {
+	result := r.db.Model(&models.User{}).
+		Where("id = ? AND mfa_last_step < ?", userID, step).
+		UpdateColumn("mfa_last_step", step)
+	return result.RowsAffected > 0, result.Error
+}
+
+// ReplaceRecoveryCodes 替换用户的全部恢复码
+func (r *mfaRepository) ReplaceRecoveryCodes(userID uint, codeHashes []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return replaceRecoveryCodes(tx, userID, codeHashes)
+	})
+}
+
+// replaceRecoveryCodes 在事务中删除旧恢复码并写入新恢复码
+func replaceRecoveryCodes(tx *gorm.DB, userID uint, codeHashes []string) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+		return err
+	}
+	codes := make([]models.MFARecoveryCode, 0, len(codeHashes))
+	for _, hash := range codeHashes {
+		codes = append(codes, models.MFARecoveryCode{UserID: userID, CodeHash: hash})
+	}
+	if len(codes) == 0 {
+		return nil
+	}
+	return tx.Create(&codes).Error
+}
+
+// UseRecoveryCode 使用恢复码，恢复码不存在或已使用时返回false
+func (r *mfaRepository) UseRecoveryCode(userID uint, codeHash string) (bool, error) {
+	result := r.db.Model(&models.MFARecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
+
+// CountRecoveryCodes 统计未使用的恢复码数量
+func (r *mfaRepository) CountRecoveryCodes(userID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.MFARecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Count(&count).Error
+	return count, err
+}
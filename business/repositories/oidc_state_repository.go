@@ -0,0 +1,57 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/internal/database"
+	"gorm.io/gorm"
+)
+
+// OIDCStateRepository 单点登录state仓库接口
+type OIDCStateRepository interface {
+	// Create 保存登录state
+	Create(state *models.OIDCLoginState) error
+	// Take 取出并删除state，不存在或已被使用时返回gorm.ErrRecordNotFound
+	Take(hash string) (*models.OIDCLoginState, error)
+	// PurgeExpired 清理过期state
+	PurgeExpired() error
+}
+
+// oidcStateRepository GORM实现
+type oidcStateRepository struct {
+	db *gorm.DB
+}
+
+// NewOIDCStateRepository 创建单点登录state仓库实例
+func NewOIDCStateRepository() OIDCStateRepository {
+	return &oidcStateRepository{
+		db: database.DB,
+	}
+}
+
+// Create 保存登录state
+func (r *oidcStateRepository) Create(state *models.OIDCLoginState) error {
+	return r.db.Create(state).Error
+}
+
+// Take 读取后条件删除，并发回调时只有一个请求能取到state
+func (r *oidcStateRepository) Take(hash string) (*models.OIDCLoginState, error) {
+	var state models.OIDCLoginState
+	if err := r.db.Where("state_hash = ?", hash).First(&state).Error; err != nil {
+		return nil, err
+	}
+	result := r.db.Where("id = ?", state.ID).Delete(&models.OIDCLoginState{})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &state, nil
+}
+
+// PurgeExpired 清理过期state
+func (r *oidcStateRepository) PurgeExpired() error {
+	return r.db.Where("expires_at < ?", time.Now()).Delete(&models.OIDCLoginState{}).Error
+}
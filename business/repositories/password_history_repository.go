@@ -0,0 +1,57 @@
+package repositories
+
+import (
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/internal/database"
+	"gorm.io/gorm"
+)
+
+// PasswordHistoryRepository 历史密码仓库接口
+type PasswordHistoryRepository interface {
+	// Add 记录密码哈希，只保留最近keep条
+	Add(userID uint, hash string, keep int) error
+	// Recent 获取最近n条密码哈希
+	Recent(userID uint, n int) ([]string, error)
+}
+
+// passwordHistoryRepository GORM实现
+type passwordHistoryRepository struct {
+	db *gorm.DB
+}
+
+// NewPasswordHistoryRepository 创建历史密码仓库实例
+func NewPasswordHistoryRepository() PasswordHistoryRepository {
+	return &passwordHistoryRepository{
+		db: database.DB,
+	}
+}
+
+// Add 记录密码哈希并清理超出保留数量的旧记录
+func (r *passwordHistoryRepository) Add(userID uint, hash string, keep int) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&models.PasswordHistory{UserID: userID, PasswordHash: hash}).Error; err != nil {
+			return err
+		}
+
+		var ids []uint
+		if err := tx.Model(&models.PasswordHistory{}).Where("user_id = ?", userID).
+			Order("id DESC").Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		if len(ids) <= keep {
+			return nil
+		}
+		return tx.Where("id IN ?", ids[keep:]).Delete(&models.PasswordHistory{}).Error
+	})
+}
+
+// Recent 获取最近n条密码哈希
+func (r *passwordHistoryRepository) Recent(userID uint, n int) ([]string, error) {
+	var hashes []string
+	if n <= 0 {
+		return hashes, nil
+	}
+	err := r.db.Model(&models.PasswordHistory{}).Where("user_id = ?", userID).
+		Order("id DESC").Limit(n).Pluck("password_hash", &hashes).Error
+	return hashes, err
+}
@@ -0,0 +1,67 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/internal/database"
+	"gorm.io/gorm"
+)
+
+// PasswordResetRepository 找回密码令牌仓库接口
+type PasswordResetRepository interface {
+	// Create 保存新令牌并作废该用户之前未使用的令牌
+	Create(token *models.PasswordResetToken) error
+	// GetByHash 根据哈希获取令牌
+	GetByHash(hash string) (*models.PasswordResetToken, error)
+	// MarkUsed 标记令牌已使用，令牌已被使用时返回false
+	MarkUsed(id uint) (bool, error)
+	// PurgeExpired 清理过期令牌
+	PurgeExpired() error
+}
+
+// passwordResetRepository GORM实现
+type passwordResetRepository struct {
+	db *gorm.DB
+}
+
+// NewPasswordResetRepository 创建找回密码令牌仓库实例
+func NewPasswordResetRepository() PasswordResetRepository {
+	return &passwordResetRepository{
+		db: database.DB,
+	}
+}
+
+// Create 保存新令牌并作废之前未使用的令牌，保证同一时间只有最新的链接有效
+func (r *passwordResetRepository) Create(token *models.PasswordResetToken) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", token.UserID).
+			Update("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Create(token).Error
+	})
+}
+
+// GetByHash 根据哈希获取令牌
+func (r *passwordResetRepository) GetByHash(hash string) (*models.PasswordResetToken, error) {
+	var token models.PasswordResetToken
+	if err := r.db.Where("token_hash = ?", hash).First(&token).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// MarkUsed 条件更新，防止并发请求重复使用同一令牌
+func (r *passwordResetRepository) MarkUsed(id uint) (bool, error) {
+	result := r.db.Model(&models.PasswordResetToken{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
+
+// PurgeExpired 清理过期令牌
+func (r *passwordResetRepository) PurgeExpired() error {
+	return r.db.Where("expires_at < ?", time.Now()).Delete(&models.PasswordResetToken{}).Error
+}
@@ -0,0 +1,198 @@
+package repositories
+
+import (
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/internal/database"
+	"gorm.io/gorm"
+)
+
+// PolicySnapshot 角色、权限及其关联的当前数据
+type PolicySnapshot struct {
+	Roles           []models.Role           // 包含父角色
+	Permissions     []models.Permission     // 全部权限
+	RolePermissions []models.RolePermission // 包含角色和权限
+	UserRoles       []models.UserRole       // 默认租户的用户角色（不包括临时授权），包含用户和角色；只在需要时加载
+}
+
+// PolicyRepository 权限配置导入导出仓库接口
+type PolicyRepository interface {
+	// Snapshot 读取角色、权限和角色权限关联，includeUsers为true时同时读取默认租户的用户角色
+	Snapshot(includeUsers bool) (*PolicySnapshot, error)
+	// Transaction 在事务中执行fn，fn收到绑定该事务的仓库，返回错误时回滚
+	Transaction(fn func(tx PolicyRepository) error) error
+	// SaveRole 创建或更新角色，创建时恢复同名的已删除角色
+	SaveRole(role *models.Role) error
+	// DeleteRole 删除角色及其用户、租户成员、权限和继承关联
+	DeleteRole(id uint) error
+	// ReplaceRoleParents 替换角色的父角色
+	ReplaceRoleParents(roleID uint, parentIDs []uint) error
+	// SavePermission 创建或更新权限
+	SavePermission(permission *models.Permission) error
+	// DeletePermission 删除权限及其角色关联
+	DeletePermission(id uint) error
+	// SaveRolePermission 创建角色权限关联或更新其效果
+	SaveRolePermission(roleID, permissionID uint, effect string) error
+	// DeleteRolePermission 删除角色权限关联
+	DeleteRolePermission(roleID, permissionID uint) error
+	// GetUsersByUsername 按用户名批量获取用户
+	GetUsersByUsername(usernames []string) ([]models.User, error)
+	// ReplaceUserRoles 替换用户在默认租户的角色，保留临时授权
+	ReplaceUserRoles(userID uint, roleIDs []uint) error
+	// SyncCasbin 按仓库（事务）中的数据同步casbin_rule，返回的差异在事务提交后应用到内存
+	SyncCasbin() (*database.PolicyDelta, error)
+}
+
+// policyRepository GORM实现
+type policyRepository struct {
+	db *gorm.DB
+}
+
+// NewPolicyRepository 创建权限配置仓库实例
+func NewPolicyRepository() PolicyRepository {
+	return &policyRepository{
+		db: database.DB,
+	}
+}
+
+// Snapshot 读取角色、权限和角色权限关联
+func (r *policyRepository) Snapshot(includeUsers bool) (*PolicySnapshot, error) {
+	snapshot := &PolicySnapshot{}
+	if err := r.db.Preload("Parents").Order("id").Find(&snapshot.Roles).Error; err != nil {
+		return nil, err
+	}
+	if err := r.db.Order("id").Find(&snapshot.Permissions).Error; err != nil {
+		return nil, err
+	}
+	if err := r.db.Preload("Role").Preload("Permission").Find(&snapshot.RolePermissions).Error; err != nil {
+		return nil, err
+	}
+	if includeUsers {
+		if err := r.db.Preload("User").Preload("Role").Where("expires_at IS NULL").Find(&snapshot.UserRoles).Error; err != nil {
+			return nil, err
+		}
+	}
+	return snapshot, nil
+}
+
+// Transaction 在事务中执行fn
+func (r *policyRepository) Transaction(fn func(tx PolicyRepository) error) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return fn(&policyRepository{db: tx})
+	})
+}
+
+// SaveRole 创建或更新角色
+func (r *policyRepository) SaveRole(role *models.Role) error {
+	if role.ID != 0 {
+		return r.db.Model(role).Select("description", "require_mfa").Updates(role).Error
+	}
+	// 角色名唯一，已删除的同名角色直接恢复
+	var deleted models.Role
+	result := r.db.Unscoped().Where("name = ? AND deleted_at IS NOT NULL", role.Name).Limit(1).Find(&deleted)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		role.ID = deleted.ID
+		return r.db.Unscoped().Model(&deleted).Updates(map[string]interface{}{
+			"description": role.Description,
+			"require_mfa": role.RequireMFA,
+			"deleted_at":  nil,
+		}).Error
+	}
+	return r.db.Create(role).Error
+}
+
+// DeleteRole 删除角色及其全部关联
+func (r *policyRepository) DeleteRole(id uint) error {
+	if err := r.db.Table("user_roles").Where("role_id = ?", id).Delete(nil).Error; err != nil {
+		return err
+	}
+	if err := r.db.Where("role_id = ?", id).Delete(&models.TenantUserRole{}).Error; err != nil {
+		return err
+	}
+	if err := r.db.Table("role_permissions").Where("role_id = ?", id).Delete(nil).Error; err != nil {
+		return err
+	}
+	if err := r.db.Where("role_id = ? OR parent_id = ?", id, id).Delete(&models.RoleParent{}).Error; err != nil {
+		return err
+	}
+	return r.db.Delete(&models.Role{}, id).Error
+}
+
+// ReplaceRoleParents 替换角色的父角色
+func (r *policyRepository) ReplaceRoleParents(roleID uint, parentIDs []uint) error {
+	if err := r.db.Where("role_id = ?", roleID).Delete(&models.RoleParent{}).Error; err != nil {
+		return err
+	}
+	for _, parentID := range parentIDs {
+		if err := r.db.Create(&models.RoleParent{RoleID: roleID, ParentID: parentID}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SavePermission 创建或更新权限
+func (r *policyRepository) SavePermission(permission *models.Permission) error {
+	if permission.ID != 0 {
+		return r.db.Model(permission).Select("description").Updates(permission).Error
+	}
+	return r.db.Create(permission).Error
+}
+
+// DeletePermission 删除权限及其角色关联
+func (r *policyRepository) DeletePermission(id uint) error {
+	if err := r.db.Unscoped().Where("permission_id = ?", id).Delete(&models.RolePermission{}).Error; err != nil {
+		return err
+	}
+	return r.db.Delete(&models.Permission{}, id).Error
+}
+
+// SaveRolePermission 创建角色权限关联或更新其效果
+func (r *policyRepository) SaveRolePermission(roleID, permissionID uint, effect string) error {
+	var existing models.RolePermission
+	result := r.db.Where("role_id = ? AND permission_id = ?", roleID, permissionID).Limit(1).Find(&existing)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		return r.db.Model(&models.RolePermission{}).Where("role_id = ? AND permission_id = ?", roleID, permissionID).Update("effect", effect).Error
+	}
+	// 清理软删除的同主键记录
+	if err := r.db.Unscoped().Where("role_id = ? AND permission_id = ?", roleID, permissionID).Delete(&models.RolePermission{}).Error; err != nil {
+		return err
+	}
+	return r.db.Create(&models.RolePermission{RoleID: roleID, PermissionID: permissionID, Effect: effect}).Error
+}
+
+// DeleteRolePermission 删除角色权限关联
+func (r *policyRepository) DeleteRolePermission(roleID, permissionID uint) error {
+	return r.db.Unscoped().Where("role_id = ? AND permission_id = ?", roleID, permissionID).Delete(&models.RolePermission{}).Error
+}
+
+// GetUsersByUsername 按用户名批量获取用户
+func (r *policyRepository) GetUsersByUsername(usernames []string) ([]models.User, error) {
+	var users []models.User
+	if len(usernames) == 0 {
+		return users, nil
+	}
+	if err := r.db.Where("username IN ?", usernames).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// ReplaceUserRoles 替换用户在默认租户的角色，保留临时授权
+func (r *policyRepository) ReplaceUserRoles(userID uint, roleIDs []uint) error {
+	roles := make([]models.Role, 0, len(roleIDs))
+	for _, roleID := range roleIDs {
+		roles = append(roles, models.Role{ID: roleID})
+	}
+	return ReplaceUserRoles(r.db, userID, roles)
+}
+
+// SyncCasbin 按仓库中的数据同步casbin_rule
+func (r *policyRepository) SyncCasbin() (*database.PolicyDelta, error) {
+	return database.SyncPolicy(r.db, database.ScopeAll())
+}
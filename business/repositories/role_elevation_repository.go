@@ -0,0 +1,206 @@
+package repositories
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/internal/database"
+)
+
+// errElevationHandled 事务中发现申请已不是待审批状态，回滚后以false返回
+var errElevationHandled = errors.New("申请已被处理")
+
+// RoleElevationRepository 临时提权仓库接口
+type RoleElevationRepository interface {
+	// Create 创建提权申请
+	Create(elevation *models.RoleElevation) error
+	// GetByID 根据ID获取申请（包含申请人和角色）
+	GetByID(id uint) (*models.RoleElevation, error)
+	// ListByUser 获取用户的全部申请，最新的在前
+	ListByUser(userID uint) ([]models.RoleElevation, error)
+	// ListPending 获取全部待审批的申请（包含申请人和角色），最早的在前
+	ListPending() ([]models.RoleElevation, error)
+	// HasPending 用户是否已有该角色的待审批申请
+	HasPending(userID, roleID uint) (bool, error)
+	// Review 保存拒绝或撤回的结果，只修改仍为待审批的申请，返回是否修改成功
+	Review(elevation *models.RoleElevation) (bool, error)
+	// GetGrant 获取用户的角色授权
+	GetGrant(userID, roleID uint) (*models.UserRole, error)
+	// HasActiveRole 用户在默认租户内当前是否拥有该角色（包括有效期内的临时授权）
+	HasActiveRole(userID uint, roleName string) (bool, error)
+	// ListTemporaryGrants 获取全部临时授权（包含用户和角色），最早到期的在前
+	ListTemporaryGrants() ([]models.UserRole, error)
+	// Grant 写入临时授权并在同一事务中同步该用户的Casbin规则；elevation不为空时同时保存批准结果，
+	// 申请已不是待审批状态时不写入并返回false
+	Grant(grant *models.UserRole, elevation *models.RoleElevation) (bool, error)
+	// RevokeExpired 删除now时已到期的临时授权，并同步持有临时授权的用户的Casbin规则，使到达生效时间的授权生效；
+	// 返回删除的授权（包含用户和角色）
+	RevokeExpired(now time.Time) ([]models.UserRole, error)
+}
+
+// roleElevationRepository GORM实现
+type roleElevationRepository struct {
+	db *gorm.DB
+}
+
+// NewRoleElevationRepository 创建临时提权仓库实例
+func NewRoleElevationRepository() RoleElevationRepository {
+	return &roleElevationRepository{
+		db: database.DB,
+	}
+}
+
+// Create 创建提权申请
+func (r *roleElevationRepository) Create(elevation *models.RoleElevation) error {
+	return r.db.Create(elevation).Error
+}
+
+// GetByID 根据ID获取申请
+func (r *roleElevationRepository) GetByID(id uint) (*models.RoleElevation, error) {
+	var elevation models.RoleElevation
+	if err := r.db.Preload("User").Preload("Role").First(&elevation, id).Error; err != nil {
+		return nil, err
+	}
+	return &elevation, nil
+}
+
+// ListByUser 获取用户的全部申请
+func (r *roleElevationRepository) ListByUser(userID uint) ([]models.RoleElevation, error) {
+	var elevations []models.RoleElevation
+	err := r.db.Preload("Role").Where("user_id = ?", userID).Order("id DESC").Find(&elevations).Error
+	return elevations, err
+}
+
+// ListPending 获取全部待审批的申请
+func (r *roleElevationRepository) ListPending() ([]models.RoleElevation, error) {
+	var elevations []models.RoleElevation
+	err := r.db.Preload("User").Preload("Role").Where("status = ?", models.ElevationPending).Order("id").Find(&elevations).Error
+	return elevations, err
+}
+
+// HasPending 用户是否已有该角色的待审批申请
+func (r *roleElevationRepository) HasPending(userID, roleID uint) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.RoleElevation{}).
+		Where("user_id = ? AND role_id = ? AND status = ?", userID, roleID, models.ElevationPending).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// Review 保存拒绝或撤回的结果
+func (r *roleElevationRepository) Review(elevation *models.RoleElevation) (bool, error) {
+	return reviewElevation(r.db, elevation)
+}
+
+// reviewElevation 按ID更新仍为待审批的申请
+func reviewElevation(db *gorm.DB, elevation *models.RoleElevation) (bool, error) {
+	result := db.Model(&models.RoleElevation{}).
+		Where("id = ? AND status = ?", elevation.ID, models.ElevationPending).
+		Updates(map[string]interface{}{
+			"status":         elevation.Status,
+			"reviewer_id":    elevation.ReviewerID,
+			"review_comment": elevation.ReviewComment,
+			"reviewed_at":    elevation.ReviewedAt,
+			"expires_at":     elevation.ExpiresAt,
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// GetGrant 获取用户的角色授权
+func (r *roleElevationRepository) GetGrant(userID, roleID uint) (*models.UserRole, error) {
+	var grant models.UserRole
+	if err := r.db.Where("user_id = ? AND role_id = ?", userID, roleID).First(&grant).Error; err != nil {
+		return nil, err
+	}
+	return &grant, nil
+}
+
+// HasActiveRole 用户当前是否拥有该角色
+func (r *roleElevationRepository) HasActiveRole(userID uint, roleName string) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.UserRole{}).
+		Joins("JOIN roles ON roles.id = user_roles.role_id AND roles.deleted_at IS NULL").
+		Where("user_roles.user_id = ? AND roles.name = ?", userID, roleName).
+		Scopes(models.ActiveUserRoles(time.Now())).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// ListTemporaryGrants 获取全部临时授权
+func (r *roleElevationRepository) ListTemporaryGrants() ([]models.UserRole, error) {
+	var grants []models.UserRole
+	err := r.db.Preload("User").Preload("Role").Where("expires_at IS NOT NULL").Order("expires_at").Find(&grants).Error
+	return grants, err
+}
+
+// Grant 写入临时授权
+func (r *roleElevationRepository) Grant(grant *models.UserRole, elevation *models.RoleElevation) (bool, error) {
+	err := database.UpdatePolicyIn(r.db, func(tx *gorm.DB) (database.PolicyScope, error) {
+		if elevation != nil {
+			ok, err := reviewElevation(tx, elevation)
+			if err != nil {
+				return database.PolicyScope{}, err
+			}
+			if !ok {
+				return database.PolicyScope{}, errElevationHandled
+			}
+		}
+
+		// 已有的授权（包括已软删除的行）直接覆盖有效期
+		if err := tx.Unscoped().Clauses(clause.OnConflict{
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"not_before": grant.NotBefore,
+				"expires_at": grant.ExpiresAt,
+				"reason":     grant.Reason,
+				"deleted_at": nil,
+			}),
+		}).Create(grant).Error; err != nil {
+			return database.PolicyScope{}, err
+		}
+
+		var user models.User
+		if err := tx.Select("username").First(&user, grant.UserID).Error; err != nil {
+			return database.PolicyScope{}, err
+		}
+		return database.ScopeUsers(user.Username), nil
+	})
+	if errors.Is(err, errElevationHandled) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// RevokeExpired 删除到期的临时授权
+func (r *roleElevationRepository) RevokeExpired(now time.Time) ([]models.UserRole, error) {
+	var expired []models.UserRole
+	err := database.UpdatePolicyIn(r.db, func(tx *gorm.DB) (database.PolicyScope, error) {
+		var grants []models.UserRole
+		if err := tx.Preload("User").Preload("Role").Where("expires_at IS NOT NULL").Find(&grants).Error; err != nil {
+			return database.PolicyScope{}, err
+		}
+		var usernames []string
+		for _, grant := range grants {
+			if grant.User.Username != "" {
+				usernames = append(usernames, grant.User.Username)
+			}
+			if !grant.ExpiresAt.After(now) {
+				expired = append(expired, grant)
+			}
+		}
+		for _, grant := range expired {
+			if err := tx.Unscoped().Where("user_id = ? AND role_id = ? AND expires_at <= ?", grant.UserID, grant.RoleID, now).
+				Delete(&models.UserRole{}).Error; err != nil {
+				return database.PolicyScope{}, err
+			}
+		}
+		return database.ScopeUsers(usernames...), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return expired, nil
+}
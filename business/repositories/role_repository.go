@@ -22,6 +22,16 @@ type RoleRepository interface {
 	Update(role *models.Role) error
 	// Delete 删除角色
 	Delete(id uint) error
+	// ListParentLinks 获取全部角色继承关系
+	ListParentLinks() ([]models.RoleParent, error)
+	// ReplaceParents 替换角色的父角色
+	ReplaceParents(role *models.Role, parents []models.Role) error
+	// GetByIDs 根据ID列表获取角色
+	GetByIDs(ids []uint) ([]models.Role, error)
+	// ListRolePermissions 获取指定角色的角色权限关联（包含权限）
+	ListRolePermissions(roleIDs []uint) ([]models.RolePermission, error)
+	// WithTx 返回在事务tx中执行的仓库
+	WithTx(tx *gorm.DB) RoleRepository
 }
 
 // roleRepository 角色仓库GORM实现
@@ -36,6 +46,11 @@ func NewRoleRepository() RoleRepository {
 	}
 }
 
+// WithTx 返回在事务tx中执行的仓库
+func (r *roleRepository) WithTx(tx *gorm.DB) RoleRepository {
+	return &roleRepository{db: tx}
+}
+
 // GetByNameIn 根据角色名称列表获取角色
 func (r *roleRepository) GetByNameIn(names []string) ([]models.Role, error) {
 	var roles []models.Role
@@ -53,7 +68,7 @@ func (r *roleRepository) Create(role *models.Role) error {
 // GetAll 获取所有角色
 func (r *roleRepository) GetAll() ([]models.Role, error) {
 	var roles []models.Role
-	if err := r.db.Find(&roles).Error; err != nil {
+	if err := r.db.Preload("Parents").Find(&roles).Error; err != nil {
 		return nil, err
 	}
 	return roles, nil
@@ -62,15 +77,15 @@ func (r *roleRepository) GetAll() ([]models.Role, error) {
 // GetByID 根据ID获取角色
 func (r *roleRepository) GetByID(id uint) (*models.Role, error) {
 	var role models.Role
-	if err := r.db.First(&role, id).Error; err != nil {
+	if err := r.db.Preload("Parents").First(&role, id).Error; err != nil {
 		return nil, err
 	}
 	return &role, nil
 }
 
-// Update 更新角色信息
+// Update 更新角色信息，父角色通过ReplaceParents修改
 func (r *roleRepository) Update(role *models.Role) error {
-	return r.db.Save(role).Error
+	return r.db.Omit("Parents").Save(role).Error
 }
 
 // Delete 删除角色
@@ -95,10 +110,55 @@ func (r *roleRepository) Delete(id uint) error {
 	if err := r.db.Table("user_roles").Where("role_id = ?", id).Delete(nil).Error; err != nil {
 		return err
 	}
+	if err := r.db.Where("role_id = ?", id).Delete(&models.TenantUserRole{}).Error; err != nil {
+		return err
+	}
 	// 删除角色权限关联
 	if err := r.db.Table("role_permissions").Where("role_id = ?", id).Delete(nil).Error; err != nil {
 		return err
 	}
+	// 删除角色继承关系，继承该角色的子角色不再获得其权限
+	if err := r.db.Where("role_id = ? OR parent_id = ?", id, id).Delete(&models.RoleParent{}).Error; err != nil {
+		return err
+	}
 	// 再删除角色
 	return r.db.Delete(&models.Role{}, id).Error
 }
+
+// ListParentLinks 获取全部角色继承关系
+func (r *roleRepository) ListParentLinks() ([]models.RoleParent, error) {
+	var links []models.RoleParent
+	if err := r.db.Find(&links).Error; err != nil {
+		return nil, err
+	}
+	return links, nil
+}
+
+// ReplaceParents 替换角色的父角色
+func (r *roleRepository) ReplaceParents(role *models.Role, parents []models.Role) error {
+	return r.db.Model(role).Association("Parents").Replace(parents)
+}
+
+// GetByIDs 根据ID列表获取角色
+func (r *roleRepository) GetByIDs(ids []uint) ([]models.Role, error) {
+	var roles []models.Role
+	if len(ids) == 0 {
+		return roles, nil
+	}
+	if err := r.db.Where("id IN ?", ids).Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+// ListRolePermissions 获取指定角色的角色权限关联（包含权限）
+func (r *roleRepository) ListRolePermissions(roleIDs []uint) ([]models.RolePermission, error) {
+	var rolePermissions []models.RolePermission
+	if len(roleIDs) == 0 {
+		return rolePermissions, nil
+	}
+	if err := r.db.Preload("Permission").Where("role_id IN ?", roleIDs).Find(&rolePermissions).Error; err != nil {
+		return nil, err
+	}
+	return rolePermissions, nil
+}
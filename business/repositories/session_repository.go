@@ -0,0 +1,104 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/internal/database"
+	"gorm.io/gorm"
+)
+
+// SessionRepository 登录会话仓库接口
+type SessionRepository interface {
+	// Create 保存新会话
+	Create(session *models.UserSession) error
+	// GetBySessionID 根据会话ID获取会话
+	GetBySessionID(sessionID string) (*models.UserSession, error)
+	// ListActiveByUser 获取用户未吊销且未过期的会话，最近访问的在前
+	ListActiveByUser(userID uint) ([]*models.UserSession, error)
+	// Rotate 刷新令牌轮换后更新会话的访问令牌ID、过期时间和访问信息
+	Rotate(sessionID, accessJTI string, expiresAt time.Time, ip string) error
+	// Touch 更新最近访问时间和IP
+	Touch(sessionID, ip string, at time.Time) error
+	// Revoke 吊销单个会话，会话已吊销时返回false
+	Revoke(sessionID string, revokedBy uint) (bool, error)
+	// RevokeByUser 吊销用户的全部会话，返回吊销数量
+	RevokeByUser(userID, revokedBy uint) (int64, error)
+	// PurgeExpired 清理已过期的会话
+	PurgeExpired() error
+}
+
+// sessionRepository GORM实现
+type sessionRepository struct {
+	db *gorm.DB
+}
+
+// NewSessionRepository 创建登录会话仓库实例
+func NewSessionRepository() SessionRepository {
+	return &sessionRepository{
+		db: database.DB,
+	}
+}
+
+// Create 保存新会话
+func (r *sessionRepository) Create(session *models.UserSession) error {
+	return r.db.Create(session).Error
+}
+
+// GetBySessionID 根据会话ID获取会话
+func (r *sessionRepository) GetBySessionID(sessionID string) (*models.UserSession, error) {
+	var session models.UserSession
+	if err := r.db.Where("session_id = ?", sessionID).First(&session).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// ListActiveByUser 获取用户的有效会话
+func (r *sessionRepository) ListActiveByUser(userID uint) ([]*models.UserSession, error) {
+	var sessions []*models.UserSession
+	err := r.db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+// Rotate 刷新令牌轮换后更新会话
+func (r *sessionRepository) Rotate(sessionID, accessJTI string, expiresAt time.Time, ip string) error {
+	return r.db.Model(&models.UserSession{}).
+		Where("session_id = ? AND revoked_at IS NULL", sessionID).
+		Updates(map[string]interface{}{
+			"access_jti":   accessJTI,
+			"expires_at":   expiresAt,
+			"last_seen_ip": ip,
+			"last_seen_at": time.Now(),
+		}).Error
+}
+
+// Touch 更新最近访问时间和IP
+func (r *sessionRepository) Touch(sessionID, ip string, at time.Time) error {
+	return r.db.Model(&models.UserSession{}).
+		Where("session_id = ?", sessionID).
+		UpdateColumns(map[string]interface{}{"last_seen_at": at, "last_seen_ip": ip}).Error
+}
+
+// Revoke 条件更新，只吊销尚未吊销的会话
+func (r *sessionRepository) Revoke(sessionID string, revokedBy uint) (bool, error) {
+	result := r.db.Model(&models.UserSession{}).
+		Where("session_id = ? AND revoked_at IS NULL", sessionID).
+		Updates(map[string]interface{}{"revoked_at": time.Now(), "revoked_by": revokedBy})
+	return result.RowsAffected > 0, result.Error
+}
+
+// RevokeByUser 吊销用户的全部会话
+func (r *sessionRepository) RevokeByUser(userID, revokedBy uint) (int64, error) {
+	result := r.db.Model(&models.UserSession{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Updates(map[string]interface{}{"revoked_at": time.Now(), "revoked_by": revokedBy})
+	return result.RowsAffected, result.Error
+}
+
+// PurgeExpired 清理已过期的会话
+func (r *sessionRepository) PurgeExpired() error {
+	return r.db.Where("expires_at < ?", time.Now()).Delete(&models.UserSession{}).Error
+}
@@ -0,0 +1,138 @@
+package repositories
+
+import (
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/internal/database"
+	"gorm.io/gorm"
+)
+
+// TenantRepository 租户仓库接口
+type TenantRepository interface {
+	// Create 创建租户
+	Create(tenant *models.Tenant) error
+	// GetByID 根据ID获取租户
+	GetByID(id uint) (*models.Tenant, error)
+	// GetByCode 根据标识获取租户
+	GetByCode(code string) (*models.Tenant, error)
+	// List 获取全部租户
+	List() ([]models.Tenant, error)
+	// Delete 删除租户及其成员角色
+	Delete(id uint) error
+	// ListMembers 获取租户内的全部成员角色（包含用户和角色）
+	ListMembers(tenantID uint) ([]models.TenantUserRole, error)
+	// ReplaceMemberRoles 替换用户在租户内的角色，角色为空时移出租户
+	ReplaceMemberRoles(tenantID, userID uint, roleIDs []uint) error
+	// GetMemberRoles 获取用户在租户内的角色
+	GetMemberRoles(tenantID, userID uint) ([]models.Role, error)
+}
+
+// tenantRepository GORM实现
+type tenantRepository struct {
+	db *gorm.DB
+}
+
+// NewTenantRepository 创建租户仓库实例
+func NewTenantRepository() TenantRepository {
+	return &tenantRepository{
+		db: database.DB,
+	}
+}
+
+// TenantScope 将用户查询限定为租户成员，默认租户（tenantID为0）不限定
+func TenantScope(tenantID uint) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if tenantID == 0 {
+			return db
+		}
+		return db.Where("users.id IN (?)", db.Session(&gorm.Session{NewDB: true}).
+			Model(&models.TenantUserRole{}).Select("user_id").Where("tenant_id = ?", tenantID))
+	}
+}
+
+// Create 创建租户
+func (r *tenantRepository) Create(tenant *models.Tenant) error {
+	return r.db.Create(tenant).Error
+}
+
+// GetByID 根据ID获取租户
+func (r *tenantRepository) GetByID(id uint) (*models.Tenant, error) {
+	var tenant models.Tenant
+	if err := r.db.First(&tenant, id).Error; err != nil {
+		return nil, err
+	}
+	return &tenant, nil
+}
+
+// GetByCode 根据标识获取租户
+func (r *tenantRepository) GetByCode(code string) (*models.Tenant, error) {
+	var tenant models.Tenant
+	if err := r.db.Where("code = ?", code).First(&tenant).Error; err != nil {
+		return nil, err
+	}
+	return &tenant, nil
+}
+
+// List 获取全部租户
+func (r *tenantRepository) List() ([]models.Tenant, error) {
+	var tenants []models.Tenant
+	if err := r.db.Order("id").Find(&tenants).Error; err != nil {
+		return nil, err
+	}
+	return tenants, nil
+}
+
+// Delete 删除租户及其成员角色，并在同一事务中同步成员的Casbin规则
+func (r *tenantRepository) Delete(id uint) error {
+	return database.UpdatePolicyIn(r.db, func(tx *gorm.DB) (database.PolicyScope, error) {
+		var usernames []string
+		if err := tx.Model(&models.User{}).
+			Where("id IN (?)", tx.Model(&models.TenantUserRole{}).Select("user_id").Where("tenant_id = ?", id)).
+			Pluck("username", &usernames).Error; err != nil {
+			return database.PolicyScope{}, err
+		}
+		if err := tx.Where("tenant_id = ?", id).Delete(&models.TenantUserRole{}).Error; err != nil {
+			return database.PolicyScope{}, err
+		}
+		if err := tx.Delete(&models.Tenant{}, id).Error; err != nil {
+			return database.PolicyScope{}, err
+		}
+		return database.ScopeUsers(usernames...), nil
+	})
+}
+
+// ListMembers 获取租户内的全部成员角色
+func (r *tenantRepository) ListMembers(tenantID uint) ([]models.TenantUserRole, error) {
+	var members []models.TenantUserRole
+	if err := r.db.Preload("User").Preload("Role").Where("tenant_id = ?", tenantID).Order("user_id").Find(&members).Error; err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// ReplaceMemberRoles 替换用户在租户内的角色，并在同一事务中同步该用户的Casbin规则
+func (r *tenantRepository) ReplaceMemberRoles(tenantID, userID uint, roleIDs []uint) error {
+	return database.UpdatePolicyIn(r.db, func(tx *gorm.DB) (database.PolicyScope, error) {
+		var user models.User
+		if err := tx.Select("username").First(&user, userID).Error; err != nil {
+			return database.PolicyScope{}, err
+		}
+		if err := tx.Where("tenant_id = ? AND user_id = ?", tenantID, userID).Delete(&models.TenantUserRole{}).Error; err != nil {
+			return database.PolicyScope{}, err
+		}
+		for _, roleID := range roleIDs {
+			if err := tx.Create(&models.TenantUserRole{TenantID: tenantID, UserID: userID, RoleID: roleID}).Error; err != nil {
+				return database.PolicyScope{}, err
+			}
+		}
+		return database.ScopeUsers(user.Username), nil
+	})
+}
+
+// GetMemberRoles 获取用户在租户内的角色
+func (r *tenantRepository) GetMemberRoles(tenantID, userID uint) ([]models.Role, error) {
+	var roles []models.Role
+	err := r.db.Joins("JOIN tenant_user_roles ON tenant_user_roles.role_id = roles.id").
+		Where("tenant_user_roles.tenant_id = ? AND tenant_user_roles.user_id = ?", tenantID, userID).
+		Find(&roles).Error
+	return roles, err
+}
@@ -0,0 +1,145 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/internal/database"
+	"gorm.io/gorm"
+)
+
+// TokenRepository 令牌仓库接口
+type TokenRepository interface {
+	// CreateRefreshToken 保存刷新令牌
+	CreateRefreshToken(token *models.RefreshToken) error
+	// GetRefreshTokenByHash 根据哈希获取刷新令牌
+	GetRefreshTokenByHash(hash string) (*models.RefreshToken, error)
+	// RotateRefreshToken 吊销旧刷新令牌并保存新令牌
+	RotateRefreshToken(old *models.RefreshToken, next *models.RefreshToken) error
+	// RevokeRefreshTokenFamily 吊销同一令牌族下的全部刷新令牌
+	RevokeRefreshTokenFamily(familyID string) error
+	// RevokeRefreshTokensByAccessJTI 吊销与指定访问令牌配对的刷新令牌
+	RevokeRefreshTokensByAccessJTI(jti string) error
+	// RevokeAccessToken 将访问令牌加入吊销列表
+	RevokeAccessToken(jti string, userID uint, expiresAt time.Time) error
+	// IsAccessTokenRevoked 检查访问令牌是否已吊销
+	IsAccessTokenRevoked(jti string) (bool, error)
+	// RevokeUserTokens 吊销用户的全部刷新令牌及仍在有效期内的访问令牌
+	RevokeUserTokens(userID uint, accessTTL time.Duration) error
+	// PurgeExpired 清理已过期的吊销记录和刷新令牌
+	PurgeExpired() error
+}
+
+// tokenRepository GORM实现
+type tokenRepository struct {
+	db *gorm.DB
+}
+
+// NewTokenRepository 创建令牌仓库实例
+func NewTokenRepository() TokenRepository {
+	return &tokenRepository{
+		db: database.DB,
+	}
+}
+
+// CreateRefreshToken 保存刷新令牌
+func (r *tokenRepository) CreateRefreshToken(token *models.RefreshToken) error {
+	return r.db.Create(token).Error
+}
+
+// GetRefreshTokenByHash 根据哈希获取刷新令牌
+func (r *tokenRepository) GetRefreshTokenByHash(hash string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	if err := r.db.Where("token_hash = ?", hash).First(&token).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// RotateRefreshToken 吊销旧刷新令牌并保存新令牌
+func (r *tokenRepository) RotateRefreshToken(old *models.RefreshToken, next *models.RefreshToken) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(next).Error; err != nil {
+			return err
+		}
+		// 仅当旧令牌尚未被吊销时才更新，防止并发刷新时同一令牌被使用两次
+		now := time.Now()
+		result := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND revoked_at IS NULL", old.ID).
+			Updates(map[string]interface{}{"revoked_at": now, "replaced_by": next.ID})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		old.RevokedAt = &now
+		old.ReplacedBy = &next.ID
+		return nil
+	})
+}
+
+// RevokeRefreshTokenFamily 吊销同一令牌族下的全部刷新令牌
+func (r *tokenRepository) RevokeRefreshTokenFamily(familyID string) error {
+	return r.db.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RevokeRefreshTokensByAccessJTI 吊销与指定访问令牌配对的刷新令牌
+func (r *tokenRepository) RevokeRefreshTokensByAccessJTI(jti string) error {
+	return r.db.Model(&models.RefreshToken{}).
+		Where("access_jti = ? AND revoked_at IS NULL", jti).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RevokeAccessToken 将访问令牌加入吊销列表
+func (r *tokenRepository) RevokeAccessToken(jti string, userID uint, expiresAt time.Time) error {
+	revoked := models.RevokedToken{
+		JTI:       jti,
+		UserID:    userID,
+		ExpiresAt: expiresAt,
+	}
+	return r.db.Where(models.RevokedToken{JTI: jti}).FirstOrCreate(&revoked).Error
+}
+
+// IsAccessTokenRevoked 检查访问令牌是否已吊销
+func (r *tokenRepository) IsAccessTokenRevoked(jti string) (bool, error) {
+	var count int64
+	if err := r.db.Model(&models.RevokedToken{}).Where("jti = ?", jti).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// RevokeUserTokens 吊销用户的全部刷新令牌及仍在有效期内的访问令牌
+// 访问令牌与刷新令牌同时签发，签发时间在accessTTL之内的刷新令牌对应的访问令牌可能仍然有效
+func (r *tokenRepository) RevokeUserTokens(userID uint, accessTTL time.Duration) error {
+	now := time.Now()
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var jtis []string
+		if err := tx.Model(&models.RefreshToken{}).
+			Where("user_id = ? AND created_at > ? AND access_jti <> ''", userID, now.Add(-accessTTL)).
+			Pluck("access_jti", &jtis).Error; err != nil {
+			return err
+		}
+		for _, jti := range jtis {
+			revoked := models.RevokedToken{JTI: jti, UserID: userID, ExpiresAt: now.Add(accessTTL)}
+			if err := tx.Where(models.RevokedToken{JTI: jti}).FirstOrCreate(&revoked).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&models.RefreshToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", now).Error
+	})
+}
+
+// PurgeExpired 清理已过期的吊销记录和刷新令牌
+func (r *tokenRepository) PurgeExpired() error {
+	now := time.Now()
+	if err := r.db.Where("expires_at < ?", now).Delete(&models.RevokedToken{}).Error; err != nil {
+		return err
+	}
+	return r.db.Where("expires_at < ?", now).Delete(&models.RefreshToken{}).Error
+}
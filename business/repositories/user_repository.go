@@ -1,6 +1,11 @@
 package repositories
 
 import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
 	"github.com/GZ-Alinx/autops/business/models"
 	"github.com/GZ-Alinx/autops/internal/database"
 )
@@ -9,11 +14,15 @@ import (
 type UserRepository interface {
 	GetByID(id uint) (*models.User, error)
 	GetByUsername(username string) (*models.User, error)
+	GetByEmail(email string) (*models.User, error)
+	GetByExternalID(source, externalID string) (*models.User, error)
 	Create(user *models.User) error
 	Update(user *models.User) (int64, error)
 	Delete(id uint) error
-	List(page, pageSize int) ([]*models.User, int64, error)
+	List(tenantID uint, page, pageSize int) ([]*models.User, int64, error)
+	ListByType(userType string) ([]*models.User, error)
 	AssignRole(userID, roleID uint) error
+	ReplaceRoles(user *models.User, roles []models.Role) error
 }
 
 // userRepository GORM实现
@@ -27,25 +36,46 @@ func NewUserRepository() UserRepository {
 // GetByID 根据ID获取用户（包含角色）
 func (r *userRepository) GetByID(id uint) (*models.User, error) {
 	var user models.User
-	result := database.DB.Preload("Roles").First(&user, id)
-	return &user, result.Error
+	if err := database.DB.First(&user, id).Error; err != nil {
+		return &user, err
+	}
+	return &user, loadActiveRoles(database.DB, &user)
 }
 
 // GetByUsername 根据用户名获取用户（包含角色）
 func (r *userRepository) GetByUsername(username string) (*models.User, error) {
 	var user models.User
-	result := database.DB.Where("username = ?", username).Preload("Roles").First(&user)
+	if err := database.DB.Where("username = ?", username).First(&user).Error; err != nil {
+		return &user, err
+	}
+	return &user, loadActiveRoles(database.DB, &user)
+}
+
+// GetByEmail 根据邮箱获取用户
+func (r *userRepository) GetByEmail(email string) (*models.User, error) {
+	var user models.User
+	result := database.DB.Where("email = ?", email).First(&user)
 	return &user, result.Error
 }
 
+// GetByExternalID 根据认证源和外部唯一标识获取用户（包含角色）
+func (r *userRepository) GetByExternalID(source, externalID string) (*models.User, error) {
+	var user models.User
+	if err := database.DB.Where("source = ? AND external_id = ?", source, externalID).First(&user).Error; err != nil {
+		return &user, err
+	}
+	return &user, loadActiveRoles(database.DB, &user)
+}
+
 // Create 创建用户
 func (r *userRepository) Create(user *models.User) error {
 	return database.DB.Create(user).Error
 }
 
-// Update 更新用户
+// Update 更新用户，不写入角色关联：角色只通过AssignRole/ReplaceRoles和临时授权变更，
+// 避免把已到期回收的临时授权重新写回为长期角色
 func (r *userRepository) Update(user *models.User) (int64, error) {
-	result := database.DB.Save(user)
+	result := database.DB.Omit("Roles").Save(user)
 	return result.RowsAffected, result.Error
 }
 
@@ -54,19 +84,96 @@ func (r *userRepository) Delete(id uint) error {
 	return database.DB.Delete(&models.User{}, id).Error
 }
 
-// List 分页获取用户列表（包含角色）
-func (r *userRepository) List(page, pageSize int) ([]*models.User, int64, error) {
+// List 分页获取租户内的用户列表（包含角色），tenantID为0表示默认租户
+func (r *userRepository) List(tenantID uint, page, pageSize int) ([]*models.User, int64, error) {
 	var users []*models.User
 	var total int64
 
 	// 获取总数
-	database.DB.Model(&models.User{}).Count(&total)
+	database.DB.Model(&models.User{}).Scopes(TenantScope(tenantID)).Count(&total)
 
-	// 分页查询并预加载角色
+	// 分页查询并加载角色
 	offset := (page - 1) * pageSize
-	result := database.DB.Preload("Roles").Offset(offset).Limit(pageSize).Find(&users)
+	if tenantID == 0 {
+		if err := database.DB.Offset(offset).Limit(pageSize).Find(&users).Error; err != nil {
+			return nil, 0, err
+		}
+		return users, total, loadActiveRoles(database.DB, users...)
+	}
+	if err := database.DB.Scopes(TenantScope(tenantID)).Offset(offset).Limit(pageSize).Find(&users).Error; err != nil {
+		return nil, 0, err
+	}
+
+	// 非默认租户只返回用户在该租户内的角色
+	ids := make([]uint, 0, len(users))
+	for _, user := range users {
+		ids = append(ids, user.ID)
+	}
+	var members []models.TenantUserRole
+	if len(ids) > 0 {
+		if err := database.DB.Preload("Role").Where("tenant_id = ? AND user_id IN ?", tenantID, ids).Find(&members).Error; err != nil {
+			return nil, 0, err
+		}
+	}
+	roles := make(map[uint][]models.Role, len(users))
+	for _, m := range members {
+		roles[m.UserID] = append(roles[m.UserID], m.Role)
+	}
+	for _, user := range users {
+		user.Roles = roles[user.ID]
+	}
+	return users, total, nil
+}
+
+// ListByType 获取指定类型的全部用户（包含角色）
+func (r *userRepository) ListByType(userType string) ([]*models.User, error) {
+	var users []*models.User
+	if err := database.DB.Where("type = ?", userType).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return users, loadActiveRoles(database.DB, users...)
+}
+
+// loadActiveRoles 加载users在默认租户内当前生效的角色，跳过未生效、已到期或已删除的授权；
+// 不使用Preload("Roles")，因为它按user_roles全部行加载，不检查临时授权的有效期
+func loadActiveRoles(db *gorm.DB, users ...*models.User) error {
+	if len(users) == 0 {
+		return nil
+	}
+	ids := make([]uint, 0, len(users))
+	for _, user := range users {
+		ids = append(ids, user.ID)
+	}
 
-	return users, total, result.Error
+	var grants []models.UserRole
+	if err := db.Where("user_roles.user_id IN ?", ids).Scopes(models.ActiveUserRoles(time.Now())).Order("user_roles.role_id").Find(&grants).Error; err != nil {
+		return err
+	}
+	roleIDs := make([]uint, 0, len(grants))
+	for _, grant := range grants {
+		roleIDs = append(roleIDs, grant.RoleID)
+	}
+	var roles []models.Role
+	if len(roleIDs) > 0 {
+		if err := db.Where("id IN ?", roleIDs).Order("id").Find(&roles).Error; err != nil {
+			return err
+		}
+	}
+	byID := make(map[uint]models.Role, len(roles))
+	for _, role := range roles {
+		byID[role.ID] = role
+	}
+
+	byUser := make(map[uint][]models.Role, len(users))
+	for _, grant := range grants {
+		if role, ok := byID[grant.RoleID]; ok {
+			byUser[grant.UserID] = append(byUser[grant.UserID], role)
+		}
+	}
+	for _, user := range users {
+		user.Roles = byUser[user.ID]
+	}
+	return nil
 }
 
 // AssignRole 为用户分配角色
@@ -75,3 +182,35 @@ func (r *userRepository) AssignRole(userID, roleID uint) error {
 	result := database.DB.Exec("INSERT INTO user_roles (user_id, role_id) VALUES (?, ?)", userID, roleID)
 	return result.Error
 }
+
+// ReplaceRoles 替换用户的长期角色，临时授权保持不变
+func (r *userRepository) ReplaceRoles(user *models.User, roles []models.Role) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		return ReplaceUserRoles(tx, user.ID, roles)
+	})
+}
+
+// ReplaceUserRoles 在tx中把用户的长期角色替换为roles：列表中的角色成为长期角色（原为临时授权的转为长期），
+// 不在列表中的长期角色被移除；不在列表中的临时授权保持不变，到期后由回收任务移除
+func ReplaceUserRoles(tx *gorm.DB, userID uint, roles []models.Role) error {
+	roleIDs := make([]uint, 0, len(roles))
+	for _, role := range roles {
+		roleIDs = append(roleIDs, role.ID)
+	}
+	query := tx.Unscoped().Where("user_id = ? AND expires_at IS NULL", userID)
+	if len(roleIDs) > 0 {
+		query = query.Where("role_id NOT IN ?", roleIDs)
+	}
+	if err := query.Delete(&models.UserRole{}).Error; err != nil {
+		return err
+	}
+	for _, roleID := range roleIDs {
+		grant := models.UserRole{UserID: userID, RoleID: roleID}
+		if err := tx.Clauses(clause.OnConflict{
+			DoUpdates: clause.Assignments(map[string]interface{}{"not_before": nil, "expires_at": nil, "reason": "", "deleted_at": nil}),
+		}).Create(&grant).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
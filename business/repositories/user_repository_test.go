@@ -0,0 +1,158 @@
+package repositories
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	glog "gorm.io/gorm/logger"
+
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/internal/database"
+)
+
+// setupDB 使用内存SQLite替换database.DB，测试结束时恢复
+func setupDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: glog.Default.LogMode(glog.Silent)})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	// 内存数据库每个连接独立，只使用一个连接
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("获取连接失败: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.User{}, &models.Role{}, &models.UserRole{}); err != nil {
+		t.Fatalf("迁移失败: %v", err)
+	}
+
+	previous := database.DB
+	database.DB = db
+	t.Cleanup(func() {
+		database.DB = previous
+		sqlDB.Close()
+	})
+	return db
+}
+
+// roleNames 返回用户角色名
+func roleNames(user *models.User) []string {
+	names := make([]string, 0, len(user.Roles))
+	for _, role := range user.Roles {
+		names = append(names, role.Name)
+	}
+	return names
+}
+
+func TestUserRepositoryLoadsActiveRolesOnly(t *testing.T) {
+	db := setupDB(t)
+	now := time.Now()
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+
+	user := models.User{Username: "alice", Password: "x", Email: "alice@example.com"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+	grants := []struct {
+		role  string
+		grant models.UserRole
+	}{
+		{role: "permanent"},
+		{role: "temporary", grant: models.UserRole{NotBefore: &past, ExpiresAt: &future}},
+		{role: "expired", grant: models.UserRole{ExpiresAt: &past}},
+		{role: "pending", grant: models.UserRole{NotBefore: &future, ExpiresAt: &future}},
+		{role: "revoked"},
+		{role: "deleted_role"},
+	}
+	for _, g := range grants {
+		role := models.Role{Name: g.role}
+		if err := db.Create(&role).Error; err != nil {
+			t.Fatalf("创建角色失败: %v", err)
+		}
+		grant := g.grant
+		grant.UserID, grant.RoleID = user.ID, role.ID
+		if err := db.Create(&grant).Error; err != nil {
+			t.Fatalf("创建授权失败: %v", err)
+		}
+		switch g.role {
+		case "revoked":
+			db.Delete(&grant)
+		case "deleted_role":
+			db.Delete(&role)
+		}
+	}
+
+	want := "[permanent temporary]"
+	repo := NewUserRepository()
+	loads := map[string]func() (*models.User, error){
+		"GetByID":       func() (*models.User, error) { return repo.GetByID(user.ID) },
+		"GetByUsername": func() (*models.User, error) { return repo.GetByUsername("alice") },
+		"List": func() (*models.User, error) {
+			users, _, err := repo.List(0, 1, 10)
+			if err != nil || len(users) != 1 {
+				t.Fatalf("List返回%d个用户，错误: %v", len(users), err)
+			}
+			return users[0], nil
+		},
+	}
+	for name, load := range loads {
+		t.Run(name, func(t *testing.T) {
+			got, err := load()
+			if err != nil {
+				t.Fatalf("加载用户失败: %v", err)
+			}
+			if names := roleNames(got); fmt.Sprint(names) != want {
+				t.Fatalf("角色为%v，期望%s", names, want)
+			}
+		})
+	}
+}
+
+// TestUserRepositoryUpdateKeepsGrants 保存用户时不回写角色，已回收的临时授权不会被重新创建
+func TestUserRepositoryUpdateKeepsGrants(t *testing.T) {
+	db := setupDB(t)
+	repo := NewUserRepository()
+
+	user := models.User{Username: "bob", Password: "x", Email: "bob@example.com"}
+	role := models.Role{Name: "oncall"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+	if err := db.Create(&role).Error; err != nil {
+		t.Fatalf("创建角色失败: %v", err)
+	}
+	expires := time.Now().Add(time.Hour)
+	if err := db.Create(&models.UserRole{UserID: user.ID, RoleID: role.ID, ExpiresAt: &expires}).Error; err != nil {
+		t.Fatalf("创建授权失败: %v", err)
+	}
+
+	loaded, err := repo.GetByID(user.ID)
+	if err != nil || len(loaded.Roles) != 1 {
+		t.Fatalf("加载用户失败: %v，角色%v", err, roleNames(loaded))
+	}
+
+	// 加载用户后临时授权被回收任务删除
+	if err := db.Unscoped().Where("user_id = ?", user.ID).Delete(&models.UserRole{}).Error; err != nil {
+		t.Fatalf("删除授权失败: %v", err)
+	}
+
+	loaded.Nickname = "Bob"
+	if _, err := repo.Update(loaded); err != nil {
+		t.Fatalf("更新用户失败: %v", err)
+	}
+
+	var count int64
+	db.Unscoped().Model(&models.UserRole{}).Where("user_id = ?", user.ID).Count(&count)
+	if count != 0 {
+		t.Fatalf("更新用户重新写入了%d条角色授权", count)
+	}
+	var saved models.User
+	db.First(&saved, user.ID)
+	if saved.Nickname != "Bob" {
+		t.Fatalf("昵称为%q", saved.Nickname)
+	}
+}
@@ -1,6 +1,8 @@
 package routes
 
 import (
+	"net/http"
+
 	"github.com/GZ-Alinx/autops/business/controllers"
 	"github.com/GZ-Alinx/autops/business/repositories"
 	"github.com/GZ-Alinx/autops/business/services"
@@ -8,49 +10,183 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-// registerAPIRoutes 注册需要认证的API路由
-func registerAPIRoutes(api *gin.RouterGroup) {
+// registerAPIRoutes 注册需要认证的API路由，handler用于执行已批准的变更
+func registerAPIRoutes(api *gin.RouterGroup, loginGuard services.LoginGuard, handler http.Handler) {
 	userRepo := repositories.NewUserRepository()
 	userService := services.NewUserService(userRepo)
-	userController := controllers.NewUserController(userService)
+	tokenService := services.NewTokenService(repositories.NewTokenRepository(), repositories.NewSessionRepository(), userRepo)
+	mfaService := services.NewMFAService(repositories.NewMFARepository())
+	userController := controllers.NewUserController(userService, tokenService, mfaService, loginGuard, services.NewAuthenticatorFromConfig(userService, userRepo))
+	mfaController := controllers.NewMFAController(mfaService, userService)
+	sessionController := controllers.NewSessionController(tokenService, userService)
 
 	// 初始化用户控制器
 	permController := controllers.NewPermissionController()
 
-	// 用户需要权限检查的接口
-	userProtected := api.Group("/users")
-	userProtected.Use(middleware.CasbinMiddleware())
+	apiTokenService := services.NewAPITokenService(repositories.NewAPITokenRepository(), userRepo, repositories.NewRoleRepository())
+	apiTokenController := controllers.NewAPITokenController(apiTokenService, userService)
+	auditService := services.NewAuditService(repositories.NewAuditLogRepository())
+	auditController := controllers.NewAuditController(auditService)
+	impersonationController := controllers.NewImpersonationController(services.NewImpersonationService(userRepo, repositories.NewTokenRepository(), repositories.NewSessionRepository(), auditService))
+	permCheckController := controllers.NewPermissionCheckController(services.NewPermissionCheckService(), userRepo, repositories.NewTenantRepository())
+	policyTransferController := controllers.NewPolicyTransferController(services.NewPolicyTransferService(repositories.NewPolicyRepository(), auditService))
+	tenantController := controllers.NewTenantController(services.NewTenantService(repositories.NewTenantRepository(), userRepo, repositories.NewRoleRepository(), auditService))
+	changeService := services.NewChangeRequestService(repositories.NewChangeRequestRepository(), auditService, handler)
+	changeController := controllers.NewChangeRequestController(changeService)
+	elevationController := controllers.NewRoleElevationController(services.NewRoleElevationService(repositories.NewRoleElevationRepository(), userRepo, repositories.NewRoleRepository(), auditService))
+
+	// CasbinMiddleware将匹配permission.approval.rules的请求保存为待审批变更
+	middleware.SetChangeSubmitter(changeService)
+
+	// 模拟登录期间只能由用户本人执行的操作
+	denyImpersonation := middleware.DenyImpersonation()
+	// 用户账号、角色定义等全局资源只能在默认租户下管理
+	defaultTenantOnly := middleware.DefaultTenantOnly()
+
+	// 登出只需登录态，无需权限检查
+	api.POST("/user/logout", userController.Logout)
+
+	// 当前用户自助接口，只需登录态
+	me := api.Group("/me")
+	{
+		me.GET("/tokens", apiTokenController.ListMyTokens)
+		me.POST("/tokens", denyImpersonation, apiTokenController.CreateMyToken)
+		me.DELETE("/tokens/:id", denyImpersonation, apiTokenController.RevokeMyToken)
+		me.GET("/mfa", mfaController.GetStatus)
+		me.DELETE("/mfa", denyImpersonation, mfaController.Disable)
+		me.POST("/mfa/enroll", denyImpersonation, mfaController.Enroll)
+		me.POST("/mfa/verify", denyImpersonation, mfaController.Verify)
+		me.POST("/mfa/recovery-codes", denyImpersonation, mfaController.RegenerateRecoveryCodes)
+		me.GET("/sessions", sessionController.ListMySessions)
+		me.DELETE("/sessions", denyImpersonation, sessionController.RevokeMyOtherSessions)
+		me.DELETE("/sessions/:sid", sessionController.RevokeMySession)
+		me.DELETE("/impersonation", impersonationController.End)
+		me.POST("/permissions/check", permCheckController.CheckMine)
+	}
+
+	// 临时提权申请与审批，只需登录态；能否审批由角色负责人决定
+	elevation := api.Group("/role-elevations")
+	elevation.Use(defaultTenantOnly)
 	{
-		userProtected.POST("/register", userController.Register)
-		userProtected.GET("/:id", userController.GetUser)
-		userProtected.GET("/", userController.ListUsers)
-		userProtected.PUT("/:id", userController.UpdateUser)
-		userProtected.PUT("/:id/password", userController.UpdatePassword)
-		userProtected.DELETE("/:id", userController.DeleteUser)
+		elevation.POST("", denyImpersonation, elevationController.Request)
+		elevation.GET("", elevationController.ListMine)
+		elevation.DELETE("/:id", denyImpersonation, elevationController.Cancel)
+		elevation.GET("/reviews", elevationController.ListReviewable)
+		elevation.POST("/:id/approve", denyImpersonation, elevationController.Approve)
+		elevation.POST("/:id/reject", denyImpersonation, elevationController.Reject)
+	}
+
+	// 待审批变更，只需登录态；能否查看和审批由变更的审批角色决定
+	change := api.Group("/change-requests")
+	{
+		change.GET("", changeController.ListMine)
+		change.GET("/reviews", changeController.ListReviewable)
+		change.GET("/:id", changeController.Get)
+		change.DELETE("/:id", denyImpersonation, changeController.Cancel)
+		change.POST("/:id/approve", denyImpersonation, changeController.Approve)
+		change.POST("/:id/reject", denyImpersonation, changeController.Reject)
+	}
+
+	// 用户需要权限检查的接口，用户列表按当前租户过滤
+	userGroup := api.Group("/users")
+	userGroup.Use(middleware.CasbinMiddleware())
+	userProtected := protect(userGroup)
+	{
+		userProtected.POST("/register", "创建用户", defaultTenantOnly, userController.Register)
+		userProtected.GET("/:id", "查看用户详情", defaultTenantOnly, userController.GetUser)
+		userProtected.GET("/", "查看用户列表", userController.ListUsers)
+		userProtected.PUT("/:id", "更新用户信息", defaultTenantOnly, userController.UpdateUser)
+		userProtected.PUT("/:id/password", "更新用户密码", defaultTenantOnly, denyImpersonation, userController.UpdatePassword)
+		userProtected.PUT("/:id/password/reset", "重置用户密码", defaultTenantOnly, userController.ResetPassword)
+		userProtected.DELETE("/:id", "删除用户", defaultTenantOnly, userController.DeleteUser)
+		userProtected.DELETE("/:id/mfa", "重置用户两步验证", defaultTenantOnly, mfaController.ResetUserMFA)
+		userProtected.DELETE("/:id/lockout", "解除用户登录锁定", defaultTenantOnly, userController.UnlockUser)
+		userProtected.DELETE("/:id/sessions", "强制用户下线", defaultTenantOnly, sessionController.ForceLogout)
+		userProtected.PUT("/:id/status", "变更用户账号状态", defaultTenantOnly, userController.UpdateUserStatus)
+	}
+
+	// 租户管理接口
+	tenantGroup := api.Group("/tenants")
+	tenantGroup.Use(defaultTenantOnly, middleware.CasbinMiddleware())
+	tenant := protect(tenantGroup)
+	{
+		tenant.POST("/", "创建租户", denyImpersonation, tenantController.Create)
+		tenant.GET("/", "获取租户列表", tenantController.List)
+		tenant.GET("/:id", "获取租户详情", tenantController.Get)
+		tenant.DELETE("/:id", "删除租户", tenantController.Delete)
+	}
+
+	// 当前租户（X-Tenant）的成员管理接口
+	tenantMemberGroup := api.Group("/tenant-members")
+	tenantMemberGroup.Use(middleware.CasbinMiddleware())
+	tenantMember := protect(tenantMemberGroup)
+	{
+		tenantMember.GET("/", "获取当前租户成员", tenantController.ListMembers)
+		tenantMember.PUT("/", "设置当前租户成员角色", tenantController.SetMember)
 	}
 
 	// 权限管理接口
-	perm := api.Group("/permissions")
-	perm.Use(middleware.CasbinMiddleware())
+	permGroup := api.Group("/permissions")
+	permGroup.Use(defaultTenantOnly, middleware.CasbinMiddleware())
+	perm := protect(permGroup)
 	{
-		perm.POST("/policy", permController.AddPolicy)
-		perm.DELETE("/policy", permController.RemovePolicy)
-		perm.GET("/policies", permController.GetPolicies)
-		perm.PUT("/user-role", permController.UpdateUserRole)
-		perm.POST("/role-permission", permController.AssignPermissionToRole)
-		perm.DELETE("/role-permission", permController.RemovePermissionFromRole)
+		perm.POST("/policy", "添加权限策略", permController.AddPolicy)
+		perm.DELETE("/policy", "删除权限策略", permController.RemovePolicy)
+		perm.GET("/policies", "获取所有权限策略", permController.GetPolicies)
+		perm.GET("/reconcile", "检查策略漂移", permController.CheckPolicyDrift)
+		perm.POST("/reconcile", "修复策略漂移", permController.ReconcilePolicy)
+		perm.POST("/check", "检查权限并解释原因", permCheckController.Check)
+		perm.POST("/check/batch", "批量检查权限并解释原因", permCheckController.BatchCheck)
+		perm.PUT("/user-role", "更新用户角色", permController.UpdateUserRole)
+		perm.POST("/role-grants", "临时授予用户角色", elevationController.Grant)
+		perm.GET("/role-grants", "查看临时授权", elevationController.ListGrants)
+		perm.POST("/role-permission", "角色权限关联添加", permController.AssignPermissionToRole)
+		perm.DELETE("/role-permission", "角色权限关联删除", permController.RemovePermissionFromRole)
+		perm.GET("/export", "导出权限配置", policyTransferController.Export)
+		perm.POST("/import", "导入权限配置", policyTransferController.Import)
 	}
 
 	// 角色管理接口
-	role := api.Group("/roles")
-	role.Use(middleware.CasbinMiddleware())
+	roleGroup := api.Group("/roles")
+	roleGroup.Use(defaultTenantOnly, middleware.CasbinMiddleware())
+	role := protect(roleGroup)
+	{
+		role.POST("/", "创建角色", permController.CreateRole)
+		role.GET("/", "查看角色列表", permController.GetAllRoles)
+		role.GET("/:id", "查看角色详情", permController.GetRoleByID)
+		role.GET("/:id/permissions", "查看角色继承后的有效权限", permController.GetRoleEffectivePermissions)
+		role.PUT("/", "更新角色信息", permController.UpdateRole)
+		role.DELETE("/:id", "删除角色", permController.DeleteRole)
+	}
+	// 服务账号管理接口
+	serviceAccountGroup := api.Group("/service-accounts")
+	serviceAccountGroup.Use(defaultTenantOnly, middleware.CasbinMiddleware())
+	serviceAccount := protect(serviceAccountGroup)
 	{
-		role.POST("/", permController.CreateRole)
-		role.GET("/", permController.GetAllRoles)
-		role.GET("/:id", permController.GetRoleByID)
-		role.PUT("/", permController.UpdateRole)
-		role.DELETE("/:id", permController.DeleteRole)
+		serviceAccount.POST("/", "创建服务账号", apiTokenController.CreateServiceAccount)
+		serviceAccount.GET("/", "查看服务账号列表", apiTokenController.ListServiceAccounts)
+		serviceAccount.DELETE("/:id", "删除服务账号", apiTokenController.DeleteServiceAccount)
+		serviceAccount.GET("/:id/tokens", "查看服务账号令牌", apiTokenController.ListServiceAccountTokens)
+		serviceAccount.POST("/:id/tokens", "创建服务账号令牌", apiTokenController.CreateServiceAccountToken)
+		serviceAccount.DELETE("/:id/tokens/:tokenId", "吊销服务账号令牌", apiTokenController.RevokeServiceAccountToken)
 	}
+
+	// 模拟登录接口，模拟期间不能再次发起
+	impersonationGroup := api.Group("/impersonations")
+	impersonationGroup.Use(defaultTenantOnly, middleware.CasbinMiddleware())
+	impersonation := protect(impersonationGroup)
+	{
+		impersonation.POST("", "模拟用户登录", denyImpersonation, impersonationController.Start)
+	}
+
+	// 审计日志接口
+	auditGroup := api.Group("/audit-logs")
+	auditGroup.Use(defaultTenantOnly, middleware.CasbinMiddleware())
+	audit := protect(auditGroup)
+	{
+		audit.GET("", "查看审计日志", auditController.List)
+	}
+
 	// 可以根据实际业务需求修改
 	example := api.Group("/test")
 	{
@@ -0,0 +1,84 @@
+package routes
+
+import (
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/GZ-Alinx/autops/internal/database"
+)
+
+// routeDescriptions 需要权限检查的路由及其权限描述，键为"方法 路由模板"
+var routeDescriptions = map[string]string{}
+
+// protectedGroup 需要权限检查的路由组，注册路由时同时记录权限描述，用于按路由表自动注册权限
+type protectedGroup struct {
+	group *gin.RouterGroup
+}
+
+// protect 包装已挂载CasbinMiddleware的路由组
+func protect(group *gin.RouterGroup) protectedGroup {
+	return protectedGroup{group: group}
+}
+
+// handle 注册路由并记录权限描述
+func (p protectedGroup) handle(method, relativePath, description string, handlers ...gin.HandlerFunc) {
+	p.group.Handle(method, relativePath, handlers...)
+	routeDescriptions[method+" "+joinPaths(p.group.BasePath(), relativePath)] = description
+}
+
+// GET 注册GET路由
+func (p protectedGroup) GET(relativePath, description string, handlers ...gin.HandlerFunc) {
+	p.handle(http.MethodGet, relativePath, description, handlers...)
+}
+
+// POST 注册POST路由
+func (p protectedGroup) POST(relativePath, description string, handlers ...gin.HandlerFunc) {
+	p.handle(http.MethodPost, relativePath, description, handlers...)
+}
+
+// PUT 注册PUT路由
+func (p protectedGroup) PUT(relativePath, description string, handlers ...gin.HandlerFunc) {
+	p.handle(http.MethodPut, relativePath, description, handlers...)
+}
+
+// DELETE 注册DELETE路由
+func (p protectedGroup) DELETE(relativePath, description string, handlers ...gin.HandlerFunc) {
+	p.handle(http.MethodDelete, relativePath, description, handlers...)
+}
+
+// joinPaths 与gin拼接路由组路径的规则一致：保留相对路径末尾的/
+func joinPaths(absolutePath, relativePath string) string {
+	if relativePath == "" {
+		return absolutePath
+	}
+	finalPath := path.Join(absolutePath, relativePath)
+	if strings.HasSuffix(relativePath, "/") && !strings.HasSuffix(finalPath, "/") {
+		return finalPath + "/"
+	}
+	return finalPath
+}
+
+// RegisterRoutePermissions 遍历路由表，为需要权限检查的路由注册权限
+func RegisterRoutePermissions(router *gin.Engine) error {
+	return database.RegisterRoutePermissions(ProtectedRoutes(router))
+}
+
+// ProtectedRoutes 路由表中需要权限检查的路由
+func ProtectedRoutes(router *gin.Engine) []database.RoutePermission {
+	var routes []database.RoutePermission
+	for _, route := range router.Routes() {
+		description, ok := routeDescriptions[route.Method+" "+route.Path]
+		if !ok {
+			continue
+		}
+		routes = append(routes, database.RoutePermission{
+			Method:      route.Method,
+			Path:        route.Path,
+			Description: description,
+		})
+	}
+	return routes
+}
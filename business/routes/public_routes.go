@@ -4,21 +4,44 @@ import (
 	"github.com/GZ-Alinx/autops/business/controllers"
 	"github.com/GZ-Alinx/autops/business/repositories"
 	"github.com/GZ-Alinx/autops/business/services"
+	"github.com/GZ-Alinx/autops/internal/mailer"
+	"github.com/GZ-Alinx/autops/internal/middleware"
 	"github.com/GZ-Alinx/autops/internal/response"
 	"github.com/gin-gonic/gin"
 )
 
 // registerPublicRoutes 注册公开路由
-func registerPublicRoutes(router *gin.Engine) {
+func registerPublicRoutes(router *gin.Engine, loginGuard services.LoginGuard) {
 	// 健康检查接口
 	router.GET("/health", func(c *gin.Context) {
 		response.Success(c, "OK")
 	})
 
+	// JWKS公钥，供其他服务离线验证令牌
+	router.GET("/.well-known/jwks.json", middleware.JWKSHandler)
+
 	// 用户登录路由
 	userRepo := repositories.NewUserRepository()
 	userService := services.NewUserService(userRepo)
-	userController := controllers.NewUserController(userService)
+	tokenService := services.NewTokenService(repositories.NewTokenRepository(), repositories.NewSessionRepository(), userRepo)
+	mfaService := services.NewMFAService(repositories.NewMFARepository())
+	userController := controllers.NewUserController(userService, tokenService, mfaService, loginGuard, services.NewAuthenticatorFromConfig(userService, userRepo))
 	router.POST("/api/v1/user/login", userController.Login)
+	router.POST("/api/v1/user/login/mfa", userController.LoginMFA)
+	router.POST("/api/v1/user/login/mfa/enroll", userController.LoginMFAEnroll)
+	router.POST("/api/v1/user/password/change", userController.ChangeExpiredPassword)
+
+	// OIDC单点登录
+	oidcController := controllers.NewOIDCController(services.NewOIDCServiceFromConfig(userRepo), userController)
+	router.GET("/api/v1/user/oidc/login", oidcController.Login)
+	router.GET("/api/v1/user/oidc/callback", oidcController.Callback)
+	router.POST("/api/v1/user/oidc/callback", oidcController.Callback)
+
+	// 自助找回密码
+	resetService := services.NewPasswordResetService(repositories.NewPasswordResetRepository(), userRepo, userService, tokenService, mailer.NewFromConfig())
+	resetController := controllers.NewPasswordResetController(resetService, loginGuard, services.NewPasswordResetGuardFromConfig())
+	router.POST("/api/v1/user/password/forgot", resetController.Forgot)
+	router.POST("/api/v1/user/password/reset", resetController.Reset)
+	router.POST("/api/v1/user/refresh", userController.Refresh)
 
 }
@@ -1,6 +1,7 @@
 package routes
 
 import (
+	"github.com/GZ-Alinx/autops/business/services"
 	"github.com/GZ-Alinx/autops/internal/middleware"
 	"github.com/gin-gonic/gin"
 )
@@ -11,11 +12,15 @@ func RegisterRoutes(router *gin.Engine) {
 	router.Use(middleware.CorsMiddleware())
 	router.Use(gin.Recovery())
 
+	// 登录防护在公开路由和API路由之间共享，保证内存计数一致
+	loginGuard := services.NewLoginGuardFromConfig()
+
 	// 公开路由
-	registerPublicRoutes(router)
+	registerPublicRoutes(router, loginGuard)
 
 	// API路由组
 	api := router.Group("/api/v1")
-	api.Use(middleware.JWTMiddleware()) // 应用JWT认证中间件
-	registerAPIRoutes(api)
+	api.Use(middleware.JWTMiddleware())    // 应用JWT认证中间件
+	api.Use(middleware.TenantMiddleware()) // 解析当前租户
+	registerAPIRoutes(api, loginGuard, router)
 }
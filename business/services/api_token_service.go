@@ -0,0 +1,216 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/business/repositories"
+	"github.com/GZ-Alinx/autops/internal/logger"
+	"github.com/GZ-Alinx/autops/internal/middleware"
+)
+
+var (
+	// ErrAPITokenNotFound 令牌不存在或不属于该用户
+	ErrAPITokenNotFound = errors.New("API令牌不存在")
+	// ErrInvalidTokenScope 令牌限定的角色超出所属用户的角色范围
+	ErrInvalidTokenScope = errors.New("令牌角色范围必须是所属用户角色的子集")
+	// ErrServiceAccountNotFound 服务账号不存在
+	ErrServiceAccountNotFound = errors.New("服务账号不存在")
+)
+
+// APITokenService API令牌与服务账号服务接口
+type APITokenService interface {
+	// CreateToken 为用户或服务账号创建令牌，返回仅展示一次的令牌明文
+	CreateToken(owner *models.User, name string, scopes []string, expiresAt *time.Time, createdBy uint) (string, *models.APIToken, error)
+	// ListTokens 获取用户的全部令牌
+	ListTokens(userID uint) ([]models.APIToken, error)
+	// RevokeToken 吊销用户的指定令牌
+	RevokeToken(userID, tokenID uint) error
+	// CreateServiceAccount 创建服务账号并分配角色
+	CreateServiceAccount(name, description string, roles []string) (*models.User, error)
+	// GetServiceAccount 获取服务账号
+	GetServiceAccount(id uint) (*models.User, error)
+	// ListServiceAccounts 获取全部服务账号
+	ListServiceAccounts() ([]*models.User, error)
+	// DeleteServiceAccount 删除服务账号并吊销其全部令牌
+	DeleteServiceAccount(id uint) error
+}
+
+// apiTokenService 服务实现
+type apiTokenService struct {
+	repo     repositories.APITokenRepository
+	userRepo repositories.UserRepository
+	roleRepo repositories.RoleRepository
+}
+
+// NewAPITokenService 创建API令牌服务实例
+func NewAPITokenService(repo repositories.APITokenRepository, userRepo repositories.UserRepository, roleRepo repositories.RoleRepository) APITokenService {
+	return &apiTokenService{
+		repo:     repo,
+		userRepo: userRepo,
+		roleRepo: roleRepo,
+	}
+}
+
+// CreateToken 为用户或服务账号创建令牌，返回仅展示一次的令牌明文
+func (s *apiTokenService) CreateToken(owner *models.User, name string, scopes []string, expiresAt *time.Time, createdBy uint) (string, *models.APIToken, error) {
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return "", nil, errors.New("过期时间必须晚于当前时间")
+	}
+
+	// 校验令牌角色范围
+	ownerRoles := make(map[string]bool)
+	for _, role := range owner.Roles {
+		ownerRoles[role.Name] = true
+	}
+	var normalized []string
+	for _, scope := range scopes {
+		scope = strings.TrimSpace(scope)
+		if scope == "" {
+			continue
+		}
+		if !ownerRoles[scope] {
+			return "", nil, ErrInvalidTokenScope
+		}
+		normalized = append(normalized, scope)
+	}
+
+	secret, err := randomToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+	raw := middleware.APITokenPrefix + secret
+
+	token := &models.APIToken{
+		Name:      name,
+		UserID:    owner.ID,
+		Prefix:    raw[:len(middleware.APITokenPrefix)+6],
+		TokenHash: middleware.HashToken(raw),
+		Scopes:    strings.Join(normalized, ","),
+		ExpiresAt: expiresAt,
+		CreatedBy: createdBy,
+	}
+	if err := s.repo.Create(token); err != nil {
+		logger.Logger.Error("创建API令牌失败", zap.Uint("userID", owner.ID), zap.Error(err))
+		return "", nil, err
+	}
+
+	logger.Logger.Info("创建API令牌成功", zap.Uint("userID", owner.ID), zap.Uint("tokenID", token.ID), zap.Strings("scopes", normalized))
+	return raw, token, nil
+}
+
+// ListTokens 获取用户的全部令牌
+func (s *apiTokenService) ListTokens(userID uint) ([]models.APIToken, error) {
+	return s.repo.ListByUser(userID)
+}
+
+// RevokeToken 吊销用户的指定令牌
+func (s *apiTokenService) RevokeToken(userID, tokenID uint) error {
+	token, err := s.repo.GetByID(tokenID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrAPITokenNotFound
+		}
+		return err
+	}
+	if token.UserID != userID {
+		return ErrAPITokenNotFound
+	}
+
+	if err := s.repo.Revoke(tokenID); err != nil {
+		return err
+	}
+	logger.Logger.Info("吊销API令牌成功", zap.Uint("userID", userID), zap.Uint("tokenID", tokenID))
+	return nil
+}
+
+// CreateServiceAccount 创建服务账号并分配角色
+func (s *apiTokenService) CreateServiceAccount(name, description string, roles []string) (*models.User, error) {
+	existing, _ := s.userRepo.GetByUsername(name)
+	if existing.ID > 0 {
+		return nil, errors.New("用户名已存在")
+	}
+
+	roleList, err := s.roleRepo.GetByNameIn(roles)
+	if err != nil {
+		return nil, err
+	}
+	if len(roleList) != len(roles) {
+		return nil, errors.New("部分角色不存在")
+	}
+
+	// 服务账号不能通过密码登录，写入随机密码哈希占位
+	placeholder, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(placeholder), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	account := &models.User{
+		Username: name,
+		Password: string(hashedPassword),
+		Email:    fmt.Sprintf("%s@service-account.local", name),
+		Nickname: description,
+		Status:   1,
+		Type:     models.UserTypeService,
+	}
+	if err := s.userRepo.Create(account); err != nil {
+		return nil, err
+	}
+
+	for _, role := range roleList {
+		if err := s.userRepo.AssignRole(account.ID, role.ID); err != nil {
+			logger.Logger.Error("为服务账号分配角色失败", zap.Uint("userID", account.ID), zap.String("role", role.Name), zap.Error(err))
+			return nil, err
+		}
+	}
+	account.Roles = roleList
+
+	logger.Logger.Info("创建服务账号成功", zap.Uint("userID", account.ID), zap.String("name", name), zap.Strings("roles", roles))
+	return account, nil
+}
+
+// GetServiceAccount 获取服务账号
+func (s *apiTokenService) GetServiceAccount(id uint) (*models.User, error) {
+	account, err := s.userRepo.GetByID(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrServiceAccountNotFound
+		}
+		return nil, err
+	}
+	if account.Type != models.UserTypeService {
+		return nil, ErrServiceAccountNotFound
+	}
+	return account, nil
+}
+
+// ListServiceAccounts 获取全部服务账号
+func (s *apiTokenService) ListServiceAccounts() ([]*models.User, error) {
+	return s.userRepo.ListByType(models.UserTypeService)
+}
+
+// DeleteServiceAccount 删除服务账号并吊销其全部令牌
+func (s *apiTokenService) DeleteServiceAccount(id uint) error {
+	if _, err := s.GetServiceAccount(id); err != nil {
+		return err
+	}
+	if err := s.repo.RevokeByUser(id); err != nil {
+		return err
+	}
+	if err := s.userRepo.Delete(id); err != nil {
+		return err
+	}
+	logger.Logger.Info("删除服务账号成功", zap.Uint("userID", id))
+	return nil
+}
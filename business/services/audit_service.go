@@ -0,0 +1,78 @@
+package services
+
+import (
+	"encoding/json"
+
+	"go.uber.org/zap"
+
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/business/repositories"
+	"github.com/GZ-Alinx/autops/internal/logger"
+)
+
+// Actor 操作人，模拟登录期间为真实操作人
+type Actor struct {
+	ID         uint
+	Username   string
+	IP         string
+	OnBehalfOf uint // 模拟登录期间被模拟的用户ID
+}
+
+// SystemActor 系统自动执行的操作（如账号到期）
+var SystemActor = Actor{Username: "system"}
+
+// AuditService 审计日志服务接口
+type AuditService interface {
+	// Record 记录审计事件，detail序列化为JSON；写入失败只记录错误日志，不影响业务操作
+	Record(actor Actor, action, targetType, targetID string, detail interface{})
+	// List 分页查询审计日志
+	List(filter repositories.AuditLogFilter, page, pageSize int) ([]*models.AuditLog, int64, error)
+}
+
+// auditService 服务实现
+type auditService struct {
+	repo repositories.AuditLogRepository
+}
+
+// NewAuditService 创建审计日志服务实例
+func NewAuditService(repo repositories.AuditLogRepository) AuditService {
+	return &auditService{repo: repo}
+}
+
+// Record 记录审计事件，同时写入业务日志
+func (s *auditService) Record(actor Actor, action, targetType, targetID string, detail interface{}) {
+	var detailJSON string
+	if detail != nil {
+		if buf, err := json.Marshal(detail); err == nil {
+			detailJSON = string(buf)
+		}
+	}
+
+	logger.GetBusinessLogger().Info("审计事件",
+		zap.String("action", action),
+		zap.Uint("actorID", actor.ID),
+		zap.String("actor", actor.Username),
+		zap.String("ip", actor.IP),
+		zap.Uint("onBehalfOf", actor.OnBehalfOf),
+		zap.String("targetType", targetType),
+		zap.String("targetID", targetID),
+		zap.String("detail", detailJSON))
+
+	if err := s.repo.Create(&models.AuditLog{
+		ActorID:    actor.ID,
+		ActorName:  actor.Username,
+		OnBehalfOf: actor.OnBehalfOf,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Detail:     detailJSON,
+		IP:         actor.IP,
+	}); err != nil {
+		logger.Logger.Error("写入审计日志失败", zap.String("action", action), zap.Error(err))
+	}
+}
+
+// List 分页查询审计日志
+func (s *auditService) List(filter repositories.AuditLogFilter, page, pageSize int) ([]*models.AuditLog, int64, error) {
+	return s.repo.List(filter, page, pageSize)
+}
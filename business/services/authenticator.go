@@ -0,0 +1,129 @@
+package services
+
+import (
+	"errors"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/business/repositories"
+	"github.com/GZ-Alinx/autops/internal/config"
+	"github.com/GZ-Alinx/autops/internal/logger"
+)
+
+var (
+	// ErrInvalidCredentials 用户名或密码错误
+	ErrInvalidCredentials = errors.New("用户名或密码错误")
+	// ErrAuthUserNotFound 当前认证方式中不存在该用户，由下一个认证方式继续处理
+	ErrAuthUserNotFound = errors.New("认证源中不存在该用户")
+	// ErrAuthUnavailable 认证源不可用
+	ErrAuthUnavailable = errors.New("认证服务暂不可用")
+)
+
+// AuthResult 认证结果
+type AuthResult struct {
+	User         *models.User
+	Source       string // 完成认证的认证源
+	RolesChanged bool   // 认证过程中同步了用户角色，需要重新同步Casbin策略
+}
+
+// Authenticator 用户名密码认证接口
+type Authenticator interface {
+	// Name 认证源名称
+	Name() string
+	// Authenticate 校验用户名和密码，用户不存在时返回ErrAuthUserNotFound，密码错误时返回ErrInvalidCredentials
+	Authenticate(username, password string) (*AuthResult, error)
+}
+
+// authenticatorChain 按顺序尝试多个认证源
+type authenticatorChain struct {
+	authenticators []Authenticator
+}
+
+// NewAuthenticatorChain 创建认证链，前一个认证源中不存在的用户交给下一个认证源处理
+func NewAuthenticatorChain(authenticators ...Authenticator) Authenticator {
+	return &authenticatorChain{authenticators: authenticators}
+}
+
+// NewAuthenticatorFromConfig 根据配置创建登录认证链，启用LDAP时LDAP优先、本地账号兜底
+func NewAuthenticatorFromConfig(userService UserService, userRepo repositories.UserRepository) Authenticator {
+	local := NewLocalAuthenticator(userService)
+	if !config.AppConfig.LDAP.Enabled {
+		return local
+	}
+	provisioner := NewUserProvisioner(userRepo, repositories.NewRoleRepository())
+	return NewAuthenticatorChain(NewLDAPAuthenticator(config.AppConfig.LDAP, provisioner), local)
+}
+
+// Name 认证源名称
+func (c *authenticatorChain) Name() string {
+	return "chain"
+}
+
+// Authenticate 依次尝试各认证源
+func (c *authenticatorChain) Authenticate(username, password string) (*AuthResult, error) {
+	var unavailable error
+	for _, a := range c.authenticators {
+		result, err := a.Authenticate(username, password)
+		switch {
+		case err == nil:
+			return result, nil
+		case errors.Is(err, ErrAuthUserNotFound):
+			continue
+		case errors.Is(err, ErrAuthUnavailable):
+			// 认证源故障时继续尝试后续认证源，保证本地管理员在目录故障时仍可登录
+			logger.Logger.Error("认证源不可用", zap.String("authenticator", a.Name()), zap.Error(err))
+			unavailable = err
+			continue
+		default:
+			return nil, err
+		}
+	}
+	if unavailable != nil {
+		return nil, unavailable
+	}
+	return nil, ErrInvalidCredentials
+}
+
+// localAuthenticator 使用数据库中的bcrypt密码认证
+type localAuthenticator struct {
+	userService UserService
+}
+
+// NewLocalAuthenticator 创建本地账号认证源
+func NewLocalAuthenticator(userService UserService) Authenticator {
+	return &localAuthenticator{userService: userService}
+}
+
+// Name 认证源名称
+func (a *localAuthenticator) Name() string {
+	return models.UserSourceLocal
+}
+
+// Authenticate 校验本地密码
+func (a *localAuthenticator) Authenticate(username, password string) (*AuthResult, error) {
+	user, err := a.userService.GetUserByUsername(username)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAuthUserNotFound
+		}
+		return nil, err
+	}
+
+	// 服务账号只能通过API令牌访问
+	if user.Type == models.UserTypeService {
+		logger.Logger.Warn("用户登录失败: 服务账号不允许密码登录", zap.String("username", user.Username))
+		return nil, ErrInvalidCredentials
+	}
+	// 外部账号的本地密码为随机值，不能用于登录
+	if user.Source != "" && user.Source != models.UserSourceLocal {
+		logger.Logger.Warn("用户登录失败: 外部账号不能使用本地密码登录", zap.String("username", user.Username), zap.String("source", user.Source))
+		return nil, ErrInvalidCredentials
+	}
+
+	if !a.userService.VerifyPassword(user, password) {
+		return nil, ErrInvalidCredentials
+	}
+	return &AuthResult{User: user, Source: models.UserSourceLocal}, nil
+}
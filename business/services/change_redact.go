@@ -0,0 +1,183 @@
+package services
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/GZ-Alinx/autops/internal/config"
+)
+
+// redactedValue 替换敏感字段值的占位符
+const redactedValue = "******"
+
+// changeSecretKeys 字段名（不区分大小写）包含其中任一词时视为敏感字段
+var changeSecretKeys = []string{"password", "token", "secret"}
+
+// isSecretKey 字段名是否为敏感字段
+func isSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, secret := range changeSecretKeys {
+		if strings.Contains(key, secret) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactBody 替换请求体或响应内容中的敏感字段，返回替换后的内容和被替换的字段；
+// 支持JSON和表单，其他类型原样返回
+func redactBody(contentType, body string) (string, []string) {
+	if body == "" {
+		return body, nil
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "application/x-www-form-urlencoded":
+		return redactForm(body)
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		return redactJSON(body)
+	default:
+		return body, nil
+	}
+}
+
+// redactJSON 替换JSON中的敏感字段，无法解析时原样返回
+func redactJSON(body string) (string, []string) {
+	decoder := json.NewDecoder(strings.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return body, nil
+	}
+	fields := make(map[string]bool)
+	value = redactValue(value, "", fields)
+	if len(fields) == 0 {
+		return body, nil
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return redactedValue, sortedKeys(fields)
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), sortedKeys(fields)
+}
+
+// redactValue 递归替换敏感字段的字符串和数组值，path为字段路径（如user.password）
+func redactValue(value interface{}, path string, fields map[string]bool) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			childPath := key
+			if path != "" {
+				childPath = path + "." + key
+			}
+			if isSecretKey(key) {
+				switch child.(type) {
+				case string, []interface{}:
+					v[key] = redactedValue
+					fields[childPath] = true
+					continue
+				}
+			}
+			v[key] = redactValue(child, childPath, fields)
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = redactValue(child, path+"[]", fields)
+		}
+	}
+	return value
+}
+
+// redactForm 替换表单中的敏感字段
+func redactForm(body string) (string, []string) {
+	values, err := url.ParseQuery(body)
+	if err != nil {
+		return body, nil
+	}
+	var fields []string
+	for key, vs := range values {
+		if isSecretKey(key) {
+			for i := range vs {
+				vs[i] = redactedValue
+			}
+			fields = append(fields, key)
+		}
+	}
+	if len(fields) == 0 {
+		return body, nil
+	}
+	sort.Strings(fields)
+	return values.Encode(), fields
+}
+
+// sortedKeys 返回排序后的字段列表
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// changeCipher 使用permission.approval.secret_key派生的AES-256-GCM，未配置时返回nil
+func changeCipher() (cipher.AEAD, error) {
+	secret := config.AppConfig.Permission.Approval.SecretKey
+	if secret == "" {
+		return nil, nil
+	}
+	key := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealChangeBody 加密保存包含敏感字段的原始请求体，执行时解密
+func sealChangeBody(aead cipher.AEAD, body string) (string, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(body), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// openChangeBody 解密原始请求体
+func openChangeBody(sealed string) (string, error) {
+	aead, err := changeCipher()
+	if err != nil {
+		return "", err
+	}
+	if aead == nil {
+		return "", errors.New("未配置permission.approval.secret_key，无法解密请求体")
+	}
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < aead.NonceSize() {
+		return "", errors.New("加密的请求体格式错误")
+	}
+	plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("解密请求体失败，permission.approval.secret_key可能已变更: %v", err)
+	}
+	return string(plain), nil
+}
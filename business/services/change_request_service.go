@@ -0,0 +1,430 @@
+package services
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/business/repositories"
+	"github.com/GZ-Alinx/autops/internal/config"
+	"github.com/GZ-Alinx/autops/internal/logger"
+	"github.com/GZ-Alinx/autops/internal/middleware"
+)
+
+var (
+	// ErrChangeNotFound 变更不存在
+	ErrChangeNotFound = errors.New("变更不存在")
+	// ErrChangeNotPending 变更已被审批、撤回或已过期
+	ErrChangeNotPending = errors.New("变更已被处理")
+	// ErrChangeExpired 变更已超过审批截止时间
+	ErrChangeExpired = errors.New("变更已过期")
+	// ErrChangeForbidden 没有审批或查看该变更的权限
+	ErrChangeForbidden = errors.New("没有审批该变更的角色")
+	// ErrChangeSelfReview 不能审批自己提交的变更
+	ErrChangeSelfReview = errors.New("不能审批自己提交的变更")
+	// ErrChangeDuplicate 已审批过该变更
+	ErrChangeDuplicate = errors.New("已审批过该变更")
+)
+
+// defaultChangeExpireHours 未配置permission.approval.expire_hours时待审批变更的有效期
+const defaultChangeExpireHours = 72
+
+// changeFallbackApprover 审批规则未指定审批角色时由拥有该角色的用户审批
+const changeFallbackApprover = "admin"
+
+// maxChangeResult 保存的执行结果的最大长度，与TEXT列一致
+const maxChangeResult = 64 << 10
+
+// ChangeRequestService 待审批变更服务接口
+type ChangeRequestService interface {
+	// Submit 保存被CasbinMiddleware转为待审批变更的请求
+	Submit(change *middleware.PendingChange) (*models.ChangeRequest, error)
+	// ListMine 获取用户提交的变更
+	ListMine(userID uint) ([]models.ChangeRequest, error)
+	// ListReviewable 获取reviewerID可以审批且尚未审批的待审批变更
+	ListReviewable(reviewerID uint) ([]models.ChangeRequest, error)
+	// Get 获取变更详情，只有申请人和可以审批的用户可以查看
+	Get(id, viewerID uint) (*models.ChangeRequest, error)
+	// Approve 批准变更，达到需要的批准人数时以申请人的身份执行
+	Approve(id uint, comment string, actor Actor) (*models.ChangeRequest, error)
+	// Reject 拒绝变更，任一审批人拒绝即结束
+	Reject(id uint, comment string, actor Actor) (*models.ChangeRequest, error)
+	// Cancel 申请人撤回待审批的变更
+	Cancel(id uint, actor Actor) error
+}
+
+// changeRequestService 服务实现
+type changeRequestService struct {
+	repo    repositories.ChangeRequestRepository
+	audit   AuditService
+	handler http.Handler
+}
+
+// NewChangeRequestService 创建待审批变更服务实例，handler为执行已批准变更的路由（gin.Engine）
+func NewChangeRequestService(repo repositories.ChangeRequestRepository, audit AuditService, handler http.Handler) ChangeRequestService {
+	return &changeRequestService{
+		repo:    repo,
+		audit:   audit,
+		handler: handler,
+	}
+}
+
+// changeExpireHours 待审批变更的有效期
+func changeExpireHours() int {
+	if hours := config.AppConfig.Permission.Approval.ExpireHours; hours > 0 {
+		return hours
+	}
+	return defaultChangeExpireHours
+}
+
+// Submit 保存待审批变更
+func (s *changeRequestService) Submit(pending *middleware.PendingChange) (*models.ChangeRequest, error) {
+	approverRoles := pending.Rule.ApproverRoles
+	if len(approverRoles) == 0 {
+		approverRoles = []string{changeFallbackApprover}
+	}
+	required := pending.Rule.Approvals
+	if required < 1 {
+		required = 1
+	}
+
+	// 密码、令牌等敏感字段不以明文保存和展示给审批人，原始请求体加密保存供执行使用
+	body, redacted := redactBody(pending.ContentType, pending.Body)
+	var sealed string
+	if len(redacted) > 0 {
+		aead, err := changeCipher()
+		if err != nil {
+			return nil, err
+		}
+		if aead == nil {
+			return nil, middleware.ErrChangeSecretsNotSealed
+		}
+		if sealed, err = sealChangeBody(aead, pending.Body); err != nil {
+			return nil, err
+		}
+	}
+
+	change := &models.ChangeRequest{
+		RequesterID:       pending.UserID,
+		Method:            pending.Method,
+		Path:              pending.Path,
+		Query:             pending.Query,
+		ContentType:       pending.ContentType,
+		Body:              body,
+		SealedBody:        sealed,
+		RedactedFields:    truncate(strings.Join(redacted, ","), 255),
+		Tenant:            pending.Tenant,
+		IP:                pending.IP,
+		AuthType:          pending.AuthType,
+		APITokenID:        pending.APITokenID,
+		TokenScopes:       strings.Join(pending.TokenScopes, ","),
+		Reason:            truncate(pending.Reason, 255),
+		Description:       pending.Rule.Description,
+		ApproverRoles:     strings.Join(approverRoles, ","),
+		RequiredApprovals: required,
+		Status:            models.ChangePending,
+		ExpiresAt:         time.Now().Add(time.Duration(changeExpireHours()) * time.Hour),
+	}
+	if err := s.repo.Create(change); err != nil {
+		return nil, err
+	}
+
+	actor := Actor{ID: pending.UserID, Username: pending.Username, IP: pending.IP}
+	s.audit.Record(actor, models.AuditChangeSubmit, "change", strconv.Itoa(int(change.ID)), map[string]interface{}{
+		"method":         change.Method,
+		"path":           change.Path,
+		"tenant":         change.Tenant,
+		"reason":         change.Reason,
+		"auth_type":      change.AuthType,
+		"token_scopes":   pending.TokenScopes,
+		"approver_roles": approverRoles,
+		"approvals":      required,
+	})
+	return change, nil
+}
+
+// ListMine 获取用户提交的变更
+func (s *changeRequestService) ListMine(userID uint) ([]models.ChangeRequest, error) {
+	if err := s.repo.ExpirePending(time.Now()); err != nil {
+		return nil, err
+	}
+	return s.repo.ListByRequester(userID)
+}
+
+// ListReviewable 获取可以审批的变更
+func (s *changeRequestService) ListReviewable(reviewerID uint) ([]models.ChangeRequest, error) {
+	if err := s.repo.ExpirePending(time.Now()); err != nil {
+		return nil, err
+	}
+	pending, err := s.repo.ListPending()
+	if err != nil {
+		return nil, err
+	}
+	changes := make([]models.ChangeRequest, 0)
+	for _, change := range pending {
+		if change.RequesterID == reviewerID || decided(&change, reviewerID) {
+			continue
+		}
+		ok, err := s.repo.HasAnyActiveRole(reviewerID, change.ApproverRoleList())
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			changes = append(changes, change)
+		}
+	}
+	return changes, nil
+}
+
+// decided 审批人是否已审批过变更
+func decided(change *models.ChangeRequest, approverID uint) bool {
+	for _, decision := range change.Decisions {
+		if decision.ApproverID == approverID {
+			return true
+		}
+	}
+	return false
+}
+
+// Get 获取变更详情
+func (s *changeRequestService) Get(id, viewerID uint) (*models.ChangeRequest, error) {
+	change, err := s.get(id)
+	if err != nil {
+		return nil, err
+	}
+	if change.RequesterID == viewerID {
+		return change, nil
+	}
+	ok, err := s.repo.HasAnyActiveRole(viewerID, change.ApproverRoleList())
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrChangeForbidden
+	}
+	return change, nil
+}
+
+// get 根据ID获取变更
+func (s *changeRequestService) get(id uint) (*models.ChangeRequest, error) {
+	change, err := s.repo.GetByID(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrChangeNotFound
+		}
+		return nil, err
+	}
+	return change, nil
+}
+
+// pendingForReview 获取待审批的变更并校验审批人
+func (s *changeRequestService) pendingForReview(id uint, actor Actor) (*models.ChangeRequest, error) {
+	change, err := s.get(id)
+	if err != nil {
+		return nil, err
+	}
+	if change.Status != models.ChangePending {
+		return nil, ErrChangeNotPending
+	}
+	if now := time.Now(); !now.Before(change.ExpiresAt) {
+		if err := s.repo.ExpirePending(now); err != nil {
+			return nil, err
+		}
+		return nil, ErrChangeExpired
+	}
+	if change.RequesterID == actor.ID {
+		return nil, ErrChangeSelfReview
+	}
+	ok, err := s.repo.HasAnyActiveRole(actor.ID, change.ApproverRoleList())
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrChangeForbidden
+	}
+	return change, nil
+}
+
+// decide 记录审批，返回批准人数
+func (s *changeRequestService) decide(change *models.ChangeRequest, decision, comment string, actor Actor) (int, error) {
+	approvals, ok, err := s.repo.AddDecision(&models.ChangeDecision{
+		ChangeRequestID: change.ID,
+		ApproverID:      actor.ID,
+		Decision:        decision,
+		Comment:         truncate(comment, 255),
+	})
+	if err != nil {
+		if errors.Is(err, repositories.ErrDecisionExists) {
+			return 0, ErrChangeDuplicate
+		}
+		return 0, err
+	}
+	if !ok {
+		return 0, ErrChangeNotPending
+	}
+	return approvals, nil
+}
+
+// Approve 批准变更
+func (s *changeRequestService) Approve(id uint, comment string, actor Actor) (*models.ChangeRequest, error) {
+	change, err := s.pendingForReview(id, actor)
+	if err != nil {
+		return nil, err
+	}
+	approvals, err := s.decide(change, models.DecisionApprove, comment, actor)
+	if err != nil {
+		return nil, err
+	}
+
+	s.audit.Record(actor, models.AuditChangeApprove, "change", strconv.Itoa(int(change.ID)), map[string]interface{}{
+		"method":    change.Method,
+		"path":      change.Path,
+		"approvals": approvals,
+		"required":  change.RequiredApprovals,
+		"comment":   comment,
+	})
+	if approvals < change.RequiredApprovals {
+		return s.get(id)
+	}
+
+	// 同时审批时只有一个请求执行变更
+	ok, err := s.repo.Transition(change.ID, models.ChangePending, models.ChangeApproved, nil)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		s.execute(change, actor)
+	}
+	return s.get(id)
+}
+
+// execute 以申请人的身份重新执行请求，经过与原请求相同的认证、租户和权限检查，保存执行结果
+func (s *changeRequestService) execute(change *models.ChangeRequest, actor Actor) {
+	target := change.Path
+	if change.Query != "" {
+		target += "?" + change.Query
+	}
+	body := change.Body
+	var err error
+	if change.SealedBody != "" {
+		body, err = openChangeBody(change.SealedBody)
+	}
+	var req *http.Request
+	if err == nil {
+		req, err = http.NewRequest(change.Method, target, strings.NewReader(body))
+	}
+	recorder := httptest.NewRecorder()
+	if err != nil {
+		recorder.WriteHeader(http.StatusBadRequest)
+		recorder.WriteString(err.Error())
+	} else {
+		if change.ContentType != "" {
+			req.Header.Set("Content-Type", change.ContentType)
+		}
+		if change.Tenant != "" && change.Tenant != models.DefaultTenantCode {
+			req.Header.Set(middleware.TenantHeader, change.Tenant)
+		}
+		req.RemoteAddr = net.JoinHostPort(change.IP, "0")
+		req = req.WithContext(middleware.WithChangeReplay(req.Context(), middleware.ChangeReplay{
+			ChangeID:    change.ID,
+			UserID:      change.RequesterID,
+			Username:    change.Requester.Username,
+			APITokenID:  change.APITokenID,
+			TokenScopes: change.TokenScopeList(),
+		}))
+		s.handler.ServeHTTP(recorder, req)
+	}
+
+	status := models.ChangeExecuted
+	if recorder.Code < 200 || recorder.Code >= 300 {
+		status = models.ChangeFailed
+	}
+	// 返回内容可能包含新签发的令牌等凭据，只保存替换了敏感字段的内容
+	result, redacted := redactBody(recorder.Header().Get("Content-Type"), recorder.Body.String())
+	now := time.Now()
+	if _, err := s.repo.Transition(change.ID, models.ChangeApproved, status, map[string]interface{}{
+		"executed_at":   &now,
+		"result_status": recorder.Code,
+		"result_body":   truncate(result, maxChangeResult),
+	}); err != nil {
+		logger.Logger.Error("保存变更执行结果失败", zap.Uint("changeID", change.ID), zap.Error(err))
+	}
+
+	logger.Logger.Info("执行已批准的变更", zap.Uint("changeID", change.ID), zap.String("method", change.Method), zap.String("path", change.Path), zap.Int("status", recorder.Code))
+	s.audit.Record(actor, models.AuditChangeExecute, "change", strconv.Itoa(int(change.ID)), map[string]interface{}{
+		"method":    change.Method,
+		"path":      change.Path,
+		"requester": change.Requester.Username,
+		"status":    recorder.Code,
+		"redacted":  redacted,
+	})
+}
+
+// Reject 拒绝变更
+func (s *changeRequestService) Reject(id uint, comment string, actor Actor) (*models.ChangeRequest, error) {
+	change, err := s.pendingForReview(id, actor)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.decide(change, models.DecisionReject, comment, actor); err != nil {
+		return nil, err
+	}
+	ok, err := s.repo.Transition(change.ID, models.ChangePending, models.ChangeRejected, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrChangeNotPending
+	}
+
+	s.audit.Record(actor, models.AuditChangeReject, "change", strconv.Itoa(int(change.ID)), map[string]interface{}{
+		"method":  change.Method,
+		"path":    change.Path,
+		"comment": comment,
+	})
+	return s.get(id)
+}
+
+// Cancel 申请人撤回变更
+func (s *changeRequestService) Cancel(id uint, actor Actor) error {
+	change, err := s.get(id)
+	if err != nil {
+		return err
+	}
+	if change.RequesterID != actor.ID {
+		return ErrChangeNotFound
+	}
+	ok, err := s.repo.Transition(change.ID, models.ChangePending, models.ChangeCancelled, nil)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrChangeNotPending
+	}
+
+	s.audit.Record(actor, models.AuditChangeCancel, "change", strconv.Itoa(int(change.ID)), map[string]interface{}{
+		"method": change.Method,
+		"path":   change.Path,
+	})
+	return nil
+}
+
+// truncate 截断超过limit字节的字符串，不截断多字节字符
+func truncate(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	for limit > 0 && !utf8.RuneStart(s[limit]) {
+		limit--
+	}
+	return s[:limit]
+}
@@ -0,0 +1,181 @@
+package services
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/business/repositories"
+	"github.com/GZ-Alinx/autops/internal/config"
+	"github.com/GZ-Alinx/autops/internal/logger"
+	"github.com/GZ-Alinx/autops/internal/middleware"
+)
+
+var (
+	// ErrImpersonationTargetNotFound 被模拟的用户不存在
+	ErrImpersonationTargetNotFound = errors.New("用户不存在")
+	// ErrImpersonateSelf 不能模拟自己
+	ErrImpersonateSelf = errors.New("不能模拟自己登录")
+	// ErrImpersonateServiceAccount 服务账号只能通过API令牌访问
+	ErrImpersonateServiceAccount = errors.New("不能模拟服务账号登录")
+	// ErrImpersonationEscalation 被模拟用户拥有操作人没有的角色
+	ErrImpersonationEscalation = errors.New("不能模拟拥有更多角色的用户")
+	// ErrNotImpersonating 当前令牌不是模拟登录令牌
+	ErrNotImpersonating = errors.New("当前不在模拟登录中")
+)
+
+// ImpersonationToken 模拟登录令牌，不签发刷新令牌，到期后需重新发起
+type ImpersonationToken struct {
+	Token     string       `json:"token"`
+	SessionID string       `json:"session_id"`
+	ExpiresAt time.Time    `json:"expires_at"`
+	User      *models.User `json:"user"` // 被模拟的用户
+}
+
+// ImpersonationService 模拟登录服务接口
+type ImpersonationService interface {
+	// Start 以指定用户的身份签发短期访问令牌，权限检查按被模拟用户进行
+	Start(actor Actor, targetID uint, reason string, client ClientInfo) (*ImpersonationToken, error)
+	// End 结束模拟登录，吊销模拟会话和令牌
+	End(claims *middleware.JWTClaims, actor Actor) error
+}
+
+// impersonationService 服务实现
+type impersonationService struct {
+	userRepo    repositories.UserRepository
+	tokenRepo   repositories.TokenRepository
+	sessionRepo repositories.SessionRepository
+	audit       AuditService
+}
+
+// NewImpersonationService 创建模拟登录服务实例
+func NewImpersonationService(userRepo repositories.UserRepository, tokenRepo repositories.TokenRepository, sessionRepo repositories.SessionRepository, audit AuditService) ImpersonationService {
+	return &impersonationService{
+		userRepo:    userRepo,
+		tokenRepo:   tokenRepo,
+		sessionRepo: sessionRepo,
+		audit:       audit,
+	}
+}
+
+// impersonationTTL 模拟登录令牌有效期，默认15分钟
+func impersonationTTL() time.Duration {
+	if config.AppConfig.JWT.ImpersonationMinute > 0 {
+		return time.Duration(config.AppConfig.JWT.ImpersonationMinute) * time.Minute
+	}
+	return 15 * time.Minute
+}
+
+// Start 开始模拟登录
+func (s *impersonationService) Start(actor Actor, targetID uint, reason string, client ClientInfo) (*ImpersonationToken, error) {
+	if actor.ID == targetID {
+		return nil, ErrImpersonateSelf
+	}
+
+	target, err := s.userRepo.GetByID(targetID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrImpersonationTargetNotFound
+		}
+		return nil, err
+	}
+	if target.Type == models.UserTypeService {
+		return nil, ErrImpersonateServiceAccount
+	}
+	if status := target.EffectiveStatus(time.Now()); status != models.UserStatusActive {
+		return nil, &AccountStatusError{Status: status}
+	}
+
+	// 只能模拟角色是自己角色子集的用户，避免借模拟登录提升权限
+	operator, err := s.userRepo.GetByID(actor.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !rolesSubset(target.Roles, operator.Roles) {
+		return nil, ErrImpersonationEscalation
+	}
+
+	sessionID := uuid.New().String()
+	token, claims, err := middleware.GenerateImpersonationToken(
+		strconv.Itoa(int(target.ID)), target.Username, sessionID,
+		&middleware.ImpersonationActor{UserID: strconv.Itoa(int(actor.ID)), Username: actor.Username},
+		impersonationTTL())
+	if err != nil {
+		return nil, err
+	}
+
+	userAgent := client.UserAgent
+	if r := []rune(userAgent); len(r) > 255 {
+		userAgent = string(r[:255])
+	}
+	if err := s.sessionRepo.Create(&models.UserSession{
+		SessionID:      sessionID,
+		UserID:         target.ID,
+		AuthSource:     models.SessionSourceImpersonation,
+		AccessJTI:      claims.ID,
+		IP:             client.IP,
+		UserAgent:      userAgent,
+		LastSeenIP:     client.IP,
+		LastSeenAt:     time.Now(),
+		ExpiresAt:      claims.ExpiresAt.Time,
+		ImpersonatorID: actor.ID,
+	}); err != nil {
+		logger.Logger.Error("保存模拟登录会话失败", zap.Uint("userID", target.ID), zap.Error(err))
+		return nil, err
+	}
+
+	s.audit.Record(actor, models.AuditImpersonationStart, "user", strconv.Itoa(int(target.ID)), map[string]interface{}{
+		"username":   target.Username,
+		"session_id": sessionID,
+		"expires_at": claims.ExpiresAt.Time,
+		"reason":     reason,
+	})
+	return &ImpersonationToken{
+		Token:     token,
+		SessionID: sessionID,
+		ExpiresAt: claims.ExpiresAt.Time,
+		User:      target,
+	}, nil
+}
+
+// rolesSubset roles中的角色是否都在allowed中
+func rolesSubset(roles, allowed []models.Role) bool {
+	owned := make(map[uint]struct{}, len(allowed))
+	for _, role := range allowed {
+		owned[role.ID] = struct{}{}
+	}
+	for _, role := range roles {
+		if _, ok := owned[role.ID]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// End 结束模拟登录
+func (s *impersonationService) End(claims *middleware.JWTClaims, actor Actor) error {
+	if claims == nil || claims.Actor == nil {
+		return ErrNotImpersonating
+	}
+	userID, _ := strconv.ParseUint(claims.UserID, 10, 64)
+
+	if err := s.tokenRepo.RevokeAccessToken(claims.ID, uint(userID), claims.ExpiresAt.Time); err != nil {
+		logger.Logger.Error("吊销模拟登录令牌失败", zap.String("jti", claims.ID), zap.Error(err))
+		return err
+	}
+	if _, err := s.sessionRepo.Revoke(claims.SessionID, actor.ID); err != nil {
+		logger.Logger.Error("吊销模拟登录会话失败", zap.String("sid", claims.SessionID), zap.Error(err))
+		return err
+	}
+
+	s.audit.Record(actor, models.AuditImpersonationEnd, "user", claims.UserID, map[string]interface{}{
+		"username":   claims.Username,
+		"session_id": claims.SessionID,
+	})
+	return nil
+}
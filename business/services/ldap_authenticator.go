@@ -0,0 +1,262 @@
+package services
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"go.uber.org/zap"
+
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/internal/config"
+	"github.com/GZ-Alinx/autops/internal/logger"
+)
+
+// ldapEntry LDAP中查到的用户
+type ldapEntry struct {
+	DN       string
+	Username string
+	Email    string
+	Name     string
+	Groups   []string // 组DN或组名
+}
+
+// ldapAuthenticator LDAP/Active Directory认证源
+type ldapAuthenticator struct {
+	cfg         config.LDAPConfig
+	provisioner UserProvisioner
+}
+
+// NewLDAPAuthenticator 创建LDAP认证源
+func NewLDAPAuthenticator(cfg config.LDAPConfig, provisioner UserProvisioner) Authenticator {
+	if cfg.UserFilter == "" {
+		cfg.UserFilter = "(uid=%s)"
+	}
+	if cfg.UsernameAttr == "" {
+		cfg.UsernameAttr = "uid"
+	}
+	if cfg.EmailAttr == "" {
+		cfg.EmailAttr = "mail"
+	}
+	if cfg.NameAttr == "" {
+		cfg.NameAttr = "cn"
+	}
+	if cfg.MemberOfAttr == "" {
+		cfg.MemberOfAttr = "memberOf"
+	}
+	if cfg.GroupFilter == "" {
+		cfg.GroupFilter = "(member=%s)"
+	}
+	if cfg.GroupNameAttr == "" {
+		cfg.GroupNameAttr = "cn"
+	}
+	if cfg.TimeoutSeconds <= 0 {
+		cfg.TimeoutSeconds = 5
+	}
+	return &ldapAuthenticator{
+		cfg:         cfg,
+		provisioner: provisioner,
+	}
+}
+
+// Name 认证源名称
+func (a *ldapAuthenticator) Name() string {
+	return models.UserSourceLDAP
+}
+
+// Authenticate 查询用户DN并以用户身份绑定校验密码，通过后即时创建本地账号并映射角色
+func (a *ldapAuthenticator) Authenticate(username, password string) (*AuthResult, error) {
+	// 空密码会被LDAP服务器当作匿名绑定而成功，必须拒绝
+	if password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := a.connect()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrAuthUnavailable, err)
+	}
+	defer conn.Close()
+
+	if err := a.serviceBind(conn); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrAuthUnavailable, err)
+	}
+
+	entry, err := a.findUser(conn, username)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			logger.Logger.Warn("LDAP认证失败: 密码错误", zap.String("username", username))
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("%w: %v", ErrAuthUnavailable, err)
+	}
+
+	// 以服务账号重新绑定后查询组，普通用户通常没有读取组的权限
+	if a.cfg.GroupBaseDN != "" {
+		if err := a.serviceBind(conn); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrAuthUnavailable, err)
+		}
+		groups, err := a.findGroups(conn, entry.DN)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrAuthUnavailable, err)
+		}
+		entry.Groups = groups
+	}
+
+	user, rolesChanged, err := a.provisioner.Provision(&ExternalIdentity{
+		Source:    models.UserSourceLDAP,
+		Username:  entry.Username,
+		Email:     entry.Email,
+		Nickname:  entry.Name,
+		Roles:     a.mapRoles(entry.Groups),
+		SyncRoles: a.cfg.SyncRoles,
+	})
+	if err != nil {
+		// 同名本地账号交给本地认证源处理，目录账号不能接管本地账号
+		if errors.Is(err, ErrAccountConflict) {
+			return nil, ErrAuthUserNotFound
+		}
+		return nil, err
+	}
+
+	logger.Logger.Info("LDAP认证成功", zap.String("username", entry.Username), zap.Strings("groups", entry.Groups))
+	return &AuthResult{User: user, Source: models.UserSourceLDAP, RolesChanged: rolesChanged}, nil
+}
+
+// connect 建立LDAP连接，按配置使用LDAPS或StartTLS
+func (a *ldapAuthenticator) connect() (*ldap.Conn, error) {
+	u, err := url.Parse(a.cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("LDAP地址无效: %v", err)
+	}
+	timeout := time.Duration(a.cfg.TimeoutSeconds) * time.Second
+	tlsConfig := &tls.Config{
+		ServerName:         u.Hostname(),
+		InsecureSkipVerify: a.cfg.InsecureSkipVerify,
+	}
+
+	conn, err := ldap.DialURL(a.cfg.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: timeout}),
+		ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(timeout)
+
+	if a.cfg.StartTLS && u.Scheme == "ldap" {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("LDAP StartTLS失败: %v", err)
+		}
+	}
+	return conn, nil
+}
+
+// serviceBind 使用服务账号绑定，未配置时匿名查询
+func (a *ldapAuthenticator) serviceBind(conn *ldap.Conn) error {
+	if a.cfg.BindDN == "" {
+		return conn.UnauthenticatedBind("")
+	}
+	return conn.Bind(a.cfg.BindDN, a.cfg.BindPassword)
+}
+
+// findUser 按用户名查询唯一的用户条目
+func (a *ldapAuthenticator) findUser(conn *ldap.Conn, username string) (*ldapEntry, error) {
+	attrs := []string{a.cfg.UsernameAttr, a.cfg.EmailAttr, a.cfg.NameAttr}
+	if a.cfg.GroupBaseDN == "" {
+		attrs = append(attrs, a.cfg.MemberOfAttr)
+	}
+
+	req := ldap.NewSearchRequest(
+		a.cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, a.cfg.TimeoutSeconds, false,
+		fmt.Sprintf(a.cfg.UserFilter, ldap.EscapeFilter(username)),
+		attrs, nil,
+	)
+	result, err := conn.Search(req)
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+			return nil, ErrAuthUserNotFound
+		}
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+			return nil, fmt.Errorf("LDAP中存在多个用户名为%s的条目", username)
+		}
+		return nil, fmt.Errorf("%w: %v", ErrAuthUnavailable, err)
+	}
+	switch len(result.Entries) {
+	case 0:
+		return nil, ErrAuthUserNotFound
+	case 1:
+	default:
+		return nil, fmt.Errorf("LDAP中存在多个用户名为%s的条目", username)
+	}
+
+	e := result.Entries[0]
+	entry := &ldapEntry{
+		DN:       e.DN,
+		Username: e.GetAttributeValue(a.cfg.UsernameAttr),
+		Email:    e.GetAttributeValue(a.cfg.EmailAttr),
+		Name:     e.GetAttributeValue(a.cfg.NameAttr),
+	}
+	if entry.Username == "" {
+		entry.Username = username
+	}
+	if a.cfg.GroupBaseDN == "" {
+		entry.Groups = e.GetAttributeValues(a.cfg.MemberOfAttr)
+	}
+	return entry, nil
+}
+
+// findGroups 查询用户所属的组，返回组DN和组名
+func (a *ldapAuthenticator) findGroups(conn *ldap.Conn, userDN string) ([]string, error) {
+	req := ldap.NewSearchRequest(
+		a.cfg.GroupBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		0, a.cfg.TimeoutSeconds, false,
+		fmt.Sprintf(a.cfg.GroupFilter, ldap.EscapeFilter(userDN)),
+		[]string{a.cfg.GroupNameAttr}, nil,
+	)
+	result, err := conn.Search(req)
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	groups := make([]string, 0, len(result.Entries)*2)
+	for _, e := range result.Entries {
+		groups = append(groups, e.DN)
+		if name := e.GetAttributeValue(a.cfg.GroupNameAttr); name != "" {
+			groups = append(groups, name)
+		}
+	}
+	return groups, nil
+}
+
+// mapRoles 将组映射为角色名称，组DN和组名均可匹配，不区分大小写
+func (a *ldapAuthenticator) mapRoles(groups []string) []string {
+	memberOf := make(map[string]struct{}, len(groups)*2)
+	for _, g := range groups {
+		memberOf[strings.ToLower(g)] = struct{}{}
+		// memberOf属性只有DN，同时按第一个RDN的值匹配组名
+		if dn, err := ldap.ParseDN(g); err == nil && len(dn.RDNs) > 0 && len(dn.RDNs[0].Attributes) > 0 {
+			memberOf[strings.ToLower(dn.RDNs[0].Attributes[0].Value)] = struct{}{}
+		}
+	}
+
+	roles := append([]string{}, a.cfg.DefaultRoles...)
+	for _, m := range a.cfg.GroupMappings {
+		if _, ok := memberOf[strings.ToLower(m.Group)]; ok {
+			roles = append(roles, m.Roles...)
+		}
+	}
+	return uniqueStrings(roles)
+}
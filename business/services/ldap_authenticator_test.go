@@ -0,0 +1,521 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	glog "gorm.io/gorm/logger"
+
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/business/repositories"
+	"github.com/GZ-Alinx/autops/internal/config"
+	"github.com/GZ-Alinx/autops/internal/database"
+	"github.com/GZ-Alinx/autops/internal/logger"
+)
+
+const (
+	testBaseDN      = "ou=people,dc=example,dc=org"
+	testGroupBaseDN = "ou=groups,dc=example,dc=org"
+	testBindDN      = "cn=autops,dc=example,dc=org"
+	testBindPass    = "bind-secret"
+	aliceDN         = "uid=alice,ou=people,dc=example,dc=org"
+)
+
+// stubEntry 模拟目录中的条目，password非空时可以绑定
+type stubEntry struct {
+	dn       string
+	password string
+	attrs    map[string][]string
+}
+
+// stubLDAP 进程内模拟的LDAP服务器，只实现简单绑定和等值过滤的搜索
+type stubLDAP struct {
+	t        *testing.T
+	listener net.Listener
+
+	mu      sync.Mutex
+	entries []stubEntry
+	binds   []string // 成功或失败的绑定DN，按顺序记录
+}
+
+// newStubLDAP 启动模拟LDAP服务器，测试结束时关闭
+func newStubLDAP(t *testing.T, entries ...stubEntry) *stubLDAP {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听失败: %v", err)
+	}
+	s := &stubLDAP{t: t, listener: listener, entries: entries}
+	go s.serve()
+	t.Cleanup(func() { listener.Close() })
+	return s
+}
+
+// url 模拟服务器地址
+func (s *stubLDAP) url() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+// bindDNs 已收到的绑定请求
+func (s *stubLDAP) bindDNs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.binds...)
+}
+
+// setEntries 替换目录中的条目
+func (s *stubLDAP) setEntries(entries ...stubEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = entries
+}
+
+func (s *stubLDAP) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *stubLDAP) handle(conn net.Conn) {
+	defer conn.Close()
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				s.t.Logf("读取LDAP请求失败: %v", err)
+			}
+			return
+		}
+		if len(packet.Children) < 2 {
+			return
+		}
+		messageID := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			s.bind(conn, messageID, op)
+		case ldap.ApplicationSearchRequest:
+			s.search(conn, messageID, op)
+		case ldap.ApplicationUnbindRequest:
+			return
+		default:
+			s.t.Logf("不支持的LDAP操作: %d", op.Tag)
+			return
+		}
+	}
+}
+
+// bind 处理简单绑定：空DN和空密码为匿名绑定
+func (s *stubLDAP) bind(conn net.Conn, messageID int64, op *ber.Packet) {
+	dn := op.Children[1].Data.String()
+	password := op.Children[2].Data.String()
+
+	s.mu.Lock()
+	s.binds = append(s.binds, dn)
+	code := ldap.LDAPResultInvalidCredentials
+	switch {
+	case dn == "" && password == "":
+		code = ldap.LDAPResultSuccess
+	case dn == testBindDN && password == testBindPass:
+		code = ldap.LDAPResultSuccess
+	default:
+		for _, e := range s.entries {
+			if strings.EqualFold(e.dn, dn) && e.password != "" && e.password == password {
+				code = ldap.LDAPResultSuccess
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	s.write(conn, messageID, result(ldap.ApplicationBindResponse, code))
+}
+
+// search 按baseDN和等值过滤条件返回条目，超过sizeLimit时返回sizeLimitExceeded
+func (s *stubLDAP) search(conn net.Conn, messageID int64, op *ber.Packet) {
+	baseDN := strings.ToLower(op.Children[0].Data.String())
+	sizeLimit := op.Children[3].Value.(int64)
+	filter := op.Children[6]
+	var attrs []string
+	for _, a := range op.Children[7].Children {
+		attrs = append(attrs, a.Data.String())
+	}
+
+	s.mu.Lock()
+	var matched []stubEntry
+	for _, e := range s.entries {
+		if strings.HasSuffix(strings.ToLower(e.dn), baseDN) && matchFilter(filter, e) {
+			matched = append(matched, e)
+		}
+	}
+	s.mu.Unlock()
+
+	code := ldap.LDAPResultSuccess
+	if sizeLimit > 0 && int64(len(matched)) > sizeLimit {
+		matched = matched[:sizeLimit]
+		code = ldap.LDAPResultSizeLimitExceeded
+	}
+	for _, e := range matched {
+		s.write(conn, messageID, searchEntry(e, attrs))
+	}
+	s.write(conn, messageID, result(ldap.ApplicationSearchResultDone, code))
+}
+
+// matchFilter 只支持等值过滤，属性名和值不区分大小写
+func matchFilter(filter *ber.Packet, e stubEntry) bool {
+	if filter.ClassType != ber.ClassContext || filter.Tag != ldap.FilterEqualityMatch || len(filter.Children) != 2 {
+		return false
+	}
+	attr := filter.Children[0].Data.String()
+	value := filter.Children[1].Data.String()
+	for name, values := range e.attrs {
+		if !strings.EqualFold(name, attr) {
+			continue
+		}
+		for _, v := range values {
+			if strings.EqualFold(v, value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *stubLDAP) write(conn net.Conn, messageID int64, op *ber.Packet) {
+	envelope := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	envelope.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "MessageID"))
+	envelope.AppendChild(op)
+	if _, err := conn.Write(envelope.Bytes()); err != nil {
+		s.t.Logf("写入LDAP响应失败: %v", err)
+	}
+}
+
+// result 构造LDAPResult类型的响应
+func result(tag ber.Tag, code int) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Response")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "resultCode"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "diagnosticMessage"))
+	return op
+}
+
+// searchEntry 构造搜索结果条目，只返回请求的属性
+func searchEntry(e stubEntry, attrs []string) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.dn, "objectName"))
+	list := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attributes")
+	for _, name := range attrs {
+		values, ok := e.attrs[name]
+		if !ok {
+			continue
+		}
+		attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attribute")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "vals")
+		for _, v := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "value"))
+		}
+		attr.AppendChild(set)
+		list.AppendChild(attr)
+	}
+	op.AppendChild(list)
+	return op
+}
+
+// setupTestDB 使用内存SQLite替换database.DB并迁移用户、角色及extra中的模型，测试结束时恢复
+func setupTestDB(t *testing.T, extra ...interface{}) *gorm.DB {
+	t.Helper()
+	logger.Logger = zap.NewNop()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: glog.Default.LogMode(glog.Silent)})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	// 内存数据库每个连接独立，只使用一个连接
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("获取连接失败: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(append([]interface{}{&models.User{}, &models.Role{}, &models.UserRole{}}, extra...)...); err != nil {
+		t.Fatalf("迁移失败: %v", err)
+	}
+
+	previous := database.DB
+	database.DB = db
+	t.Cleanup(func() {
+		database.DB = previous
+		sqlDB.Close()
+	})
+	return db
+}
+
+// setupLDAPDB 初始化数据库并创建组映射用到的角色
+func setupLDAPDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := setupTestDB(t)
+	for _, name := range []string{"viewer", "operator", "admin"} {
+		if err := db.Create(&models.Role{Name: name}).Error; err != nil {
+			t.Fatalf("创建角色失败: %v", err)
+		}
+	}
+	return db
+}
+
+// newTestLDAPAuthenticator 连接模拟服务器的LDAP认证源，使用真实的即时创建服务
+func newTestLDAPAuthenticator(s *stubLDAP, modify func(*config.LDAPConfig)) Authenticator {
+	cfg := config.LDAPConfig{
+		URL:          s.url(),
+		BindDN:       testBindDN,
+		BindPassword: testBindPass,
+		BaseDN:       testBaseDN,
+		DefaultRoles: []string{"viewer"},
+		GroupMappings: []config.LDAPGroupMapping{
+			{Group: "ops", Roles: []string{"operator"}},
+			{Group: "cn=admins," + testGroupBaseDN, Roles: []string{"admin"}},
+		},
+	}
+	if modify != nil {
+		modify(&cfg)
+	}
+	return NewLDAPAuthenticator(cfg, NewUserProvisioner(repositories.NewUserRepository(), repositories.NewRoleRepository()))
+}
+
+// alice 目录中的用户，groups为memberOf属性
+func alice(groups ...string) stubEntry {
+	return stubEntry{
+		dn:       aliceDN,
+		password: "alice-pass",
+		attrs: map[string][]string{
+			"uid":      {"alice"},
+			"mail":     {"alice@example.org"},
+			"cn":       {"Alice Liddell"},
+			"memberOf": groups,
+		},
+	}
+}
+
+// group 目录中的组，members为成员DN
+func group(name string, members ...string) stubEntry {
+	return stubEntry{
+		dn:    "cn=" + name + "," + testGroupBaseDN,
+		attrs: map[string][]string{"cn": {name}, "member": members},
+	}
+}
+
+// userRoles 用户当前角色名，按名称排序
+func userRoles(user *models.User) []string {
+	names := make([]string, 0, len(user.Roles))
+	for _, role := range user.Roles {
+		names = append(names, role.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestLDAPAuthenticate(t *testing.T) {
+	tests := []struct {
+		name      string
+		entries   []stubEntry
+		modify    func(*config.LDAPConfig)
+		username  string
+		password  string
+		wantErr   error
+		wantRoles string
+		wantBinds []string
+	}{
+		{
+			name:      "按memberOf映射角色",
+			entries:   []stubEntry{alice("cn=ops,"+testGroupBaseDN, "cn=other,"+testGroupBaseDN)},
+			username:  "alice",
+			password:  "alice-pass",
+			wantRoles: "[operator viewer]",
+			wantBinds: []string{testBindDN, aliceDN},
+		},
+		{
+			name:    "按组搜索映射角色",
+			entries: []stubEntry{alice(), group("admins", aliceDN), group("ops", "uid=bob,"+testBaseDN)},
+			modify: func(cfg *config.LDAPConfig) {
+				cfg.GroupBaseDN = testGroupBaseDN
+			},
+			username:  "alice",
+			password:  "alice-pass",
+			wantRoles: "[admin viewer]",
+			// 用户绑定校验密码后以服务账号重新绑定查询组
+			wantBinds: []string{testBindDN, aliceDN, testBindDN},
+		},
+		{
+			name:      "未配置服务账号时匿名查询",
+			entries:   []stubEntry{alice()},
+			modify:    func(cfg *config.LDAPConfig) { cfg.BindDN, cfg.BindPassword = "", "" },
+			username:  "alice",
+			password:  "alice-pass",
+			wantRoles: "[viewer]",
+			wantBinds: []string{"", aliceDN},
+		},
+		{
+			name:      "密码错误",
+			entries:   []stubEntry{alice()},
+			username:  "alice",
+			password:  "wrong",
+			wantErr:   ErrInvalidCredentials,
+			wantBinds: []string{testBindDN, aliceDN},
+		},
+		{
+			name:     "空密码不连接服务器",
+			entries:  []stubEntry{alice()},
+			username: "alice",
+			wantErr:  ErrInvalidCredentials,
+		},
+		{
+			name:      "用户不存在",
+			entries:   []stubEntry{alice()},
+			username:  "bob",
+			password:  "x",
+			wantErr:   ErrAuthUserNotFound,
+			wantBinds: []string{testBindDN},
+		},
+		{
+			name:      "用户名中的过滤字符被转义",
+			entries:   []stubEntry{alice()},
+			username:  "*",
+			password:  "x",
+			wantErr:   ErrAuthUserNotFound,
+			wantBinds: []string{testBindDN},
+		},
+		{
+			name:      "服务账号绑定失败",
+			entries:   []stubEntry{alice()},
+			modify:    func(cfg *config.LDAPConfig) { cfg.BindPassword = "wrong" },
+			username:  "alice",
+			password:  "alice-pass",
+			wantErr:   ErrAuthUnavailable,
+			wantBinds: []string{testBindDN},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupLDAPDB(t)
+			s := newStubLDAP(t, tt.entries...)
+			auth := newTestLDAPAuthenticator(s, tt.modify)
+
+			res, err := auth.Authenticate(tt.username, tt.password)
+			if got := s.bindDNs(); fmt.Sprint(got) != fmt.Sprint(tt.wantBinds) {
+				t.Errorf("绑定顺序为%q，期望%q", got, tt.wantBinds)
+			}
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("错误为%v，期望%v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("认证失败: %v", err)
+			}
+
+			user := res.User
+			if res.Source != models.UserSourceLDAP || user.Source != models.UserSourceLDAP {
+				t.Errorf("认证源为%s/%s", res.Source, user.Source)
+			}
+			if user.ID == 0 || user.Username != "alice" || user.Email != "alice@example.org" || user.Nickname != "Alice Liddell" {
+				t.Errorf("即时创建的用户资料错误: %+v", user)
+			}
+			if got := fmt.Sprint(userRoles(user)); got != tt.wantRoles {
+				t.Errorf("角色为%s，期望%s", got, tt.wantRoles)
+			}
+			if !res.RolesChanged {
+				t.Error("首次登录分配角色后RolesChanged应为true")
+			}
+		})
+	}
+}
+
+// TestLDAPAuthenticateMultipleEntries 用户名对应多个条目时拒绝登录
+func TestLDAPAuthenticateMultipleEntries(t *testing.T) {
+	setupLDAPDB(t)
+	other := alice()
+	other.dn = "uid=alice,ou=contractors," + testBaseDN
+	s := newStubLDAP(t, alice(), other)
+
+	_, err := newTestLDAPAuthenticator(s, nil).Authenticate("alice", "alice-pass")
+	if err == nil || !strings.Contains(err.Error(), "多个") {
+		t.Fatalf("期望多个条目的错误，实际为%v", err)
+	}
+}
+
+// TestLDAPSyncRoles 再次登录时按sync_roles决定是否按组映射覆盖角色
+func TestLDAPSyncRoles(t *testing.T) {
+	for _, sync := range []bool{true, false} {
+		t.Run(fmt.Sprintf("sync_roles=%v", sync), func(t *testing.T) {
+			db := setupLDAPDB(t)
+			s := newStubLDAP(t, alice("cn=ops,"+testGroupBaseDN))
+			auth := newTestLDAPAuthenticator(s, func(cfg *config.LDAPConfig) { cfg.SyncRoles = sync })
+
+			first, err := auth.Authenticate("alice", "alice-pass")
+			if err != nil {
+				t.Fatalf("首次登录失败: %v", err)
+			}
+
+			// 用户被移出ops组，邮箱变更
+			moved := alice()
+			moved.attrs["mail"] = []string{"alice@new.example.org"}
+			s.setEntries(moved)
+			second, err := auth.Authenticate("alice", "alice-pass")
+			if err != nil {
+				t.Fatalf("再次登录失败: %v", err)
+			}
+			if second.User.ID != first.User.ID {
+				t.Fatalf("再次登录创建了新用户")
+			}
+			if second.User.Email != "alice@new.example.org" {
+				t.Errorf("邮箱未同步: %s", second.User.Email)
+			}
+
+			want, changed := "[operator viewer]", false
+			if sync {
+				want, changed = "[viewer]", true
+			}
+			if got := fmt.Sprint(userRoles(second.User)); got != want {
+				t.Errorf("角色为%s，期望%s", got, want)
+			}
+			if second.RolesChanged != changed {
+				t.Errorf("RolesChanged为%v，期望%v", second.RolesChanged, changed)
+			}
+
+			var count int64
+			db.Model(&models.User{}).Count(&count)
+			if count != 1 {
+				t.Errorf("共有%d个用户，期望1个", count)
+			}
+		})
+	}
+}
+
+// TestLDAPLocalAccountConflict 目录用户不能接管同名的本地账号，交给本地认证源处理
+func TestLDAPLocalAccountConflict(t *testing.T) {
+	db := setupLDAPDB(t)
+	local := models.User{Username: "alice", Password: "x", Email: "alice@local", Source: models.UserSourceLocal}
+	if err := db.Create(&local).Error; err != nil {
+		t.Fatalf("创建本地用户失败: %v", err)
+	}
+	s := newStubLDAP(t, alice())
+
+	_, err := newTestLDAPAuthenticator(s, nil).Authenticate("alice", "alice-pass")
+	if !errors.Is(err, ErrAuthUserNotFound) {
+		t.Fatalf("错误为%v，期望ErrAuthUserNotFound", err)
+	}
+}
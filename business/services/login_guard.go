@@ -0,0 +1,297 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/business/repositories"
+	"github.com/GZ-Alinx/autops/internal/config"
+	"github.com/GZ-Alinx/autops/internal/logger"
+)
+
+// 登录防护默认值
+const (
+	defaultMaxUserFailures   = 5
+	defaultMaxIPFailures     = 20
+	defaultWindowMinutes     = 15
+	defaultLockoutMinutes    = 5
+	defaultMaxLockoutMinutes = 24 * 60
+
+	// 找回密码申请频率限制默认值
+	defaultResetMaxPerEmail  = 3
+	defaultResetMaxPerIP     = 10
+	defaultResetWindowMinute = 60
+	// resetGuardScope 找回密码计数键前缀，与登录失败计数分开
+	resetGuardScope = "reset:"
+
+	// loginAttemptPurgeInterval 清理过期计数的最小间隔
+	loginAttemptPurgeInterval = 10 * time.Minute
+)
+
+// LoginLockedError 登录被锁定错误
+type LoginLockedError struct {
+	RetryAfter time.Duration
+}
+
+// Error 实现error接口
+func (e *LoginLockedError) Error() string {
+	return fmt.Sprintf("登录失败次数过多，请%d秒后重试", int(e.RetryAfter.Seconds()+0.5))
+}
+
+// LoginGuard 登录防暴力破解服务接口
+type LoginGuard interface {
+	// Check 检查用户名和客户端IP是否处于锁定状态，锁定时返回*LoginLockedError；
+	// 计数存储不可用期间按本实例内存中的计数检查
+	Check(username, ip string) error
+	// RecordFailure 记录一次登录失败，达到阈值时锁定
+	RecordFailure(username, ip string)
+	// RecordSuccess 登录成功后清除用户名的失败计数
+	RecordSuccess(username string)
+	// Unlock 管理员解除用户名（及可选的IP）锁定
+	Unlock(username, ip string) error
+}
+
+// loginGuard 服务实现
+type loginGuard struct {
+	store     repositories.LoginAttemptStore
+	fallback  repositories.LoginAttemptStore // store不可用时改用本实例内存计数，不因存储故障放开限制
+	cfg       config.LoginGuardConfig
+	scope     string // 计数键前缀，登录防护为空
+	mu        sync.Mutex
+	lastPurge time.Time
+}
+
+// NewLoginGuard 创建登录防护服务实例
+func NewLoginGuard(store repositories.LoginAttemptStore, cfg config.LoginGuardConfig) LoginGuard {
+	if cfg.MaxUserFailures <= 0 {
+		cfg.MaxUserFailures = defaultMaxUserFailures
+	}
+	if cfg.MaxIPFailures <= 0 {
+		cfg.MaxIPFailures = defaultMaxIPFailures
+	}
+	if cfg.WindowMinutes <= 0 {
+		cfg.WindowMinutes = defaultWindowMinutes
+	}
+	if cfg.LockoutMinutes <= 0 {
+		cfg.LockoutMinutes = defaultLockoutMinutes
+	}
+	if cfg.MaxLockoutMinutes <= 0 {
+		cfg.MaxLockoutMinutes = defaultMaxLockoutMinutes
+	}
+	return &loginGuard{
+		store:     store,
+		fallback:  repositories.NewMemoryLoginAttemptStore(),
+		cfg:       cfg,
+		lastPurge: time.Now(),
+	}
+}
+
+// NewLoginGuardFromConfig 根据配置选择计数存储并创建登录防护服务
+func NewLoginGuardFromConfig() LoginGuard {
+	cfg := config.AppConfig.LoginGuard
+	return NewLoginGuard(loginAttemptStore(cfg), cfg)
+}
+
+// NewPasswordResetGuardFromConfig 创建找回密码申请的频率限制：每次申请都计数，同一邮箱或IP
+// 在password_reset.limit_window_minutes内超过上限后锁定同样时长；计数存储与登录防护相同，计数键分开
+func NewPasswordResetGuardFromConfig() LoginGuard {
+	reset := config.AppConfig.PasswordReset
+	cfg := config.AppConfig.LoginGuard
+	cfg.MaxUserFailures = reset.MaxPerEmail
+	if cfg.MaxUserFailures <= 0 {
+		cfg.MaxUserFailures = defaultResetMaxPerEmail
+	}
+	cfg.MaxIPFailures = reset.MaxPerIP
+	if cfg.MaxIPFailures <= 0 {
+		cfg.MaxIPFailures = defaultResetMaxPerIP
+	}
+	cfg.WindowMinutes = reset.LimitWindowMinutes
+	if cfg.WindowMinutes <= 0 {
+		cfg.WindowMinutes = defaultResetWindowMinute
+	}
+	cfg.LockoutMinutes = cfg.WindowMinutes
+
+	g := NewLoginGuard(loginAttemptStore(cfg), cfg).(*loginGuard)
+	g.scope = resetGuardScope
+	return g
+}
+
+// loginAttemptStore 根据login_guard.store选择计数存储
+func loginAttemptStore(cfg config.LoginGuardConfig) repositories.LoginAttemptStore {
+	switch strings.ToLower(cfg.Store) {
+	case "memory":
+		return repositories.NewMemoryLoginAttemptStore()
+	default:
+		// 默认共享数据库计数，避免多副本部署时攻击者轮流访问各实例绕过锁定
+		return repositories.NewDBLoginAttemptStore()
+	}
+}
+
+// userIdentifier 用户名计数键，用户名不区分大小写
+func (g *loginGuard) userIdentifier(username string) string {
+	return g.scope + "user:" + strings.ToLower(strings.TrimSpace(username))
+}
+
+// ipIdentifier 客户端IP计数键
+func (g *loginGuard) ipIdentifier(ip string) string {
+	return g.scope + "ip:" + ip
+}
+
+// window 失败次数统计窗口
+func (g *loginGuard) window() time.Duration {
+	return time.Duration(g.cfg.WindowMinutes) * time.Minute
+}
+
+// lockoutDuration 按累计锁定次数指数退避计算锁定时长
+func (g *loginGuard) lockoutDuration(lockCount int) time.Duration {
+	base := time.Duration(g.cfg.LockoutMinutes) * time.Minute
+	max := time.Duration(g.cfg.MaxLockoutMinutes) * time.Minute
+
+	d := base
+	for i := 0; i < lockCount && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+// Check 检查是否处于锁定状态
+func (g *loginGuard) Check(username, ip string) error {
+	now := time.Now()
+	var retryAfter time.Duration
+
+	for _, identifier := range []string{g.userIdentifier(username), g.ipIdentifier(ip)} {
+		for _, attempt := range g.attempts(identifier) {
+			if attempt.IsLocked(now) {
+				if d := attempt.LockedUntil.Sub(now); d > retryAfter {
+					retryAfter = d
+				}
+			}
+		}
+	}
+
+	if retryAfter > 0 {
+		logger.GetBusinessLogger().Warn("登录请求被拒绝: 账号或IP已锁定",
+			zap.String("username", username),
+			zap.String("ip", ip),
+			zap.Duration("retryAfter", retryAfter))
+		return &LoginLockedError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// attempts 计数键在共享存储和本实例内存中的记录。
+// 共享存储故障期间的失败计入内存，恢复后锁定仍需生效，所以内存记录始终参与检查
+func (g *loginGuard) attempts(identifier string) []*models.LoginAttempt {
+	var attempts []*models.LoginAttempt
+	if attempt, err := g.store.Get(identifier); err != nil {
+		logger.Logger.Error("读取登录失败计数失败，改用本实例内存计数", zap.String("identifier", identifier), zap.Error(err))
+	} else {
+		attempts = append(attempts, attempt)
+	}
+	if attempt, err := g.fallback.Get(identifier); err == nil {
+		attempts = append(attempts, attempt)
+	}
+	return attempts
+}
+
+// RecordFailure 记录登录失败
+func (g *loginGuard) RecordFailure(username, ip string) {
+	g.recordFailure(g.userIdentifier(username), g.cfg.MaxUserFailures, username, ip)
+	g.recordFailure(g.ipIdentifier(ip), g.cfg.MaxIPFailures, username, ip)
+	g.purgeIfDue()
+}
+
+// recordFailure 累加单个计数键的失败次数，达到阈值时锁定
+func (g *loginGuard) recordFailure(identifier string, threshold int, username, ip string) {
+	now := time.Now()
+	var locked bool
+
+	update := func(a *models.LoginAttempt) {
+		locked = false
+		// 锁定期间的请求已被Check拦截，这里不再累加
+		if a.IsLocked(now) {
+			return
+		}
+		if a.WindowStart.IsZero() || now.Sub(a.WindowStart) > g.window() {
+			a.Failures = 0
+			a.WindowStart = now
+		}
+		a.Failures++
+		if a.Failures >= threshold {
+			until := now.Add(g.lockoutDuration(a.LockCount))
+			a.LockedUntil = &until
+			a.LockCount++
+			a.Failures = 0
+			a.WindowStart = now
+			locked = true
+		}
+	}
+	attempt, err := g.store.Update(identifier, update)
+	if err != nil {
+		logger.Logger.Error("记录登录失败计数失败，改用本实例内存计数", zap.String("identifier", identifier), zap.Error(err))
+		if attempt, err = g.fallback.Update(identifier, update); err != nil {
+			return
+		}
+	}
+
+	if locked {
+		logger.GetBusinessLogger().Warn("登录失败次数过多，已锁定",
+			zap.String("identifier", identifier),
+			zap.String("username", username),
+			zap.String("ip", ip),
+			zap.Int("lockCount", attempt.LockCount),
+			zap.Timep("lockedUntil", attempt.LockedUntil))
+	}
+}
+
+// RecordSuccess 登录成功后清除用户名计数（包括退避次数）
+func (g *loginGuard) RecordSuccess(username string) {
+	identifier := g.userIdentifier(username)
+	g.fallback.Delete(identifier)
+	if err := g.store.Delete(identifier); err != nil {
+		logger.Logger.Error("清除登录失败计数失败", zap.String("username", username), zap.Error(err))
+	}
+}
+
+// Unlock 管理员解除锁定
+func (g *loginGuard) Unlock(username, ip string) error {
+	identifiers := []string{g.userIdentifier(username)}
+	if ip != "" {
+		identifiers = append(identifiers, g.ipIdentifier(ip))
+	}
+	for _, identifier := range identifiers {
+		g.fallback.Delete(identifier)
+		if err := g.store.Delete(identifier); err != nil {
+			return err
+		}
+	}
+
+	logger.GetBusinessLogger().Info("管理员解除登录锁定", zap.String("username", username), zap.String("ip", ip))
+	return nil
+}
+
+// purgeIfDue 定期清理长时间未更新的计数记录
+func (g *loginGuard) purgeIfDue() {
+	g.mu.Lock()
+	if time.Since(g.lastPurge) < loginAttemptPurgeInterval {
+		g.mu.Unlock()
+		return
+	}
+	g.lastPurge = time.Now()
+	g.mu.Unlock()
+
+	// 闲置超过锁定上限的记录连同退避次数一起清理
+	before := time.Now().Add(-time.Duration(g.cfg.MaxLockoutMinutes)*time.Minute - g.window())
+	g.fallback.Purge(before)
+	if err := g.store.Purge(before); err != nil {
+		logger.Logger.Error("清理登录失败计数失败", zap.Error(err))
+	}
+}
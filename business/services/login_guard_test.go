@@ -0,0 +1,85 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/business/repositories"
+	"github.com/GZ-Alinx/autops/internal/config"
+	"github.com/GZ-Alinx/autops/internal/logger"
+)
+
+// flakyAttemptStore down为true时所有操作都失败，模拟共享计数存储故障
+type flakyAttemptStore struct {
+	repositories.LoginAttemptStore
+	down bool
+}
+
+var errStoreDown = errors.New("存储不可用")
+
+func (s *flakyAttemptStore) Get(identifier string) (*models.LoginAttempt, error) {
+	if s.down {
+		return nil, errStoreDown
+	}
+	return s.LoginAttemptStore.Get(identifier)
+}
+
+func (s *flakyAttemptStore) Update(identifier string, fn func(attempt *models.LoginAttempt)) (*models.LoginAttempt, error) {
+	if s.down {
+		return nil, errStoreDown
+	}
+	return s.LoginAttemptStore.Update(identifier, fn)
+}
+
+func (s *flakyAttemptStore) Delete(identifier string) error {
+	if s.down {
+		return errStoreDown
+	}
+	return s.LoginAttemptStore.Delete(identifier)
+}
+
+func TestLoginGuardStoreFailure(t *testing.T) {
+	logger.Logger = zap.NewNop()
+	store := &flakyAttemptStore{LoginAttemptStore: repositories.NewMemoryLoginAttemptStore()}
+	guard := NewLoginGuard(store, config.LoginGuardConfig{MaxUserFailures: 3, MaxIPFailures: 100})
+
+	// 存储故障期间失败计入本实例内存，达到阈值后仍然锁定
+	store.down = true
+	for i := 0; i < 3; i++ {
+		if err := guard.Check("alice", "10.0.0.1"); err != nil {
+			t.Fatalf("第%d次登录前被锁定: %v", i+1, err)
+		}
+		guard.RecordFailure("alice", "10.0.0.1")
+	}
+	var locked *LoginLockedError
+	if err := guard.Check("Alice", "10.0.0.2"); !errors.As(err, &locked) || locked.RetryAfter <= 0 {
+		t.Fatalf("存储故障时未锁定，错误为%v", err)
+	}
+
+	// 存储恢复后故障期间的锁定仍然有效
+	store.down = false
+	if err := guard.Check("alice", "10.0.0.3"); !errors.As(err, &locked) {
+		t.Fatalf("存储恢复后锁定失效，错误为%v", err)
+	}
+
+	// 解除锁定同时清除内存中的计数
+	if err := guard.Unlock("alice", ""); err != nil {
+		t.Fatalf("解除锁定失败: %v", err)
+	}
+	if err := guard.Check("alice", "10.0.0.1"); err != nil {
+		t.Fatalf("解除锁定后仍被拒绝: %v", err)
+	}
+
+	// 存储正常时计数写入存储，不写入内存
+	guard.RecordFailure("bob", "10.0.0.4")
+	attempt, err := store.Get("user:bob")
+	if err != nil || attempt.Failures != 1 {
+		t.Fatalf("存储中的计数为%+v，错误: %v", attempt, err)
+	}
+	if fallback, _ := guard.(*loginGuard).fallback.Get("user:bob"); fallback.Failures != 0 {
+		t.Errorf("存储正常时计入了内存: %+v", fallback)
+	}
+}
@@ -0,0 +1,262 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/business/repositories"
+	"github.com/GZ-Alinx/autops/internal/config"
+	"github.com/GZ-Alinx/autops/internal/logger"
+	"github.com/GZ-Alinx/autops/internal/middleware"
+	"github.com/GZ-Alinx/autops/internal/totp"
+)
+
+// recoveryCodeCount 每次生成的恢复码数量
+const recoveryCodeCount = 10
+
+var (
+	// ErrMFANotEnabled 用户未启用两步验证
+	ErrMFANotEnabled = errors.New("未启用两步验证")
+	// ErrMFAAlreadyEnabled 用户已启用两步验证
+	ErrMFAAlreadyEnabled = errors.New("已启用两步验证，如需更换设备请先关闭")
+	// ErrMFANotEnrolling 用户未开始绑定流程
+	ErrMFANotEnrolling = errors.New("请先获取两步验证密钥")
+	// ErrInvalidMFACode 验证码或恢复码错误
+	ErrInvalidMFACode = errors.New("验证码错误或已使用")
+)
+
+// MFAEnrollment 两步验证绑定信息
+type MFAEnrollment struct {
+	Secret     string `json:"secret"`      // Base32密钥，供无法扫码时手动输入
+	OTPAuthURI string `json:"otpauth_uri"` // otpauth URI
+	QRPayload  string `json:"qr_payload"`  // 二维码内容，前端直接编码为二维码即可
+}
+
+// MFAStatus 两步验证状态
+type MFAStatus struct {
+	Enabled                bool  `json:"enabled"`
+	Required               bool  `json:"required"`
+	RecoveryCodesRemaining int64 `json:"recovery_codes_remaining"`
+}
+
+// MFAService 两步验证服务接口
+type MFAService interface {
+	// RequiredByRole 用户的角色是否要求启用两步验证
+	RequiredByRole(user *models.User) bool
+	// Status 获取用户两步验证状态
+	Status(user *models.User) (*MFAStatus, error)
+	// BeginEnrollment 生成新的TOTP密钥，确认前不生效
+	BeginEnrollment(user *models.User) (*MFAEnrollment, error)
+	// ConfirmEnrollment 校验验证码后启用两步验证，返回仅展示一次的恢复码
+	ConfirmEnrollment(user *models.User, code string) ([]string, error)
+	// Verify 校验TOTP验证码或恢复码
+	Verify(user *models.User, code string) error
+	// Disable 校验验证码后关闭两步验证
+	Disable(user *models.User, code string) error
+	// RegenerateRecoveryCodes 校验验证码后重新生成恢复码
+	RegenerateRecoveryCodes(user *models.User, code string) ([]string, error)
+	// Reset 管理员重置用户的两步验证（用于设备丢失）
+	Reset(userID uint) error
+}
+
+// mfaService 服务实现
+type mfaService struct {
+	repo repositories.MFARepository
+}
+
+// NewMFAService 创建两步验证服务实例
+func NewMFAService(repo repositories.MFARepository) MFAService {
+	return &mfaService{
+		repo: repo,
+	}
+}
+
+// mfaIssuer otpauth URI中的签发方名称
+func mfaIssuer() string {
+	if config.AppConfig.MFA.Issuer != "" {
+		return config.AppConfig.MFA.Issuer
+	}
+	return config.AppConfig.App.Name
+}
+
+// normalizeRecoveryCode 统一恢复码格式（忽略大小写、空格和连字符）
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
+
+// generateRecoveryCodes 生成恢复码明文及其哈希
+func generateRecoveryCodes() ([]string, []string, error) {
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		buf := make([]byte, 7)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(encoding.EncodeToString(buf))[:10]
+		codes = append(codes, raw[:5]+"-"+raw[5:])
+		hashes = append(hashes, middleware.HashToken(raw))
+	}
+	return codes, hashes, nil
+}
+
+// RequiredByRole 用户的角色是否要求启用两步验证
+func (s *mfaService) RequiredByRole(user *models.User) bool {
+	for _, role := range user.Roles {
+		if role.RequireMFA {
+			return true
+		}
+	}
+	return false
+}
+
+// Status 获取用户两步验证状态
+func (s *mfaService) Status(user *models.User) (*MFAStatus, error) {
+	status := &MFAStatus{Enabled: user.MFAEnabled, Required: s.RequiredByRole(user)}
+	if user.MFAEnabled {
+		remaining, err := s.repo.CountRecoveryCodes(user.ID)
+		if err != nil {
+			return nil, err
+		}
+		status.RecoveryCodesRemaining = remaining
+	}
+	return status, nil
+}
+
+// BeginEnrollment 生成新的TOTP密钥，确认前不生效
+func (s *mfaService) BeginEnrollment(user *models.User) (*MFAEnrollment, error) {
+	if user.MFAEnabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.SaveSecret(user.ID, secret); err != nil {
+		logger.Logger.Error("保存TOTP密钥失败", zap.Uint("userID", user.ID), zap.Error(err))
+		return nil, err
+	}
+	user.MFASecret = secret
+
+	uri := totp.URI(mfaIssuer(), user.Username, secret)
+	logger.Logger.Info("生成两步验证密钥", zap.Uint("userID", user.ID))
+	return &MFAEnrollment{Secret: secret, OTPAuthURI: uri, QRPayload: uri}, nil
+}
+
+// ConfirmEnrollment 校验验证码后启用两步验证，返回仅展示一次的恢复码
+func (s *mfaService) ConfirmEnrollment(user *models.User, code string) ([]string, error) {
+	if user.MFAEnabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if user.MFASecret == "" {
+		return nil, ErrMFANotEnrolling
+	}
+
+	step, ok := totp.Validate(user.MFASecret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.Enable(user.ID, step, hashes); err != nil {
+		logger.Logger.Error("启用两步验证失败", zap.Uint("userID", user.ID), zap.Error(err))
+		return nil, err
+	}
+	user.MFAEnabled = true
+	user.MFALastStep = step
+
+	logger.Logger.Info("启用两步验证成功", zap.Uint("userID", user.ID))
+	return codes, nil
+}
+
+// Verify 校验TOTP验证码或恢复码
+func (s *mfaService) Verify(user *models.User, code string) error {
+	if !user.MFAEnabled || user.MFASecret == "" {
+		return ErrMFANotEnabled
+	}
+
+	// 6位数字按TOTP验证码处理，其余按恢复码处理
+	if len(strings.TrimSpace(code)) == totp.Digits {
+		step, ok := totp.Validate(user.MFASecret, code, time.Now())
+		if !ok {
+			return ErrInvalidMFACode
+		}
+		advanced, err := s.repo.AdvanceStep(user.ID, step)
+		if err != nil {
+			return err
+		}
+		if !advanced {
+			logger.Logger.Warn("两步验证码重复使用", zap.Uint("userID", user.ID))
+			return ErrInvalidMFACode
+		}
+		user.MFALastStep = step
+		return nil
+	}
+
+	used, err := s.repo.UseRecoveryCode(user.ID, middleware.HashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidMFACode
+	}
+
+	remaining, _ := s.repo.CountRecoveryCodes(user.ID)
+	logger.Logger.Info("使用两步验证恢复码", zap.Uint("userID", user.ID), zap.Int64("remaining", remaining))
+	return nil
+}
+
+// Disable 校验验证码后关闭两步验证
+func (s *mfaService) Disable(user *models.User, code string) error {
+	if err := s.Verify(user, code); err != nil {
+		return err
+	}
+	if err := s.repo.Disable(user.ID); err != nil {
+		return err
+	}
+	user.MFAEnabled = false
+	user.MFASecret = ""
+
+	logger.Logger.Info("关闭两步验证", zap.Uint("userID", user.ID))
+	return nil
+}
+
+// RegenerateRecoveryCodes 校验验证码后重新生成恢复码
+func (s *mfaService) RegenerateRecoveryCodes(user *models.User, code string) ([]string, error) {
+	if err := s.Verify(user, code); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.ReplaceRecoveryCodes(user.ID, hashes); err != nil {
+		return nil, err
+	}
+
+	logger.Logger.Info("重新生成两步验证恢复码", zap.Uint("userID", user.ID))
+	return codes, nil
+}
+
+// Reset 管理员重置用户的两步验证（用于设备丢失）
+func (s *mfaService) Reset(userID uint) error {
+	if err := s.repo.Disable(userID); err != nil {
+		return err
+	}
+	logger.Logger.Info("管理员重置两步验证", zap.Uint("userID", userID))
+	return nil
+}
@@ -0,0 +1,262 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/business/repositories"
+	"github.com/GZ-Alinx/autops/internal/config"
+	"github.com/GZ-Alinx/autops/internal/logger"
+	"github.com/GZ-Alinx/autops/internal/middleware"
+	"github.com/GZ-Alinx/autops/internal/oidc"
+)
+
+var (
+	// ErrOIDCDisabled 未启用单点登录
+	ErrOIDCDisabled = errors.New("未启用单点登录")
+	// ErrInvalidOIDCState state无效、已过期或已使用
+	ErrInvalidOIDCState = errors.New("单点登录请求无效或已过期，请重新登录")
+	// ErrOIDCLoginFailed 授权码换取令牌或ID令牌校验失败
+	ErrOIDCLoginFailed = errors.New("单点登录失败，请重新登录")
+)
+
+// OIDCLogin 发起单点登录的结果
+type OIDCLogin struct {
+	AuthorizationURL string        `json:"authorization_url"` // 身份提供方授权地址
+	State            string        `json:"state"`             // 回调时需原样带回
+	ExpiresIn        time.Duration `json:"-"`                 // state有效期
+}
+
+// OIDCService OpenID Connect单点登录服务接口
+type OIDCService interface {
+	// Enabled 是否启用单点登录
+	Enabled() bool
+	// BeginLogin 生成state、nonce和PKCE校验码，返回身份提供方授权地址
+	BeginLogin() (*OIDCLogin, error)
+	// CompleteLogin 校验state，用授权码换取并校验ID令牌，创建或关联本地用户
+	CompleteLogin(state, code string) (*AuthResult, error)
+}
+
+// oidcService 服务实现
+type oidcService struct {
+	cfg         config.OIDCConfig
+	repo        repositories.OIDCStateRepository
+	provisioner UserProvisioner
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+// NewOIDCService 创建单点登录服务实例
+func NewOIDCService(cfg config.OIDCConfig, repo repositories.OIDCStateRepository, provisioner UserProvisioner) OIDCService {
+	if cfg.UsernameClaim == "" {
+		cfg.UsernameClaim = "preferred_username"
+	}
+	if cfg.EmailClaim == "" {
+		cfg.EmailClaim = "email"
+	}
+	if cfg.NameClaim == "" {
+		cfg.NameClaim = "name"
+	}
+	if cfg.GroupsClaim == "" {
+		cfg.GroupsClaim = "groups"
+	}
+	if cfg.StateMinutes <= 0 {
+		cfg.StateMinutes = 10
+	}
+	if cfg.TimeoutSeconds <= 0 {
+		cfg.TimeoutSeconds = 10
+	}
+	return &oidcService{
+		cfg:         cfg,
+		repo:        repo,
+		provisioner: provisioner,
+	}
+}
+
+// NewOIDCServiceFromConfig 使用全局配置创建单点登录服务
+func NewOIDCServiceFromConfig(userRepo repositories.UserRepository) OIDCService {
+	provisioner := NewUserProvisioner(userRepo, repositories.NewRoleRepository())
+	return NewOIDCService(config.AppConfig.OIDC, repositories.NewOIDCStateRepository(), provisioner)
+}
+
+// Enabled 是否启用单点登录
+func (s *oidcService) Enabled() bool {
+	return s.cfg.Enabled
+}
+
+// getProvider 首次使用时读取发现文档，失败后下次请求重试
+func (s *oidcService) getProvider(ctx context.Context) (*oidc.Provider, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.provider != nil {
+		return s.provider, nil
+	}
+	provider, err := oidc.Discover(ctx, s.cfg)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrAuthUnavailable, err)
+	}
+	s.provider = provider
+	logger.Logger.Info("OIDC身份提供方发现成功", zap.String("issuer", provider.Metadata().Issuer))
+	return provider, nil
+}
+
+// context 访问身份提供方的超时上下文
+func (s *oidcService) context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), time.Duration(s.cfg.TimeoutSeconds)*time.Second)
+}
+
+// BeginLogin 发起单点登录
+func (s *oidcService) BeginLogin() (*OIDCLogin, error) {
+	if !s.cfg.Enabled {
+		return nil, ErrOIDCDisabled
+	}
+	ctx, cancel := s.context()
+	defer cancel()
+	provider, err := s.getProvider(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := oidc.RandomString(32)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := oidc.RandomString(32)
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := oidc.RandomString(48)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl := time.Duration(s.cfg.StateMinutes) * time.Minute
+	if err := s.repo.Create(&models.OIDCLoginState{
+		StateHash:    middleware.HashToken(state),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(ttl),
+	}); err != nil {
+		return nil, err
+	}
+	if err := s.repo.PurgeExpired(); err != nil {
+		logger.Logger.Error("清理过期的单点登录state失败", zap.Error(err))
+	}
+
+	return &OIDCLogin{
+		AuthorizationURL: provider.AuthCodeURL(state, nonce, verifier),
+		State:            state,
+		ExpiresIn:        ttl,
+	}, nil
+}
+
+// CompleteLogin 完成单点登录
+func (s *oidcService) CompleteLogin(state, code string) (*AuthResult, error) {
+	if !s.cfg.Enabled {
+		return nil, ErrOIDCDisabled
+	}
+	if state == "" || code == "" {
+		return nil, ErrInvalidOIDCState
+	}
+
+	// state只能使用一次，先取出再访问身份提供方
+	record, err := s.repo.Take(middleware.HashToken(state))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidOIDCState
+		}
+		return nil, err
+	}
+	if time.Now().After(record.ExpiresAt) {
+		return nil, ErrInvalidOIDCState
+	}
+
+	ctx, cancel := s.context()
+	defer cancel()
+	provider, err := s.getProvider(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := provider.Exchange(ctx, code, record.CodeVerifier)
+	if err != nil {
+		logger.Logger.Warn("OIDC授权码换取令牌失败", zap.Error(err))
+		return nil, fmt.Errorf("%w: %v", ErrOIDCLoginFailed, err)
+	}
+	claims, err := provider.VerifyIDToken(ctx, token.IDToken, record.Nonce)
+	if err != nil {
+		logger.GetBusinessLogger().Warn("OIDC ID令牌校验失败", zap.Error(err))
+		return nil, fmt.Errorf("%w: %v", ErrOIDCLoginFailed, err)
+	}
+
+	identity, err := s.identity(claims)
+	if err != nil {
+		return nil, err
+	}
+	user, rolesChanged, err := s.provisioner.Provision(identity)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.GetBusinessLogger().Info("OIDC单点登录成功",
+		zap.Uint("userID", user.ID),
+		zap.String("username", user.Username),
+		zap.String("subject", identity.ExternalID))
+	return &AuthResult{User: user, Source: models.UserSourceOIDC, RolesChanged: rolesChanged}, nil
+}
+
+// identity 从ID令牌声明中提取用户身份
+func (s *oidcService) identity(claims oidc.Claims) (*ExternalIdentity, error) {
+	email := claims.String(s.cfg.EmailClaim)
+	// 身份提供方明确表示邮箱未验证时不使用该邮箱，避免占用他人邮箱
+	if verified, ok := claims.Bool("email_verified"); ok && !verified {
+		email = ""
+	}
+
+	username := claims.String(s.cfg.UsernameClaim)
+	if username == "" {
+		username = email
+	}
+	if username == "" {
+		return nil, fmt.Errorf("%w: ID令牌缺少%s声明", ErrOIDCLoginFailed, s.cfg.UsernameClaim)
+	}
+	if len([]rune(username)) > 50 {
+		return nil, fmt.Errorf("%w: 用户名过长", ErrOIDCLoginFailed)
+	}
+
+	return &ExternalIdentity{
+		Source:     models.UserSourceOIDC,
+		ExternalID: claims.String("sub"),
+		Username:   username,
+		Email:      email,
+		Nickname:   claims.String(s.cfg.NameClaim),
+		Roles:      s.mapRoles(claims.Strings(s.cfg.GroupsClaim)),
+		SyncRoles:  s.cfg.SyncRoles,
+	}, nil
+}
+
+// mapRoles 将组声明映射为角色名称，不区分大小写
+func (s *oidcService) mapRoles(groups []string) []string {
+	memberOf := make(map[string]struct{}, len(groups))
+	for _, g := range groups {
+		memberOf[strings.ToLower(g)] = struct{}{}
+	}
+
+	roles := append([]string{}, s.cfg.DefaultRoles...)
+	for _, m := range s.cfg.GroupMappings {
+		if _, ok := memberOf[strings.ToLower(m.Group)]; ok {
+			roles = append(roles, m.Roles...)
+		}
+	}
+	return uniqueStrings(roles)
+}
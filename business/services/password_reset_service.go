@@ -0,0 +1,163 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/business/repositories"
+	"github.com/GZ-Alinx/autops/internal/config"
+	"github.com/GZ-Alinx/autops/internal/logger"
+	"github.com/GZ-Alinx/autops/internal/mailer"
+	"github.com/GZ-Alinx/autops/internal/middleware"
+)
+
+// ErrInvalidResetToken 重置链接无效、已过期或已使用
+var ErrInvalidResetToken = errors.New("重置链接无效或已过期，请重新申请")
+
+// PasswordResetService 自助找回密码服务接口
+type PasswordResetService interface {
+	// RequestReset 为邮箱对应的用户发送重置链接，邮箱不存在时同样返回nil，避免泄露账号是否存在
+	RequestReset(email, ip string) error
+	// ResetPassword 校验重置令牌并设置新密码，成功后吊销该用户全部会话
+	ResetPassword(token, newPassword string) (*models.User, error)
+}
+
+// passwordResetService 服务实现
+type passwordResetService struct {
+	repo         repositories.PasswordResetRepository
+	userRepo     repositories.UserRepository
+	userService  UserService
+	tokenService TokenService
+	mailer       mailer.Mailer
+}
+
+// NewPasswordResetService 创建找回密码服务实例
+func NewPasswordResetService(repo repositories.PasswordResetRepository, userRepo repositories.UserRepository, userService UserService, tokenService TokenService, m mailer.Mailer) PasswordResetService {
+	return &passwordResetService{
+		repo:         repo,
+		userRepo:     userRepo,
+		userService:  userService,
+		tokenService: tokenService,
+		mailer:       m,
+	}
+}
+
+// resetTokenTTL 重置链接有效期
+func resetTokenTTL() time.Duration {
+	if config.AppConfig.PasswordReset.TokenMinutes > 0 {
+		return time.Duration(config.AppConfig.PasswordReset.TokenMinutes) * time.Minute
+	}
+	return 30 * time.Minute
+}
+
+// resetLink 生成邮件中的重置链接
+func resetLink(token string) string {
+	base := config.AppConfig.PasswordReset.URL
+	if base == "" {
+		return token
+	}
+	sep := "?"
+	if strings.Contains(base, "?") {
+		sep = "&"
+	}
+	return base + sep + "token=" + url.QueryEscape(token)
+}
+
+// RequestReset 生成一次性重置令牌并发送邮件
+func (s *passwordResetService) RequestReset(email, ip string) error {
+	email = strings.TrimSpace(email)
+	user, err := s.userRepo.GetByEmail(email)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			logger.Logger.Info("找回密码: 邮箱未注册", zap.String("email", email), zap.String("ip", ip))
+			return nil
+		}
+		return err
+	}
+	// 服务账号和外部账号没有可用的本地密码
+	if user.Type == models.UserTypeService || !isLocalUser(user) {
+		logger.Logger.Warn("找回密码: 该账号不支持找回密码", zap.Uint("userID", user.ID), zap.String("source", user.Source))
+		return nil
+	}
+
+	raw, err := randomToken(32)
+	if err != nil {
+		return err
+	}
+	ttl := resetTokenTTL()
+	token := &models.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: middleware.HashToken(raw),
+		ExpiresAt: time.Now().Add(ttl),
+		RequestIP: ip,
+	}
+	if err := s.repo.Create(token); err != nil {
+		return err
+	}
+
+	msg := &mailer.Message{
+		To:      []string{user.Email},
+		Subject: fmt.Sprintf("[%s] 重置密码", config.AppConfig.App.Name),
+		Body: fmt.Sprintf("%s，您好：\n\n我们收到了重置您账号密码的请求，请在%d分钟内打开以下链接设置新密码：\n\n%s\n\n链接只能使用一次。如果这不是您本人的操作，请忽略本邮件，您的密码不会被修改。\n",
+			user.Username, int(ttl.Minutes()), resetLink(raw)),
+	}
+	if err := s.mailer.Send(msg); err != nil {
+		logger.Logger.Error("发送重置密码邮件失败", zap.Uint("userID", user.ID), zap.Error(err))
+		return err
+	}
+
+	logger.GetBusinessLogger().Info("已发送重置密码邮件", zap.Uint("userID", user.ID), zap.String("ip", ip))
+	return nil
+}
+
+// ResetPassword 使用重置令牌设置新密码
+func (s *passwordResetService) ResetPassword(token, newPassword string) (*models.User, error) {
+	record, err := s.repo.GetByHash(middleware.HashToken(token))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidResetToken
+		}
+		return nil, err
+	}
+	if record.UsedAt != nil || time.Now().After(record.ExpiresAt) {
+		return nil, ErrInvalidResetToken
+	}
+
+	user, err := s.userRepo.GetByID(record.UserID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidResetToken
+		}
+		return nil, err
+	}
+
+	// 先校验新密码，不符合密码策略时令牌保持可用
+	if err := s.userService.ValidatePassword(user, newPassword); err != nil {
+		return nil, err
+	}
+	// 条件更新抢占令牌后再修改密码，并发请求中只有一个能成功
+	if ok, err := s.repo.MarkUsed(record.ID); err != nil {
+		return nil, err
+	} else if !ok {
+		logger.Logger.Warn("重置密码令牌被并发使用", zap.Uint("userID", user.ID))
+		return nil, ErrInvalidResetToken
+	}
+	if err := s.userService.ResetPassword(user, newPassword, false); err != nil {
+		return nil, err
+	}
+
+	// 密码可能已泄露，重置后吊销全部已登录会话
+	if err := s.tokenService.RevokeAllForUser(user.ID, 0); err != nil {
+		return nil, err
+	}
+
+	logger.GetBusinessLogger().Info("用户通过邮件重置密码", zap.Uint("userID", user.ID))
+	return user, nil
+}
@@ -0,0 +1,196 @@
+package services
+
+import (
+	"errors"
+	"io"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/business/repositories"
+	"github.com/GZ-Alinx/autops/internal/config"
+	"github.com/GZ-Alinx/autops/internal/mailer"
+	"github.com/GZ-Alinx/autops/internal/mailer/mailertest"
+	"github.com/GZ-Alinx/autops/internal/middleware"
+)
+
+const testResetURL = "https://autops.example.com/reset-password"
+
+// resetLinkPattern 邮件正文中的重置链接
+var resetLinkPattern = regexp.MustCompile(regexp.QuoteMeta(testResetURL) + `\?token=(\S+)`)
+
+// resetFixture 连接进程内SMTP服务器的找回密码服务
+type resetFixture struct {
+	db      *gorm.DB
+	service PasswordResetService
+	server  *mailertest.Server
+	user    *models.User
+}
+
+func newResetFixture(t *testing.T) *resetFixture {
+	t.Helper()
+	db := setupTestDB(t, &models.PasswordResetToken{}, &models.PasswordHistory{},
+		&models.RefreshToken{}, &models.RevokedToken{}, &models.UserSession{})
+
+	previous := config.AppConfig.PasswordReset
+	config.AppConfig.PasswordReset = config.PasswordResetConfig{URL: testResetURL, TokenMinutes: 30}
+	t.Cleanup(func() { config.AppConfig.PasswordReset = previous })
+
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("Old-Passw0rd!"), bcrypt.MinCost)
+	user := &models.User{Username: "alice", Password: string(hashed), Email: "alice@example.com", Status: models.UserStatusActive}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+
+	server := mailertest.NewServer(t)
+	userRepo := repositories.NewUserRepository()
+	tokenService := NewTokenService(repositories.NewTokenRepository(), repositories.NewSessionRepository(), userRepo)
+	service := NewPasswordResetService(repositories.NewPasswordResetRepository(), userRepo, NewUserService(userRepo),
+		tokenService, mailer.NewSMTPMailer(server.Config("Autops <noreply@example.com>")))
+	return &resetFixture{db: db, service: service, server: server, user: user}
+}
+
+// requestLink 申请重置并从收到的邮件中取出令牌
+func (f *resetFixture) requestLink(t *testing.T) string {
+	t.Helper()
+	before := len(f.server.Messages())
+	if err := f.service.RequestReset(f.user.Email, "10.0.0.1"); err != nil {
+		t.Fatalf("RequestReset失败: %v", err)
+	}
+	msgs := f.server.Messages()
+	if len(msgs) != before+1 {
+		t.Fatalf("服务器收到%d封新邮件，期望1封", len(msgs)-before)
+	}
+	msg := msgs[len(msgs)-1]
+	if strings.Join(msg.To, ",") != f.user.Email {
+		t.Fatalf("收件人为%v", msg.To)
+	}
+
+	parsed, err := mail.ReadMessage(strings.NewReader(msg.Data))
+	if err != nil {
+		t.Fatalf("解析邮件失败: %v", err)
+	}
+	body, _ := io.ReadAll(parsed.Body)
+	match := resetLinkPattern.FindStringSubmatch(string(body))
+	if match == nil {
+		t.Fatalf("正文中没有重置链接: %s", body)
+	}
+	token, err := url.QueryUnescape(match[1])
+	if err != nil || token == "" {
+		t.Fatalf("链接中的令牌无效: %q", match[1])
+	}
+	if !strings.Contains(string(body), f.user.Username) {
+		t.Errorf("正文中缺少用户名: %s", body)
+	}
+	return token
+}
+
+func TestPasswordResetMailFlow(t *testing.T) {
+	f := newResetFixture(t)
+	refresh := &models.RefreshToken{UserID: f.user.ID, TokenHash: middleware.HashToken("refresh-1"), FamilyID: "family-1", ExpiresAt: time.Now().Add(time.Hour)}
+	if err := repositories.NewTokenRepository().CreateRefreshToken(refresh); err != nil {
+		t.Fatalf("创建刷新令牌失败: %v", err)
+	}
+
+	first := f.requestLink(t)
+
+	// 数据库只保存令牌哈希
+	var stored models.PasswordResetToken
+	if err := f.findToken(first, &stored); err != nil {
+		t.Fatalf("未按哈希保存令牌: %v", err)
+	}
+	if stored.TokenHash == first || stored.RequestIP != "10.0.0.1" {
+		t.Errorf("令牌记录错误: %+v", stored)
+	}
+
+	// 再次申请后之前的链接失效
+	second := f.requestLink(t)
+	if second == first {
+		t.Fatal("两次申请生成了相同的令牌")
+	}
+	if _, err := f.service.ResetPassword(first, "N3w-Passw0rd!x"); !errors.Is(err, ErrInvalidResetToken) {
+		t.Fatalf("旧链接应失效，实际错误为%v", err)
+	}
+
+	// 不符合密码策略时令牌保持可用
+	if _, err := f.service.ResetPassword(second, "short"); err == nil || errors.Is(err, ErrInvalidResetToken) {
+		t.Fatalf("弱密码应被密码策略拒绝，实际错误为%v", err)
+	}
+
+	user, err := f.service.ResetPassword(second, "N3w-Passw0rd!x")
+	if err != nil {
+		t.Fatalf("ResetPassword失败: %v", err)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte("N3w-Passw0rd!x")) != nil {
+		t.Error("密码未更新")
+	}
+	if user.MustChangePassword {
+		t.Error("通过邮件重置后不应要求再次修改密码")
+	}
+
+	// 链接只能使用一次
+	if _, err := f.service.ResetPassword(second, "An0ther-Passw0rd!"); !errors.Is(err, ErrInvalidResetToken) {
+		t.Fatalf("链接被重复使用，错误为%v", err)
+	}
+
+	// 重置后吊销已有的刷新令牌
+	got, err := repositories.NewTokenRepository().GetRefreshTokenByHash(refresh.TokenHash)
+	if err != nil {
+		t.Fatalf("读取刷新令牌失败: %v", err)
+	}
+	if got.RevokedAt == nil {
+		t.Error("重置密码后刷新令牌未被吊销")
+	}
+}
+
+func TestPasswordResetExpiredLink(t *testing.T) {
+	f := newResetFixture(t)
+	token := f.requestLink(t)
+
+	var stored models.PasswordResetToken
+	if err := f.findToken(token, &stored); err != nil {
+		t.Fatalf("读取令牌失败: %v", err)
+	}
+	stored.ExpiresAt = time.Now().Add(-time.Minute)
+	if err := f.db.Save(&stored).Error; err != nil {
+		t.Fatalf("更新令牌失败: %v", err)
+	}
+	if _, err := f.service.ResetPassword(token, "N3w-Passw0rd!x"); !errors.Is(err, ErrInvalidResetToken) {
+		t.Fatalf("过期链接应失效，实际错误为%v", err)
+	}
+}
+
+// TestPasswordResetNoMail 邮箱未注册或账号不使用本地密码时不发送邮件，且返回与正常申请相同的结果
+func TestPasswordResetNoMail(t *testing.T) {
+	f := newResetFixture(t)
+	ldapUser := &models.User{Username: "bob", Password: "x", Email: "bob@example.com", Source: models.UserSourceLDAP}
+	if err := f.db.Create(ldapUser).Error; err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+
+	for _, email := range []string{"nobody@example.com", ldapUser.Email} {
+		if err := f.service.RequestReset(email, "10.0.0.1"); err != nil {
+			t.Errorf("%s: RequestReset返回错误: %v", email, err)
+		}
+	}
+	if n := len(f.server.Messages()); n != 0 {
+		t.Fatalf("发送了%d封邮件，期望0封", n)
+	}
+}
+
+// findToken 按原始令牌的哈希查找记录
+func (f *resetFixture) findToken(raw string, token *models.PasswordResetToken) error {
+	found, err := repositories.NewPasswordResetRepository().GetByHash(middleware.HashToken(raw))
+	if err != nil {
+		return err
+	}
+	*token = *found
+	return nil
+}
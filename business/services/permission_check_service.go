@@ -0,0 +1,131 @@
+package services
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/casbin/casbin/v2/util"
+
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/internal/condition"
+	"github.com/GZ-Alinx/autops/internal/database"
+	"github.com/GZ-Alinx/autops/internal/global"
+	"github.com/GZ-Alinx/autops/internal/middleware"
+)
+
+// ErrEnforcerNotReady 权限管理器未初始化
+var ErrEnforcerNotReady = errors.New("权限管理器未初始化")
+
+// CheckItem 待检查的操作
+type CheckItem struct {
+	Path   string            `json:"path" binding:"required"` // 请求路径；template模式下为路由模板，如/api/v1/users/:id
+	Method string            `json:"method" binding:"required"`
+	Params map[string]string `json:"params"` // 路径参数，用于owner条件，如{"id": "5"}
+}
+
+// CheckSubject 检查的主体：用户在租户内的角色或指定的角色
+type CheckSubject struct {
+	Roles  []string
+	Tenant string
+	Attrs  condition.Attributes // 请求属性，Params按操作覆盖
+}
+
+// PolicyMatch 与请求匹配的策略
+type PolicyMatch struct {
+	Role         string   `json:"role"`          // 被检查的角色
+	Policy       []string `json:"policy"`        // 策略：角色, 租户, 资源, 动作, 条件, 效果；角色可能是被检查角色继承的父角色
+	Matcher      string   `json:"matcher"`       // 资源的匹配方式：equal、keyMatch（path模式）或keyMatch2（template模式）
+	ConditionMet bool     `json:"condition_met"` // 条件是否满足，不满足时该策略不生效
+}
+
+// CheckResult 权限检查结果
+type CheckResult struct {
+	Path    string                  `json:"path"`
+	Method  string                  `json:"method"`
+	Allowed bool                    `json:"allowed"`
+	Roles   []middleware.RoleResult `json:"roles,omitempty"`   // 每个角色的检查结果
+	Matches []PolicyMatch           `json:"matches,omitempty"` // 匹配资源和动作的全部策略
+}
+
+// PermissionCheckService 权限检查服务接口
+type PermissionCheckService interface {
+	// Check 检查主体能否执行操作，explain为true时返回角色结果和匹配的策略
+	Check(subject CheckSubject, items []CheckItem, explain bool) ([]CheckResult, error)
+}
+
+// permissionCheckService 服务实现，与CasbinMiddleware使用相同的检查逻辑
+type permissionCheckService struct{}
+
+// NewPermissionCheckService 创建权限检查服务实例
+func NewPermissionCheckService() PermissionCheckService {
+	return &permissionCheckService{}
+}
+
+// Check 检查主体能否执行操作
+func (s *permissionCheckService) Check(subject CheckSubject, items []CheckItem, explain bool) ([]CheckResult, error) {
+	if global.Enforcer == nil {
+		return nil, ErrEnforcerNotReady
+	}
+	if subject.Tenant == "" {
+		subject.Tenant = models.DefaultTenantCode
+	}
+
+	results := make([]CheckResult, 0, len(items))
+	for _, item := range items {
+		attrs := subject.Attrs
+		attrs.Params = item.Params
+		method := strings.ToUpper(item.Method)
+
+		allowed, roleResults, err := middleware.EnforceRoles(subject.Roles, subject.Tenant, item.Path, method, &attrs)
+		if err != nil {
+			return nil, err
+		}
+		result := CheckResult{Path: item.Path, Method: method, Allowed: allowed}
+		if explain {
+			result.Roles = roleResults
+			if result.Matches, err = matchPolicies(subject.Roles, subject.Tenant, item.Path, method, &attrs); err != nil {
+				return nil, err
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// matchPolicies 列出角色（含继承的父角色）在租户内匹配资源和动作的全部策略
+func matchPolicies(roles []string, tenant, path, method string, attrs *condition.Attributes) ([]PolicyMatch, error) {
+	policies, err := global.Enforcer.GetPolicy()
+	if err != nil {
+		return nil, err
+	}
+
+	matches := make([]PolicyMatch, 0)
+	for _, role := range roles {
+		implicit, err := global.Enforcer.GetImplicitRolesForUser(role, tenant)
+		if err != nil {
+			return nil, err
+		}
+		subjects := map[string]bool{role: true}
+		for _, r := range implicit {
+			subjects[r] = true
+		}
+
+		for _, p := range policies {
+			// p: 角色, 租户, 资源, 动作, 条件, 效果
+			if len(p) < 6 || !subjects[p[0]] || p[3] != method || !util.KeyMatch(tenant, p[1]) || !database.ResourceMatch(path, p[2]) {
+				continue
+			}
+			matcher := database.ResourceMatcher()
+			if p[2] == path {
+				matcher = "equal"
+			}
+			matches = append(matches, PolicyMatch{
+				Role:         role,
+				Policy:       p,
+				Matcher:      matcher,
+				ConditionMet: condition.Eval(p[4], attrs),
+			})
+		}
+	}
+	return matches, nil
+}
@@ -0,0 +1,383 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/internal/condition"
+)
+
+// 权限配置文档的格式
+const (
+	PolicyFormatYAML = "yaml"
+	PolicyFormatCSV  = "csv"
+)
+
+var (
+	// ErrPolicyFormat 不支持的文档格式
+	ErrPolicyFormat = errors.New("不支持的格式，应为yaml或csv")
+	// ErrPolicyInvalid 文档内容不合法
+	ErrPolicyInvalid = errors.New("权限配置不合法")
+)
+
+// builtinRoles 启动时自动创建的内置角色，文档中必须包含
+var builtinRoles = []string{"admin", "user"}
+
+// PolicyDocument 声明式的权限配置：角色、权限、角色权限关联和可选的用户角色
+type PolicyDocument struct {
+	Roles           []PolicyRole           `yaml:"roles" json:"roles"`
+	Permissions     []PolicyPermission     `yaml:"permissions" json:"permissions"`
+	RolePermissions []PolicyRolePermission `yaml:"role_permissions" json:"role_permissions"`
+	UserRoles       []PolicyUserRole       `yaml:"user_roles,omitempty" json:"user_roles,omitempty"` // 为空时不修改用户角色
+}
+
+// PolicyRole 角色
+type PolicyRole struct {
+	Name        string   `yaml:"name" json:"name"`
+	Description string   `yaml:"description,omitempty" json:"description,omitempty"`
+	RequireMFA  bool     `yaml:"require_mfa,omitempty" json:"require_mfa,omitempty"`
+	Parents     []string `yaml:"parents,omitempty" json:"parents,omitempty"` // 父角色名
+}
+
+// PolicyPermission 权限，以资源、动作和条件标识
+type PolicyPermission struct {
+	Resource    string `yaml:"resource" json:"resource"`
+	Action      string `yaml:"action" json:"action"`
+	Conditions  string `yaml:"conditions,omitempty" json:"conditions,omitempty"`
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+}
+
+// PolicyRolePermission 角色权限关联
+type PolicyRolePermission struct {
+	Role       string `yaml:"role" json:"role"`
+	Resource   string `yaml:"resource" json:"resource"`
+	Action     string `yaml:"action" json:"action"`
+	Conditions string `yaml:"conditions,omitempty" json:"conditions,omitempty"`
+	Effect     string `yaml:"effect" json:"effect"` // allow或deny，为空时为allow
+}
+
+// PolicyUserRole 用户在默认租户的全部角色
+type PolicyUserRole struct {
+	Username string   `yaml:"username" json:"username"`
+	Roles    []string `yaml:"roles" json:"roles"`
+}
+
+// permissionKey 权限的唯一标识
+func permissionKey(resource, action, conditions string) string {
+	key := action + " " + resource
+	if conditions != "" {
+		key += " [" + conditions + "]"
+	}
+	return key
+}
+
+// PolicyFormatFromPath 按文件扩展名判断格式，无法判断时为yaml
+func PolicyFormatFromPath(path string) string {
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return PolicyFormatCSV
+	}
+	return PolicyFormatYAML
+}
+
+// DecodePolicyDocument 解析yaml或csv格式的权限配置
+func DecodePolicyDocument(format string, data []byte) (*PolicyDocument, error) {
+	switch strings.ToLower(format) {
+	case PolicyFormatYAML, "yml", "":
+		var doc PolicyDocument
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&doc); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%w: %v", ErrPolicyInvalid, err)
+		}
+		return &doc, nil
+	case PolicyFormatCSV:
+		return decodePolicyCSV(data)
+	default:
+		return nil, ErrPolicyFormat
+	}
+}
+
+// EncodePolicyDocument 将权限配置编码为yaml或csv
+func EncodePolicyDocument(format string, doc *PolicyDocument) ([]byte, error) {
+	switch strings.ToLower(format) {
+	case PolicyFormatYAML, "yml", "":
+		var buf bytes.Buffer
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(doc); err != nil {
+			return nil, err
+		}
+		if err := encoder.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case PolicyFormatCSV:
+		return encodePolicyCSV(doc)
+	default:
+		return nil, ErrPolicyFormat
+	}
+}
+
+// csvHeader csv格式说明，每行第一列为记录类型，多个值用|分隔
+const csvHeader = `# role,名称,描述,是否要求两步验证(true/false),父角色(|分隔)
+# permission,资源,动作,条件,描述
+# role_permission,角色,资源,动作,条件,效果(allow/deny)
+# user_role,用户名,角色(|分隔)
+`
+
+// csvFields 每种记录的最大列数（含类型列）
+var csvFields = map[string]int{
+	"role":            5,
+	"permission":      5,
+	"role_permission": 6,
+	"user_role":       3,
+}
+
+// decodePolicyCSV 解析csv格式，#开头的行为注释，缺少的末尾列视为空
+func decodePolicyCSV(data []byte) (*PolicyDocument, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	doc := &PolicyDocument{}
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrPolicyInvalid, err)
+		}
+		line, _ := reader.FieldPos(0)
+		kind := strings.TrimSpace(record[0])
+		fields, ok := csvFields[kind]
+		if !ok {
+			return nil, fmt.Errorf("%w: 第%d行: 未知的记录类型 %q", ErrPolicyInvalid, line, kind)
+		}
+		if len(record) > fields {
+			return nil, fmt.Errorf("%w: 第%d行: %s最多%d列", ErrPolicyInvalid, line, kind, fields)
+		}
+		for len(record) < fields {
+			record = append(record, "")
+		}
+		switch kind {
+		case "role":
+			role := PolicyRole{Name: record[1], Description: record[2], Parents: splitList(record[4])}
+			if record[3] != "" {
+				if role.RequireMFA, err = strconv.ParseBool(record[3]); err != nil {
+					return nil, fmt.Errorf("%w: 第%d行: 无效的require_mfa %q", ErrPolicyInvalid, line, record[3])
+				}
+			}
+			doc.Roles = append(doc.Roles, role)
+		case "permission":
+			doc.Permissions = append(doc.Permissions, PolicyPermission{Resource: record[1], Action: record[2], Conditions: record[3], Description: record[4]})
+		case "role_permission":
+			doc.RolePermissions = append(doc.RolePermissions, PolicyRolePermission{Role: record[1], Resource: record[2], Action: record[3], Conditions: record[4], Effect: record[5]})
+		case "user_role":
+			doc.UserRoles = append(doc.UserRoles, PolicyUserRole{Username: record[1], Roles: splitList(record[2])})
+		}
+	}
+	return doc, nil
+}
+
+// encodePolicyCSV 编码为csv格式
+func encodePolicyCSV(doc *PolicyDocument) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(csvHeader)
+	writer := csv.NewWriter(&buf)
+	for _, role := range doc.Roles {
+		writer.Write([]string{"role", role.Name, role.Description, strconv.FormatBool(role.RequireMFA), strings.Join(role.Parents, "|")})
+	}
+	for _, p := range doc.Permissions {
+		writer.Write([]string{"permission", p.Resource, p.Action, p.Conditions, p.Description})
+	}
+	for _, rp := range doc.RolePermissions {
+		writer.Write([]string{"role_permission", rp.Role, rp.Resource, rp.Action, rp.Conditions, rp.Effect})
+	}
+	for _, ur := range doc.UserRoles {
+		writer.Write([]string{"user_role", ur.Username, strings.Join(ur.Roles, "|")})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// splitList 拆分|分隔的列表，忽略空值
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, "|") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// normalize 规范化文档（去除空白、动作转大写、默认效果），并检查引用和重复
+func (doc *PolicyDocument) normalize() error {
+	var problems []string
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	roles := make(map[string]*PolicyRole, len(doc.Roles))
+	for i := range doc.Roles {
+		role := &doc.Roles[i]
+		role.Name = strings.TrimSpace(role.Name)
+		role.Parents = uniqueStrings(role.Parents)
+		sort.Strings(role.Parents)
+		switch {
+		case role.Name == "":
+			problem("第%d个角色缺少名称", i+1)
+		case roles[role.Name] != nil:
+			problem("角色重复: %s", role.Name)
+		default:
+			roles[role.Name] = role
+		}
+	}
+	for _, name := range builtinRoles {
+		if roles[name] == nil {
+			problem("必须包含内置角色: %s", name)
+		}
+	}
+	for _, role := range roles {
+		for _, parent := range role.Parents {
+			if parent == role.Name {
+				problem("角色不能继承自身: %s", role.Name)
+			} else if roles[parent] == nil {
+				problem("角色%s的父角色不存在: %s", role.Name, parent)
+			}
+		}
+	}
+	if cycle := roleCycle(roles); cycle != "" {
+		problem("%s: %s", ErrRoleCycle.Error(), cycle)
+	}
+
+	permissions := make(map[string]bool, len(doc.Permissions))
+	for i := range doc.Permissions {
+		p := &doc.Permissions[i]
+		p.Resource = strings.TrimSpace(p.Resource)
+		p.Action = strings.ToUpper(strings.TrimSpace(p.Action))
+		p.Conditions = strings.TrimSpace(p.Conditions)
+		key := permissionKey(p.Resource, p.Action, p.Conditions)
+		switch {
+		case !strings.HasPrefix(p.Resource, "/") || p.Action == "":
+			problem("第%d个权限的资源或动作无效: %s", i+1, key)
+		case permissions[key]:
+			problem("权限重复: %s", key)
+		default:
+			permissions[key] = true
+		}
+		if err := condition.Validate(p.Conditions); err != nil {
+			problem("权限%s的条件无效: %v", key, err)
+		}
+	}
+
+	links := make(map[string]bool, len(doc.RolePermissions))
+	for i := range doc.RolePermissions {
+		rp := &doc.RolePermissions[i]
+		rp.Role = strings.TrimSpace(rp.Role)
+		rp.Resource = strings.TrimSpace(rp.Resource)
+		rp.Action = strings.ToUpper(strings.TrimSpace(rp.Action))
+		rp.Conditions = strings.TrimSpace(rp.Conditions)
+		rp.Effect = strings.ToLower(strings.TrimSpace(rp.Effect))
+		if rp.Effect == "" {
+			rp.Effect = models.EffectAllow
+		}
+		key := permissionKey(rp.Resource, rp.Action, rp.Conditions)
+		if roles[rp.Role] == nil {
+			problem("角色权限关联的角色不存在: %s", rp.Role)
+		}
+		if !permissions[key] {
+			problem("角色权限关联的权限不存在: %s", key)
+		}
+		if rp.Effect != models.EffectAllow && rp.Effect != models.EffectDeny {
+			problem("角色权限关联的效果无效: %s", rp.Effect)
+		}
+		if links[rp.Role+" "+key] {
+			problem("角色权限关联重复: %s %s", rp.Role, key)
+		}
+		links[rp.Role+" "+key] = true
+	}
+
+	users := make(map[string]bool, len(doc.UserRoles))
+	for i := range doc.UserRoles {
+		ur := &doc.UserRoles[i]
+		ur.Username = strings.TrimSpace(ur.Username)
+		ur.Roles = uniqueStrings(ur.Roles)
+		sort.Strings(ur.Roles)
+		if ur.Username == "" {
+			problem("第%d个用户角色缺少用户名", i+1)
+		} else if users[ur.Username] {
+			problem("用户角色重复: %s", ur.Username)
+		}
+		users[ur.Username] = true
+		for _, role := range ur.Roles {
+			if roles[role] == nil {
+				problem("用户%s的角色不存在: %s", ur.Username, role)
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrPolicyInvalid, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// roleCycle 查找角色继承中的循环，返回形如a -> b -> a的描述，没有循环时为空
+func roleCycle(roles map[string]*PolicyRole) string {
+	names := make([]string, 0, len(roles))
+	for name := range roles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// 0未访问，1访问中，2已完成
+	state := make(map[string]int, len(roles))
+	var path []string
+	var visit func(name string) string
+	visit = func(name string) string {
+		switch state[name] {
+		case 1:
+			for i, n := range path {
+				if n == name {
+					return strings.Join(append(path[i:], name), " -> ")
+				}
+			}
+		case 2:
+			return ""
+		}
+		state[name] = 1
+		path = append(path, name)
+		if role := roles[name]; role != nil {
+			for _, parent := range role.Parents {
+				if cycle := visit(parent); cycle != "" {
+					return cycle
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = 2
+		return ""
+	}
+	for _, name := range names {
+		if cycle := visit(name); cycle != "" {
+			return cycle
+		}
+	}
+	return ""
+}
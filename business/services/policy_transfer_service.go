@@ -0,0 +1,447 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/business/repositories"
+	"github.com/GZ-Alinx/autops/internal/database"
+)
+
+// 导入时的变更类型
+const (
+	PolicyChangeCreate = "create"
+	PolicyChangeUpdate = "update"
+	PolicyChangeDelete = "delete"
+)
+
+// PolicyChange 导入文档相对数据库的一项变更
+type PolicyChange struct {
+	Kind   string `json:"kind"`             // role、permission、role_permission或user_role
+	Op     string `json:"op"`               // create、update或delete
+	Key    string `json:"key"`              // 角色名、权限标识、"角色 权限标识"或用户名
+	Detail string `json:"detail,omitempty"` // 变更内容
+}
+
+// String 变更的文本描述
+func (c PolicyChange) String() string {
+	s := fmt.Sprintf("%-6s %-15s %s", c.Op, c.Kind, c.Key)
+	if c.Detail != "" {
+		s += "  (" + c.Detail + ")"
+	}
+	return s
+}
+
+// PolicyImportResult 导入结果
+type PolicyImportResult struct {
+	Applied bool           `json:"applied"` // 是否已写入数据库，dry-run时为false
+	Changes []PolicyChange `json:"changes"`
+}
+
+// PolicyTransferService 权限配置导入导出服务接口
+type PolicyTransferService interface {
+	// Export 导出角色、权限和角色权限关联，includeUsers为true时同时导出默认租户的用户角色
+	Export(includeUsers bool) (*PolicyDocument, error)
+	// Import 比较文档与数据库的差异；apply为true时在一个事务中按文档调整数据并同步Casbin策略
+	Import(actor Actor, doc *PolicyDocument, apply bool) (*PolicyImportResult, error)
+}
+
+// policyTransferService 服务实现
+type policyTransferService struct {
+	repo  repositories.PolicyRepository
+	audit AuditService
+}
+
+// NewPolicyTransferService 创建权限配置导入导出服务实例
+func NewPolicyTransferService(repo repositories.PolicyRepository, audit AuditService) PolicyTransferService {
+	return &policyTransferService{repo: repo, audit: audit}
+}
+
+// Export 导出权限配置，各部分按名称或资源排序，便于在git中比较
+func (s *policyTransferService) Export(includeUsers bool) (*PolicyDocument, error) {
+	snapshot, err := s.repo.Snapshot(includeUsers)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &PolicyDocument{
+		Roles:           make([]PolicyRole, 0, len(snapshot.Roles)),
+		Permissions:     make([]PolicyPermission, 0, len(snapshot.Permissions)),
+		RolePermissions: make([]PolicyRolePermission, 0, len(snapshot.RolePermissions)),
+	}
+	for _, role := range snapshot.Roles {
+		doc.Roles = append(doc.Roles, PolicyRole{
+			Name:        role.Name,
+			Description: role.Description,
+			RequireMFA:  role.RequireMFA,
+			Parents:     parentNames(role),
+		})
+	}
+	sort.Slice(doc.Roles, func(i, j int) bool { return doc.Roles[i].Name < doc.Roles[j].Name })
+
+	for _, p := range snapshot.Permissions {
+		doc.Permissions = append(doc.Permissions, PolicyPermission{
+			Resource:    p.Resource,
+			Action:      p.Action,
+			Conditions:  p.Conditions,
+			Description: p.Description,
+		})
+	}
+	sort.Slice(doc.Permissions, func(i, j int) bool {
+		a, b := doc.Permissions[i], doc.Permissions[j]
+		return permissionKey(a.Resource, a.Action, a.Conditions) < permissionKey(b.Resource, b.Action, b.Conditions)
+	})
+
+	for _, rp := range snapshot.RolePermissions {
+		// 跳过已删除的角色或权限留下的关联
+		if rp.Role.ID == 0 || rp.Permission.ID == 0 {
+			continue
+		}
+		doc.RolePermissions = append(doc.RolePermissions, PolicyRolePermission{
+			Role:       rp.Role.Name,
+			Resource:   rp.Permission.Resource,
+			Action:     rp.Permission.Action,
+			Conditions: rp.Permission.Conditions,
+			Effect:     rp.Eft(),
+		})
+	}
+	sort.Slice(doc.RolePermissions, func(i, j int) bool {
+		a, b := doc.RolePermissions[i], doc.RolePermissions[j]
+		if a.Role != b.Role {
+			return a.Role < b.Role
+		}
+		return permissionKey(a.Resource, a.Action, a.Conditions) < permissionKey(b.Resource, b.Action, b.Conditions)
+	})
+
+	if includeUsers {
+		for username, roles := range userRoleNames(snapshot.UserRoles) {
+			doc.UserRoles = append(doc.UserRoles, PolicyUserRole{Username: username, Roles: roles})
+		}
+		sort.Slice(doc.UserRoles, func(i, j int) bool { return doc.UserRoles[i].Username < doc.UserRoles[j].Username })
+	}
+	return doc, nil
+}
+
+// Import 比较并按需应用权限配置
+func (s *policyTransferService) Import(actor Actor, doc *PolicyDocument, apply bool) (*PolicyImportResult, error) {
+	if err := doc.normalize(); err != nil {
+		return nil, err
+	}
+
+	if !apply {
+		changes, err := s.reconcile(s.repo, doc, false)
+		if err != nil {
+			return nil, err
+		}
+		return &PolicyImportResult{Changes: changes}, nil
+	}
+
+	var changes []PolicyChange
+	var delta *database.PolicyDelta
+	err := s.repo.Transaction(func(tx repositories.PolicyRepository) error {
+		var err error
+		if changes, err = s.reconcile(tx, doc, true); err != nil || len(changes) == 0 {
+			return err
+		}
+		// casbin_rule与业务表在同一事务中修改，同步失败时回滚全部修改
+		delta, err = tx.SyncCasbin()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	delta.Apply()
+
+	if len(changes) > 0 {
+		s.audit.Record(actor, models.AuditPolicyImport, "policy", "", map[string]interface{}{
+			"changes": len(changes),
+			"summary": summarizeChanges(changes),
+		})
+	}
+	return &PolicyImportResult{Applied: true, Changes: changes}, nil
+}
+
+// reconcile 计算文档与数据库的差异，apply为true时同时通过repo写入
+func (s *policyTransferService) reconcile(repo repositories.PolicyRepository, doc *PolicyDocument, apply bool) ([]PolicyChange, error) {
+	snapshot, err := repo.Snapshot(len(doc.UserRoles) > 0)
+	if err != nil {
+		return nil, err
+	}
+	changes := make([]PolicyChange, 0)
+	add := func(kind, op, key, detail string) {
+		changes = append(changes, PolicyChange{Kind: kind, Op: op, Key: key, Detail: detail})
+	}
+
+	// 1. 角色
+	existingRoles := make(map[string]models.Role, len(snapshot.Roles))
+	for _, role := range snapshot.Roles {
+		existingRoles[role.Name] = role
+	}
+	roleIDs := make(map[string]uint, len(doc.Roles))
+	for _, dr := range doc.Roles {
+		existing, ok := existingRoles[dr.Name]
+		if !ok {
+			add("role", PolicyChangeCreate, dr.Name, describeRole(dr))
+			if apply {
+				role := models.Role{Name: dr.Name, Description: dr.Description, RequireMFA: dr.RequireMFA}
+				if err := repo.SaveRole(&role); err != nil {
+					return nil, fmt.Errorf("创建角色%s失败: %w", dr.Name, err)
+				}
+				roleIDs[dr.Name] = role.ID
+			}
+			continue
+		}
+		roleIDs[dr.Name] = existing.ID
+		var diffs []string
+		if existing.Description != dr.Description {
+			diffs = append(diffs, fmt.Sprintf("描述: %q -> %q", existing.Description, dr.Description))
+		}
+		if existing.RequireMFA != dr.RequireMFA {
+			diffs = append(diffs, fmt.Sprintf("两步验证: %t -> %t", existing.RequireMFA, dr.RequireMFA))
+		}
+		if current := parentNames(existing); !equalStrings(current, dr.Parents) {
+			diffs = append(diffs, fmt.Sprintf("父角色: [%s] -> [%s]", strings.Join(current, ","), strings.Join(dr.Parents, ",")))
+		}
+		if len(diffs) > 0 {
+			add("role", PolicyChangeUpdate, dr.Name, strings.Join(diffs, "; "))
+			if apply {
+				role := models.Role{ID: existing.ID, Name: dr.Name, Description: dr.Description, RequireMFA: dr.RequireMFA}
+				if err := repo.SaveRole(&role); err != nil {
+					return nil, fmt.Errorf("更新角色%s失败: %w", dr.Name, err)
+				}
+			}
+		}
+	}
+	// 全部角色创建后再设置继承关系
+	if apply {
+		for _, dr := range doc.Roles {
+			if existing, ok := existingRoles[dr.Name]; ok && equalStrings(parentNames(existing), dr.Parents) {
+				continue
+			}
+			parentIDs := make([]uint, 0, len(dr.Parents))
+			for _, parent := range dr.Parents {
+				parentIDs = append(parentIDs, roleIDs[parent])
+			}
+			if err := repo.ReplaceRoleParents(roleIDs[dr.Name], parentIDs); err != nil {
+				return nil, fmt.Errorf("设置角色%s的父角色失败: %w", dr.Name, err)
+			}
+		}
+	}
+
+	// 2. 权限；数据库中同一标识的重复权限只保留第一条
+	existingPermissions := make(map[string]models.Permission, len(snapshot.Permissions))
+	var removedPermissions []models.Permission
+	for _, p := range snapshot.Permissions {
+		key := permissionKey(p.Resource, p.Action, p.Conditions)
+		if _, ok := existingPermissions[key]; ok {
+			removedPermissions = append(removedPermissions, p)
+			continue
+		}
+		existingPermissions[key] = p
+	}
+	permissionIDs := make(map[string]uint, len(doc.Permissions))
+	for _, dp := range doc.Permissions {
+		key := permissionKey(dp.Resource, dp.Action, dp.Conditions)
+		existing, ok := existingPermissions[key]
+		if !ok {
+			add("permission", PolicyChangeCreate, key, dp.Description)
+			if apply {
+				permission := models.Permission{Resource: dp.Resource, Action: dp.Action, Conditions: dp.Conditions, Description: dp.Description}
+				if err := repo.SavePermission(&permission); err != nil {
+					return nil, fmt.Errorf("创建权限%s失败: %w", key, err)
+				}
+				permissionIDs[key] = permission.ID
+			}
+			continue
+		}
+		permissionIDs[key] = existing.ID
+		if existing.Description != dp.Description {
+			add("permission", PolicyChangeUpdate, key, fmt.Sprintf("描述: %q -> %q", existing.Description, dp.Description))
+			if apply {
+				existing.Description = dp.Description
+				if err := repo.SavePermission(&existing); err != nil {
+					return nil, fmt.Errorf("更新权限%s失败: %w", key, err)
+				}
+			}
+		}
+	}
+	for key, p := range existingPermissions {
+		if _, ok := permissionIDs[key]; !ok {
+			removedPermissions = append(removedPermissions, p)
+		}
+	}
+
+	// 3. 角色权限关联
+	existingLinks := make(map[string]models.RolePermission, len(snapshot.RolePermissions))
+	for _, rp := range snapshot.RolePermissions {
+		if rp.Role.ID == 0 || rp.Permission.ID == 0 {
+			continue
+		}
+		existingLinks[rp.Role.Name+" "+permissionKey(rp.Permission.Resource, rp.Permission.Action, rp.Permission.Conditions)] = rp
+	}
+	desiredLinks := make(map[string]bool, len(doc.RolePermissions))
+	for _, drp := range doc.RolePermissions {
+		key := drp.Role + " " + permissionKey(drp.Resource, drp.Action, drp.Conditions)
+		desiredLinks[key] = true
+		existing, ok := existingLinks[key]
+		switch {
+		case !ok:
+			add("role_permission", PolicyChangeCreate, key, drp.Effect)
+		case existing.Eft() != drp.Effect:
+			add("role_permission", PolicyChangeUpdate, key, fmt.Sprintf("效果: %s -> %s", existing.Eft(), drp.Effect))
+		default:
+			continue
+		}
+		if apply {
+			permissionID := permissionIDs[permissionKey(drp.Resource, drp.Action, drp.Conditions)]
+			if err := repo.SaveRolePermission(roleIDs[drp.Role], permissionID, drp.Effect); err != nil {
+				return nil, fmt.Errorf("保存角色权限关联%s失败: %w", key, err)
+			}
+		}
+	}
+	for key, rp := range existingLinks {
+		if desiredLinks[key] {
+			continue
+		}
+		add("role_permission", PolicyChangeDelete, key, rp.Eft())
+		if apply {
+			if err := repo.DeleteRolePermission(rp.RoleID, rp.PermissionID); err != nil {
+				return nil, fmt.Errorf("删除角色权限关联%s失败: %w", key, err)
+			}
+		}
+	}
+
+	// 4. 删除文档中没有的权限和角色
+	for _, p := range removedPermissions {
+		add("permission", PolicyChangeDelete, permissionKey(p.Resource, p.Action, p.Conditions), p.Description)
+		if apply {
+			if err := repo.DeletePermission(p.ID); err != nil {
+				return nil, fmt.Errorf("删除权限%d失败: %w", p.ID, err)
+			}
+		}
+	}
+	for _, role := range snapshot.Roles {
+		if _, ok := roleIDs[role.Name]; ok {
+			continue
+		}
+		add("role", PolicyChangeDelete, role.Name, role.Description)
+		if apply {
+			if err := repo.DeleteRole(role.ID); err != nil {
+				return nil, fmt.Errorf("删除角色%s失败: %w", role.Name, err)
+			}
+		}
+	}
+
+	// 5. 用户角色：只调整文档中列出的用户
+	if len(doc.UserRoles) > 0 {
+		usernames := make([]string, 0, len(doc.UserRoles))
+		for _, ur := range doc.UserRoles {
+			usernames = append(usernames, ur.Username)
+		}
+		users, err := repo.GetUsersByUsername(usernames)
+		if err != nil {
+			return nil, err
+		}
+		userIDs := make(map[string]uint, len(users))
+		for _, user := range users {
+			userIDs[user.Username] = user.ID
+		}
+		currentRoles := userRoleNames(snapshot.UserRoles)
+		for _, ur := range doc.UserRoles {
+			userID, ok := userIDs[ur.Username]
+			if !ok {
+				return nil, fmt.Errorf("%w: 用户不存在: %s", ErrPolicyInvalid, ur.Username)
+			}
+			current := currentRoles[ur.Username]
+			if equalStrings(current, ur.Roles) {
+				continue
+			}
+			add("user_role", PolicyChangeUpdate, ur.Username, fmt.Sprintf("[%s] -> [%s]", strings.Join(current, ","), strings.Join(ur.Roles, ",")))
+			if apply {
+				ids := make([]uint, 0, len(ur.Roles))
+				for _, role := range ur.Roles {
+					ids = append(ids, roleIDs[role])
+				}
+				if err := repo.ReplaceUserRoles(userID, ids); err != nil {
+					return nil, fmt.Errorf("设置用户%s的角色失败: %w", ur.Username, err)
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		a, b := changes[i], changes[j]
+		if a.Kind != b.Kind {
+			return policyChangeOrder[a.Kind] < policyChangeOrder[b.Kind]
+		}
+		return a.Key < b.Key
+	})
+	return changes, nil
+}
+
+// policyChangeOrder 变更列表中各类变更的顺序
+var policyChangeOrder = map[string]int{"role": 0, "permission": 1, "role_permission": 2, "user_role": 3}
+
+// parentNames 角色的父角色名（已排序）
+func parentNames(role models.Role) []string {
+	names := make([]string, 0, len(role.Parents))
+	for _, parent := range role.Parents {
+		names = append(names, parent.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// userRoleNames 按用户名汇总用户角色（已排序），跳过已删除的用户或角色
+func userRoleNames(userRoles []models.UserRole) map[string][]string {
+	result := make(map[string][]string)
+	for _, ur := range userRoles {
+		if ur.User.ID == 0 || ur.Role.ID == 0 {
+			continue
+		}
+		result[ur.User.Username] = append(result[ur.User.Username], ur.Role.Name)
+	}
+	for _, roles := range result {
+		sort.Strings(roles)
+	}
+	return result
+}
+
+// describeRole 新建角色的变更内容
+func describeRole(role PolicyRole) string {
+	var parts []string
+	if role.Description != "" {
+		parts = append(parts, role.Description)
+	}
+	if role.RequireMFA {
+		parts = append(parts, "要求两步验证")
+	}
+	if len(role.Parents) > 0 {
+		parts = append(parts, "父角色: ["+strings.Join(role.Parents, ",")+"]")
+	}
+	return strings.Join(parts, "; ")
+}
+
+// summarizeChanges 按"类型.操作"统计变更数量
+func summarizeChanges(changes []PolicyChange) map[string]int {
+	summary := make(map[string]int)
+	for _, c := range changes {
+		summary[c.Kind+"."+c.Op]++
+	}
+	return summary
+}
+
+// equalStrings 比较两个已排序的字符串列表
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
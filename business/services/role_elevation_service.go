@@ -0,0 +1,492 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/business/repositories"
+	"github.com/GZ-Alinx/autops/internal/config"
+	"github.com/GZ-Alinx/autops/internal/logger"
+)
+
+var (
+	// ErrElevationNotFound 提权申请不存在
+	ErrElevationNotFound = errors.New("提权申请不存在")
+	// ErrElevationNotPending 申请已被审批或撤回
+	ErrElevationNotPending = errors.New("申请已被处理")
+	// ErrElevationDuration 申请的时长超出范围
+	ErrElevationDuration = errors.New("临时授权的时长超出范围")
+	// ErrElevationPermanent 已长期拥有该角色，不需要临时授权
+	ErrElevationPermanent = errors.New("用户已长期拥有该角色")
+	// ErrElevationDuplicate 已有同一角色的待审批申请
+	ErrElevationDuplicate = errors.New("已有该角色的待审批申请")
+	// ErrElevationForbidden 不是角色负责人
+	ErrElevationForbidden = errors.New("只有角色负责人可以审批该申请")
+	// ErrElevationSelfReview 不能审批自己的申请
+	ErrElevationSelfReview = errors.New("不能审批自己的申请")
+	// ErrElevationUserNotFound 授权的用户不存在
+	ErrElevationUserNotFound = errors.New("用户不存在")
+)
+
+// defaultElevationMaxMinutes 未配置permission.elevation.max_minutes时单次临时授权的最长时间
+const defaultElevationMaxMinutes = 480
+
+// elevationFallbackApprover 角色未设置负责人时，由拥有该角色的用户审批
+const elevationFallbackApprover = "admin"
+
+// ElevationRequest 临时授权的角色、时长和原因
+type ElevationRequest struct {
+	Role      string
+	Reason    string
+	Minutes   int
+	NotBefore *time.Time // 为空或早于当前时间时立即生效
+}
+
+// TemporaryGrant 临时授权
+type TemporaryGrant struct {
+	UserID    uint       `json:"user_id"`
+	Username  string     `json:"username"`
+	RoleID    uint       `json:"role_id"`
+	Role      string     `json:"role"`
+	NotBefore *time.Time `json:"not_before,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	Reason    string     `json:"reason"`
+	Active    bool       `json:"active"` // 当前是否已生效
+}
+
+// RoleElevationService 临时提权服务接口
+type RoleElevationService interface {
+	// Request 当前用户申请临时拥有角色，等待角色负责人审批
+	Request(req ElevationRequest, actor Actor) (*models.RoleElevation, error)
+	// ListMine 获取用户自己的申请
+	ListMine(userID uint) ([]models.RoleElevation, error)
+	// ListReviewable 获取reviewerID可以审批的待审批申请
+	ListReviewable(reviewerID uint) ([]models.RoleElevation, error)
+	// Approve 批准申请，写入带有效期的用户角色并同步Casbin策略
+	Approve(id uint, comment string, actor Actor) (*models.RoleElevation, error)
+	// Reject 拒绝申请
+	Reject(id uint, comment string, actor Actor) (*models.RoleElevation, error)
+	// Cancel 申请人撤回待审批的申请
+	Cancel(id uint, actor Actor) error
+	// Grant 管理员直接为用户临时授权，不经过审批
+	Grant(userID uint, req ElevationRequest, actor Actor) (*TemporaryGrant, error)
+	// ListGrants 获取全部临时授权
+	ListGrants() ([]TemporaryGrant, error)
+	// RevokeExpired 回收到期的临时授权并同步Casbin策略，返回回收的数量
+	RevokeExpired() (int, error)
+}
+
+// roleElevationService 服务实现
+type roleElevationService struct {
+	repo     repositories.RoleElevationRepository
+	userRepo repositories.UserRepository
+	roleRepo repositories.RoleRepository
+	audit    AuditService
+}
+
+// NewRoleElevationService 创建临时提权服务实例
+func NewRoleElevationService(repo repositories.RoleElevationRepository, userRepo repositories.UserRepository, roleRepo repositories.RoleRepository, audit AuditService) RoleElevationService {
+	return &roleElevationService{
+		repo:     repo,
+		userRepo: userRepo,
+		roleRepo: roleRepo,
+		audit:    audit,
+	}
+}
+
+// maxMinutes 单次临时授权的最长时间
+func maxMinutes() int {
+	if limit := config.AppConfig.Permission.Elevation.MaxMinutes; limit > 0 {
+		return limit
+	}
+	return defaultElevationMaxMinutes
+}
+
+// resolve 校验时长并查询角色，用户已长期拥有该角色时返回ErrElevationPermanent
+func (s *roleElevationService) resolve(userID uint, req ElevationRequest) (*models.Role, error) {
+	if req.Minutes <= 0 || req.Minutes > maxMinutes() {
+		return nil, fmt.Errorf("%w: 应为1到%d分钟", ErrElevationDuration, maxMinutes())
+	}
+	roles, err := s.roleRepo.GetByNameIn([]string{req.Role})
+	if err != nil {
+		return nil, err
+	}
+	if len(roles) == 0 {
+		return nil, ErrRoleNotFound
+	}
+	if err := s.checkNotPermanent(userID, roles[0].ID); err != nil {
+		return nil, err
+	}
+	return &roles[0], nil
+}
+
+// checkNotPermanent 用户已长期拥有角色时，临时授权会把长期角色变为到期回收，不允许
+func (s *roleElevationService) checkNotPermanent(userID, roleID uint) error {
+	grant, err := s.repo.GetGrant(userID, roleID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if !grant.Temporary() {
+		return ErrElevationPermanent
+	}
+	return nil
+}
+
+// window 计算授权的生效和到期时间
+func window(now time.Time, notBefore *time.Time, minutes int) (*time.Time, time.Time) {
+	start := now
+	if notBefore != nil && notBefore.After(now) {
+		start = *notBefore
+	} else {
+		notBefore = nil
+	}
+	return notBefore, start.Add(time.Duration(minutes) * time.Minute)
+}
+
+// Request 申请临时提权
+func (s *roleElevationService) Request(req ElevationRequest, actor Actor) (*models.RoleElevation, error) {
+	role, err := s.resolve(actor.ID, req)
+	if err != nil {
+		return nil, err
+	}
+	pending, err := s.repo.HasPending(actor.ID, role.ID)
+	if err != nil {
+		return nil, err
+	}
+	if pending {
+		return nil, ErrElevationDuplicate
+	}
+
+	notBefore, _ := window(time.Now(), req.NotBefore, req.Minutes)
+	elevation := &models.RoleElevation{
+		UserID:    actor.ID,
+		RoleID:    role.ID,
+		Reason:    req.Reason,
+		Minutes:   req.Minutes,
+		NotBefore: notBefore,
+		Status:    models.ElevationPending,
+	}
+	if err := s.repo.Create(elevation); err != nil {
+		return nil, err
+	}
+	elevation.Role = *role
+
+	s.audit.Record(actor, models.AuditElevationRequest, "user", strconv.Itoa(int(actor.ID)), map[string]interface{}{
+		"elevation_id": elevation.ID,
+		"role":         role.Name,
+		"minutes":      req.Minutes,
+		"not_before":   notBefore,
+		"reason":       req.Reason,
+	})
+	return elevation, nil
+}
+
+// ListMine 获取用户自己的申请
+func (s *roleElevationService) ListMine(userID uint) ([]models.RoleElevation, error) {
+	return s.repo.ListByUser(userID)
+}
+
+// ListReviewable 获取可以审批的申请
+func (s *roleElevationService) ListReviewable(reviewerID uint) ([]models.RoleElevation, error) {
+	pending, err := s.repo.ListPending()
+	if err != nil {
+		return nil, err
+	}
+	elevations := make([]models.RoleElevation, 0)
+	for _, elevation := range pending {
+		if elevation.UserID == reviewerID {
+			continue
+		}
+		ok, err := s.canReview(&elevation.Role, reviewerID)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			elevations = append(elevations, elevation)
+		}
+	}
+	return elevations, nil
+}
+
+// canReview 角色负责人可以审批；角色未设置负责人时由admin审批
+func (s *roleElevationService) canReview(role *models.Role, reviewerID uint) (bool, error) {
+	if role.OwnerID != nil {
+		return *role.OwnerID == reviewerID, nil
+	}
+	return s.repo.HasActiveRole(reviewerID, elevationFallbackApprover)
+}
+
+// pendingForReview 获取待审批的申请并校验审批人
+func (s *roleElevationService) pendingForReview(id uint, actor Actor) (*models.RoleElevation, error) {
+	elevation, err := s.repo.GetByID(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrElevationNotFound
+		}
+		return nil, err
+	}
+	if elevation.Status != models.ElevationPending {
+		return nil, ErrElevationNotPending
+	}
+	if elevation.Role.ID == 0 {
+		return nil, ErrRoleNotFound
+	}
+	if elevation.UserID == actor.ID {
+		return nil, ErrElevationSelfReview
+	}
+	ok, err := s.canReview(&elevation.Role, actor.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrElevationForbidden
+	}
+	return elevation, nil
+}
+
+// Approve 批准申请
+func (s *roleElevationService) Approve(id uint, comment string, actor Actor) (*models.RoleElevation, error) {
+	elevation, err := s.pendingForReview(id, actor)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkNotPermanent(elevation.UserID, elevation.RoleID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	notBefore, expiresAt := window(now, elevation.NotBefore, elevation.Minutes)
+	elevation.Status = models.ElevationApproved
+	elevation.ReviewerID = &actor.ID
+	elevation.ReviewComment = comment
+	elevation.ReviewedAt = &now
+	elevation.ExpiresAt = &expiresAt
+	grant := &models.UserRole{
+		UserID:    elevation.UserID,
+		RoleID:    elevation.RoleID,
+		NotBefore: notBefore,
+		ExpiresAt: &expiresAt,
+		Reason:    elevation.Reason,
+	}
+	ok, err := s.repo.Grant(grant, elevation)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrElevationNotPending
+	}
+
+	logger.Logger.Info("批准临时提权", zap.Uint("elevationID", elevation.ID), zap.String("username", elevation.User.Username), zap.String("role", elevation.Role.Name), zap.Time("expiresAt", expiresAt))
+	s.audit.Record(actor, models.AuditElevationApprove, "user", strconv.Itoa(int(elevation.UserID)), map[string]interface{}{
+		"elevation_id": elevation.ID,
+		"role":         elevation.Role.Name,
+		"not_before":   notBefore,
+		"expires_at":   expiresAt,
+		"comment":      comment,
+	})
+	return elevation, nil
+}
+
+// Reject 拒绝申请
+func (s *roleElevationService) Reject(id uint, comment string, actor Actor) (*models.RoleElevation, error) {
+	elevation, err := s.pendingForReview(id, actor)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	elevation.Status = models.ElevationRejected
+	elevation.ReviewerID = &actor.ID
+	elevation.ReviewComment = comment
+	elevation.ReviewedAt = &now
+	ok, err := s.repo.Review(elevation)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrElevationNotPending
+	}
+
+	s.audit.Record(actor, models.AuditElevationReject, "user", strconv.Itoa(int(elevation.UserID)), map[string]interface{}{
+		"elevation_id": elevation.ID,
+		"role":         elevation.Role.Name,
+		"comment":      comment,
+	})
+	return elevation, nil
+}
+
+// Cancel 撤回申请，只能撤回自己的申请
+func (s *roleElevationService) Cancel(id uint, actor Actor) error {
+	elevation, err := s.repo.GetByID(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrElevationNotFound
+		}
+		return err
+	}
+	if elevation.UserID != actor.ID {
+		return ErrElevationNotFound
+	}
+	if elevation.Status != models.ElevationPending {
+		return ErrElevationNotPending
+	}
+	now := time.Now()
+	elevation.Status = models.ElevationCancelled
+	elevation.ReviewedAt = &now
+	ok, err := s.repo.Review(elevation)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrElevationNotPending
+	}
+
+	s.audit.Record(actor, models.AuditElevationCancel, "user", strconv.Itoa(int(actor.ID)), map[string]interface{}{
+		"elevation_id": elevation.ID,
+		"role":         elevation.Role.Name,
+	})
+	return nil
+}
+
+// Grant 管理员直接临时授权；用户已有该角色的临时授权时覆盖其有效期
+func (s *roleElevationService) Grant(userID uint, req ElevationRequest, actor Actor) (*TemporaryGrant, error) {
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrElevationUserNotFound
+		}
+		return nil, err
+	}
+	role, err := s.resolve(userID, req)
+	if err != nil {
+		return nil, err
+	}
+
+	notBefore, expiresAt := window(time.Now(), req.NotBefore, req.Minutes)
+	grant := &models.UserRole{
+		UserID:    userID,
+		RoleID:    role.ID,
+		NotBefore: notBefore,
+		ExpiresAt: &expiresAt,
+		Reason:    req.Reason,
+	}
+	if _, err := s.repo.Grant(grant, nil); err != nil {
+		return nil, err
+	}
+
+	s.audit.Record(actor, models.AuditRoleGrant, "user", strconv.Itoa(int(userID)), map[string]interface{}{
+		"role":       role.Name,
+		"not_before": notBefore,
+		"expires_at": expiresAt,
+		"reason":     req.Reason,
+	})
+	grant.User, grant.Role = *user, *role
+	view := temporaryGrant(grant, time.Now())
+	return &view, nil
+}
+
+// ListGrants 获取全部临时授权
+func (s *roleElevationService) ListGrants() ([]TemporaryGrant, error) {
+	grants, err := s.repo.ListTemporaryGrants()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	views := make([]TemporaryGrant, 0, len(grants))
+	for i := range grants {
+		views = append(views, temporaryGrant(&grants[i], now))
+	}
+	return views, nil
+}
+
+// temporaryGrant 临时授权的展示格式
+func temporaryGrant(grant *models.UserRole, now time.Time) TemporaryGrant {
+	return TemporaryGrant{
+		UserID:    grant.UserID,
+		Username:  grant.User.Username,
+		RoleID:    grant.RoleID,
+		Role:      grant.Role.Name,
+		NotBefore: grant.NotBefore,
+		ExpiresAt: grant.ExpiresAt,
+		Reason:    grant.Reason,
+		Active:    (grant.NotBefore == nil || !grant.NotBefore.After(now)) && grant.ExpiresAt.After(now),
+	}
+}
+
+// RevokeExpired 回收到期的临时授权
+func (s *roleElevationService) RevokeExpired() (int, error) {
+	expired, err := s.repo.RevokeExpired(time.Now())
+	if err != nil {
+		return 0, err
+	}
+	for _, grant := range expired {
+		logger.Logger.Info("临时授权已到期回收", zap.String("username", grant.User.Username), zap.String("role", grant.Role.Name), zap.Timep("expiresAt", grant.ExpiresAt))
+		s.audit.Record(SystemActor, models.AuditRoleGrantExpire, "user", strconv.Itoa(int(grant.UserID)), map[string]interface{}{
+			"role":       grant.Role.Name,
+			"expires_at": grant.ExpiresAt,
+			"reason":     grant.Reason,
+		})
+	}
+	return len(expired), nil
+}
+
+// grantReaper 定期回收临时授权的后台任务
+var grantReaper struct {
+	sync.Mutex
+	stop chan struct{}
+	done chan struct{}
+}
+
+// StartGrantReaper 按permission.elevation.reap_seconds定期使到达生效时间的临时授权生效、回收到期的授权；间隔为0时不启动
+func StartGrantReaper(service RoleElevationService) {
+	seconds := config.AppConfig.Permission.Elevation.ReapSeconds
+	if seconds <= 0 {
+		return
+	}
+	grantReaper.Lock()
+	defer grantReaper.Unlock()
+	if grantReaper.stop != nil {
+		return
+	}
+	stop, done := make(chan struct{}), make(chan struct{})
+	grantReaper.stop, grantReaper.done = stop, done
+	interval := time.Duration(seconds) * time.Second
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+			if _, err := service.RevokeExpired(); err != nil {
+				logger.Logger.Error("回收到期的临时授权失败", zap.Error(err))
+			}
+		}
+	}()
+	logger.Logger.Info("临时授权回收任务已启动", zap.Duration("interval", interval))
+}
+
+// StopGrantReaper 停止回收任务
+func StopGrantReaper() {
+	grantReaper.Lock()
+	defer grantReaper.Unlock()
+	if grantReaper.stop == nil {
+		return
+	}
+	close(grantReaper.stop)
+	<-grantReaper.done
+	grantReaper.stop, grantReaper.done = nil, nil
+}
@@ -0,0 +1,193 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/business/repositories"
+)
+
+var (
+	// ErrRoleNotFound 角色不存在
+	ErrRoleNotFound = errors.New("角色不存在")
+	// ErrRoleCycle 设置父角色后出现循环继承
+	ErrRoleCycle = errors.New("角色继承关系不能形成循环")
+)
+
+// EffectivePermission 继承后的有效权限
+type EffectivePermission struct {
+	models.Permission
+	FromRole string `json:"from_role"` // 权限来源角色，为当前角色时表示直接授予
+	Effect   string `json:"effect"`    // allow或deny，任一来源拒绝时为deny
+}
+
+// EffectivePermissions 角色继承后的有效权限
+type EffectivePermissions struct {
+	Role        *models.Role          `json:"role"`
+	Inherited   []string              `json:"inherited"` // 直接或间接继承的全部祖先角色
+	Permissions []EffectivePermission `json:"permissions"`
+}
+
+// RoleService 角色继承服务接口
+type RoleService interface {
+	// SetParents 设置角色的父角色（按名称），会形成循环时返回ErrRoleCycle
+	SetParents(role *models.Role, parentNames []string) error
+	// EffectivePermissions 计算角色继承后的有效权限
+	EffectivePermissions(roleID uint) (*EffectivePermissions, error)
+}
+
+// roleService 服务实现
+type roleService struct {
+	repo repositories.RoleRepository
+}
+
+// NewRoleService 创建角色继承服务实例
+func NewRoleService(repo repositories.RoleRepository) RoleService {
+	return &roleService{repo: repo}
+}
+
+// SetParents 设置角色的父角色
+func (s *roleService) SetParents(role *models.Role, parentNames []string) error {
+	parentNames = uniqueStrings(parentNames)
+	var parents []models.Role
+	if len(parentNames) > 0 {
+		var err error
+		parents, err = s.repo.GetByNameIn(parentNames)
+		if err != nil {
+			return err
+		}
+		if len(parents) != len(parentNames) {
+			return fmt.Errorf("%w: 部分父角色不存在", ErrRoleNotFound)
+		}
+	}
+
+	links, err := s.repo.ListParentLinks()
+	if err != nil {
+		return err
+	}
+	graph := parentGraph(links)
+	for _, parent := range parents {
+		// 父角色的祖先中包含当前角色（或就是当前角色）即形成循环
+		if parent.ID == role.ID || reachable(graph, parent.ID, role.ID) {
+			return fmt.Errorf("%w: %s 已直接或间接继承 %s", ErrRoleCycle, parent.Name, role.Name)
+		}
+	}
+
+	if err := s.repo.ReplaceParents(role, parents); err != nil {
+		return err
+	}
+	role.Parents = parents
+	return nil
+}
+
+// EffectivePermissions 计算角色继承后的有效权限
+func (s *roleService) EffectivePermissions(roleID uint) (*EffectivePermissions, error) {
+	role, err := s.repo.GetByID(roleID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRoleNotFound
+		}
+		return nil, err
+	}
+
+	links, err := s.repo.ListParentLinks()
+	if err != nil {
+		return nil, err
+	}
+	ancestorIDs := ancestors(parentGraph(links), role.ID)
+	ancestorRoles, err := s.repo.GetByIDs(ancestorIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	names := map[uint]string{role.ID: role.Name}
+	for _, r := range ancestorRoles {
+		names[r.ID] = r.Name
+	}
+	inherited := make([]string, 0, len(ancestorRoles))
+	for _, id := range ancestorIDs {
+		if name, ok := names[id]; ok {
+			inherited = append(inherited, name)
+		}
+	}
+
+	// 当前角色在前，同一权限只保留离当前角色最近的来源
+	roleIDs := append([]uint{role.ID}, ancestorIDs...)
+	rolePermissions, err := s.repo.ListRolePermissions(roleIDs)
+	if err != nil {
+		return nil, err
+	}
+	byRole := make(map[uint][]models.RolePermission, len(roleIDs))
+	for _, rp := range rolePermissions {
+		// 父角色已被删除时忽略
+		if _, ok := names[rp.RoleID]; !ok || rp.Permission.ID == 0 {
+			continue
+		}
+		byRole[rp.RoleID] = append(byRole[rp.RoleID], rp)
+	}
+
+	// 拒绝优先：已有的允许会被更远角色的拒绝覆盖
+	seen := make(map[uint]int)
+	permissions := make([]EffectivePermission, 0, len(rolePermissions))
+	for _, id := range roleIDs {
+		for _, rp := range byRole[id] {
+			if i, ok := seen[rp.Permission.ID]; ok {
+				if rp.Eft() == models.EffectDeny && permissions[i].Effect != models.EffectDeny {
+					permissions[i].FromRole = names[id]
+					permissions[i].Effect = models.EffectDeny
+				}
+				continue
+			}
+			seen[rp.Permission.ID] = len(permissions)
+			permissions = append(permissions, EffectivePermission{Permission: rp.Permission, FromRole: names[id], Effect: rp.Eft()})
+		}
+	}
+
+	return &EffectivePermissions{
+		Role:        role,
+		Inherited:   inherited,
+		Permissions: permissions,
+	}, nil
+}
+
+// parentGraph 角色ID到父角色ID列表
+func parentGraph(links []models.RoleParent) map[uint][]uint {
+	graph := make(map[uint][]uint, len(links))
+	for _, link := range links {
+		graph[link.RoleID] = append(graph[link.RoleID], link.ParentID)
+	}
+	return graph
+}
+
+// reachable 沿父角色方向从from能否到达target
+func reachable(graph map[uint][]uint, from, target uint) bool {
+	for _, id := range ancestors(graph, from) {
+		if id == target {
+			return true
+		}
+	}
+	return false
+}
+
+// ancestors 按广度优先顺序返回全部祖先角色ID（近的在前），不包含自身
+func ancestors(graph map[uint][]uint, roleID uint) []uint {
+	visited := map[uint]bool{roleID: true}
+	queue := []uint{roleID}
+	var result []uint
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, parent := range graph[current] {
+			if visited[parent] {
+				continue
+			}
+			visited[parent] = true
+			result = append(result, parent)
+			queue = append(queue, parent)
+		}
+	}
+	return result
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"gorm.io/gorm"
+
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/business/repositories"
+)
+
+var (
+	// ErrTenantNotFound 租户不存在
+	ErrTenantNotFound = errors.New("租户不存在")
+	// ErrTenantCodeReserved 租户标识为保留值
+	ErrTenantCodeReserved = errors.New("租户标识不能为default或*")
+	// ErrTenantCodeExists 租户标识已存在
+	ErrTenantCodeExists = errors.New("租户标识已存在")
+	// ErrDefaultTenantMembers 默认租户的成员角色通过用户角色接口管理
+	ErrDefaultTenantMembers = errors.New("默认租户的用户角色请通过/permissions/user-role接口管理")
+	// ErrTenantMemberNotFound 用户不存在
+	ErrTenantMemberNotFound = errors.New("用户不存在")
+)
+
+// tenantOwnerRole 创建租户时授予创建人的角色
+const tenantOwnerRole = "admin"
+
+// TenantMember 租户成员及其在租户内的角色
+type TenantMember struct {
+	UserID   uint     `json:"user_id"`
+	Username string   `json:"username"`
+	Roles    []string `json:"roles"`
+}
+
+// TenantService 租户服务接口
+type TenantService interface {
+	// Create 创建租户，创建人成为租户管理员
+	Create(tenant *models.Tenant, actor Actor) error
+	// List 获取全部租户
+	List() ([]models.Tenant, error)
+	// Get 根据ID获取租户
+	Get(id uint) (*models.Tenant, error)
+	// Delete 删除租户及其成员角色
+	Delete(id uint) error
+	// ListMembers 获取租户成员
+	ListMembers(tenantID uint) ([]TenantMember, error)
+	// SetMemberRoles 替换用户在租户内的角色，角色为空时移出租户
+	SetMemberRoles(tenantID, userID uint, roleNames []string, actor Actor) error
+}
+
+// tenantService 服务实现
+type tenantService struct {
+	repo     repositories.TenantRepository
+	userRepo repositories.UserRepository
+	roleRepo repositories.RoleRepository
+	audit    AuditService
+}
+
+// NewTenantService 创建租户服务实例
+func NewTenantService(repo repositories.TenantRepository, userRepo repositories.UserRepository, roleRepo repositories.RoleRepository, audit AuditService) TenantService {
+	return &tenantService{
+		repo:     repo,
+		userRepo: userRepo,
+		roleRepo: roleRepo,
+		audit:    audit,
+	}
+}
+
+// Create 创建租户
+func (s *tenantService) Create(tenant *models.Tenant, actor Actor) error {
+	if tenant.Code == models.DefaultTenantCode || tenant.Code == models.AllTenants {
+		return ErrTenantCodeReserved
+	}
+	if _, err := s.repo.GetByCode(tenant.Code); err == nil {
+		return ErrTenantCodeExists
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if err := s.repo.Create(tenant); err != nil {
+		return err
+	}
+	if actor.ID == 0 {
+		return nil
+	}
+	return s.SetMemberRoles(tenant.ID, actor.ID, []string{tenantOwnerRole}, actor)
+}
+
+// List 获取全部租户
+func (s *tenantService) List() ([]models.Tenant, error) {
+	return s.repo.List()
+}
+
+// Get 根据ID获取租户
+func (s *tenantService) Get(id uint) (*models.Tenant, error) {
+	tenant, err := s.repo.GetByID(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTenantNotFound
+		}
+		return nil, err
+	}
+	return tenant, nil
+}
+
+// Delete 删除租户
+func (s *tenantService) Delete(id uint) error {
+	if _, err := s.Get(id); err != nil {
+		return err
+	}
+	return s.repo.Delete(id)
+}
+
+// ListMembers 获取租户成员，按用户聚合角色
+func (s *tenantService) ListMembers(tenantID uint) ([]TenantMember, error) {
+	if tenantID == 0 {
+		return nil, ErrDefaultTenantMembers
+	}
+	rows, err := s.repo.ListMembers(tenantID)
+	if err != nil {
+		return nil, err
+	}
+	members := make([]TenantMember, 0)
+	index := make(map[uint]int)
+	for _, row := range rows {
+		i, ok := index[row.UserID]
+		if !ok {
+			i = len(members)
+			index[row.UserID] = i
+			members = append(members, TenantMember{UserID: row.UserID, Username: row.User.Username, Roles: []string{}})
+		}
+		if row.Role.ID != 0 {
+			members[i].Roles = append(members[i].Roles, row.Role.Name)
+		}
+	}
+	return members, nil
+}
+
+// SetMemberRoles 替换用户在租户内的角色
+func (s *tenantService) SetMemberRoles(tenantID, userID uint, roleNames []string, actor Actor) error {
+	if tenantID == 0 {
+		return ErrDefaultTenantMembers
+	}
+	if _, err := s.userRepo.GetByID(userID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrTenantMemberNotFound
+		}
+		return err
+	}
+
+	roleNames = uniqueStrings(roleNames)
+	var roleIDs []uint
+	if len(roleNames) > 0 {
+		roles, err := s.roleRepo.GetByNameIn(roleNames)
+		if err != nil {
+			return err
+		}
+		if len(roles) != len(roleNames) {
+			return fmt.Errorf("%w: 部分角色不存在", ErrRoleNotFound)
+		}
+		for _, role := range roles {
+			roleIDs = append(roleIDs, role.ID)
+		}
+	}
+
+	if err := s.repo.ReplaceMemberRoles(tenantID, userID, roleIDs); err != nil {
+		return err
+	}
+	s.audit.Record(actor, models.AuditTenantMemberChange, "user", strconv.Itoa(int(userID)), map[string]interface{}{
+		"tenant_id": tenantID,
+		"roles":     roleNames,
+	})
+	return nil
+}
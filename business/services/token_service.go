@@ -0,0 +1,395 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/business/repositories"
+	"github.com/GZ-Alinx/autops/internal/config"
+	"github.com/GZ-Alinx/autops/internal/logger"
+	"github.com/GZ-Alinx/autops/internal/middleware"
+	"github.com/GZ-Alinx/autops/internal/password"
+)
+
+var (
+	// ErrInvalidRefreshToken 刷新令牌无效、已过期或已被吊销
+	ErrInvalidRefreshToken = errors.New("无效的刷新令牌或刷新令牌已过期")
+	// ErrSessionNotFound 会话不存在、不属于当前用户或已失效
+	ErrSessionNotFound = errors.New("会话不存在或已失效")
+	// ErrPasswordChangeRequired 密码已过期或被要求修改，需先修改密码才能继续使用
+	ErrPasswordChangeRequired = errors.New("密码已过期或被要求修改，请先修改密码")
+)
+
+// ClientInfo 登录或刷新令牌的客户端信息，记录到会话中
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+}
+
+// TokenPair 访问令牌与刷新令牌
+type TokenPair struct {
+	AccessToken  string    `json:"token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// TokenService 令牌服务接口
+type TokenService interface {
+	// IssueTokens 创建登录会话并签发新的访问令牌和刷新令牌
+	IssueTokens(user *models.User, client ClientInfo) (*TokenPair, error)
+	// Refresh 使用刷新令牌换取新的令牌对（旧刷新令牌随即失效）；
+	// 密码过期或被要求修改时返回ErrPasswordChangeRequired和对应用户，刷新令牌保持不变
+	Refresh(refreshToken string, client ClientInfo) (*TokenPair, *models.User, error)
+	// Logout 吊销当前会话、访问令牌及其配对的刷新令牌
+	Logout(claims *middleware.JWTClaims, refreshToken string) error
+	// IssueChallenge 签发登录第二步使用的挑战令牌
+	IssueChallenge(user *models.User, purpose string) (string, error)
+	// ParseChallenge 校验挑战令牌并加载对应用户
+	ParseChallenge(challenge, purpose string) (*middleware.JWTClaims, *models.User, error)
+	// CompleteChallenge 挑战完成后使其失效，保证挑战令牌只能使用一次
+	CompleteChallenge(claims *middleware.JWTClaims) error
+	// RevokeAllForUser 吊销用户的全部登录会话（如重置密码、管理员强制下线），revokedBy为操作人，系统操作为0
+	RevokeAllForUser(userID, revokedBy uint) error
+	// ListSessions 获取用户的有效登录会话
+	ListSessions(userID uint) ([]*models.UserSession, error)
+	// RevokeSession 吊销用户的指定会话
+	RevokeSession(userID uint, sessionID string, revokedBy uint) error
+}
+
+// tokenService 服务实现
+type tokenService struct {
+	repo        repositories.TokenRepository
+	sessionRepo repositories.SessionRepository
+	userRepo    repositories.UserRepository
+	policy      *password.Policy
+}
+
+// NewTokenService 创建令牌服务实例
+func NewTokenService(repo repositories.TokenRepository, sessionRepo repositories.SessionRepository, userRepo repositories.UserRepository) TokenService {
+	return &tokenService{
+		repo:        repo,
+		sessionRepo: sessionRepo,
+		userRepo:    userRepo,
+		policy:      password.Default(),
+	}
+}
+
+// refreshTokenTTL 刷新令牌有效期
+func refreshTokenTTL() time.Duration {
+	if config.AppConfig.JWT.RefreshExpiresHour > 0 {
+		return config.AppConfig.JWT.RefreshExpiresHour * time.Hour
+	}
+	return 7 * 24 * time.Hour
+}
+
+// randomToken 生成指定字节长度的随机令牌
+func randomToken(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// newTokenPair 签发访问令牌并生成刷新令牌记录，令牌族ID同时作为会话ID
+func (s *tokenService) newTokenPair(user *models.User, familyID string) (*TokenPair, *models.RefreshToken, error) {
+	accessToken, claims, err := middleware.GenerateTokenWithClaims(strconv.Itoa(int(user.ID)), user.Username, familyID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	record := &models.RefreshToken{
+		UserID:    user.ID,
+		TokenHash: middleware.HashToken(refreshToken),
+		FamilyID:  familyID,
+		AccessJTI: claims.ID,
+		ExpiresAt: time.Now().Add(refreshTokenTTL()),
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresAt:    claims.ExpiresAt.Time,
+	}, record, nil
+}
+
+// IssueTokens 创建登录会话并签发令牌
+func (s *tokenService) IssueTokens(user *models.User, client ClientInfo) (*TokenPair, error) {
+	sessionID := uuid.New().String()
+	pair, record, err := s.newTokenPair(user, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.sessionRepo.Create(newSession(user, sessionID, record, client)); err != nil {
+		logger.Logger.Error("保存登录会话失败", zap.Uint("userID", user.ID), zap.Error(err))
+		return nil, err
+	}
+	if err := s.repo.CreateRefreshToken(record); err != nil {
+		logger.Logger.Error("保存刷新令牌失败", zap.Uint("userID", user.ID), zap.Error(err))
+		return nil, err
+	}
+
+	return pair, nil
+}
+
+// newSession 创建会话记录
+func newSession(user *models.User, sessionID string, record *models.RefreshToken, client ClientInfo) *models.UserSession {
+	source := user.Source
+	if source == "" {
+		source = models.UserSourceLocal
+	}
+	userAgent := client.UserAgent
+	if r := []rune(userAgent); len(r) > 255 {
+		userAgent = string(r[:255])
+	}
+	return &models.UserSession{
+		SessionID:  sessionID,
+		UserID:     user.ID,
+		AuthSource: source,
+		AccessJTI:  record.AccessJTI,
+		IP:         client.IP,
+		UserAgent:  userAgent,
+		LastSeenIP: client.IP,
+		LastSeenAt: time.Now(),
+		ExpiresAt:  record.ExpiresAt,
+	}
+}
+
+// Refresh 使用刷新令牌换取新的令牌对（旧刷新令牌随即失效）
+func (s *tokenService) Refresh(refreshToken string, client ClientInfo) (*TokenPair, *models.User, error) {
+	record, err := s.repo.GetRefreshTokenByHash(middleware.HashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidRefreshToken
+		}
+		return nil, nil, err
+	}
+
+	// 已轮换过的刷新令牌再次出现，视为令牌泄露，吊销整个令牌族
+	if record.RevokedAt != nil {
+		logger.Logger.Warn("检测到刷新令牌重复使用，吊销整个令牌族", zap.Uint("userID", record.UserID), zap.String("familyID", record.FamilyID))
+		if err := s.repo.RevokeRefreshTokenFamily(record.FamilyID); err != nil {
+			logger.Logger.Error("吊销令牌族失败", zap.String("familyID", record.FamilyID), zap.Error(err))
+		}
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	if time.Now().After(record.ExpiresAt) {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	user, err := s.userRepo.GetByID(record.UserID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidRefreshToken
+		}
+		return nil, nil, err
+	}
+	if status := user.EffectiveStatus(time.Now()); status != models.UserStatusActive {
+		return nil, nil, &AccountStatusError{Status: status}
+	}
+	if passwordChangeRequired(s.policy, user) {
+		logger.Logger.Warn("刷新令牌失败: 需要修改密码", zap.Uint("userID", user.ID))
+		return nil, user, ErrPasswordChangeRequired
+	}
+
+	// 会话已被吊销时刷新令牌随之失效
+	session, err := s.sessionRepo.GetBySessionID(record.FamilyID)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		session = nil
+	case err != nil:
+		return nil, nil, err
+	case !session.IsActive(time.Now()):
+		logger.Logger.Warn("刷新令牌失败: 会话已失效", zap.Uint("userID", record.UserID), zap.String("sid", record.FamilyID))
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	pair, next, err := s.newTokenPair(user, record.FamilyID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := s.repo.RotateRefreshToken(record, next); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// 并发刷新时另一个请求已完成轮换
+			return nil, nil, ErrInvalidRefreshToken
+		}
+		logger.Logger.Error("轮换刷新令牌失败", zap.Uint("userID", user.ID), zap.Error(err))
+		return nil, nil, err
+	}
+
+	// 启用会话记录之前签发的刷新令牌在首次刷新时补建会话
+	if session == nil {
+		err = s.sessionRepo.Create(newSession(user, record.FamilyID, next, client))
+	} else {
+		err = s.sessionRepo.Rotate(record.FamilyID, next.AccessJTI, next.ExpiresAt, client.IP)
+	}
+	if err != nil {
+		logger.Logger.Error("更新登录会话失败", zap.Uint("userID", user.ID), zap.String("sid", record.FamilyID), zap.Error(err))
+		return nil, nil, err
+	}
+
+	logger.Logger.Info("刷新令牌成功", zap.Uint("userID", user.ID), zap.String("familyID", record.FamilyID))
+	return pair, user, nil
+}
+
+// Logout 吊销当前访问令牌及其配对的刷新令牌
+func (s *tokenService) Logout(claims *middleware.JWTClaims, refreshToken string) error {
+	userID, _ := strconv.ParseUint(claims.UserID, 10, 64)
+
+	if err := s.repo.RevokeAccessToken(claims.ID, uint(userID), claims.ExpiresAt.Time); err != nil {
+		logger.Logger.Error("吊销访问令牌失败", zap.String("jti", claims.ID), zap.Error(err))
+		return err
+	}
+
+	if err := s.repo.RevokeRefreshTokensByAccessJTI(claims.ID); err != nil {
+		logger.Logger.Error("吊销刷新令牌失败", zap.String("jti", claims.ID), zap.Error(err))
+		return err
+	}
+
+	if claims.SessionID != "" {
+		if _, err := s.sessionRepo.Revoke(claims.SessionID, 0); err != nil {
+			logger.Logger.Error("吊销登录会话失败", zap.String("sid", claims.SessionID), zap.Error(err))
+			return err
+		}
+	}
+
+	// 客户端显式提交的刷新令牌（可能已轮换出新的访问令牌）整族吊销
+	if refreshToken != "" {
+		record, err := s.repo.GetRefreshTokenByHash(middleware.HashToken(refreshToken))
+		if err == nil && record.UserID == uint(userID) {
+			if err := s.repo.RevokeRefreshTokenFamily(record.FamilyID); err != nil {
+				logger.Logger.Error("吊销令牌族失败", zap.String("familyID", record.FamilyID), zap.Error(err))
+				return err
+			}
+			if _, err := s.sessionRepo.Revoke(record.FamilyID, 0); err != nil {
+				logger.Logger.Error("吊销登录会话失败", zap.String("sid", record.FamilyID), zap.Error(err))
+				return err
+			}
+		}
+	}
+
+	// 顺带清理过期记录，失败不影响登出
+	if err := s.repo.PurgeExpired(); err != nil {
+		logger.Logger.Warn("清理过期令牌记录失败", zap.Error(err))
+	}
+	if err := s.sessionRepo.PurgeExpired(); err != nil {
+		logger.Logger.Warn("清理过期会话失败", zap.Error(err))
+	}
+
+	logger.Logger.Info("用户登出成功", zap.String("username", claims.Username), zap.String("jti", claims.ID))
+	return nil
+}
+
+// challengeTTL 挑战令牌有效期
+func challengeTTL() time.Duration {
+	if config.AppConfig.MFA.ChallengeMinutes > 0 {
+		return time.Duration(config.AppConfig.MFA.ChallengeMinutes) * time.Minute
+	}
+	return 5 * time.Minute
+}
+
+// IssueChallenge 签发登录第二步使用的挑战令牌
+func (s *tokenService) IssueChallenge(user *models.User, purpose string) (string, error) {
+	return middleware.GenerateChallengeToken(strconv.Itoa(int(user.ID)), user.Username, purpose, challengeTTL())
+}
+
+// ParseChallenge 校验挑战令牌并加载对应用户
+func (s *tokenService) ParseChallenge(challenge, purpose string) (*middleware.JWTClaims, *models.User, error) {
+	claims, err := middleware.ParseChallengeToken(challenge, purpose)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	revoked, err := s.repo.IsAccessTokenRevoked(claims.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if revoked {
+		return nil, nil, middleware.ErrInvalidChallenge
+	}
+
+	userID, err := strconv.ParseUint(claims.UserID, 10, 64)
+	if err != nil {
+		return nil, nil, middleware.ErrInvalidChallenge
+	}
+	user, err := s.userRepo.GetByID(uint(userID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, middleware.ErrInvalidChallenge
+		}
+		return nil, nil, err
+	}
+	return claims, user, nil
+}
+
+// CompleteChallenge 挑战完成后使其失效，保证挑战令牌只能使用一次
+func (s *tokenService) CompleteChallenge(claims *middleware.JWTClaims) error {
+	userID, _ := strconv.ParseUint(claims.UserID, 10, 64)
+	return s.repo.RevokeAccessToken(claims.ID, uint(userID), claims.ExpiresAt.Time)
+}
+
+// RevokeAllForUser 吊销用户的全部登录会话
+func (s *tokenService) RevokeAllForUser(userID, revokedBy uint) error {
+	if err := s.repo.RevokeUserTokens(userID, middleware.AccessTokenTTL()); err != nil {
+		logger.Logger.Error("吊销用户全部会话失败", zap.Uint("userID", userID), zap.Error(err))
+		return err
+	}
+	count, err := s.sessionRepo.RevokeByUser(userID, revokedBy)
+	if err != nil {
+		logger.Logger.Error("吊销用户全部会话失败", zap.Uint("userID", userID), zap.Error(err))
+		return err
+	}
+	logger.GetBusinessLogger().Info("已吊销用户全部会话",
+		zap.Uint("userID", userID),
+		zap.Uint("revokedBy", revokedBy),
+		zap.Int64("sessions", count))
+	return nil
+}
+
+// ListSessions 获取用户的有效登录会话
+func (s *tokenService) ListSessions(userID uint) ([]*models.UserSession, error) {
+	return s.sessionRepo.ListActiveByUser(userID)
+}
+
+// RevokeSession 吊销用户的指定会话及其刷新令牌，已签发的访问令牌由JWT中间件按会话状态拒绝
+func (s *tokenService) RevokeSession(userID uint, sessionID string, revokedBy uint) error {
+	session, err := s.sessionRepo.GetBySessionID(sessionID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrSessionNotFound
+		}
+		return err
+	}
+	if session.UserID != userID || !session.IsActive(time.Now()) {
+		return ErrSessionNotFound
+	}
+
+	if _, err := s.sessionRepo.Revoke(sessionID, revokedBy); err != nil {
+		return err
+	}
+	if err := s.repo.RevokeRefreshTokenFamily(sessionID); err != nil {
+		return err
+	}
+
+	logger.GetBusinessLogger().Info("已吊销登录会话",
+		zap.Uint("userID", userID),
+		zap.String("sid", sessionID),
+		zap.Uint("revokedBy", revokedBy))
+	return nil
+}
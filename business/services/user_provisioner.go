@@ -0,0 +1,239 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/business/repositories"
+	"github.com/GZ-Alinx/autops/internal/logger"
+)
+
+// ErrAccountConflict 外部账号与本地已有账号同名
+var ErrAccountConflict = errors.New("已存在同名的本地账号，请联系管理员处理")
+
+// ExternalIdentity 外部认证源返回的用户身份
+type ExternalIdentity struct {
+	Source     string   // 认证源，如ldap、oidc
+	ExternalID string   // 认证源中的唯一标识，非空时优先按它关联已有用户
+	Username   string   // 用户名
+	Email      string   // 邮箱
+	Nickname   string   // 显示名称
+	Roles      []string // 按组映射得到的角色名称
+	SyncRoles  bool     // 是否用Roles覆盖已有用户的角色
+}
+
+// UserProvisioner 外部用户即时创建接口
+type UserProvisioner interface {
+	// Provision 首次登录时创建用户，之后更新资料并按需同步角色，返回用户及角色是否发生变化
+	Provision(identity *ExternalIdentity) (*models.User, bool, error)
+}
+
+// userProvisioner 服务实现
+type userProvisioner struct {
+	userRepo repositories.UserRepository
+	roleRepo repositories.RoleRepository
+}
+
+// NewUserProvisioner 创建外部用户即时创建服务实例
+func NewUserProvisioner(userRepo repositories.UserRepository, roleRepo repositories.RoleRepository) UserProvisioner {
+	return &userProvisioner{
+		userRepo: userRepo,
+		roleRepo: roleRepo,
+	}
+}
+
+// Provision 创建或更新外部用户
+func (p *userProvisioner) Provision(identity *ExternalIdentity) (*models.User, bool, error) {
+	user, err := p.lookup(identity)
+	created := false
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		user, err = p.create(identity)
+		if err != nil {
+			return nil, false, err
+		}
+		created = true
+	case err != nil:
+		return nil, false, err
+	case user.Source != identity.Source:
+		// 不允许外部账号接管同名的本地账号或其他来源的账号
+		logger.Logger.Warn("外部账号与已有账号冲突",
+			zap.String("username", identity.Username),
+			zap.String("source", identity.Source),
+			zap.String("existingSource", user.Source))
+		return nil, false, ErrAccountConflict
+	case identity.ExternalID != "" && user.ExternalID != "" && user.ExternalID != identity.ExternalID:
+		// 同名账号已关联到外部认证源中的另一个身份
+		logger.Logger.Warn("外部账号与已有账号的外部标识不一致",
+			zap.String("username", identity.Username),
+			zap.String("source", identity.Source),
+			zap.String("externalID", identity.ExternalID))
+		return nil, false, ErrAccountConflict
+	default:
+		if err := p.updateProfile(user, identity); err != nil {
+			return nil, false, err
+		}
+	}
+
+	rolesChanged := false
+	if created || identity.SyncRoles {
+		rolesChanged, err = p.syncRoles(user, identity.Roles)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	if rolesChanged {
+		// 重新加载角色
+		if user, err = p.userRepo.GetByID(user.ID); err != nil {
+			return nil, false, err
+		}
+	}
+	return user, rolesChanged, nil
+}
+
+// lookup 先按外部标识查找用户，外部认证源中用户名变更后仍能关联到原账号，未找到时按用户名查找
+func (p *userProvisioner) lookup(identity *ExternalIdentity) (*models.User, error) {
+	if identity.ExternalID != "" {
+		user, err := p.userRepo.GetByExternalID(identity.Source, identity.ExternalID)
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return user, err
+		}
+	}
+	return p.userRepo.GetByUsername(identity.Username)
+}
+
+// create 创建外部用户，本地密码为随机值
+func (p *userProvisioner) create(identity *ExternalIdentity) (*models.User, error) {
+	placeholder, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(placeholder), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	email := identity.Email
+	if email == "" {
+		email = fmt.Sprintf("%s@%s.local", identity.Username, identity.Source)
+	}
+	now := time.Now()
+	user := &models.User{
+		Username:          identity.Username,
+		Password:          string(hashedPassword),
+		Email:             email,
+		Nickname:          identity.Nickname,
+		Status:            1,
+		Type:              models.UserTypeHuman,
+		Source:            identity.Source,
+		ExternalID:        identity.ExternalID,
+		PasswordChangedAt: &now,
+	}
+	if err := p.userRepo.Create(user); err != nil {
+		return nil, err
+	}
+
+	logger.GetBusinessLogger().Info("外部用户首次登录，已自动创建账号",
+		zap.Uint("userID", user.ID),
+		zap.String("username", user.Username),
+		zap.String("source", identity.Source))
+	return user, nil
+}
+
+// updateProfile 同步外部资料
+func (p *userProvisioner) updateProfile(user *models.User, identity *ExternalIdentity) error {
+	changed := false
+	if identity.ExternalID != "" && user.ExternalID == "" {
+		user.ExternalID = identity.ExternalID
+		changed = true
+	}
+	if identity.Email != "" && identity.Email != user.Email {
+		user.Email = identity.Email
+		changed = true
+	}
+	if identity.Nickname != "" && identity.Nickname != user.Nickname {
+		user.Nickname = identity.Nickname
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	_, err := p.userRepo.Update(user)
+	return err
+}
+
+// syncRoles 将用户角色设置为映射得到的角色，返回是否发生变化
+func (p *userProvisioner) syncRoles(user *models.User, roleNames []string) (bool, error) {
+	roles := []models.Role{}
+	if len(roleNames) > 0 {
+		found, err := p.roleRepo.GetByNameIn(roleNames)
+		if err != nil {
+			return false, err
+		}
+		roles = found
+	}
+	if len(roles) < len(uniqueStrings(roleNames)) {
+		logger.Logger.Warn("部分映射角色不存在，已忽略", zap.String("username", user.Username), zap.Strings("roles", roleNames))
+	}
+
+	if sameRoleIDs(user.Roles, roles) {
+		return false, nil
+	}
+	if err := p.userRepo.ReplaceRoles(user, roles); err != nil {
+		return false, err
+	}
+
+	names := make([]string, 0, len(roles))
+	for _, role := range roles {
+		names = append(names, role.Name)
+	}
+	logger.GetBusinessLogger().Info("已按外部组映射同步用户角色",
+		zap.Uint("userID", user.ID),
+		zap.String("username", user.Username),
+		zap.Strings("roles", names))
+	return true, nil
+}
+
+// sameRoleIDs 比较两组角色是否相同
+func sameRoleIDs(a, b []models.Role) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	ids := func(roles []models.Role) []uint {
+		out := make([]uint, 0, len(roles))
+		for _, role := range roles {
+			out = append(out, role.ID)
+		}
+		sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+		return out
+	}
+	x, y := ids(a), ids(b)
+	for i := range x {
+		if x[i] != y[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// uniqueStrings 去重并保持顺序
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]struct{}, len(values))
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		if _, ok := seen[v]; ok || v == "" {
+			continue
+		}
+		seen[v] = struct{}{}
+		out = append(out, v)
+	}
+	return out
+}
@@ -2,15 +2,51 @@ package services
 
 import (
 	"errors"
+	"strconv"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 
 	"github.com/GZ-Alinx/autops/business/models"
 	"github.com/GZ-Alinx/autops/business/repositories"
+	"github.com/GZ-Alinx/autops/internal/authcache"
+	"github.com/GZ-Alinx/autops/internal/database"
 	"github.com/GZ-Alinx/autops/internal/logger"
+	"github.com/GZ-Alinx/autops/internal/middleware"
+	"github.com/GZ-Alinx/autops/internal/password"
 	"go.uber.org/zap"
 )
 
+var (
+	// ErrPasswordReused 新密码与最近使用过的密码相同
+	ErrPasswordReused = errors.New("新密码不能与最近使用过的密码相同")
+	// ErrExternalPassword 外部账号的密码由认证源管理
+	ErrExternalPassword = errors.New("该账号的密码由外部认证源管理，不能在本系统修改")
+	// ErrInvalidUserStatus 无效的账号状态
+	ErrInvalidUserStatus = errors.New("无效的账号状态")
+	// ErrValidUntilPassed 启用账号时有效期已过
+	ErrValidUntilPassed = errors.New("有效期必须晚于当前时间")
+	// ErrSelfDeactivate 不能停用自己的账号
+	ErrSelfDeactivate = errors.New("不能停用自己的账号")
+)
+
+// AccountStatusError 账号状态不允许登录或访问
+type AccountStatusError struct {
+	Status int
+}
+
+// Error 实现error接口
+func (e *AccountStatusError) Error() string {
+	return models.UserStatusMessage(e.Status)
+}
+
+// UserStatusChange 账号状态变更
+type UserStatusChange struct {
+	Status     int
+	ValidUntil *time.Time // 为空表示长期有效
+	Reason     string
+}
+
 // UserService 用户服务接口
 type UserService interface {
 	CreateUser(username, password, email string, phone *string) (*models.User, error)
@@ -18,20 +54,37 @@ type UserService interface {
 	GetUserByUsername(username string) (*models.User, error)
 	UpdateUser(user *models.User) error
 	DeleteUser(id uint) error
-	ListUsers(page, pageSize int) ([]*models.User, int64, error)
+	// ListUsers 分页获取租户内的用户，tenantID为0表示默认租户
+	ListUsers(tenantID uint, page, pageSize int) ([]*models.User, int64, error)
 	VerifyPassword(user *models.User, password string) bool
 	UpdatePassword(user *models.User, newPassword string) error
+	// ResetPassword 管理员重置密码，mustChange为true时用户下次登录必须修改密码
+	ResetPassword(user *models.User, newPassword string, mustChange bool) error
+	// ValidatePassword 校验新密码是否符合密码策略和历史记录要求，不修改密码
+	ValidatePassword(user *models.User, newPassword string) error
+	// PasswordChangeRequired 密码是否已过期或被要求修改
+	PasswordChangeRequired(user *models.User) bool
+	// ChangeStatus 变更账号状态和有效期并记录审计日志
+	ChangeStatus(user *models.User, change UserStatusChange, actor Actor) error
+	// CheckAccountStatus 校验账号可以登录，不可用时返回*AccountStatusError；已超过有效期的账号同时标记为过期
+	CheckAccountStatus(user *models.User) error
 }
 
 // userService 服务实现
 type userService struct {
-	repo repositories.UserRepository
+	repo    repositories.UserRepository
+	history repositories.PasswordHistoryRepository
+	policy  *password.Policy
+	audit   AuditService
 }
 
 // NewUserService 创建用户服务实例
 func NewUserService(repo repositories.UserRepository) UserService {
 	return &userService{
-		repo: repo,
+		repo:    repo,
+		history: repositories.NewPasswordHistoryRepository(),
+		policy:  password.Default(),
+		audit:   NewAuditService(repositories.NewAuditLogRepository()),
 	}
 }
 
@@ -43,6 +96,11 @@ func (s *userService) CreateUser(username, password, email string, phone *string
 		return nil, errors.New("用户名已存在")
 	}
 
+	// 校验密码策略
+	if err := s.policy.Validate(password, username); err != nil {
+		return nil, err
+	}
+
 	// 密码加密
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
@@ -50,16 +108,19 @@ func (s *userService) CreateUser(username, password, email string, phone *string
 	}
 
 	// 创建用户
+	now := time.Now()
 	user := &models.User{
-		Username: username,
-		Password: string(hashedPassword),
-		Email:    email,
-		Phone:    phone,
+		Username:          username,
+		Password:          string(hashedPassword),
+		Email:             email,
+		Phone:             phone,
+		PasswordChangedAt: &now,
 	}
 
 	if err := s.repo.Create(user); err != nil {
 		return nil, err
 	}
+	s.recordHistory(user)
 
 	// 分配默认角色 "user"
 	roleRepo := repositories.NewRoleRepository()
@@ -97,12 +158,16 @@ func (s *userService) UpdateUser(user *models.User) error {
 
 // DeleteUser 删除用户
 func (s *userService) DeleteUser(id uint) error {
-	return s.repo.Delete(id)
+	if err := s.repo.Delete(id); err != nil {
+		return err
+	}
+	invalidateUserCaches(id)
+	return nil
 }
 
 // ListUsers 分页获取用户列表
-func (s *userService) ListUsers(page, pageSize int) ([]*models.User, int64, error) {
-	return s.repo.List(page, pageSize)
+func (s *userService) ListUsers(tenantID uint, page, pageSize int) ([]*models.User, int64, error) {
+	return s.repo.List(tenantID, page, pageSize)
 }
 
 // VerifyPassword 验证密码
@@ -113,6 +178,91 @@ func (s *userService) VerifyPassword(user *models.User, password string) bool {
 
 // UpdatePassword 更新用户密码
 func (s *userService) UpdatePassword(user *models.User, newPassword string) error {
+	return s.setPassword(user, newPassword, false)
+}
+
+// ResetPassword 管理员重置密码
+func (s *userService) ResetPassword(user *models.User, newPassword string, mustChange bool) error {
+	return s.setPassword(user, newPassword, mustChange)
+}
+
+// ValidatePassword 校验新密码是否符合密码策略和历史记录要求
+func (s *userService) ValidatePassword(user *models.User, newPassword string) error {
+	if !isLocalUser(user) {
+		return ErrExternalPassword
+	}
+	if err := s.policy.Validate(newPassword, user.Username); err != nil {
+		return err
+	}
+	return s.checkReuse(user, newPassword)
+}
+
+// PasswordChangeRequired 密码是否已过期或被要求修改
+func (s *userService) PasswordChangeRequired(user *models.User) bool {
+	return passwordChangeRequired(s.policy, user)
+}
+
+// ChangeStatus 变更账号状态
+func (s *userService) ChangeStatus(user *models.User, change UserStatusChange, actor Actor) error {
+	if !models.ValidUserStatus(change.Status) {
+		return ErrInvalidUserStatus
+	}
+	now := time.Now()
+	if change.Status == models.UserStatusActive && change.ValidUntil != nil && !now.Before(*change.ValidUntil) {
+		return ErrValidUntilPassed
+	}
+	if actor.ID == user.ID && change.Status != models.UserStatusActive {
+		return ErrSelfDeactivate
+	}
+
+	detail := map[string]interface{}{
+		"from":        user.Status,
+		"to":          change.Status,
+		"valid_until": change.ValidUntil,
+		"reason":      change.Reason,
+	}
+	if user.ValidUntil != nil {
+		detail["previous_valid_until"] = user.ValidUntil
+	}
+
+	user.Status = change.Status
+	user.ValidUntil = change.ValidUntil
+	user.StatusReason = change.Reason
+	if _, err := s.repo.Update(user); err != nil {
+		return err
+	}
+	invalidateUserCaches(user.ID)
+
+	s.audit.Record(actor, models.AuditUserStatusChange, "user", strconv.Itoa(int(user.ID)), detail)
+	return nil
+}
+
+// CheckAccountStatus 校验账号可以登录
+func (s *userService) CheckAccountStatus(user *models.User) error {
+	status := user.EffectiveStatus(time.Now())
+	if status == models.UserStatusActive {
+		return nil
+	}
+
+	// 超过有效期的正常账号落库为过期状态，便于管理员查询和审计
+	if status == models.UserStatusExpired && user.Status == models.UserStatusActive {
+		if err := s.ChangeStatus(user, UserStatusChange{
+			Status:     models.UserStatusExpired,
+			ValidUntil: user.ValidUntil,
+			Reason:     "超过有效期",
+		}, SystemActor); err != nil {
+			logger.Logger.Error("标记账号过期失败", zap.Uint("userID", user.ID), zap.Error(err))
+		}
+	}
+	return &AccountStatusError{Status: status}
+}
+
+// setPassword 校验密码策略和历史记录后更新密码
+func (s *userService) setPassword(user *models.User, newPassword string, mustChange bool) error {
+	if err := s.ValidatePassword(user, newPassword); err != nil {
+		return err
+	}
+
 	// 加密新密码
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
 	if err != nil {
@@ -120,9 +270,69 @@ func (s *userService) UpdatePassword(user *models.User, newPassword string) erro
 	}
 
 	// 更新用户密码
+	now := time.Now()
 	user.Password = string(hashedPassword)
-	_, err = s.repo.Update(user)
-	return err
+	user.PasswordChangedAt = &now
+	user.MustChangePassword = mustChange
+	if _, err = s.repo.Update(user); err != nil {
+		return err
+	}
+	s.recordHistory(user)
+	return nil
+}
+
+// invalidateUserCaches 清除本实例的账号状态和角色缓存，并通知其他实例清除
+func invalidateUserCaches(userID uint) {
+	middleware.InvalidateAccountStatus(userID)
+	authcache.InvalidateUserID(userID)
+	database.NotifyUserChanged(userID)
+}
+
+// passwordChangeRequired 本地账号的密码按policy已过期或被要求修改
+func passwordChangeRequired(policy *password.Policy, user *models.User) bool {
+	if !isLocalUser(user) {
+		return false
+	}
+	if user.MustChangePassword {
+		return true
+	}
+	changedAt := user.CreatedAt
+	if user.PasswordChangedAt != nil {
+		changedAt = *user.PasswordChangedAt
+	}
+	return policy.Expired(changedAt, time.Now())
+}
+
+// isLocalUser 是否为使用本地密码的账号
+func isLocalUser(user *models.User) bool {
+	return user.Source == "" || user.Source == models.UserSourceLocal
+}
+
+// checkReuse 禁止新密码与当前密码及最近N次历史密码相同
+func (s *userService) checkReuse(user *models.User, newPassword string) error {
+	hashes := []string{user.Password}
+	recent, err := s.history.Recent(user.ID, s.policy.HistorySize)
+	if err != nil {
+		return err
+	}
+	hashes = append(hashes, recent...)
+
+	for _, hash := range hashes {
+		if hash != "" && bcrypt.CompareHashAndPassword([]byte(hash), []byte(newPassword)) == nil {
+			return ErrPasswordReused
+		}
+	}
+	return nil
+}
+
+// recordHistory 记录当前密码哈希到历史，失败时只记录日志
+func (s *userService) recordHistory(user *models.User) {
+	if s.policy.HistorySize <= 0 {
+		return
+	}
+	if err := s.history.Add(user.ID, user.Password, s.policy.HistorySize); err != nil {
+		logger.Logger.Error("记录历史密码失败", zap.Uint("userID", user.ID), zap.Error(err))
+	}
 }
 
 // InitAdminUser 初始化管理员用户
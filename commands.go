@@ -0,0 +1,245 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/GZ-Alinx/autops/business/repositories"
+	"github.com/GZ-Alinx/autops/business/routes"
+	"github.com/GZ-Alinx/autops/business/services"
+	"github.com/GZ-Alinx/autops/internal/config"
+	"github.com/GZ-Alinx/autops/internal/database"
+)
+
+// commandUsage 子命令说明
+const commandUsage = `用法: autops [命令]
+
+不带命令时启动HTTP服务。可用命令:
+  migrate-permissions [-apply]  把权限资源改写为路由模板（permission.match_mode: template），默认只打印改写方案
+  export-policy [-format yaml|csv] [-include-users] [-o 文件]
+                                导出角色、权限和角色权限关联，默认输出到标准输出
+  import-policy [-format yaml|csv] [-apply] 文件
+                                导入权限配置，默认只打印与数据库的差异；文件为-时读取标准输入
+  reconcile-policy [-fix]       按业务表检查casbin_rule中缺少、多余和重复的规则，默认只打印差异
+`
+
+// runCommand 执行命令行子命令，返回进程退出码
+func runCommand(args []string) int {
+	switch args[0] {
+	case "migrate-permissions":
+		return migratePermissions(args[1:])
+	case "export-policy":
+		return exportPolicy(args[1:])
+	case "import-policy":
+		return importPolicy(args[1:])
+	case "reconcile-policy":
+		return reconcilePolicy(args[1:])
+	case "help", "-h", "--help":
+		fmt.Print(commandUsage)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "未知命令: %s\n\n%s", args[0], commandUsage)
+		return 2
+	}
+}
+
+// migratePermissions 按路由表把path模式的权限资源改写为路由模板
+func migratePermissions(args []string) int {
+	fs := flag.NewFlagSet("migrate-permissions", flag.ContinueOnError)
+	apply := fs.Bool("apply", false, "执行改写；不指定时只打印改写方案")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *apply && !config.AppConfig.Permission.TemplateMode() {
+		fmt.Fprintln(os.Stderr, "请先将permission.match_mode设置为template：改写后的权限在path模式下不会匹配任何请求")
+		return 1
+	}
+
+	// 注册路由以获得完整的路由表
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	routes.RegisterRoutes(router)
+
+	plan, err := database.PlanPermissionTemplates(routes.ProtectedRoutes(router))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "计算改写方案失败: %v\n", err)
+		return 1
+	}
+	changed := 0
+	for _, rewrite := range plan {
+		if rewrite.Changed() {
+			changed++
+		}
+		fmt.Println(database.FormatPermissionRewrite(rewrite))
+	}
+	fmt.Printf("共%d条权限，需要改写%d条\n", len(plan), changed)
+
+	if !*apply || changed == 0 {
+		return 0
+	}
+	if err := database.ApplyPermissionTemplates(plan); err != nil {
+		fmt.Fprintf(os.Stderr, "改写权限失败，已回滚: %v\n", err)
+		return 1
+	}
+	fmt.Println("改写完成，casbin_rule已在同一事务中同步，运行中的服务重启后生效")
+	return 0
+}
+
+// newPolicyTransferService 命令行使用的权限配置导入导出服务
+func newPolicyTransferService() services.PolicyTransferService {
+	return services.NewPolicyTransferService(repositories.NewPolicyRepository(), services.NewAuditService(repositories.NewAuditLogRepository()))
+}
+
+// exportPolicy 导出权限配置
+func exportPolicy(args []string) int {
+	fs := flag.NewFlagSet("export-policy", flag.ContinueOnError)
+	format := fs.String("format", "", "格式：yaml或csv，默认按输出文件扩展名判断")
+	includeUsers := fs.Bool("include-users", false, "同时导出默认租户的用户角色")
+	output := fs.String("o", "", "输出文件，默认为标准输出")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *format == "" {
+		*format = services.PolicyFormatFromPath(*output)
+	}
+
+	doc, err := newPolicyTransferService().Export(*includeUsers)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "导出权限配置失败: %v\n", err)
+		return 1
+	}
+	data, err := services.EncodePolicyDocument(*format, doc)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "导出权限配置失败: %v\n", err)
+		return 1
+	}
+	if *output == "" {
+		os.Stdout.Write(data)
+		return 0
+	}
+	if err := os.WriteFile(*output, data, 0o644); err != nil {
+		fmt.Fprintf(os.Stderr, "写入文件失败: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// importPolicy 导入权限配置
+func importPolicy(args []string) int {
+	fs := flag.NewFlagSet("import-policy", flag.ContinueOnError)
+	format := fs.String("format", "", "格式：yaml或csv，默认按文件扩展名判断")
+	apply := fs.Bool("apply", false, "写入数据库；不指定时只打印差异")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "需要指定一个文件\n\n%s", commandUsage)
+		return 2
+	}
+	path := fs.Arg(0)
+	if *format == "" {
+		*format = services.PolicyFormatFromPath(path)
+	}
+
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "读取文件失败: %v\n", err)
+		return 1
+	}
+	doc, err := services.DecodePolicyDocument(*format, data)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	// 写入时需要同步Casbin策略，配置了watcher时同时通知运行中的实例重新加载
+	if *apply {
+		if err := database.InitCasbin(); err != nil {
+			fmt.Fprintf(os.Stderr, "Casbin初始化失败: %v\n", err)
+			return 1
+		}
+		if err := database.StartPolicyWatcher(); err != nil {
+			fmt.Fprintf(os.Stderr, "策略watcher初始化失败: %v\n", err)
+			return 1
+		}
+		defer database.StopPolicyWatcher()
+	}
+	result, err := newPolicyTransferService().Import(services.Actor{Username: "cli"}, doc, *apply)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "导入权限配置失败: %v\n", err)
+		return 1
+	}
+	for _, change := range result.Changes {
+		fmt.Println(change)
+	}
+	switch {
+	case len(result.Changes) == 0:
+		fmt.Println("没有差异")
+	case result.Applied:
+		if config.AppConfig.Permission.Watcher.Enabled() {
+			fmt.Printf("已应用%d项变更，已通知运行中的服务重新加载\n", len(result.Changes))
+		} else {
+			fmt.Printf("已应用%d项变更，运行中的服务重启后生效\n", len(result.Changes))
+		}
+	default:
+		fmt.Printf("共%d项差异，使用-apply写入\n", len(result.Changes))
+	}
+	return 0
+}
+
+// reconcilePolicy 检查并修复casbin_rule与业务表之间的差异
+func reconcilePolicy(args []string) int {
+	fs := flag.NewFlagSet("reconcile-policy", flag.ContinueOnError)
+	fix := fs.Bool("fix", false, "修正casbin_rule；不指定时只打印差异")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if err := database.InitCasbin(); err != nil {
+		fmt.Fprintf(os.Stderr, "Casbin初始化失败: %v\n", err)
+		return 1
+	}
+	// 修复时通过watcher把修正的规则通知运行中的实例
+	if *fix {
+		if err := database.StartPolicyWatcher(); err != nil {
+			fmt.Fprintf(os.Stderr, "策略watcher初始化失败: %v\n", err)
+			return 1
+		}
+		defer database.StopPolicyWatcher()
+	}
+	drift, err := database.ReconcilePolicy(*fix)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "检查策略漂移失败: %v\n", err)
+		return 1
+	}
+	for _, line := range drift.Missing {
+		fmt.Println("+ " + line)
+	}
+	for _, line := range drift.Extra {
+		fmt.Println("- " + line)
+	}
+	if drift.Duplicates > 0 {
+		fmt.Printf("重复的行: %d\n", drift.Duplicates)
+	}
+	switch {
+	case len(drift.Missing) == 0 && len(drift.Extra) == 0 && drift.Duplicates == 0:
+		fmt.Println("casbin_rule与业务表一致")
+	case drift.Fixed && config.AppConfig.Permission.Watcher.Enabled():
+		fmt.Println("已修正casbin_rule，已通知运行中的服务")
+	case drift.Fixed:
+		fmt.Println("已修正casbin_rule，运行中的服务重启后或下次漂移检查修复后生效")
+	default:
+		fmt.Println("casbin_rule与业务表不一致，使用-fix修正")
+	}
+	return 0
+}
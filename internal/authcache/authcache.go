@@ -0,0 +1,120 @@
+// Package authcache 缓存权限检查使用的用户及其在租户内的角色，避免每个请求都查询用户表和角色关联。
+//
+// 缓存按permission.role_cache_seconds过期，并在以下情况立即清除：
+//
+//	用户角色变化       同步到内存的g规则（用户, 角色, 租户）按用户清除，包括其他实例通过watcher通知的变化
+//	重新加载全部策略   全部清除
+//	用户状态变化或删除 按用户ID清除，包括其他实例通过watcher通知的变化
+package authcache
+
+import (
+	"sync"
+	"time"
+
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/internal/config"
+)
+
+// Entry 缓存的用户及其在租户内的角色，调用方不能修改
+type Entry struct {
+	UserID uint
+	Roles  []models.Role
+}
+
+// key 缓存键：用户名和租户ID（默认租户为0）
+type key struct {
+	username string
+	tenantID uint
+}
+
+// item 缓存项
+type item struct {
+	entry     *Entry
+	fetchedAt time.Time
+}
+
+var (
+	mu    sync.RWMutex
+	items = make(map[key]*item)
+	// generation 每次清除递增；清除前开始的查询可能读到旧数据，结果不写入缓存
+	generation uint64
+)
+
+// ttl 缓存时间，0表示不缓存
+func ttl() time.Duration {
+	return time.Duration(config.AppConfig.Permission.RoleCacheSeconds) * time.Second
+}
+
+// Load 获取用户在租户内的角色，未命中或已过期时调用load查询并写入缓存；load出错时不缓存
+func Load(username string, tenantID uint, load func() (*Entry, error)) (*Entry, error) {
+	ttl := ttl()
+	if ttl <= 0 {
+		return load()
+	}
+
+	k := key{username: username, tenantID: tenantID}
+	now := time.Now()
+	mu.RLock()
+	cached, ok := items[k]
+	gen := generation
+	mu.RUnlock()
+	if ok && now.Sub(cached.fetchedAt) < ttl {
+		return cached.entry, nil
+	}
+
+	entry, err := load()
+	if err != nil {
+		return nil, err
+	}
+	mu.Lock()
+	if generation == gen {
+		items[k] = &item{entry: entry, fetchedAt: now}
+	}
+	mu.Unlock()
+	return entry, nil
+}
+
+// InvalidateUser 清除用户在全部租户内的缓存
+func InvalidateUser(usernames ...string) {
+	if len(usernames) == 0 {
+		return
+	}
+	names := make(map[string]bool, len(usernames))
+	for _, username := range usernames {
+		names[username] = true
+	}
+	invalidate(func(k key, _ *item) bool { return names[k.username] })
+}
+
+// InvalidateUserID 按用户ID清除缓存，用于只知道用户ID的场景（修改状态、删除用户）
+func InvalidateUserID(userID uint) {
+	invalidate(func(_ key, it *item) bool { return it.entry.UserID == userID })
+}
+
+// InvalidateGrouping 按变化的g规则清除相关用户的缓存；角色之间的继承关系（租户为*）不影响用户的直接角色
+func InvalidateGrouping(rules [][]string) {
+	var usernames []string
+	for _, rule := range rules {
+		if len(rule) >= 3 && rule[2] != "*" {
+			usernames = append(usernames, rule[0])
+		}
+	}
+	InvalidateUser(usernames...)
+}
+
+// Purge 清除全部缓存
+func Purge() {
+	invalidate(func(key, *item) bool { return true })
+}
+
+// invalidate 删除匹配的缓存项，并使进行中的查询结果失效
+func invalidate(match func(key, *item) bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	generation++
+	for k, it := range items {
+		if match(k, it) {
+			delete(items, k)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package authcache
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/internal/config"
+)
+
+// withTTL 设置缓存时间并在测试结束时清空缓存
+func withTTL(t *testing.T, seconds int) {
+	t.Helper()
+	previous := config.AppConfig.Permission.RoleCacheSeconds
+	config.AppConfig.Permission.RoleCacheSeconds = seconds
+	Purge()
+	t.Cleanup(func() {
+		config.AppConfig.Permission.RoleCacheSeconds = previous
+		Purge()
+	})
+}
+
+// counter 记录load被调用的次数
+type counter struct {
+	calls int
+	entry *Entry
+}
+
+func (c *counter) load() (*Entry, error) {
+	c.calls++
+	return c.entry, nil
+}
+
+func newCounter(userID uint, roles ...string) *counter {
+	entry := &Entry{UserID: userID}
+	for _, role := range roles {
+		entry.Roles = append(entry.Roles, models.Role{Name: role})
+	}
+	return &counter{entry: entry}
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("命中缓存", func(t *testing.T) {
+		withTTL(t, 60)
+		c := newCounter(1, "ops")
+		for i := 0; i < 3; i++ {
+			entry, err := Load("alice", 0, c.load)
+			if err != nil {
+				t.Fatalf("Load返回错误: %v", err)
+			}
+			if entry != c.entry {
+				t.Fatalf("Load返回了其他缓存项")
+			}
+		}
+		if c.calls != 1 {
+			t.Fatalf("load调用%d次，期望1次", c.calls)
+		}
+	})
+
+	t.Run("按用户和租户分别缓存", func(t *testing.T) {
+		withTTL(t, 60)
+		c := newCounter(1, "ops")
+		Load("alice", 0, c.load)
+		Load("alice", 2, c.load)
+		Load("bob", 0, c.load)
+		if c.calls != 3 {
+			t.Fatalf("load调用%d次，期望3次", c.calls)
+		}
+	})
+
+	t.Run("过期后重新查询", func(t *testing.T) {
+		withTTL(t, 60)
+		c := newCounter(1, "ops")
+		Load("alice", 0, c.load)
+		mu.Lock()
+		items[key{username: "alice"}].fetchedAt = time.Now().Add(-61 * time.Second)
+		mu.Unlock()
+		Load("alice", 0, c.load)
+		if c.calls != 2 {
+			t.Fatalf("load调用%d次，期望2次", c.calls)
+		}
+	})
+
+	t.Run("TTL为0时不缓存", func(t *testing.T) {
+		withTTL(t, 0)
+		c := newCounter(1, "ops")
+		Load("alice", 0, c.load)
+		Load("alice", 0, c.load)
+		if c.calls != 2 {
+			t.Fatalf("load调用%d次，期望2次", c.calls)
+		}
+		if len(items) != 0 {
+			t.Fatalf("TTL为0时写入了%d个缓存项", len(items))
+		}
+	})
+
+	t.Run("查询出错时不缓存", func(t *testing.T) {
+		withTTL(t, 60)
+		calls := 0
+		failing := func() (*Entry, error) {
+			calls++
+			return nil, errors.New("db down")
+		}
+		for i := 0; i < 2; i++ {
+			if _, err := Load("alice", 0, failing); err == nil {
+				t.Fatalf("期望返回load的错误")
+			}
+		}
+		if calls != 2 {
+			t.Fatalf("load调用%d次，期望2次", calls)
+		}
+	})
+}
+
+func TestInvalidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		invalidate func()
+		evicted    []string // 期望被清除的用户
+	}{
+		{
+			name:       "用户角色规则按用户清除",
+			invalidate: func() { InvalidateGrouping([][]string{{"alice", "ops", models.DefaultTenantCode}}) },
+			evicted:    []string{"alice"},
+		},
+		{
+			name:       "租户内的用户角色规则同样清除",
+			invalidate: func() { InvalidateGrouping([][]string{{"bob", "ops", "acme"}}) },
+			evicted:    []string{"bob"},
+		},
+		{
+			name:       "角色继承规则不影响用户缓存",
+			invalidate: func() { InvalidateGrouping([][]string{{"alice", "ops", models.AllTenants}}) },
+		},
+		{
+			name:       "字段不完整的规则忽略",
+			invalidate: func() { InvalidateGrouping([][]string{{"alice", "ops"}}) },
+		},
+		{
+			name:       "按用户名清除",
+			invalidate: func() { InvalidateUser("alice", "carol") },
+			evicted:    []string{"alice"},
+		},
+		{
+			name:       "按用户ID清除",
+			invalidate: func() { InvalidateUserID(2) },
+			evicted:    []string{"bob"},
+		},
+		{
+			name:       "全部清除",
+			invalidate: Purge,
+			evicted:    []string{"alice", "bob"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withTTL(t, 60)
+			loaders := map[string]*counter{"alice": newCounter(1, "ops"), "bob": newCounter(2, "dev")}
+			for username, c := range loaders {
+				Load(username, 0, c.load)
+			}
+
+			tt.invalidate()
+
+			evicted := make(map[string]bool)
+			for _, username := range tt.evicted {
+				evicted[username] = true
+			}
+			for username, c := range loaders {
+				Load(username, 0, c.load)
+				want := 1
+				if evicted[username] {
+					want = 2
+				}
+				if c.calls != want {
+					t.Errorf("%s: load调用%d次，期望%d次", username, c.calls, want)
+				}
+			}
+		})
+	}
+}
+
+// TestLoadGenerationGuard 查询期间发生清除时，可能读到旧数据的查询结果不写入缓存
+func TestLoadGenerationGuard(t *testing.T) {
+	withTTL(t, 60)
+	stale := &Entry{UserID: 1, Roles: []models.Role{{Name: "admin"}}}
+	entry, err := Load("alice", 0, func() (*Entry, error) {
+		// 查询读到旧角色后，另一个请求撤销了角色并清除缓存
+		InvalidateGrouping([][]string{{"alice", "admin", models.DefaultTenantCode}})
+		return stale, nil
+	})
+	if err != nil {
+		t.Fatalf("Load返回错误: %v", err)
+	}
+	if entry != stale {
+		t.Fatalf("本次请求应返回查询结果")
+	}
+
+	c := newCounter(1, "ops")
+	entry, _ = Load("alice", 0, c.load)
+	if c.calls != 1 || entry != c.entry {
+		t.Fatalf("清除前开始的查询结果被写入了缓存")
+	}
+}
@@ -0,0 +1,281 @@
+// Package condition 解析和计算权限上的属性条件。
+//
+// 条件表达式由一个或多个条件以 && 连接组成，全部满足时成立，空表达式总是成立：
+//
+//	owner                        路径参数id等于当前用户ID
+//	owner(userId)                指定比较的路径参数名
+//	ip(10.0.0.0/8, 192.168.1.10) 客户端IP在任一网段内或等于任一IP
+//	time(09:00-18:00)            当前时间（服务器时区）在区间内，结束时间早于开始时间表示跨天
+//	weekday(Mon-Fri)             星期在范围内，也可以逗号分隔：weekday(Mon,Wed,Sat)
+package condition
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OwnerParam owner条件默认比较的路径参数
+const OwnerParam = "id"
+
+// Attributes 计算条件所需的请求属性
+type Attributes struct {
+	IP     string            // 客户端IP
+	Time   time.Time         // 请求时间
+	UserID string            // 当前用户ID（来自JWT）
+	Params map[string]string // 路径参数
+}
+
+// Expression 解析后的条件表达式
+type Expression struct {
+	clauses []clause
+}
+
+// clause 单个条件
+type clause interface {
+	match(attrs *Attributes) bool
+}
+
+// Parse 解析条件表达式
+func Parse(expr string) (*Expression, error) {
+	e := &Expression{}
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return e, nil
+	}
+	for _, part := range strings.Split(expr, "&&") {
+		c, err := parseClause(strings.TrimSpace(part))
+		if err != nil {
+			return nil, err
+		}
+		e.clauses = append(e.clauses, c)
+	}
+	return e, nil
+}
+
+// Validate 检查条件表达式是否合法
+func Validate(expr string) error {
+	_, err := Parse(expr)
+	return err
+}
+
+// Match 全部条件满足时返回true
+func (e *Expression) Match(attrs *Attributes) bool {
+	for _, c := range e.clauses {
+		if !c.match(attrs) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseClause 解析 name 或 name(args)
+func parseClause(s string) (clause, error) {
+	name, args := s, ""
+	if i := strings.Index(s, "("); i >= 0 {
+		if !strings.HasSuffix(s, ")") {
+			return nil, fmt.Errorf("条件缺少右括号: %s", s)
+		}
+		name, args = strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+1:len(s)-1])
+	}
+
+	switch name {
+	case "owner":
+		if args == "" {
+			args = OwnerParam
+		}
+		return ownerClause{param: args}, nil
+	case "ip":
+		return parseIP(args)
+	case "time":
+		return parseTime(args)
+	case "weekday":
+		return parseWeekday(args)
+	case "":
+		return nil, fmt.Errorf("条件不能为空")
+	default:
+		return nil, fmt.Errorf("不支持的条件: %s", name)
+	}
+}
+
+// ownerClause 路径参数等于当前用户ID
+type ownerClause struct {
+	param string
+}
+
+func (c ownerClause) match(attrs *Attributes) bool {
+	if attrs.UserID == "" {
+		return false
+	}
+	return attrs.Params[c.param] == attrs.UserID
+}
+
+// ipClause 客户端IP在网段内
+type ipClause struct {
+	nets []*net.IPNet
+}
+
+func parseIP(args string) (clause, error) {
+	var c ipClause
+	for _, item := range strings.Split(args, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("无效的IP: %s", item)
+			}
+			bits := 32
+			if ip.To4() == nil {
+				bits = 128
+			}
+			item = fmt.Sprintf("%s/%d", item, bits)
+		}
+		_, ipNet, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("无效的网段: %s", item)
+		}
+		c.nets = append(c.nets, ipNet)
+	}
+	if len(c.nets) == 0 {
+		return nil, fmt.Errorf("ip条件至少需要一个网段")
+	}
+	return c, nil
+}
+
+func (c ipClause) match(attrs *Attributes) bool {
+	ip := net.ParseIP(attrs.IP)
+	if ip == nil {
+		return false
+	}
+	for _, n := range c.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// timeClause 一天中的时间区间（分钟）
+type timeClause struct {
+	start, end int
+}
+
+func parseTime(args string) (clause, error) {
+	from, to, ok := strings.Cut(args, "-")
+	if !ok {
+		return nil, fmt.Errorf("time条件格式应为HH:MM-HH:MM: %s", args)
+	}
+	start, err := parseClock(from)
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseClock(to)
+	if err != nil {
+		return nil, err
+	}
+	return timeClause{start: start, end: end}, nil
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("无效的时间: %s", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (c timeClause) match(attrs *Attributes) bool {
+	now := attrs.Time.Hour()*60 + attrs.Time.Minute()
+	if c.start <= c.end {
+		return now >= c.start && now < c.end
+	}
+	// 跨天，如22:00-06:00
+	return now >= c.start || now < c.end
+}
+
+// weekdayClause 允许的星期
+type weekdayClause struct {
+	days [7]bool
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+func parseDay(s string) (time.Weekday, error) {
+	d, ok := weekdays[strings.ToLower(strings.TrimSpace(s))]
+	if !ok {
+		return 0, fmt.Errorf("无效的星期: %s", s)
+	}
+	return d, nil
+}
+
+func parseWeekday(args string) (clause, error) {
+	var c weekdayClause
+	for _, item := range strings.Split(args, ",") {
+		from, to, isRange := strings.Cut(item, "-")
+		start, err := parseDay(from)
+		if err != nil {
+			return nil, err
+		}
+		end := start
+		if isRange {
+			if end, err = parseDay(to); err != nil {
+				return nil, err
+			}
+		}
+		// 支持跨周末的范围，如Sat-Mon
+		for d := start; ; d = (d + 1) % 7 {
+			c.days[d] = true
+			if d == end {
+				break
+			}
+		}
+	}
+	return c, nil
+}
+
+func (c weekdayClause) match(attrs *Attributes) bool {
+	return c.days[attrs.Time.Weekday()]
+}
+
+// 解析结果缓存，策略中的表达式数量有限
+var cache sync.Map
+
+// Eval 计算条件表达式，解析失败时视为不满足
+func Eval(expr string, attrs *Attributes) bool {
+	if strings.TrimSpace(expr) == "" {
+		return true
+	}
+	var e *Expression
+	if v, ok := cache.Load(expr); ok {
+		e = v.(*Expression)
+	} else {
+		parsed, err := Parse(expr)
+		if err != nil {
+			return false
+		}
+		cache.Store(expr, parsed)
+		e = parsed
+	}
+	if attrs == nil {
+		return false
+	}
+	return e.Match(attrs)
+}
+
+// CasbinFunc 供Casbin匹配器调用的条件函数：matchCondition(p.cond, r.env)
+func CasbinFunc(args ...interface{}) (interface{}, error) {
+	if len(args) != 2 {
+		return false, fmt.Errorf("matchCondition需要2个参数")
+	}
+	expr, _ := args[0].(string)
+	attrs, _ := args[1].(*Attributes)
+	return Eval(expr, attrs), nil
+}
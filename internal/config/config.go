@@ -23,7 +23,7 @@ type LoggerConfig struct {
 	MaxSize    int    `mapstructure:"max_size"`    // MB
 	MaxBackups int    `mapstructure:"max_backups"` // 个
 	MaxAge     int    `mapstructure:"max_age"`     // 天
-	Compress   bool   `mapstructure:"compress"`   // 是否压缩
+	Compress   bool   `mapstructure:"compress"`    // 是否压缩
 }
 
 // MySQLConfig MySQL数据库配置
@@ -46,10 +46,190 @@ type CorsConfig struct {
 	MaxAge           int      `mapstructure:"max_age"` // 小时
 }
 
+// JWTKeyConfig JWT非对称密钥配置
+type JWTKeyConfig struct {
+	KID            string `mapstructure:"kid"`              // 密钥ID，写入令牌头kid
+	PrivateKeyFile string `mapstructure:"private_key_file"` // 私钥PEM文件，签名密钥必填
+	PublicKeyFile  string `mapstructure:"public_key_file"`  // 公钥PEM文件，仅验证旧令牌时可只配置公钥
+}
+
 // JWTConfig JWT配置
 type JWTConfig struct {
-	Secret      string        `mapstructure:"secret"`
-	ExpiresHour time.Duration `mapstructure:"expires_hours"`
+	Algorithm           string         `mapstructure:"algorithm"`      // HS256, RS256, ES256, EdDSA
+	SigningKeyID        string         `mapstructure:"signing_key_id"` // 当前用于签名的密钥ID
+	Keys                []JWTKeyConfig `mapstructure:"keys"`           // 非对称密钥列表，可同时配置多个用于轮换
+	Secret              string         `mapstructure:"secret"`
+	ExpiresHour         time.Duration  `mapstructure:"expires_hours"`          // 兼容旧配置，未配置access_expires_minutes时使用
+	AccessExpiresMinute time.Duration  `mapstructure:"access_expires_minutes"` // 访问令牌有效期（分钟）
+	RefreshExpiresHour  time.Duration  `mapstructure:"refresh_expires_hours"`  // 刷新令牌有效期（小时）
+	ImpersonationMinute int            `mapstructure:"impersonation_minutes"`  // 模拟登录令牌有效期（分钟），不可刷新
+}
+
+// MFAConfig 两步验证配置
+type MFAConfig struct {
+	Issuer           string `mapstructure:"issuer"`            // 验证器应用中显示的签发方，默认使用应用名称
+	ChallengeMinutes int    `mapstructure:"challenge_minutes"` // 登录第二步挑战令牌有效期（分钟）
+}
+
+// LoginGuardConfig 登录防暴力破解配置
+type LoginGuardConfig struct {
+	Store             string `mapstructure:"store"`               // 计数存储：db（默认，多副本共享）或 memory（仅单实例）
+	MaxUserFailures   int    `mapstructure:"max_user_failures"`   // 同一用户名在窗口内允许的失败次数
+	MaxIPFailures     int    `mapstructure:"max_ip_failures"`     // 同一客户端IP在窗口内允许的失败次数
+	WindowMinutes     int    `mapstructure:"window_minutes"`      // 失败次数统计窗口（分钟）
+	LockoutMinutes    int    `mapstructure:"lockout_minutes"`     // 首次锁定时长（分钟），之后每次锁定翻倍
+	MaxLockoutMinutes int    `mapstructure:"max_lockout_minutes"` // 锁定时长上限（分钟）
+}
+
+// PasswordPolicyConfig 密码策略配置
+type PasswordPolicyConfig struct {
+	MinLength      int      `mapstructure:"min_length"`       // 最小长度
+	RequireUpper   bool     `mapstructure:"require_upper"`    // 必须包含大写字母
+	RequireLower   bool     `mapstructure:"require_lower"`    // 必须包含小写字母
+	RequireDigit   bool     `mapstructure:"require_digit"`    // 必须包含数字
+	RequireSymbol  bool     `mapstructure:"require_symbol"`   // 必须包含特殊字符
+	MinCharClasses int      `mapstructure:"min_char_classes"` // 至少包含的字符类别数（0-4）
+	Denylist       []string `mapstructure:"denylist"`         // 额外禁用的密码
+	DenylistFile   string   `mapstructure:"denylist_file"`    // 禁用密码文件，每行一个
+	HistorySize    int      `mapstructure:"history_size"`     // 禁止与最近N次使用过的密码相同
+	MaxAgeDays     int      `mapstructure:"max_age_days"`     // 密码最长使用天数，0表示不过期
+}
+
+// MailConfig 邮件发送配置
+type MailConfig struct {
+	Driver             string `mapstructure:"driver"`               // smtp, file, log
+	Host               string `mapstructure:"host"`                 // SMTP服务器地址
+	Port               int    `mapstructure:"port"`                 // SMTP服务器端口
+	Username           string `mapstructure:"username"`             // SMTP认证用户名，为空时不认证
+	Password           string `mapstructure:"password"`             // SMTP认证密码
+	From               string `mapstructure:"from"`                 // 发件人地址
+	TLSMode            string `mapstructure:"tls_mode"`             // none, starttls, tls
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"` // 跳过证书校验，仅用于测试
+	FileDir            string `mapstructure:"file_dir"`             // driver为file时邮件写入的目录
+}
+
+// PasswordResetConfig 自助找回密码配置
+type PasswordResetConfig struct {
+	URL                string `mapstructure:"url"`                  // 重置页面地址，邮件中的链接为 url?token=xxx
+	TokenMinutes       int    `mapstructure:"token_minutes"`        // 重置链接有效期（分钟）
+	MaxPerEmail        int    `mapstructure:"max_per_email"`        // 统计窗口内同一邮箱最多申请次数
+	MaxPerIP           int    `mapstructure:"max_per_ip"`           // 统计窗口内同一客户端IP最多申请次数
+	LimitWindowMinutes int    `mapstructure:"limit_window_minutes"` // 申请次数统计窗口，达到上限后同样锁定该时长
+}
+
+// LDAPGroupMapping LDAP组到角色的映射
+type LDAPGroupMapping struct {
+	Group string   `mapstructure:"group"` // 组DN或组名（group_name_attr的值），不区分大小写
+	Roles []string `mapstructure:"roles"` // 对应的角色名称
+}
+
+// LDAPConfig LDAP/Active Directory认证配置
+type LDAPConfig struct {
+	Enabled            bool               `mapstructure:"enabled"`
+	URL                string             `mapstructure:"url"`                  // ldap://host:389 或 ldaps://host:636
+	StartTLS           bool               `mapstructure:"start_tls"`            // ldap://连接后升级为TLS
+	InsecureSkipVerify bool               `mapstructure:"insecure_skip_verify"` // 跳过证书校验，仅用于测试
+	TimeoutSeconds     int                `mapstructure:"timeout_seconds"`      // 连接和操作超时
+	BindDN             string             `mapstructure:"bind_dn"`              // 用于查询的服务账号，为空时匿名查询
+	BindPassword       string             `mapstructure:"bind_password"`
+	BaseDN             string             `mapstructure:"base_dn"`         // 用户搜索起点
+	UserFilter         string             `mapstructure:"user_filter"`     // 用户过滤条件，%s替换为用户名，如(uid=%s)、(sAMAccountName=%s)
+	UsernameAttr       string             `mapstructure:"username_attr"`   // 用户名属性
+	EmailAttr          string             `mapstructure:"email_attr"`      // 邮箱属性
+	NameAttr           string             `mapstructure:"name_attr"`       // 显示名称属性
+	MemberOfAttr       string             `mapstructure:"member_of_attr"`  // 用户所属组属性（AD为memberOf），未配置group_base_dn时使用
+	GroupBaseDN        string             `mapstructure:"group_base_dn"`   // 组搜索起点，为空时从用户的member_of_attr读取组
+	GroupFilter        string             `mapstructure:"group_filter"`    // 组过滤条件，%s替换为用户DN，如(member=%s)
+	GroupNameAttr      string             `mapstructure:"group_name_attr"` // 组名属性
+	GroupMappings      []LDAPGroupMapping `mapstructure:"group_mappings"`  // 组到角色的映射
+	DefaultRoles       []string           `mapstructure:"default_roles"`   // 所有LDAP用户都拥有的角色
+	SyncRoles          bool               `mapstructure:"sync_roles"`      // 每次登录按组映射覆盖用户角色
+}
+
+// OIDCGroupMapping OIDC组声明到角色的映射
+type OIDCGroupMapping struct {
+	Group string   `mapstructure:"group"` // groups_claim中的组名，不区分大小写
+	Roles []string `mapstructure:"roles"` // 对应的角色名称
+}
+
+// OIDCConfig OpenID Connect单点登录配置
+type OIDCConfig struct {
+	Enabled        bool               `mapstructure:"enabled"`
+	Issuer         string             `mapstructure:"issuer"`          // 身份提供方地址，从 issuer/.well-known/openid-configuration 获取端点
+	ClientID       string             `mapstructure:"client_id"`       // 客户端ID
+	ClientSecret   string             `mapstructure:"client_secret"`   // 客户端密钥，公共客户端为空，仅使用PKCE
+	RedirectURL    string             `mapstructure:"redirect_url"`    // 回调地址，需在身份提供方登记
+	Scopes         []string           `mapstructure:"scopes"`          // 申请的scope，默认openid profile email
+	UsernameClaim  string             `mapstructure:"username_claim"`  // 用户名声明
+	EmailClaim     string             `mapstructure:"email_claim"`     // 邮箱声明
+	NameClaim      string             `mapstructure:"name_claim"`      // 显示名称声明
+	GroupsClaim    string             `mapstructure:"groups_claim"`    // 组声明，值为字符串或字符串数组
+	GroupMappings  []OIDCGroupMapping `mapstructure:"group_mappings"`  // 组到角色的映射
+	DefaultRoles   []string           `mapstructure:"default_roles"`   // 所有SSO用户都拥有的角色
+	SyncRoles      bool               `mapstructure:"sync_roles"`      // 每次登录按组映射覆盖用户角色
+	StateMinutes   int                `mapstructure:"state_minutes"`   // 发起登录到回调的最长时间（分钟）
+	TimeoutSeconds int                `mapstructure:"timeout_seconds"` // 访问身份提供方的超时
+}
+
+// 权限资源的匹配模式
+const (
+	MatchModePath     = "path"     // 按请求路径检查，资源使用keyMatch通配，如/api/v1/users/*
+	MatchModeTemplate = "template" // 按路由模板检查，资源使用keyMatch2，如/api/v1/users/:id
+)
+
+// WatcherConfig 多实例间同步策略变更的配置
+type WatcherConfig struct {
+	Driver        string `mapstructure:"driver"`         // none（默认，单实例）, db, redis
+	PollSeconds   int    `mapstructure:"poll_seconds"`   // driver为db时轮询变更记录的间隔
+	RetainMinutes int    `mapstructure:"retain_minutes"` // driver为db时变更记录的保留时间，落后更多的实例全量重新加载
+	RedisAddr     string `mapstructure:"redis_addr"`     // Redis地址，如127.0.0.1:6379
+	RedisPassword string `mapstructure:"redis_password"` // Redis密码，为空时不认证
+	RedisDB       int    `mapstructure:"redis_db"`       // Redis数据库编号
+	Channel       string `mapstructure:"channel"`        // Redis发布订阅的频道
+}
+
+// Enabled 是否配置了watcher
+func (c WatcherConfig) Enabled() bool {
+	return c.Driver != "" && c.Driver != "none"
+}
+
+// PermissionConfig 权限目录配置
+type PermissionConfig struct {
+	AutoRegister     bool            `mapstructure:"auto_register"`      // 启动时按路由表为需要权限检查的路由注册权限，并标记失效的权限
+	MatchMode        string          `mapstructure:"match_mode"`         // 资源匹配模式：path（默认）或template
+	Watcher          WatcherConfig   `mapstructure:"watcher"`            // 多实例部署时同步策略变更
+	ReconcileMinutes int             `mapstructure:"reconcile_minutes"`  // 定期检查Casbin策略与业务表是否一致的间隔（分钟），0为不检查
+	ReconcileFix     bool            `mapstructure:"reconcile_fix"`      // 检查到不一致时自动修复，否则只记录日志
+	RoleCacheSeconds int             `mapstructure:"role_cache_seconds"` // 权限检查时缓存用户角色的时间（秒），0为不缓存
+	Elevation        ElevationConfig `mapstructure:"elevation"`          // 临时提权
+	Approval         ApprovalConfig  `mapstructure:"approval"`           // 敏感操作审批
+}
+
+// ElevationConfig 临时提权配置
+type ElevationConfig struct {
+	MaxMinutes  int `mapstructure:"max_minutes"`  // 单次临时授权的最长时间（分钟）
+	ReapSeconds int `mapstructure:"reap_seconds"` // 检查临时授权生效和到期的间隔（秒），0为不检查
+}
+
+// ApprovalConfig 敏感操作审批配置
+type ApprovalConfig struct {
+	ExpireHours int            `mapstructure:"expire_hours"` // 待审批变更的有效期（小时），过期后不能再审批
+	SecretKey   string         `mapstructure:"secret_key"`   // 加密保存请求体中密码等敏感字段的密钥，未配置时包含敏感字段的请求不能提交审批
+	Rules       []ApprovalRule `mapstructure:"rules"`        // 需要审批的接口
+}
+
+// ApprovalRule 需要审批的接口：通过权限检查的匹配请求不立即执行，而是保存为待审批变更
+type ApprovalRule struct {
+	Method        string   `mapstructure:"method"`         // 请求方法，*匹配全部方法
+	Path          string   `mapstructure:"path"`           // 请求路径，按keyMatch2匹配（如/api/v1/users/:id）
+	ApproverRoles []string `mapstructure:"approver_roles"` // 可以审批的角色（默认租户），拥有任一角色即可
+	Approvals     int      `mapstructure:"approvals"`      // 需要的批准人数，默认1
+	Description   string   `mapstructure:"description"`    // 说明，展示给审批人
+}
+
+// TemplateMode 是否按路由模板检查权限
+func (c PermissionConfig) TemplateMode() bool {
+	return c.MatchMode == MatchModeTemplate
 }
 
 // Config 应用总配置
@@ -59,6 +239,15 @@ type Config struct {
 	MySQL  MySQLConfig  `mapstructure:"mysql"`
 	JWT    JWTConfig    `mapstructure:"jwt"`
 	Cors   CorsConfig   `mapstructure:"cors"`
+	MFA    MFAConfig    `mapstructure:"mfa"`
+
+	LoginGuard     LoginGuardConfig     `mapstructure:"login_guard"`
+	PasswordPolicy PasswordPolicyConfig `mapstructure:"password_policy"`
+	PasswordReset  PasswordResetConfig  `mapstructure:"password_reset"`
+	Mail           MailConfig           `mapstructure:"mail"`
+	LDAP           LDAPConfig           `mapstructure:"ldap"`
+	OIDC           OIDCConfig           `mapstructure:"oidc"`
+	Permission     PermissionConfig     `mapstructure:"permission"`
 }
 
 // AppConfig 全局配置实例
@@ -80,6 +269,14 @@ func LoadConfig() error {
 		return err
 	}
 
+	switch AppConfig.Permission.MatchMode {
+	case "":
+		AppConfig.Permission.MatchMode = MatchModePath
+	case MatchModePath, MatchModeTemplate:
+	default:
+		return fmt.Errorf("不支持的权限匹配模式: %s", AppConfig.Permission.MatchMode)
+	}
+
 	fmt.Println("配置加载成功，应用配置已初始化")
 	return nil
 }
@@ -25,13 +25,15 @@ func InitAdminUser() error {
 			return err
 		}
 
+		// 默认密码不符合密码策略，首次登录必须修改
 		phone := ""
 		user = models.User{
-			Username: "admin",
-			Password: string(hashedPassword),
-			Email:    "admin@example.com",
-			Phone:    &phone,
-			Status:   1,
+			Username:           "admin",
+			Password:           string(hashedPassword),
+			Email:              "admin@example.com",
+			Phone:              &phone,
+			Status:             1,
+			MustChangePassword: true,
 		}
 
 		// 保存用户到数据库
@@ -64,11 +66,18 @@ func InitAdminUser() error {
 		logger.Logger.Info("为管理员用户分配角色成功")
 	}
 
-	// 同步Casbin策略
-	if err := SyncCasbinPolicy(); err != nil {
+	// 按业务表修正全部Casbin规则；加载失败以空策略启动时内存与数据库不一致，同时重新加载
+	drift, err := ReconcilePolicy(true)
+	if err != nil {
 		logger.Logger.Error("同步Casbin策略失败", zap.Error(err))
 		return err
 	}
+	if drift.Fixed {
+		logger.Logger.Info("已按业务表修正Casbin策略",
+			zap.Int("missing", len(drift.Missing)),
+			zap.Int("extra", len(drift.Extra)),
+			zap.Int("duplicates", drift.Duplicates))
+	}
 
 	return nil
 }
@@ -61,7 +61,7 @@ func InitDB() error {
 	// logger.Logger.Info(fmt.Sprintf("设置连接最大生存时间为: %v", mysqlConfig.ConnMaxLife))
 
 	// 自动迁移数据表
-	if err := DB.AutoMigrate(&models.User{}, &models.Role{}, &models.UserRole{}, &models.Permission{}, &models.RolePermission{}); err != nil {
+	if err := DB.AutoMigrate(&models.User{}, &models.Role{}, &models.UserRole{}, &models.Permission{}, &models.RolePermission{}, &models.RefreshToken{}, &models.RevokedToken{}, &models.APIToken{}, &models.MFARecoveryCode{}, &models.LoginAttempt{}, &models.PasswordHistory{}, &models.PasswordResetToken{}, &models.OIDCLoginState{}, &models.UserSession{}, &models.AuditLog{}, &models.Tenant{}, &models.TenantUserRole{}, &models.PolicyEvent{}, &models.RoleElevation{}, &models.ChangeRequest{}, &models.ChangeDecision{}); err != nil {
 		logger.Logger.Error("数据表迁移失败", zap.Error(err))
 		return err
 	}
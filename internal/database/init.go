@@ -5,9 +5,12 @@ import (
 	"os"
 
 	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/internal/condition"
+	"github.com/GZ-Alinx/autops/internal/config"
 	"github.com/GZ-Alinx/autops/internal/global"
 	"github.com/GZ-Alinx/autops/internal/logger"
 	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/util"
 	gormadapter "github.com/casbin/gorm-adapter/v3"
 	"go.uber.org/zap"
 )
@@ -21,12 +24,28 @@ func InitCasbinAndPermissions() error {
 		&models.Permission{},
 		&models.UserRole{},
 		&models.RolePermission{},
+		&models.RefreshToken{},
+		&models.RevokedToken{},
+		&models.APIToken{},
+		&models.MFARecoveryCode{},
+		&models.LoginAttempt{},
+		&models.PasswordHistory{},
+		&models.PasswordResetToken{},
+		&models.OIDCLoginState{},
+		&models.UserSession{},
+		&models.AuditLog{},
+		&models.Tenant{},
+		&models.TenantUserRole{},
+		&models.PolicyEvent{},
+		&models.RoleElevation{},
+		&models.ChangeRequest{},
+		&models.ChangeDecision{},
 	); err != nil {
 		return fmt.Errorf("表结构迁移失败: %w", err)
 	}
 
 	// 初始化Casbin
-	if err := initCasbin(); err != nil {
+	if err := InitCasbin(); err != nil {
 		return fmt.Errorf("Casbin初始化失败: %w", err)
 	}
 
@@ -38,8 +57,13 @@ func InitCasbinAndPermissions() error {
 	return nil
 }
 
-// initCasbin 初始化Casbin权限控制
-func initCasbin() error {
+// InitCasbin 初始化Casbin权限控制，模型配置为工作目录下的configs/casbin_model.conf
+func InitCasbin() error {
+	return InitCasbinWithModel("configs/casbin_model.conf")
+}
+
+// InitCasbinWithModel 使用指定的模型配置文件初始化Casbin权限控制
+func InitCasbinWithModel(modelPath string) error {
 	// 创建GORM适配器
 	adapter, err := gormadapter.NewAdapterByDB(DB)
 	if err != nil {
@@ -47,20 +71,30 @@ func initCasbin() error {
 	}
 
 	// 从文件加载模型配置
-	modelPath := "configs/casbin_model.conf"
 	if _, err := os.Stat(modelPath); os.IsNotExist(err) {
 		return fmt.Errorf("Casbin模型配置文件不存在: %s", modelPath)
 	}
 
-	// 创建Casbin执行者
-	enforcer, err := casbin.NewEnforcer(modelPath, adapter)
+	// 创建Casbin执行者，先不加载策略
+	enforcer, err := casbin.NewSyncedEnforcer(modelPath)
 	if err != nil {
 		return fmt.Errorf("创建Casbin执行者失败: %w", err)
 	}
-
-	// 加载策略
+	enforcer.SetAdapter(adapter)
+	// casbin_rule由SyncPolicy在修改业务表的事务中维护，enforcer只修改内存中的策略
+	enforcer.EnableAutoSave(false)
+	// 域为*的g策略（角色继承）在所有租户内生效
+	enforcer.AddNamedDomainMatchingFunc("g", "keyMatch", util.KeyMatch)
+	// 资源匹配：path模式为keyMatch，template模式为keyMatch2
+	enforcer.AddFunction("matchResource", resourceMatchFunc())
+	// 权限上的属性条件（IP、时间、所有权）
+	enforcer.AddFunction("matchCondition", condition.CasbinFunc)
+
+	// 加载策略；旧版本保存的策略字段数与模型不一致，加载失败时以空策略启动，
+	// 启动时的ReconcilePolicy会按数据库中的角色和权限修正
 	if err := enforcer.LoadPolicy(); err != nil {
-		return fmt.Errorf("加载Casbin策略失败: %w", err)
+		logger.Logger.Warn("加载Casbin策略失败，将在同步时重建", zap.Error(err))
+		enforcer.ClearPolicy()
 	}
 
 	global.Enforcer = enforcer
@@ -94,17 +128,22 @@ func InitRolesAndPermissions() error {
 	}
 
 	// 2. 创建预设权限
+	// user角色查看自己信息的权限（owner条件：路径中的用户ID为本人）
+	viewSelf := models.Permission{Resource: "/api/v1/users/*", Action: "GET", Conditions: "owner", Description: "查看自己的用户详情"}
+	if config.AppConfig.Permission.TemplateMode() {
+		viewSelf.Resource = "/api/v1/users/:id"
+	}
 	permissions := []models.Permission{
 		{Resource: "/api/v1/users/", Action: "GET", Description: "查看用户列表"},
 		{Resource: "/api/v1/users/register", Action: "POST", Description: "创建用户"},
 		{Resource: "/api/v1/users/*", Action: "GET", Description: "查看用户详情"},
+		viewSelf,
 		{Resource: "/api/v1/users/*", Action: "PUT", Description: "更新用户信息"},
 		{Resource: "/api/v1/users/*", Action: "DELETE", Description: "删除用户"},
-		{Resource: "/api/v1/users/:id/password", Action: "PUT", Description: "更新用户密码"},
-		{Resource: "/api/v1/roles/*", Action: "GET", Description: "查看角色列表"},
-		{Resource: "/api/v1/roles/*", Action: "POST", Description: "创建角色"},
+		{Resource: "/api/v1/roles/", Action: "GET", Description: "查看角色列表"},
+		{Resource: "/api/v1/roles/", Action: "POST", Description: "创建角色"},
+		{Resource: "/api/v1/roles/", Action: "PUT", Description: "更新角色信息"},
 		{Resource: "/api/v1/roles/*", Action: "GET", Description: "查看角色详情"},
-		{Resource: "/api/v1/roles/*", Action: "PUT", Description: "更新角色信息"},
 		{Resource: "/api/v1/roles/*", Action: "DELETE", Description: "删除角色"},
 		{Resource: "/api/v1/permissions/policy", Action: "POST", Description: "添加权限策略"},
 		{Resource: "/api/v1/permissions/policy", Action: "DELETE", Description: "删除权限策略"},
@@ -113,11 +152,36 @@ func InitRolesAndPermissions() error {
 		{Resource: "/api/v1/test", Action: "GET", Description: "示例接口"},
 		{Resource: "/api/v1/permissions/role-permission", Action: "DELETE", Description: "角色权限关联删除"},
 		{Resource: "/api/v1/permissions/role-permission", Action: "POST", Description: "角色权限关联添加"},
+		{Resource: "/api/v1/service-accounts/", Action: "GET", Description: "查看服务账号列表"},
+		{Resource: "/api/v1/service-accounts/", Action: "POST", Description: "创建服务账号"},
+		{Resource: "/api/v1/service-accounts/*", Action: "DELETE", Description: "删除服务账号及吊销服务账号令牌"},
+		{Resource: "/api/v1/service-accounts/*", Action: "GET", Description: "查看服务账号令牌"},
+		{Resource: "/api/v1/service-accounts/*", Action: "POST", Description: "创建服务账号令牌"},
+		{Resource: "/api/v1/audit-logs", Action: "GET", Description: "查看审计日志"},
+		{Resource: "/api/v1/impersonations", Action: "POST", Description: "模拟用户登录"},
+		{Resource: "/api/v1/permissions/check", Action: "POST", Description: "检查权限并解释原因"},
+		{Resource: "/api/v1/permissions/check/batch", Action: "POST", Description: "批量检查权限并解释原因"},
+		{Resource: "/api/v1/permissions/export", Action: "GET", Description: "导出权限配置"},
+		{Resource: "/api/v1/permissions/import", Action: "POST", Description: "导入权限配置"},
+		{Resource: "/api/v1/permissions/reconcile", Action: "GET", Description: "检查策略漂移"},
+		{Resource: "/api/v1/permissions/reconcile", Action: "POST", Description: "修复策略漂移"},
+		{Resource: "/api/v1/permissions/role-grants", Action: "GET", Description: "查看临时授权"},
+		{Resource: "/api/v1/permissions/role-grants", Action: "POST", Description: "临时授予用户角色"},
+		{Resource: "/api/v1/tenants/", Action: "GET", Description: "获取租户列表"},
+		{Resource: "/api/v1/tenants/", Action: "POST", Description: "创建租户"},
+		{Resource: "/api/v1/tenants/*", Action: "GET", Description: "获取租户详情"},
+		{Resource: "/api/v1/tenants/*", Action: "DELETE", Description: "删除租户"},
+		{Resource: "/api/v1/tenant-members/", Action: "GET", Description: "获取当前租户成员"},
+		{Resource: "/api/v1/tenant-members/", Action: "PUT", Description: "设置当前租户成员角色"},
+	}
+	// 按路由模板检查时，权限目录来自路由表（permission.auto_register）和迁移工具，这里只创建user角色需要的权限
+	if config.AppConfig.Permission.TemplateMode() {
+		permissions = []models.Permission{viewSelf}
 	}
 
 	for _, permission := range permissions {
 		var existingPermission models.Permission
-		if err := DB.Where("resource = ? AND action = ?", permission.Resource, permission.Action).First(&existingPermission).Error; err != nil && err.Error() != "record not found" {
+		if err := DB.Where("resource = ? AND action = ? AND conditions = ?", permission.Resource, permission.Action, permission.Conditions).First(&existingPermission).Error; err != nil && err.Error() != "record not found" {
 			return fmt.Errorf("查询权限失败: %w", err)
 		} else if err == nil {
 			// 权限已存在，更新描述
@@ -157,9 +221,9 @@ func InitRolesAndPermissions() error {
 		return fmt.Errorf("为admin角色分配权限失败: %w", err)
 	}
 
-	// 为user角色分配查看自己信息的权限
+	// 为user角色分配查看自己信息的权限（owner条件：路径中的用户ID为本人）
 	var viewSelfPermission models.Permission
-	if err := DB.Where("resource = ? AND action = ?", "/api/v1/users/*", "GET").First(&viewSelfPermission).Error; err != nil {
+	if err := DB.Where("resource = ? AND action = ? AND conditions = ?", viewSelf.Resource, viewSelf.Action, viewSelf.Conditions).First(&viewSelfPermission).Error; err != nil {
 		return fmt.Errorf("获取查看用户详情权限失败: %w", err)
 	}
 
@@ -177,20 +241,9 @@ func InitRolesAndPermissions() error {
 		return fmt.Errorf("为user角色添加权限失败: %w", err)
 	}
 
-	// 同步到Casbin
-	if _, err := global.Enforcer.AddPolicy("user", viewSelfPermission.Resource, viewSelfPermission.Action); err != nil {
-		logger.Logger.Error("同步权限到Casbin失败", zap.String("resource", viewSelfPermission.Resource), zap.String("action", viewSelfPermission.Action), zap.Error(err))
-	}
-
-	// 保存Casbin策略
-	if err := global.Enforcer.SavePolicy(); err != nil {
-		logger.Logger.Error("保存Casbin策略失败", zap.Error(err))
-		return fmt.Errorf("保存Casbin策略失败: %w", err)
-	}
-
-	// 4. 刷新Casbin策略
-	if err := global.Enforcer.LoadPolicy(); err != nil {
-		return fmt.Errorf("刷新Casbin策略失败: %w", err)
+	// 4. 同步预设角色的Casbin策略
+	if err := SyncCasbinPolicyScope(ScopeRoles("admin", "user")); err != nil {
+		return fmt.Errorf("同步Casbin策略失败: %w", err)
 	}
 
 	logger.Logger.Info("角色和权限初始化成功")
@@ -0,0 +1,31 @@
+package database
+
+import (
+	"github.com/casbin/casbin/v2/util"
+
+	"github.com/GZ-Alinx/autops/internal/config"
+)
+
+// ResourceMatcher 当前匹配模式下资源使用的匹配函数：path模式为keyMatch，template模式为keyMatch2
+func ResourceMatcher() string {
+	if config.AppConfig.Permission.TemplateMode() {
+		return "keyMatch2"
+	}
+	return "keyMatch"
+}
+
+// ResourceMatch 按当前匹配模式判断请求资源（请求路径或路由模板）是否匹配权限资源
+func ResourceMatch(obj, resource string) bool {
+	if config.AppConfig.Permission.TemplateMode() {
+		return util.KeyMatch2(obj, resource)
+	}
+	return util.KeyMatch(obj, resource)
+}
+
+// resourceMatchFunc 供Casbin匹配器调用的资源匹配函数：matchResource(r.obj, p.obj)
+func resourceMatchFunc() func(args ...interface{}) (interface{}, error) {
+	if config.AppConfig.Permission.TemplateMode() {
+		return util.KeyMatch2Func
+	}
+	return util.KeyMatchFunc
+}
@@ -0,0 +1,174 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/casbin/casbin/v2/util"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/internal/logger"
+)
+
+// PermissionRewrite 迁移到路由模板时对一条权限的改写
+type PermissionRewrite struct {
+	PermissionID uint     // 权限ID
+	Action       string   // HTTP方法
+	Conditions   string   // 属性条件
+	From         string   // 原资源
+	To           []string // 原资源在path模式下覆盖的路由模板，多个时拆分为多条权限；为空表示没有匹配的路由，保持不变
+}
+
+// Changed 是否需要改写
+func (r PermissionRewrite) Changed() bool {
+	return len(r.To) > 0 && !(len(r.To) == 1 && r.To[0] == r.From)
+}
+
+// PlanPermissionTemplates 计算把权限资源改写为路由模板的方案：按path模式（keyMatch）的语义找出每条权限
+// 当前覆盖的路由，改写后的权限覆盖的路由与原来完全一致，不会扩大或缩小任何角色的访问范围
+func PlanPermissionTemplates(routes []RoutePermission) ([]PermissionRewrite, error) {
+	var permissions []models.Permission
+	if err := DB.Order("id").Find(&permissions).Error; err != nil {
+		return nil, fmt.Errorf("查询权限失败: %w", err)
+	}
+
+	plan := make([]PermissionRewrite, 0, len(permissions))
+	for _, permission := range permissions {
+		rewrite := PermissionRewrite{
+			PermissionID: permission.ID,
+			Action:       permission.Action,
+			Conditions:   permission.Conditions,
+			From:         permission.Resource,
+		}
+		seen := make(map[string]bool)
+		for _, route := range routes {
+			if route.Method != permission.Action || seen[route.Path] {
+				continue
+			}
+			// 已经是路由模板的权限只对应该路由本身
+			if route.Path == permission.Resource {
+				rewrite.To = []string{route.Path}
+				break
+			}
+			if pathResource(route.Path) == permission.Resource || util.KeyMatch(routeSample(route.Path), permission.Resource) {
+				seen[route.Path] = true
+				rewrite.To = append(rewrite.To, route.Path)
+			}
+		}
+		sort.Strings(rewrite.To)
+		plan = append(plan, rewrite)
+	}
+	return plan, nil
+}
+
+// ApplyPermissionTemplates 在一个事务中执行改写方案：原权限改写为第一个路由模板，其余模板创建新权限并复制角色关联；
+// 目标权限已存在时合并角色关联（拒绝优先）并删除原权限。casbin_rule在同一事务中同步
+func ApplyPermissionTemplates(plan []PermissionRewrite) error {
+	return UpdatePolicy(func(tx *gorm.DB) (PolicyScope, error) {
+		for _, rewrite := range plan {
+			if !rewrite.Changed() {
+				continue
+			}
+			var permission models.Permission
+			if err := tx.First(&permission, rewrite.PermissionID).Error; err != nil {
+				return PolicyScope{}, fmt.Errorf("查询权限%d失败: %w", rewrite.PermissionID, err)
+			}
+			var links []models.RolePermission
+			if err := tx.Where("permission_id = ?", permission.ID).Find(&links).Error; err != nil {
+				return PolicyScope{}, fmt.Errorf("查询权限%d的角色关联失败: %w", permission.ID, err)
+			}
+
+			reused := false
+			for _, template := range rewrite.To {
+				var target models.Permission
+				result := tx.Where("resource = ? AND action = ? AND conditions = ? AND id <> ?", template, permission.Action, permission.Conditions, permission.ID).Limit(1).Find(&target)
+				if result.Error != nil {
+					return PolicyScope{}, fmt.Errorf("查询权限失败: %w", result.Error)
+				}
+				switch {
+				case result.RowsAffected > 0:
+					// 目标权限已存在，合并角色关联
+				case !reused:
+					if err := tx.Model(&permission).Updates(map[string]interface{}{"resource": template, "stale": false}).Error; err != nil {
+						return PolicyScope{}, fmt.Errorf("改写权限%d失败: %w", permission.ID, err)
+					}
+					reused = true
+					logger.Logger.Info("权限资源改写为路由模板", zap.Uint("permissionID", permission.ID), zap.String("from", rewrite.From), zap.String("to", template))
+					continue
+				default:
+					target = models.Permission{
+						Resource:    template,
+						Action:      permission.Action,
+						Conditions:  permission.Conditions,
+						Description: permission.Description,
+					}
+					if err := tx.Create(&target).Error; err != nil {
+						return PolicyScope{}, fmt.Errorf("创建权限失败: %w", err)
+					}
+					logger.Logger.Info("权限拆分出新的路由模板", zap.Uint("permissionID", permission.ID), zap.Uint("newPermissionID", target.ID), zap.String("from", rewrite.From), zap.String("to", template))
+				}
+				if err := mergeRoleLinks(tx, links, target.ID); err != nil {
+					return PolicyScope{}, err
+				}
+			}
+
+			// 所有模板都已有对应的权限，原权限合并后删除
+			if !reused {
+				if err := tx.Unscoped().Where("permission_id = ?", permission.ID).Delete(&models.RolePermission{}).Error; err != nil {
+					return PolicyScope{}, fmt.Errorf("删除权限%d的角色关联失败: %w", permission.ID, err)
+				}
+				if err := tx.Delete(&permission).Error; err != nil {
+					return PolicyScope{}, fmt.Errorf("删除权限%d失败: %w", permission.ID, err)
+				}
+				logger.Logger.Info("权限已合并到现有的路由模板权限", zap.Uint("permissionID", permission.ID), zap.String("from", rewrite.From), zap.Strings("to", rewrite.To))
+			}
+		}
+		return ScopeAll(), nil
+	})
+}
+
+// mergeRoleLinks 把角色关联复制到目标权限，目标已有同一角色的关联时拒绝优先
+func mergeRoleLinks(tx *gorm.DB, links []models.RolePermission, permissionID uint) error {
+	for _, link := range links {
+		var existing models.RolePermission
+		result := tx.Where("role_id = ? AND permission_id = ?", link.RoleID, permissionID).Limit(1).Find(&existing)
+		if result.Error != nil {
+			return fmt.Errorf("查询角色关联失败: %w", result.Error)
+		}
+		if result.RowsAffected > 0 {
+			if link.Eft() == models.EffectDeny && existing.Eft() != models.EffectDeny {
+				if err := tx.Model(&models.RolePermission{}).Where("role_id = ? AND permission_id = ?", link.RoleID, permissionID).Update("effect", models.EffectDeny).Error; err != nil {
+					return fmt.Errorf("更新角色关联失败: %w", err)
+				}
+			}
+			continue
+		}
+		// 清理软删除的同主键记录
+		if err := tx.Unscoped().Where("role_id = ? AND permission_id = ?", link.RoleID, permissionID).Delete(&models.RolePermission{}).Error; err != nil {
+			return fmt.Errorf("清理角色关联失败: %w", err)
+		}
+		if err := tx.Create(&models.RolePermission{RoleID: link.RoleID, PermissionID: permissionID, Effect: link.Eft()}).Error; err != nil {
+			return fmt.Errorf("复制角色关联失败: %w", err)
+		}
+	}
+	return nil
+}
+
+// FormatPermissionRewrite 改写方案的文本描述
+func FormatPermissionRewrite(r PermissionRewrite) string {
+	subject := fmt.Sprintf("#%d %s %s", r.PermissionID, r.Action, r.From)
+	if r.Conditions != "" {
+		subject += " [" + r.Conditions + "]"
+	}
+	switch {
+	case len(r.To) == 0:
+		return subject + " -> 没有匹配的路由，保持不变"
+	case !r.Changed():
+		return subject + " -> 已是路由模板"
+	default:
+		return subject + " -> " + strings.Join(r.To, ", ")
+	}
+}
@@ -0,0 +1,190 @@
+package database
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/GZ-Alinx/autops/internal/authcache"
+	"github.com/GZ-Alinx/autops/internal/config"
+	"github.com/GZ-Alinx/autops/internal/global"
+	"github.com/GZ-Alinx/autops/internal/logger"
+)
+
+// PolicyDrift 业务表（用户角色、角色继承、角色权限）与casbin_rule、本实例内存中策略之间的差异
+type PolicyDrift struct {
+	Missing       []string  `json:"missing"`        // 业务表中有、casbin_rule中缺少的规则
+	Extra         []string  `json:"extra"`          // casbin_rule中多出的规则
+	Duplicates    int       `json:"duplicates"`     // casbin_rule中重复的行
+	MemoryMissing []string  `json:"memory_missing"` // 本实例内存中缺少的规则
+	MemoryExtra   []string  `json:"memory_extra"`   // 本实例内存中多出的规则
+	Fixed         bool      `json:"fixed"`          // 是否已修复
+	CheckedAt     time.Time `json:"checked_at"`
+}
+
+// Drifted 是否存在差异
+func (d *PolicyDrift) Drifted() bool {
+	return len(d.Missing) > 0 || len(d.Extra) > 0 || d.Duplicates > 0 || d.memoryDrifted()
+}
+
+// memoryDrifted 内存中的策略是否与业务表不一致
+func (d *PolicyDrift) memoryDrifted() bool {
+	return len(d.MemoryMissing) > 0 || len(d.MemoryExtra) > 0
+}
+
+// ReconcilePolicy 按业务表检查全部Casbin规则，fix为true时在事务中修正casbin_rule，
+// 应用到内存并通知其他实例；本实例内存中的策略不一致时从数据库重新加载
+func ReconcilePolicy(fix bool) (*PolicyDrift, error) {
+	drift := &PolicyDrift{CheckedAt: time.Now()}
+	var delta *PolicyDelta
+	check := func(tx *gorm.DB) error {
+		desired, err := desiredRules(tx, ScopeAll())
+		if err != nil {
+			return err
+		}
+		current, err := currentRules(tx, ScopeAll())
+		if err != nil {
+			return err
+		}
+		var staleIDs []uint
+		delta, staleIDs = diffRules(desired, current)
+		drift.Missing = ruleStrings(delta.added)
+		drift.Extra = ruleStrings(delta.removed)
+		drift.Duplicates = len(staleIDs) - len(delta.removed)
+		if drift.MemoryMissing, drift.MemoryExtra, err = memoryDrift(desired); err != nil {
+			return err
+		}
+		if !fix {
+			return nil
+		}
+		return writeDelta(tx, delta, staleIDs)
+	}
+
+	if !fix {
+		return drift, check(DB)
+	}
+	if err := DB.Transaction(check); err != nil {
+		return nil, err
+	}
+	if !drift.Drifted() {
+		return drift, nil
+	}
+	delta.Apply()
+	if drift.memoryDrifted() {
+		if err := global.Enforcer.LoadPolicy(); err != nil {
+			return nil, err
+		}
+		authcache.Purge()
+	}
+	drift.Fixed = true
+	return drift, nil
+}
+
+// memoryDrift 比较内存中的策略与目标规则
+func memoryDrift(desired map[string]policyRule) (missing, extra []string, err error) {
+	policies, err := global.Enforcer.GetPolicy()
+	if err != nil {
+		return nil, nil, err
+	}
+	groupings, err := global.Enforcer.GetGroupingPolicy()
+	if err != nil {
+		return nil, nil, err
+	}
+	memory := make(map[string]bool, len(policies)+len(groupings))
+	var extraRules []policyRule
+	for _, rules := range []struct {
+		ptype  string
+		values [][]string
+	}{{"p", policies}, {"g", groupings}} {
+		for _, values := range rules.values {
+			rule := policyRule{Ptype: rules.ptype, Values: values}
+			memory[rule.key()] = true
+			if _, ok := desired[rule.key()]; !ok {
+				extraRules = append(extraRules, rule)
+			}
+		}
+	}
+	var missingRules []policyRule
+	for key, rule := range desired {
+		if !memory[key] {
+			missingRules = append(missingRules, rule)
+		}
+	}
+	sortRules(missingRules)
+	sortRules(extraRules)
+	return ruleStrings(missingRules), ruleStrings(extraRules), nil
+}
+
+// ruleStrings 规则的CSV格式
+func ruleStrings(rules []policyRule) []string {
+	lines := make([]string, len(rules))
+	for i, rule := range rules {
+		lines[i] = rule.String()
+	}
+	return lines
+}
+
+// reconciler 定期检查策略漂移的后台任务
+var reconciler struct {
+	sync.Mutex
+	stop chan struct{}
+	done chan struct{}
+}
+
+// StartPolicyReconciler 按permission.reconcile_minutes定期检查策略漂移，reconcile_fix开启时同时修复；间隔为0时不启动
+func StartPolicyReconciler() {
+	cfg := config.AppConfig.Permission
+	if cfg.ReconcileMinutes <= 0 {
+		return
+	}
+	reconciler.Lock()
+	defer reconciler.Unlock()
+	if reconciler.stop != nil {
+		return
+	}
+	stop, done := make(chan struct{}), make(chan struct{})
+	reconciler.stop, reconciler.done = stop, done
+	interval := time.Duration(cfg.ReconcileMinutes) * time.Minute
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+			drift, err := ReconcilePolicy(cfg.ReconcileFix)
+			if err != nil {
+				logger.Logger.Error("检查策略漂移失败", zap.Error(err))
+				continue
+			}
+			if drift.Drifted() {
+				logger.Logger.Warn("Casbin策略与业务表不一致",
+					zap.Bool("fixed", drift.Fixed),
+					zap.Strings("missing", drift.Missing),
+					zap.Strings("extra", drift.Extra),
+					zap.Int("duplicates", drift.Duplicates),
+					zap.Int("memory_missing", len(drift.MemoryMissing)),
+					zap.Int("memory_extra", len(drift.MemoryExtra)))
+			}
+		}
+	}()
+	logger.Logger.Info("策略漂移检查已启动", zap.Duration("interval", interval), zap.Bool("fix", cfg.ReconcileFix))
+}
+
+// StopPolicyReconciler 停止定期检查
+func StopPolicyReconciler() {
+	reconciler.Lock()
+	defer reconciler.Unlock()
+	if reconciler.stop == nil {
+		return
+	}
+	close(reconciler.stop)
+	<-reconciler.done
+	reconciler.stop, reconciler.done = nil, nil
+}
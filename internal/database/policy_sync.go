@@ -0,0 +1,383 @@
+package database
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	gormadapter "github.com/casbin/gorm-adapter/v3"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/internal/authcache"
+	"github.com/GZ-Alinx/autops/internal/global"
+	"github.com/GZ-Alinx/autops/internal/logger"
+)
+
+// PolicyScope 需要同步的Casbin规则范围
+type PolicyScope struct {
+	All   bool     // 全部规则
+	Users []string // 这些用户在各租户的用户角色（g规则）
+	Roles []string // 这些角色的权限（p规则）、继承关系，以及成员的用户角色
+}
+
+// ScopeAll 全部规则
+func ScopeAll() PolicyScope {
+	return PolicyScope{All: true}
+}
+
+// ScopeUsers 指定用户的用户角色
+func ScopeUsers(usernames ...string) PolicyScope {
+	return PolicyScope{Users: usernames}
+}
+
+// ScopeRoles 指定角色的权限、继承关系和成员
+func ScopeRoles(names ...string) PolicyScope {
+	return PolicyScope{Roles: names}
+}
+
+// Merge 合并两个范围
+func (s PolicyScope) Merge(other PolicyScope) PolicyScope {
+	return PolicyScope{
+		All:   s.All || other.All,
+		Users: append(append([]string{}, s.Users...), other.Users...),
+		Roles: append(append([]string{}, s.Roles...), other.Roles...),
+	}
+}
+
+// empty 范围内没有任何规则
+func (s PolicyScope) empty() bool {
+	return !s.All && len(s.Users) == 0 && len(s.Roles) == 0
+}
+
+// policyRule 一条Casbin规则
+type policyRule struct {
+	Ptype  string
+	Values []string
+}
+
+// key 规则的唯一标识
+func (r policyRule) key() string {
+	return r.Ptype + "\x00" + strings.Join(r.Values, "\x00")
+}
+
+// String 以Casbin CSV格式输出，用于日志和漂移报告
+func (r policyRule) String() string {
+	return r.Ptype + ", " + strings.Join(r.Values, ", ")
+}
+
+// casbinRule 转换为casbin_rule表的行
+func (r policyRule) casbinRule() gormadapter.CasbinRule {
+	line := gormadapter.CasbinRule{Ptype: r.Ptype}
+	fields := []*string{&line.V0, &line.V1, &line.V2, &line.V3, &line.V4, &line.V5}
+	for i, value := range r.Values {
+		*fields[i] = value
+	}
+	return line
+}
+
+// ruleFromCasbin 从casbin_rule表的行转换，p规则固定6个字段，g规则固定3个字段
+func ruleFromCasbin(line gormadapter.CasbinRule) policyRule {
+	values := []string{line.V0, line.V1, line.V2, line.V3, line.V4, line.V5}
+	if strings.HasPrefix(line.Ptype, "g") {
+		values = values[:3]
+	}
+	return policyRule{Ptype: line.Ptype, Values: values}
+}
+
+// PolicyDelta 一次同步对Casbin规则的修改，事务提交后通过Apply应用到内存中的策略
+type PolicyDelta struct {
+	added   []policyRule
+	removed []policyRule
+}
+
+// Empty 没有任何修改
+func (d *PolicyDelta) Empty() bool {
+	return d == nil || (len(d.added) == 0 && len(d.removed) == 0)
+}
+
+// Apply 把修改应用到内存中的策略，并通过watcher增量通知其他实例。
+// 全部修改在enforcer的写锁内完成，请求不会看到只应用了一部分的策略；应用失败时从数据库重新加载
+func (d *PolicyDelta) Apply() {
+	if d.Empty() || global.Enforcer == nil {
+		return
+	}
+	if err := d.apply(); err != nil {
+		logger.Logger.Error("应用Casbin策略变更失败，重新加载全部策略", zap.Error(err))
+		if err := global.Enforcer.LoadPolicy(); err != nil {
+			logger.Logger.Error("重新加载Casbin策略失败", zap.Error(err))
+		}
+		authcache.Purge()
+		return
+	}
+	for _, rules := range []map[string][][]string{groupRules(d.removed), groupRules(d.added)} {
+		for ptype, values := range rules {
+			if strings.HasPrefix(ptype, "g") {
+				authcache.InvalidateGrouping(values)
+			}
+		}
+	}
+	logger.Logger.Info("权限策略同步成功", zap.Int("added", len(d.added)), zap.Int("removed", len(d.removed)))
+}
+
+// apply 在写锁内先删除再新增
+func (d *PolicyDelta) apply() error {
+	lock := global.Enforcer.GetLock()
+	lock.Lock()
+	defer lock.Unlock()
+
+	e := global.Enforcer.Enforcer
+	for ptype, rules := range groupRules(d.removed) {
+		var err error
+		if strings.HasPrefix(ptype, "g") {
+			_, err = e.RemoveNamedGroupingPolicies(ptype, rules)
+		} else {
+			_, err = e.RemoveNamedPolicies(ptype, rules)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	for ptype, rules := range groupRules(d.added) {
+		var err error
+		if strings.HasPrefix(ptype, "g") {
+			_, err = e.AddNamedGroupingPoliciesEx(ptype, rules)
+		} else {
+			_, err = e.AddNamedPoliciesEx(ptype, rules)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// groupRules 按策略类型分组
+func groupRules(rules []policyRule) map[string][][]string {
+	groups := make(map[string][][]string)
+	for _, rule := range rules {
+		groups[rule.Ptype] = append(groups[rule.Ptype], rule.Values)
+	}
+	return groups
+}
+
+// SyncPolicy 在事务tx中按业务表重新计算scope范围内的Casbin规则，把差异写入casbin_rule。
+// 业务表的修改和casbin_rule的修改在同一事务中提交或回滚；返回的差异需要在提交后调用Apply
+func SyncPolicy(tx *gorm.DB, scope PolicyScope) (*PolicyDelta, error) {
+	if scope.empty() {
+		return &PolicyDelta{}, nil
+	}
+	desired, err := desiredRules(tx, scope)
+	if err != nil {
+		return nil, err
+	}
+	current, err := currentRules(tx, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	delta, staleIDs := diffRules(desired, current)
+	if err := writeDelta(tx, delta, staleIDs); err != nil {
+		return nil, err
+	}
+	return delta, nil
+}
+
+// writeDelta 删除casbin_rule中多余的行并插入缺少的规则
+func writeDelta(tx *gorm.DB, delta *PolicyDelta, staleIDs []uint) error {
+	if len(staleIDs) > 0 {
+		if err := tx.Where("id IN ?", staleIDs).Delete(&gormadapter.CasbinRule{}).Error; err != nil {
+			return err
+		}
+	}
+	if len(delta.added) > 0 {
+		lines := make([]gormadapter.CasbinRule, len(delta.added))
+		for i, rule := range delta.added {
+			lines[i] = rule.casbinRule()
+		}
+		if err := tx.CreateInBatches(lines, 100).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UpdatePolicy 在一个事务中执行fn对业务表的修改并同步fn返回范围内的Casbin规则，提交后应用到内存
+func UpdatePolicy(fn func(tx *gorm.DB) (PolicyScope, error)) error {
+	return UpdatePolicyIn(DB, fn)
+}
+
+// UpdatePolicyIn 同UpdatePolicy，使用仓库持有的db开启事务。db不能是尚未提交的事务，否则内存会先于数据库变更
+func UpdatePolicyIn(db *gorm.DB, fn func(tx *gorm.DB) (PolicyScope, error)) error {
+	var delta *PolicyDelta
+	err := db.Transaction(func(tx *gorm.DB) error {
+		scope, err := fn(tx)
+		if err != nil {
+			return err
+		}
+		delta, err = SyncPolicy(tx, scope)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	delta.Apply()
+	return nil
+}
+
+// SyncCasbinPolicyScope 按已提交的业务表同步指定范围的Casbin规则，用于业务表已在别处修改的情况
+func SyncCasbinPolicyScope(scope PolicyScope) error {
+	return UpdatePolicy(func(*gorm.DB) (PolicyScope, error) {
+		return scope, nil
+	})
+}
+
+// SyncCasbinPolicy 同步全部Casbin规则（包括用户-角色和角色-权限关联），只修改有差异的规则
+func SyncCasbinPolicy() error {
+	return SyncCasbinPolicyScope(ScopeAll())
+}
+
+// diffRules 计算当前规则到目标规则的差异；current中的重复行和不在目标中的行返回其ID
+func diffRules(desired map[string]policyRule, current []gormadapter.CasbinRule) (*PolicyDelta, []uint) {
+	delta := &PolicyDelta{}
+	var staleIDs []uint
+	seen := make(map[string]bool, len(current))
+	for _, line := range current {
+		rule := ruleFromCasbin(line)
+		key := rule.key()
+		if seen[key] {
+			staleIDs = append(staleIDs, line.ID)
+			continue
+		}
+		seen[key] = true
+		if _, ok := desired[key]; !ok {
+			staleIDs = append(staleIDs, line.ID)
+			delta.removed = append(delta.removed, rule)
+		}
+	}
+	for key, rule := range desired {
+		if !seen[key] {
+			delta.added = append(delta.added, rule)
+		}
+	}
+	sortRules(delta.added)
+	sortRules(delta.removed)
+	return delta, staleIDs
+}
+
+// sortRules 按CSV格式排序，使日志和报告稳定
+func sortRules(rules []policyRule) {
+	sort.Slice(rules, func(i, j int) bool { return rules[i].String() < rules[j].String() })
+}
+
+// currentRules 读取casbin_rule中scope范围内的行
+func currentRules(tx *gorm.DB, scope PolicyScope) ([]gormadapter.CasbinRule, error) {
+	query := tx.Model(&gormadapter.CasbinRule{})
+	if !scope.All {
+		users, roles := nonEmpty(scope.Users), nonEmpty(scope.Roles)
+		// 用户角色：g, 用户, 角色, 租户；角色继承：g, 子角色, 父角色, *；角色权限：p, 角色, ...
+		query = query.Where(
+			tx.Where("ptype = ? AND v2 <> ? AND (v0 IN ? OR v1 IN ?)", "g", models.AllTenants, users, roles).
+				Or("ptype = ? AND v2 = ? AND (v0 IN ? OR v1 IN ?)", "g", models.AllTenants, roles, roles).
+				Or("ptype = ? AND v0 IN ?", "p", roles))
+	}
+	var lines []gormadapter.CasbinRule
+	if err := query.Order("id").Find(&lines).Error; err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+// nonEmpty IN查询需要非空列表，空列表时使用不会匹配任何名称的占位值
+func nonEmpty(names []string) []string {
+	if len(names) == 0 {
+		return []string{""}
+	}
+	return names
+}
+
+// desiredRules 按业务表计算scope范围内应有的规则
+func desiredRules(tx *gorm.DB, scope PolicyScope) (map[string]policyRule, error) {
+	rules := make(map[string]policyRule)
+	add := func(rule policyRule) {
+		rules[rule.key()] = rule
+	}
+	users, roles := nonEmpty(scope.Users), nonEmpty(scope.Roles)
+
+	// 1. 默认租户的用户角色 (g, 用户, 角色, default)
+	var userRoles []struct{ Username, RoleName string }
+	query := tx.Table("user_roles").
+		Select("users.username, roles.name AS role_name").
+		Joins("JOIN users ON users.id = user_roles.user_id AND users.deleted_at IS NULL").
+		Joins("JOIN roles ON roles.id = user_roles.role_id AND roles.deleted_at IS NULL").
+		Where("user_roles.deleted_at IS NULL").
+		Scopes(models.ActiveUserRoles(time.Now()))
+	if !scope.All {
+		query = query.Where("users.username IN ? OR roles.name IN ?", users, roles)
+	}
+	if err := query.Scan(&userRoles).Error; err != nil {
+		logger.Logger.Error("查询用户角色关联关系失败", zap.Error(err))
+		return nil, err
+	}
+	for _, ur := range userRoles {
+		add(policyRule{Ptype: "g", Values: []string{ur.Username, ur.RoleName, models.DefaultTenantCode}})
+	}
+
+	// 2. 其他租户的用户角色 (g, 用户, 角色, 租户标识)
+	var tenantUserRoles []struct{ Username, RoleName, TenantCode string }
+	query = tx.Table("tenant_user_roles").
+		Select("users.username, roles.name AS role_name, tenants.code AS tenant_code").
+		Joins("JOIN tenants ON tenants.id = tenant_user_roles.tenant_id").
+		Joins("JOIN users ON users.id = tenant_user_roles.user_id AND users.deleted_at IS NULL").
+		Joins("JOIN roles ON roles.id = tenant_user_roles.role_id AND roles.deleted_at IS NULL")
+	if !scope.All {
+		query = query.Where("users.username IN ? OR roles.name IN ?", users, roles)
+	}
+	if err := query.Scan(&tenantUserRoles).Error; err != nil {
+		logger.Logger.Error("查询租户用户角色关联关系失败", zap.Error(err))
+		return nil, err
+	}
+	for _, tur := range tenantUserRoles {
+		add(policyRule{Ptype: "g", Values: []string{tur.Username, tur.RoleName, tur.TenantCode}})
+	}
+
+	// 3. 角色继承关系 (g, 子角色, 父角色, *)，在所有租户内生效
+	var roleParents []struct{ Child, Parent string }
+	query = tx.Table("role_parents").
+		Select("child.name AS child, parent.name AS parent").
+		Joins("JOIN roles child ON child.id = role_parents.role_id AND child.deleted_at IS NULL").
+		Joins("JOIN roles parent ON parent.id = role_parents.parent_id AND parent.deleted_at IS NULL")
+	if !scope.All {
+		query = query.Where("child.name IN ? OR parent.name IN ?", roles, roles)
+	}
+	if err := query.Scan(&roleParents).Error; err != nil {
+		logger.Logger.Error("查询角色继承关系失败", zap.Error(err))
+		return nil, err
+	}
+	for _, rp := range roleParents {
+		add(policyRule{Ptype: "g", Values: []string{rp.Child, rp.Parent, models.AllTenants}})
+	}
+
+	// 4. 角色权限 (p, 角色, *, 资源, 动作, 条件, 效果)，在所有租户内生效
+	var rolePermissions []struct {
+		RoleName, Resource, Action, Conditions, Effect string
+	}
+	query = tx.Table("role_permissions").
+		Select("roles.name AS role_name, permissions.resource, permissions.action, permissions.conditions, role_permissions.effect").
+		Joins("JOIN roles ON roles.id = role_permissions.role_id AND roles.deleted_at IS NULL").
+		Joins("JOIN permissions ON permissions.id = role_permissions.permission_id AND permissions.deleted_at IS NULL").
+		Where("role_permissions.deleted_at IS NULL")
+	if !scope.All {
+		query = query.Where("roles.name IN ?", roles)
+	}
+	if err := query.Scan(&rolePermissions).Error; err != nil {
+		logger.Logger.Error("查询角色权限关联关系失败", zap.Error(err))
+		return nil, err
+	}
+	for _, rp := range rolePermissions {
+		effect := models.RolePermission{Effect: rp.Effect}.Eft()
+		add(policyRule{Ptype: "p", Values: []string{rp.RoleName, models.AllTenants, rp.Resource, rp.Action, rp.Conditions, effect}})
+	}
+	return rules, nil
+}
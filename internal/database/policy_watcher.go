@@ -0,0 +1,60 @@
+package database
+
+import (
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"github.com/GZ-Alinx/autops/internal/config"
+	"github.com/GZ-Alinx/autops/internal/global"
+	"github.com/GZ-Alinx/autops/internal/logger"
+	"github.com/GZ-Alinx/autops/internal/watcher"
+)
+
+var (
+	// policyWatcher 当前使用的watcher，未配置时为nil
+	policyWatcher watcher.Watcher
+	// userNotifier 向其他实例发布用户变化，未配置watcher时为nil
+	userNotifier watcher.UserNotifier
+)
+
+// StartPolicyWatcher 按permission.watcher配置把本实例的策略变更通知其他实例，并接收其他实例的变更；
+// 需要在InitCasbin之后调用
+func StartPolicyWatcher() error {
+	cfg := config.AppConfig.Permission.Watcher
+	w, err := watcher.New(cfg, DB)
+	if err != nil {
+		return err
+	}
+	if w == nil {
+		return nil
+	}
+	notifier, err := watcher.Bind(global.Enforcer, w)
+	if err != nil {
+		w.Close()
+		return fmt.Errorf("启动策略watcher失败: %w", err)
+	}
+	policyWatcher = w
+	userNotifier = notifier
+	logger.Logger.Info("策略watcher已启动", zap.String("driver", cfg.Driver))
+	return nil
+}
+
+// StopPolicyWatcher 停止接收其他实例的策略变更
+func StopPolicyWatcher() {
+	if policyWatcher == nil {
+		return
+	}
+	if err := policyWatcher.Close(); err != nil {
+		logger.Logger.Warn("关闭策略watcher失败", zap.Error(err))
+	}
+	policyWatcher = nil
+	userNotifier = nil
+}
+
+// NotifyUserChanged 通知其他实例用户的账号状态已变化或用户已删除，未配置watcher时不做处理
+func NotifyUserChanged(userIDs ...uint) {
+	if userNotifier != nil {
+		userNotifier.NotifyUserChanged(userIDs...)
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"errors"
 
 	"github.com/GZ-Alinx/autops/business/models"
-	"github.com/GZ-Alinx/autops/internal/global"
 	"github.com/GZ-Alinx/autops/internal/logger"
 	"go.uber.org/zap"
 )
@@ -66,17 +65,12 @@ func updateAdminRolePermissions(roleID uint) error {
 			logger.Logger.Error("添加权限到admin角色失败", zap.Uint("permissionID", permission.ID), zap.Error(err))
 			return errors.New("添加权限到admin角色失败: " + err.Error())
 		}
-
-		// 同步到Casbin
-		if _, err := global.Enforcer.AddPolicy("admin", permission.Resource, permission.Action); err != nil {
-			logger.Logger.Error("同步权限到Casbin失败", zap.String("resource", permission.Resource), zap.String("action", permission.Action), zap.Error(err))
-		}
 	}
 
-	// 保存Casbin策略
-	if err := global.Enforcer.SavePolicy(); err != nil {
-		logger.Logger.Error("保存Casbin策略失败", zap.Error(err))
-		return errors.New("保存Casbin策略失败: " + err.Error())
+	// 同步admin角色的Casbin策略
+	if err := SyncCasbinPolicyScope(ScopeRoles("admin")); err != nil {
+		logger.Logger.Error("同步Casbin策略失败", zap.Error(err))
+		return errors.New("同步Casbin策略失败: " + err.Error())
 	}
 
 	return nil
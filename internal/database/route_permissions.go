@@ -0,0 +1,168 @@
+package database
+
+import (
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/internal/config"
+	"github.com/GZ-Alinx/autops/internal/logger"
+)
+
+// RoutePermission 需要权限检查的路由
+type RoutePermission struct {
+	Method      string // HTTP方法
+	Path        string // 路由模板，如/api/v1/users/:id
+	Description string // 权限描述
+}
+
+// RouteResource 将路由模板转换为权限资源：template模式直接使用路由模板；
+// path模式转换为keyMatch使用的资源，从第一个路径参数起替换为*
+func RouteResource(path string) string {
+	if config.AppConfig.Permission.TemplateMode() {
+		return path
+	}
+	return pathResource(path)
+}
+
+// pathResource 路由模板在path模式下对应的资源
+func pathResource(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			return strings.Join(segments[:i], "/") + "/*"
+		}
+	}
+	return path
+}
+
+// routeObject 路由在权限检查时的请求资源：template模式为路由模板本身，path模式为替换了参数的示例路径
+func routeObject(path string) string {
+	if config.AppConfig.Permission.TemplateMode() {
+		return path
+	}
+	return routeSample(path)
+}
+
+// routeSample 将路由模板中的参数替换为示例值，用于判断已有权限是否仍能匹配路由
+func routeSample(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			segments[i] = "0"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// RegisterRoutePermissions 按路由表注册权限：为每个路由创建或更新无条件的权限，新权限授予admin；
+// 没有任何路由能匹配的权限标记为stale（不删除，由管理员确认后处理）
+func RegisterRoutePermissions(routes []RoutePermission) error {
+	// 路径短的在前，多个路由转换为同一资源时使用最短路由的描述
+	sort.SliceStable(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+
+	seen := make(map[string]bool, len(routes))
+	created, updated := 0, 0
+	// 新权限和admin的授权与casbin_rule在同一事务中写入
+	err := UpdatePolicy(func(tx *gorm.DB) (PolicyScope, error) {
+		var adminRole models.Role
+		if err := tx.Where("name = ?", "admin").First(&adminRole).Error; err != nil {
+			logger.Logger.Error("获取admin角色失败", zap.Error(err))
+			return PolicyScope{}, err
+		}
+
+		for _, route := range routes {
+			resource := RouteResource(route.Path)
+			key := route.Method + " " + resource
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			var permission models.Permission
+			result := tx.Where("resource = ? AND action = ? AND conditions = ?", resource, route.Method, "").Limit(1).Find(&permission)
+			if result.Error != nil {
+				logger.Logger.Error("查询权限失败", zap.String("resource", resource), zap.String("action", route.Method), zap.Error(result.Error))
+				return PolicyScope{}, result.Error
+			}
+			if result.RowsAffected > 0 {
+				if permission.Description != route.Description && route.Description != "" {
+					permission.Description = route.Description
+					if err := tx.Save(&permission).Error; err != nil {
+						logger.Logger.Error("更新权限描述失败", zap.Uint("permissionID", permission.ID), zap.Error(err))
+						return PolicyScope{}, err
+					}
+					updated++
+				}
+				continue
+			}
+
+			permission = models.Permission{Resource: resource, Action: route.Method, Description: route.Description}
+			if err := tx.Create(&permission).Error; err != nil {
+				logger.Logger.Error("创建权限失败", zap.String("resource", resource), zap.String("action", route.Method), zap.Error(err))
+				return PolicyScope{}, err
+			}
+			if err := tx.Create(&models.RolePermission{RoleID: adminRole.ID, PermissionID: permission.ID, Effect: models.EffectAllow}).Error; err != nil {
+				logger.Logger.Error("授予admin新权限失败", zap.Uint("permissionID", permission.ID), zap.Error(err))
+				return PolicyScope{}, err
+			}
+			created++
+			logger.Logger.Info("按路由注册权限", zap.String("resource", resource), zap.String("action", route.Method), zap.String("route", route.Path))
+		}
+		if created == 0 {
+			return PolicyScope{}, nil
+		}
+		return ScopeRoles(adminRole.Name), nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// 标记失效的权限：同方法的路由中没有能被该资源匹配的
+	var permissions []models.Permission
+	if err := DB.Find(&permissions).Error; err != nil {
+		logger.Logger.Error("查询权限失败", zap.Error(err))
+		return err
+	}
+	var staleIDs, activeIDs []uint
+	for _, permission := range permissions {
+		matched := false
+		for _, route := range routes {
+			if route.Method == permission.Action && (RouteResource(route.Path) == permission.Resource || ResourceMatch(routeObject(route.Path), permission.Resource)) {
+				matched = true
+				break
+			}
+		}
+		if matched {
+			activeIDs = append(activeIDs, permission.ID)
+			continue
+		}
+		staleIDs = append(staleIDs, permission.ID)
+		logger.Logger.Warn("权限没有对应的路由，已标记为stale", zap.Uint("permissionID", permission.ID), zap.String("resource", permission.Resource), zap.String("action", permission.Action))
+	}
+	if len(staleIDs) > 0 {
+		if err := DB.Model(&models.Permission{}).Where("id IN ?", staleIDs).Update("stale", true).Error; err != nil {
+			return err
+		}
+	}
+	if len(activeIDs) > 0 {
+		if err := DB.Model(&models.Permission{}).Where("id IN ?", activeIDs).Update("stale", false).Error; err != nil {
+			return err
+		}
+	}
+
+	logger.Logger.Info("按路由表注册权限完成",
+		zap.Int("route_count", len(routes)),
+		zap.Int("created", created),
+		zap.Int("updated", updated),
+		zap.Int("stale", len(staleIDs)))
+	return nil
+}
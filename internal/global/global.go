@@ -6,5 +6,5 @@ import (
 
 var (
 	// Enforcer Casbin权限控制实例
-	Enforcer *casbin.Enforcer
+	Enforcer *casbin.SyncedEnforcer
 )
\ No newline at end of file
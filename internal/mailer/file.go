@@ -0,0 +1,66 @@
+package mailer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/GZ-Alinx/autops/internal/logger"
+)
+
+// FileMailer 将邮件写入目录下的.eml文件，用于开发和测试
+type FileMailer struct {
+	from string
+	dir  string
+}
+
+// NewFileMailer 创建文件邮件发送器
+func NewFileMailer(from, dir string) (*FileMailer, error) {
+	if dir == "" {
+		dir = "logs/mail"
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("创建邮件目录失败: %v", err)
+	}
+	return &FileMailer{from: from, dir: dir}, nil
+}
+
+// Send 写入.eml文件
+func (m *FileMailer) Send(msg *Message) error {
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102T150405"), uuid.New().String()[:8])
+	path := filepath.Join(m.dir, name)
+	if err := os.WriteFile(path, buildMIME(m.from, msg), 0o600); err != nil {
+		return err
+	}
+	logger.Logger.Info("邮件已写入文件", zap.Strings("to", msg.To), zap.String("path", path))
+	return nil
+}
+
+// LogMailer 将邮件摘要输出到日志，未配置邮件服务时使用；正文可能包含重置链接等凭据，不写入日志
+type LogMailer struct {
+	from string
+}
+
+// NewLogMailer 创建日志邮件发送器
+func NewLogMailer(from string) *LogMailer {
+	return &LogMailer{from: from}
+}
+
+// Send 输出收件人、主题和正文长度及哈希到日志
+func (m *LogMailer) Send(msg *Message) error {
+	sum := sha256.Sum256([]byte(msg.Body))
+	logger.Logger.Info("邮件未实际发送（mail.driver=log）",
+		zap.String("from", m.from),
+		zap.String("to", strings.Join(msg.To, ",")),
+		zap.String("subject", msg.Subject),
+		zap.Int("bodyLength", len(msg.Body)),
+		zap.String("bodySHA256", hex.EncodeToString(sum[:])))
+	return nil
+}
@@ -0,0 +1,61 @@
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"strings"
+	"time"
+
+	"github.com/GZ-Alinx/autops/internal/config"
+)
+
+// Message 邮件内容
+type Message struct {
+	To      []string
+	Subject string
+	Body    string // 纯文本正文
+}
+
+// Mailer 邮件发送接口
+type Mailer interface {
+	Send(msg *Message) error
+}
+
+// New 根据配置创建邮件发送器，driver为空时使用日志输出
+func New(cfg config.MailConfig) (Mailer, error) {
+	switch strings.ToLower(cfg.Driver) {
+	case "smtp":
+		return NewSMTPMailer(cfg), nil
+	case "file":
+		return NewFileMailer(cfg.From, cfg.FileDir)
+	case "", "log":
+		return NewLogMailer(cfg.From), nil
+	default:
+		return nil, fmt.Errorf("不支持的邮件发送方式: %s", cfg.Driver)
+	}
+}
+
+// NewFromConfig 使用全局配置创建邮件发送器，配置错误时退回日志输出
+func NewFromConfig() Mailer {
+	m, err := New(config.AppConfig.Mail)
+	if err != nil {
+		return NewLogMailer(config.AppConfig.Mail.From)
+	}
+	return m
+}
+
+// buildMIME 生成RFC 5322格式的邮件内容
+func buildMIME(from string, msg *Message) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(msg.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n")
+	buf.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return buf.Bytes()
+}
@@ -0,0 +1,214 @@
+// Package mailertest 提供进程内的SMTP服务器，用于测试邮件发送
+package mailertest
+
+import (
+	"encoding/base64"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/GZ-Alinx/autops/internal/config"
+)
+
+// Message 服务器收到的一封邮件
+type Message struct {
+	From string   // 信封发件人
+	To   []string // 信封收件人
+	Data string   // DATA阶段收到的完整邮件内容
+}
+
+// Server 只实现EHLO、AUTH PLAIN、MAIL、RCPT、DATA和QUIT的SMTP服务器，不支持STARTTLS
+type Server struct {
+	listener net.Listener
+
+	mu       sync.Mutex
+	username string
+	password string
+	rejected map[string]bool
+	messages []Message
+}
+
+// NewServer 启动SMTP服务器，测试结束时关闭
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听失败: %v", err)
+	}
+	s := &Server{
+		listener: listener,
+		rejected: make(map[string]bool),
+	}
+	go s.serve()
+	t.Cleanup(func() { listener.Close() })
+	return s
+}
+
+// Config 指向本服务器的邮件配置
+func (s *Server) Config(from string) config.MailConfig {
+	addr := s.listener.Addr().(*net.TCPAddr)
+	return config.MailConfig{
+		Driver:  "smtp",
+		Host:    addr.IP.String(),
+		Port:    addr.Port,
+		From:    from,
+		TLSMode: "none",
+	}
+}
+
+// RequireAuth 要求客户端使用AUTH PLAIN认证
+func (s *Server) RequireAuth(username, password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.username, s.password = username, password
+}
+
+// Reject 拒绝发往该地址的邮件
+func (s *Server) Reject(rcpt string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rejected[strings.ToLower(rcpt)] = true
+}
+
+// Messages 已收到的邮件
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+func (s *Server) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+// session 单个连接的状态
+type session struct {
+	authed bool
+	msg    Message
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	reply := func(format string, args ...interface{}) bool {
+		return tp.PrintfLine(format, args...) == nil
+	}
+	if !reply("220 mailertest ESMTP") {
+		return
+	}
+
+	var sess session
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			s.mu.Lock()
+			auth := s.username != ""
+			s.mu.Unlock()
+			if auth {
+				reply("250-mailertest")
+				reply("250 AUTH PLAIN")
+			} else {
+				reply("250 mailertest")
+			}
+		case "AUTH":
+			if s.auth(arg) {
+				sess.authed = true
+				reply("235 2.7.0 Authentication successful")
+			} else {
+				reply("535 5.7.8 Authentication credentials invalid")
+			}
+		case "MAIL":
+			if !s.authorized(sess) {
+				reply("530 5.7.0 Authentication required")
+				continue
+			}
+			sess.msg = Message{From: address(arg, "FROM:")}
+			reply("250 2.1.0 Ok")
+		case "RCPT":
+			rcpt := address(arg, "TO:")
+			s.mu.Lock()
+			rejected := s.rejected[strings.ToLower(rcpt)]
+			s.mu.Unlock()
+			if rejected {
+				reply("550 5.1.1 No such user")
+				continue
+			}
+			sess.msg.To = append(sess.msg.To, rcpt)
+			reply("250 2.1.5 Ok")
+		case "DATA":
+			if len(sess.msg.To) == 0 {
+				reply("503 5.5.1 No recipients")
+				continue
+			}
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			sess.msg.Data = string(data)
+			s.mu.Lock()
+			s.messages = append(s.messages, sess.msg)
+			s.mu.Unlock()
+			sess.msg = Message{}
+			reply("250 2.0.0 Ok: queued")
+		case "RSET":
+			sess.msg = Message{}
+			reply("250 2.0.0 Ok")
+		case "NOOP":
+			reply("250 2.0.0 Ok")
+		case "QUIT":
+			reply("221 2.0.0 Bye")
+			return
+		default:
+			reply("502 5.5.2 Command not recognized")
+		}
+	}
+}
+
+// auth 校验AUTH PLAIN的初始响应
+func (s *Server) auth(arg string) bool {
+	mechanism, initial, _ := strings.Cut(arg, " ")
+	if !strings.EqualFold(mechanism, "PLAIN") {
+		return false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(initial)
+	if err != nil {
+		return false
+	}
+	parts := strings.Split(string(decoded), "\x00")
+	if len(parts) != 3 {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.username != "" && parts[1] == s.username && parts[2] == s.password
+}
+
+// authorized 未要求认证或已认证
+func (s *Server) authorized(sess session) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.username == "" || sess.authed
+}
+
+// address 从"FROM:<a@b>"中取出邮箱地址
+func address(arg, prefix string) string {
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return ""
+	}
+	addr, _, _ := strings.Cut(strings.TrimSpace(arg[len(prefix):]), " ")
+	return strings.TrimSuffix(strings.TrimPrefix(addr, "<"), ">")
+}
@@ -0,0 +1,97 @@
+package mailer
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GZ-Alinx/autops/internal/config"
+)
+
+// SMTP加密方式
+const (
+	TLSModeNone     = "none"     // 明文，仅用于本地测试
+	TLSModeStartTLS = "starttls" // 明文连接后升级为TLS（默认，服务器不支持时保持明文）
+	TLSModeTLS      = "tls"      // 直接建立TLS连接（通常为465端口）
+)
+
+// SMTPMailer 通过SMTP服务器发送邮件
+type SMTPMailer struct {
+	cfg config.MailConfig
+}
+
+// NewSMTPMailer 创建SMTP邮件发送器
+func NewSMTPMailer(cfg config.MailConfig) *SMTPMailer {
+	return &SMTPMailer{cfg: cfg}
+}
+
+// Send 发送邮件
+func (m *SMTPMailer) Send(msg *Message) error {
+	addr := net.JoinHostPort(m.cfg.Host, strconv.Itoa(m.cfg.Port))
+	tlsConfig := &tls.Config{ServerName: m.cfg.Host, InsecureSkipVerify: m.cfg.InsecureSkipVerify}
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+
+	var conn net.Conn
+	var err error
+	if strings.EqualFold(m.cfg.TLSMode, TLSModeTLS) {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("连接SMTP服务器失败: %v", err)
+	}
+
+	client, err := smtp.NewClient(conn, m.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("连接SMTP服务器失败: %v", err)
+	}
+	defer client.Close()
+
+	if mode := strings.ToLower(m.cfg.TLSMode); mode == "" || mode == TLSModeStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(tlsConfig); err != nil {
+				return fmt.Errorf("SMTP STARTTLS失败: %v", err)
+			}
+		}
+	}
+
+	if m.cfg.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)); err != nil {
+			return fmt.Errorf("SMTP认证失败: %v", err)
+		}
+	}
+
+	// 信封发件人只能使用邮箱地址，不能带显示名称
+	from := m.cfg.From
+	if addr, err := mail.ParseAddress(from); err == nil {
+		from = addr.Address
+	}
+	if err := client.Mail(from); err != nil {
+		return fmt.Errorf("SMTP发件人被拒绝: %v", err)
+	}
+	for _, to := range msg.To {
+		if err := client.Rcpt(to); err != nil {
+			return fmt.Errorf("SMTP收件人被拒绝: %v", err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(buildMIME(m.cfg.From, msg)); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
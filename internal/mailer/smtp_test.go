@@ -0,0 +1,103 @@
+package mailer
+
+import (
+	"io"
+	"mime"
+	"net/mail"
+	"strings"
+	"testing"
+
+	"github.com/GZ-Alinx/autops/internal/mailer/mailertest"
+)
+
+func TestSMTPMailerSend(t *testing.T) {
+	tests := []struct {
+		name     string
+		username string // 服务器要求的认证用户名，为空表示不要求认证
+		password string // 客户端使用的密码
+		reject   string
+		wantErr  string
+	}{
+		{name: "无需认证"},
+		{name: "PLAIN认证", username: "mailer", password: "s3cret"},
+		{name: "认证失败", username: "mailer", password: "wrong", wantErr: "SMTP认证失败"},
+		{name: "收件人被拒绝", reject: "bob@example.com", wantErr: "SMTP收件人被拒绝"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := mailertest.NewServer(t)
+			cfg := server.Config("Autops <noreply@example.com>")
+			if tt.username != "" {
+				server.RequireAuth(tt.username, "s3cret")
+				cfg.Username, cfg.Password = tt.username, tt.password
+			}
+			if tt.reject != "" {
+				server.Reject(tt.reject)
+			}
+			m, err := New(cfg)
+			if err != nil {
+				t.Fatalf("创建邮件发送器失败: %v", err)
+			}
+
+			err = m.Send(&Message{
+				To:      []string{"alice@example.com", "bob@example.com"},
+				Subject: "重置密码",
+				Body:    "第一行\n第二行\n.以点开头的行\n",
+			})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("期望包含%q的错误，实际为%v", tt.wantErr, err)
+				}
+				if n := len(server.Messages()); n != 0 {
+					t.Fatalf("发送失败时服务器收到了%d封邮件", n)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("发送失败: %v", err)
+			}
+
+			msgs := server.Messages()
+			if len(msgs) != 1 {
+				t.Fatalf("服务器收到%d封邮件，期望1封", len(msgs))
+			}
+			got := msgs[0]
+			// 信封发件人不带显示名称
+			if got.From != "noreply@example.com" {
+				t.Errorf("信封发件人为%q", got.From)
+			}
+			if strings.Join(got.To, ",") != "alice@example.com,bob@example.com" {
+				t.Errorf("信封收件人为%v", got.To)
+			}
+
+			parsed, err := mail.ReadMessage(strings.NewReader(got.Data))
+			if err != nil {
+				t.Fatalf("解析邮件失败: %v", err)
+			}
+			if from := parsed.Header.Get("From"); from != "Autops <noreply@example.com>" {
+				t.Errorf("From头为%q", from)
+			}
+			subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+			if err != nil || subject != "重置密码" {
+				t.Errorf("主题为%q，错误: %v", subject, err)
+			}
+			if ct := parsed.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+				t.Errorf("Content-Type为%q", ct)
+			}
+			body, _ := io.ReadAll(parsed.Body)
+			if string(body) != "第一行\n第二行\n.以点开头的行\n" {
+				t.Errorf("正文为%q", body)
+			}
+		})
+	}
+}
+
+func TestSMTPMailerConnectFailure(t *testing.T) {
+	server := mailertest.NewServer(t)
+	cfg := server.Config("noreply@example.com")
+	// 对明文服务器直接建立TLS连接
+	cfg.TLSMode = TLSModeTLS
+	if err := NewSMTPMailer(cfg).Send(&Message{To: []string{"alice@example.com"}, Subject: "s", Body: "b"}); err == nil {
+		t.Fatal("TLS握手失败时应返回错误")
+	}
+}
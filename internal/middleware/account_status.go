@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/business/repositories"
+	"github.com/GZ-Alinx/autops/internal/logger"
+	"github.com/GZ-Alinx/autops/internal/response"
+	"github.com/GZ-Alinx/autops/internal/watcher"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// accountStatusTTL 账号状态缓存时间；变更状态会立即清除本实例的缓存，并通过watcher通知其他实例清除，
+// 未配置watcher的多副本部署最迟在该时间后生效
+const accountStatusTTL = 30 * time.Second
+
+// accountStatusEntry 缓存的账号状态
+type accountStatusEntry struct {
+	status     int
+	validUntil *time.Time
+	fetchedAt  time.Time
+}
+
+// accountStatusCache 按用户ID缓存账号状态，避免每个请求都查询用户表
+type accountStatusCache struct {
+	repo    repositories.UserRepository
+	entries sync.Map // userID -> *accountStatusEntry
+}
+
+// accountStatuses 全局账号状态缓存
+var accountStatuses = &accountStatusCache{repo: repositories.NewUserRepository()}
+
+func init() {
+	watcher.OnUserChanged(InvalidateAccountStatus)
+}
+
+// InvalidateAccountStatus 清除用户的账号状态缓存，变更状态或删除用户后调用
+func InvalidateAccountStatus(userID uint) {
+	accountStatuses.entries.Delete(userID)
+}
+
+// get 获取账号状态，缓存过期时重新查询
+func (c *accountStatusCache) get(userID uint, now time.Time) (*accountStatusEntry, error) {
+	if value, ok := c.entries.Load(userID); ok {
+		entry := value.(*accountStatusEntry)
+		if now.Sub(entry.fetchedAt) < accountStatusTTL {
+			return entry, nil
+		}
+	}
+
+	user, err := c.repo.GetByID(userID)
+	if err != nil {
+		c.entries.Delete(userID)
+		return nil, err
+	}
+	entry := &accountStatusEntry{status: user.Status, validUntil: user.ValidUntil, fetchedAt: now}
+	c.entries.Store(userID, entry)
+	return entry, nil
+}
+
+// checkAccountStatus 校验令牌所属账号仍然可用，失败时已写入响应
+func checkAccountStatus(c *gin.Context, userID string) bool {
+	id, err := strconv.ParseUint(userID, 10, 64)
+	if err != nil {
+		response.Fail(c, http.StatusUnauthorized, errors.New("无效的token或token已过期"))
+		c.Abort()
+		return false
+	}
+
+	now := time.Now()
+	entry, err := accountStatuses.get(uint(id), now)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			logger.Logger.Warn("认证失败: 用户不存在", zap.String("userID", userID))
+			response.Fail(c, http.StatusUnauthorized, errors.New("用户不存在"))
+		} else {
+			logger.Logger.Error("查询账号状态失败", zap.String("userID", userID), zap.Error(err))
+			response.Fail(c, http.StatusInternalServerError, errors.New("令牌校验失败"))
+		}
+		c.Abort()
+		return false
+	}
+
+	return allowAccountStatus(c, userID, models.EffectiveUserStatus(entry.status, entry.validUntil, now))
+}
+
+// allowAccountStatus 账号为正常状态时放行，否则返回403
+func allowAccountStatus(c *gin.Context, userID string, status int) bool {
+	if status == models.UserStatusActive {
+		return true
+	}
+	logger.Logger.Warn("认证失败: 账号不可用", zap.String("userID", userID), zap.Int("status", status))
+	response.Fail(c, http.StatusForbidden, errors.New(models.UserStatusMessage(status)))
+	c.Abort()
+	return false
+}
@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/business/repositories"
+	"github.com/GZ-Alinx/autops/internal/logger"
+	"github.com/GZ-Alinx/autops/internal/response"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// APITokenPrefix API令牌明文前缀，用于与JWT区分
+const APITokenPrefix = "autops_pat_"
+
+// 认证方式
+const (
+	AuthTypeJWT      = "jwt"
+	AuthTypeAPIToken = "api_token"
+)
+
+// apiTokenTouchInterval 最近使用时间的最小更新间隔，避免每个请求都写库
+const apiTokenTouchInterval = time.Minute
+
+// HashToken 计算令牌的SHA-256哈希，数据库中只保存哈希
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GetTokenScopes 获取API令牌限定的角色列表，未限定时返回nil
+func GetTokenScopes(c *gin.Context) []string {
+	value, exists := c.Get("tokenScopes")
+	if !exists {
+		return nil
+	}
+	scopes, _ := value.([]string)
+	return scopes
+}
+
+// ScopedRoles API令牌限定了角色范围时，只保留范围内的角色
+func ScopedRoles(c *gin.Context, roles []models.Role) []models.Role {
+	scopes := GetTokenScopes(c)
+	if len(scopes) == 0 {
+		return roles
+	}
+	allowed := make(map[string]bool, len(scopes))
+	for _, scope := range scopes {
+		allowed[scope] = true
+	}
+	var scopedRoles []models.Role
+	for _, role := range roles {
+		if allowed[role.Name] {
+			scopedRoles = append(scopedRoles, role)
+		}
+	}
+	return scopedRoles
+}
+
+// IsAPITokenAuth 当前请求是否通过API令牌认证，执行通过API令牌提交的变更时同样返回true
+func IsAPITokenAuth(c *gin.Context) bool {
+	if c.GetString("authType") == AuthTypeAPIToken {
+		return true
+	}
+	_, ok := c.Get("apiTokenID")
+	return ok
+}
+
+// apiTokenAuthenticator API令牌认证
+type apiTokenAuthenticator struct {
+	tokenRepo repositories.APITokenRepository
+	userRepo  repositories.UserRepository
+	lastTouch sync.Map // tokenID -> time.Time
+}
+
+// newAPITokenAuthenticator 创建API令牌认证实例
+func newAPITokenAuthenticator() *apiTokenAuthenticator {
+	return &apiTokenAuthenticator{
+		tokenRepo: repositories.NewAPITokenRepository(),
+		userRepo:  repositories.NewUserRepository(),
+	}
+}
+
+// authenticate 校验API令牌并将所属用户写入上下文，失败时已写入响应
+func (a *apiTokenAuthenticator) authenticate(c *gin.Context, raw string) bool {
+	token, err := a.tokenRepo.GetByHash(HashToken(raw))
+	if err != nil {
+		logger.Logger.Warn("API令牌认证失败: 令牌不存在")
+		response.Fail(c, http.StatusUnauthorized, errors.New("无效的API令牌"))
+		c.Abort()
+		return false
+	}
+
+	now := time.Now()
+	if !token.IsActive(now) {
+		logger.Logger.Warn("API令牌认证失败: 令牌已吊销或已过期", zap.Uint("tokenID", token.ID))
+		response.Fail(c, http.StatusUnauthorized, errors.New("API令牌已吊销或已过期"))
+		c.Abort()
+		return false
+	}
+
+	user, err := a.userRepo.GetByID(token.UserID)
+	if err != nil {
+		logger.Logger.Warn("API令牌认证失败: 所属用户不存在", zap.Uint("tokenID", token.ID), zap.Uint("userID", token.UserID))
+		response.Fail(c, http.StatusUnauthorized, errors.New("无效的API令牌"))
+		c.Abort()
+		return false
+	}
+
+	if !allowAccountStatus(c, strconv.Itoa(int(user.ID)), user.EffectiveStatus(now)) {
+		return false
+	}
+
+	a.touch(token.ID, c.ClientIP(), now)
+
+	c.Set("userID", strconv.Itoa(int(user.ID)))
+	c.Set("username", user.Username)
+	c.Set("authType", AuthTypeAPIToken)
+	c.Set("apiTokenID", token.ID)
+	if scopes := token.ScopeList(); len(scopes) > 0 {
+		c.Set("tokenScopes", scopes)
+	}
+
+	logger.Logger.Info("API令牌认证成功", zap.String("username", user.Username), zap.Uint("tokenID", token.ID))
+	return true
+}
+
+// touch 按间隔更新令牌最近使用信息
+func (a *apiTokenAuthenticator) touch(tokenID uint, ip string, now time.Time) {
+	if last, ok := a.lastTouch.Load(tokenID); ok && now.Sub(last.(time.Time)) < apiTokenTouchInterval {
+		return
+	}
+	a.lastTouch.Store(tokenID, now)
+	if err := a.tokenRepo.TouchLastUsed(tokenID, ip, now); err != nil {
+		logger.Logger.Warn("更新API令牌使用时间失败", zap.Uint("tokenID", tokenID), zap.Error(err))
+	}
+}
@@ -0,0 +1,240 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/business/repositories"
+	"github.com/GZ-Alinx/autops/internal/config"
+	"github.com/GZ-Alinx/autops/internal/logger"
+	"github.com/GZ-Alinx/autops/internal/response"
+	"github.com/casbin/casbin/v2/util"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// AuthTypeChange 执行已批准的变更时，以申请人的身份重新执行请求
+const AuthTypeChange = "change"
+
+// ChangeReasonHeader 提交需要审批的请求时说明变更原因的请求头
+const ChangeReasonHeader = "X-Change-Reason"
+
+// maxChangeBody 待审批变更请求体的最大长度，与TEXT列一致
+const maxChangeBody = 64 << 10
+
+// ErrChangeSecretsNotSealed 请求体包含敏感字段但未配置加密密钥，不能保存为待审批变更
+var ErrChangeSecretsNotSealed = errors.New("请求包含密码、令牌等敏感字段，未配置permission.approval.secret_key时不能提交审批")
+
+// PendingChange 匹配审批规则、等待保存为待审批变更的请求
+type PendingChange struct {
+	Rule        config.ApprovalRule
+	UserID      uint
+	Username    string
+	Tenant      string
+	Method      string
+	Path        string
+	Query       string
+	ContentType string
+	Body        string
+	IP          string
+	Reason      string
+	AuthType    string   // 提交请求的认证方式
+	APITokenID  uint     // 通过API令牌提交时的令牌ID
+	TokenScopes []string // API令牌限定的角色，执行时同样只使用这些角色
+}
+
+// ChangeSubmitter 保存待审批变更
+type ChangeSubmitter interface {
+	Submit(change *PendingChange) (*models.ChangeRequest, error)
+}
+
+var (
+	changeSubmitterMu sync.RWMutex
+	changeSubmitter   ChangeSubmitter
+)
+
+// SetChangeSubmitter 设置CasbinMiddleware保存待审批变更使用的服务，注册路由时调用
+func SetChangeSubmitter(submitter ChangeSubmitter) {
+	changeSubmitterMu.Lock()
+	defer changeSubmitterMu.Unlock()
+	changeSubmitter = submitter
+}
+
+// MatchApprovalRule 查找请求匹配的审批规则，按配置顺序第一条匹配的规则生效
+func MatchApprovalRule(method, path string) (config.ApprovalRule, bool) {
+	for _, rule := range config.AppConfig.Permission.Approval.Rules {
+		if rule.Method != "*" && !strings.EqualFold(rule.Method, method) {
+			continue
+		}
+		if rule.Path == path || util.KeyMatch2(path, rule.Path) {
+			return rule, true
+		}
+	}
+	return config.ApprovalRule{}, false
+}
+
+// ChangeReplay 执行已批准的变更时附加在请求上下文中的申请人身份
+type ChangeReplay struct {
+	ChangeID    uint
+	UserID      uint
+	Username    string
+	APITokenID  uint     // 通过API令牌提交的变更，执行时令牌必须仍然有效
+	TokenScopes []string // 提交时API令牌限定的角色
+}
+
+// changeReplayKey 请求上下文的键，只能在进程内设置，外部请求无法伪造
+type changeReplayKey struct{}
+
+// WithChangeReplay 返回附加了变更执行身份的上下文
+func WithChangeReplay(ctx context.Context, replay ChangeReplay) context.Context {
+	return context.WithValue(ctx, changeReplayKey{}, replay)
+}
+
+// getChangeReplay 获取请求上下文中的变更执行身份
+func getChangeReplay(c *gin.Context) (ChangeReplay, bool) {
+	replay, ok := c.Request.Context().Value(changeReplayKey{}).(ChangeReplay)
+	return replay, ok
+}
+
+// GetChangeID 正在执行已批准的变更时返回变更ID
+func GetChangeID(c *gin.Context) (uint, bool) {
+	replay, ok := getChangeReplay(c)
+	return replay.ChangeID, ok
+}
+
+// authenticateChangeReplay 执行已批准的变更时以申请人的身份认证，不是变更执行时返回false且不写入响应；
+// handled为true时已完成认证或已写入错误响应
+func authenticateChangeReplay(c *gin.Context) (handled bool) {
+	replay, ok := getChangeReplay(c)
+	if !ok {
+		return false
+	}
+
+	// 申请人的账号在审批期间被停用时不再执行
+	userID := strconv.FormatUint(uint64(replay.UserID), 10)
+	if !checkAccountStatus(c, userID) {
+		return true
+	}
+	// 通过API令牌提交的变更，令牌在审批期间被吊销或已过期时不再执行
+	if replay.APITokenID != 0 && !checkChangeToken(c, replay) {
+		return true
+	}
+
+	c.Set("userID", userID)
+	c.Set("username", replay.Username)
+	c.Set("authType", AuthTypeChange)
+	if replay.APITokenID != 0 {
+		c.Set("apiTokenID", replay.APITokenID)
+	}
+	// 与提交时相同，只使用API令牌限定的角色进行权限检查
+	if len(replay.TokenScopes) > 0 {
+		c.Set("tokenScopes", replay.TokenScopes)
+	}
+	logger.Logger.Info("执行已批准的变更", zap.Uint("changeID", replay.ChangeID), zap.String("username", replay.Username))
+	c.Next()
+	return true
+}
+
+// checkChangeToken 校验提交变更的API令牌仍然有效且属于申请人，失败时已写入响应
+func checkChangeToken(c *gin.Context, replay ChangeReplay) bool {
+	token, err := repositories.NewAPITokenRepository().GetByID(replay.APITokenID)
+	if err != nil || token.UserID != replay.UserID || !token.IsActive(time.Now()) {
+		logger.Logger.Warn("执行变更失败: 提交变更的API令牌已失效", zap.Uint("changeID", replay.ChangeID), zap.Uint("tokenID", replay.APITokenID))
+		response.Fail(c, http.StatusUnauthorized, errors.New("提交变更的API令牌已吊销或已过期"))
+		c.Abort()
+		return false
+	}
+	return true
+}
+
+// divertChange 请求匹配审批规则时保存为待审批变更并返回202，返回true表示请求已被转为待审批变更；
+// 执行已批准的变更时不再转换
+func divertChange(c *gin.Context) bool {
+	if _, ok := getChangeReplay(c); ok {
+		return false
+	}
+	rule, ok := MatchApprovalRule(c.Request.Method, c.Request.URL.Path)
+	if !ok {
+		return false
+	}
+
+	username := c.GetString("username")
+	if actor, ok := GetImpersonator(c); ok {
+		logger.Logger.Warn("模拟登录期间不能提交需要审批的变更", zap.String("actor", actor.Username), zap.String("username", username))
+		response.Forbidden(c, errors.New("模拟登录期间不能提交需要审批的变更"))
+		c.Abort()
+		return true
+	}
+
+	changeSubmitterMu.RLock()
+	submitter := changeSubmitter
+	changeSubmitterMu.RUnlock()
+	if submitter == nil {
+		logger.Logger.Error("请求需要审批但未配置审批服务", zap.String("path", c.Request.URL.Path), zap.String("method", c.Request.Method))
+		response.Fail(c, http.StatusServiceUnavailable, errors.New("审批服务未启用"))
+		c.Abort()
+		return true
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxChangeBody+1))
+	if err != nil {
+		response.BadRequest(c, fmt.Errorf("读取请求体失败: %v", err))
+		c.Abort()
+		return true
+	}
+	if len(body) > maxChangeBody {
+		response.Fail(c, http.StatusRequestEntityTooLarge, errors.New("需要审批的请求的请求体过大"))
+		c.Abort()
+		return true
+	}
+
+	userID, _ := strconv.ParseUint(c.GetString("userID"), 10, 64)
+	_, tenant := GetTenant(c)
+	tokenID, _ := c.Get("apiTokenID")
+	apiTokenID, _ := tokenID.(uint)
+	change, err := submitter.Submit(&PendingChange{
+		Rule:        rule,
+		UserID:      uint(userID),
+		Username:    username,
+		Tenant:      tenant,
+		Method:      c.Request.Method,
+		Path:        c.Request.URL.Path,
+		Query:       c.Request.URL.RawQuery,
+		ContentType: c.ContentType(),
+		Body:        string(body),
+		IP:          c.ClientIP(),
+		Reason:      c.GetHeader(ChangeReasonHeader),
+		AuthType:    c.GetString("authType"),
+		APITokenID:  apiTokenID,
+		TokenScopes: GetTokenScopes(c),
+	})
+	if errors.Is(err, ErrChangeSecretsNotSealed) {
+		logger.Logger.Warn("保存待审批变更失败: 请求包含敏感字段", zap.String("username", username), zap.String("path", c.Request.URL.Path))
+		response.BadRequest(c, err)
+		c.Abort()
+		return true
+	}
+	if err != nil {
+		logger.Logger.Error("保存待审批变更失败", zap.String("username", username), zap.String("path", c.Request.URL.Path), zap.Error(err))
+		response.InternalServerError(c, fmt.Errorf("提交审批失败: %v", err))
+		c.Abort()
+		return true
+	}
+
+	logger.Logger.Info("请求已转为待审批变更", zap.String("username", username), zap.String("path", c.Request.URL.Path), zap.String("method", c.Request.Method), zap.Uint("changeID", change.ID))
+	c.JSON(http.StatusAccepted, response.Response{
+		Code:    http.StatusAccepted,
+		Message: "变更已提交审批，批准后执行",
+		Data:    change,
+	})
+	c.Abort()
+	return true
+}
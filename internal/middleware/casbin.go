@@ -1,22 +1,28 @@
 package middleware
 
 import (
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/business/repositories"
+	"github.com/GZ-Alinx/autops/internal/authcache"
+	"github.com/GZ-Alinx/autops/internal/condition"
+	"github.com/GZ-Alinx/autops/internal/config"
 	"github.com/GZ-Alinx/autops/internal/database"
 	"github.com/GZ-Alinx/autops/internal/global"
 	"github.com/GZ-Alinx/autops/internal/logger"
 	"github.com/GZ-Alinx/autops/internal/response"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
 )
 
 // CasbinMiddleware 权限检查中间件
 func CasbinMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// 获取当前用户
-		var err error
 		username, exists := c.Get("username")
 		if !exists {
 			logger.Logger.Warn("权限检查失败: 未登录")
@@ -27,52 +33,52 @@ func CasbinMiddleware() gin.HandlerFunc {
 
 		logger.Logger.Info("开始权限检查", zap.String("username", username.(string)))
 
-		// 查询用户角色
-		var user models.User
-		result := database.DB.Where("username = ?", username.(string)).First(&user)
-		if result.Error != nil {
-			logger.Logger.Error("查询用户失败", zap.String("username", username.(string)), zap.Error(result.Error))
-			response.Unauthorized(c, fmt.Errorf("用户不存在"))
+		// 查询用户及其在当前租户内的角色，优先使用授权缓存
+		tenantID, tenant := GetTenant(c)
+		entry, err := authcache.Load(username.(string), tenantID, func() (*authcache.Entry, error) {
+			return loadUserRoles(username.(string), tenantID)
+		})
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				logger.Logger.Warn("用户不存在", zap.String("username", username.(string)))
+				response.Unauthorized(c, fmt.Errorf("用户不存在"))
+			} else {
+				logger.Logger.Error("查询用户角色失败", zap.String("username", username.(string)), zap.String("tenant", tenant), zap.Error(err))
+				response.InternalServerError(c, fmt.Errorf("查询用户角色失败: %v", err))
+			}
 			c.Abort()
 			return
 		}
 
-		logger.Logger.Info("查询用户成功", zap.String("username", username.(string)), zap.Int("userID", int(user.ID)))
-
-		// 预加载角色信息
-		database.DB.Model(&user).Association("Roles").Find(&user.Roles)
-		if user.ID == 0 {
-			logger.Logger.Warn("用户不存在", zap.String("username", username.(string)))
-			response.Unauthorized(c, fmt.Errorf("用户不存在"))
-			c.Abort()
-			return
-		}
+		// API令牌限定了角色范围时，只使用范围内的角色进行权限检查
+		roles := ScopedRoles(c, entry.Roles)
 
 		// 记录用户角色
 		var roleNames []string
-		for _, role := range user.Roles {
+		for _, role := range roles {
 			roleNames = append(roleNames, role.Name)
 		}
-		logger.Logger.Info("获取用户角色成功", zap.String("username", username.(string)), zap.Strings("roles", roleNames))
+		logger.Logger.Info("获取用户角色成功", zap.String("username", username.(string)), zap.String("tenant", tenant), zap.Strings("roles", roleNames))
 
-		// 获取请求路径和方法
-		path := c.Request.URL.Path
+		// 获取请求资源和方法：path模式为请求路径，template模式为路由模板
+		path := RequestResource(c)
 		method := c.Request.Method
 		logger.Logger.Info("请求信息", zap.String("path", path), zap.String("method", method))
 
-		// 检查权限：遍历用户所有角色
-		ok := false
-		for _, role := range user.Roles {
-			ok, err = global.Enforcer.Enforce(role.Name, path, method)
-			if err != nil {
-				logger.Logger.Error("权限检查出错", zap.String("role", role.Name), zap.String("path", path), zap.String("method", method), zap.Error(err))
-				break
-			}
-			if ok {
-				logger.Logger.Info("权限检查通过", zap.String("role", role.Name), zap.String("path", path), zap.String("method", method))
-				break
+		// 权限条件使用的请求属性
+		env := RequestAttributes(c)
+
+		// 检查权限：遍历用户所有角色，任一角色允许且没有角色拒绝时通过（拒绝优先）
+		ok, results, err := EnforceRoles(roleNames, tenant, path, method, env)
+		for _, r := range results {
+			switch r.Effect {
+			case models.EffectAllow:
+				logger.Logger.Info("角色权限检查通过", zap.String("role", r.Role), zap.String("path", path), zap.String("method", method))
+			case models.EffectDeny:
+				logger.Logger.Info("角色被拒绝访问", zap.String("role", r.Role), zap.String("path", path), zap.String("method", method), zap.Strings("policy", r.Policy))
+			default:
+				logger.Logger.Info("角色权限不足", zap.String("role", r.Role), zap.String("path", path), zap.String("method", method))
 			}
-			logger.Logger.Info("角色权限不足", zap.String("role", role.Name), zap.String("path", path), zap.String("method", method))
 		}
 		if err != nil {
 			logger.Logger.Error("权限检查失败", zap.String("username", username.(string)), zap.Error(err))
@@ -81,13 +87,101 @@ func CasbinMiddleware() gin.HandlerFunc {
 			return
 		}
 		if !ok {
-			logger.Logger.Warn("没有操作权限", zap.String("username", username.(string)), zap.String("path", path), zap.String("method", method))
+			logger.Logger.Warn("没有操作权限", zap.String("username", username.(string)), zap.String("tenant", tenant), zap.String("path", path), zap.String("method", method), impersonatorField(c))
 			response.Forbidden(c, fmt.Errorf("没有操作权限"))
 			c.Abort()
 			return
 		}
 
-		logger.Logger.Info("权限检查通过", zap.String("username", username.(string)), zap.String("path", path), zap.String("method", method))
+		logger.Logger.Info("权限检查通过", zap.String("username", username.(string)), zap.String("path", path), zap.String("method", method), impersonatorField(c))
+
+		// 需要审批的请求保存为待审批变更，批准后再执行
+		if divertChange(c) {
+			return
+		}
 		c.Next()
 	}
 }
+
+// RequestResource 权限检查使用的请求资源：template模式为匹配到的路由模板（如/api/v1/users/:id），
+// 其他情况为请求路径
+func RequestResource(c *gin.Context) string {
+	if config.AppConfig.Permission.TemplateMode() {
+		if fullPath := c.FullPath(); fullPath != "" {
+			return fullPath
+		}
+	}
+	return c.Request.URL.Path
+}
+
+// RequestAttributes 收集计算权限条件所需的请求属性
+func RequestAttributes(c *gin.Context) *condition.Attributes {
+	params := make(map[string]string, len(c.Params))
+	for _, p := range c.Params {
+		params[p.Key] = p.Value
+	}
+	return &condition.Attributes{
+		IP:     c.ClientIP(),
+		Time:   time.Now(),
+		UserID: c.GetString("userID"),
+		Params: params,
+	}
+}
+
+// RoleResult 单个角色的权限检查结果
+type RoleResult struct {
+	Role   string   `json:"role"`
+	Effect string   `json:"effect,omitempty"` // allow或deny，未命中任何策略时为空
+	Policy []string `json:"policy,omitempty"` // 决定结果的策略：角色, 租户, 资源, 动作, 条件, 效果
+}
+
+// EnforceRoles 按角色逐个检查权限，任一角色允许且没有角色拒绝时通过（拒绝优先）
+func EnforceRoles(roles []string, tenant, path, method string, env *condition.Attributes) (bool, []RoleResult, error) {
+	allowed, denied := false, false
+	results := make([]RoleResult, 0, len(roles))
+	for _, role := range roles {
+		ok, explain, err := global.Enforcer.EnforceEx(role, tenant, path, method, env)
+		if err != nil {
+			logger.Logger.Error("权限检查出错", zap.String("role", role), zap.String("path", path), zap.String("method", method), zap.Error(err))
+			return false, results, err
+		}
+		result := RoleResult{Role: role, Policy: explain}
+		switch {
+		case ok:
+			result.Effect = models.EffectAllow
+			allowed = true
+		case len(explain) > 0:
+			// 未通过但命中了策略，说明命中的是拒绝规则
+			result.Effect = models.EffectDeny
+			denied = true
+		}
+		results = append(results, result)
+	}
+	return allowed && !denied, results, nil
+}
+
+// loadUserRoles 查询用户及其在租户内的角色，作为授权缓存的数据来源
+func loadUserRoles(username string, tenantID uint) (*authcache.Entry, error) {
+	var user models.User
+	if err := database.DB.Where("username = ?", username).First(&user).Error; err != nil {
+		return nil, err
+	}
+	roles, err := LoadTenantRoles(&user, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	return &authcache.Entry{UserID: user.ID, Roles: roles}, nil
+}
+
+// LoadTenantRoles 加载用户在租户内的角色：默认租户使用user_roles（只包含有效期内的临时授权），其他租户使用tenant_user_roles
+func LoadTenantRoles(user *models.User, tenantID uint) ([]models.Role, error) {
+	if tenantID == 0 {
+		var roles []models.Role
+		err := database.DB.Joins("JOIN user_roles ON user_roles.role_id = roles.id AND user_roles.deleted_at IS NULL").
+			Where("user_roles.user_id = ?", user.ID).
+			Scopes(models.ActiveUserRoles(time.Now())).
+			Find(&roles).Error
+		return roles, err
+	}
+	return repositories.NewTenantRepository().GetMemberRoles(tenantID, user.ID)
+}
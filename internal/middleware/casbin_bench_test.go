@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	glog "gorm.io/gorm/logger"
+
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/internal/authcache"
+	"github.com/GZ-Alinx/autops/internal/config"
+	"github.com/GZ-Alinx/autops/internal/database"
+	"github.com/GZ-Alinx/autops/internal/global"
+	"github.com/GZ-Alinx/autops/internal/logger"
+)
+
+const benchPath = "/api/v1/servers"
+
+// benchModelPath 相对于本包目录的Casbin模型配置
+const benchModelPath = "../../configs/casbin_model.conf"
+
+var (
+	setupOnce   sync.Once
+	setupErr    error
+	benchRouter *gin.Engine
+)
+
+// setupMiddleware 使用内存SQLite和真实的Casbin模型初始化一个经过CasbinMiddleware的路由
+func setupMiddleware(b *testing.B) *gin.Engine {
+	b.Helper()
+	setupOnce.Do(func() {
+		logger.Logger = zap.NewNop()
+		gin.SetMode(gin.TestMode)
+
+		db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: glog.Default.LogMode(glog.Silent)})
+		if err != nil {
+			setupErr = err
+			return
+		}
+		// 内存数据库每个连接独立，只使用一个连接
+		sqlDB, err := db.DB()
+		if err != nil {
+			setupErr = err
+			return
+		}
+		sqlDB.SetMaxOpenConns(1)
+		database.DB = db
+		if setupErr = db.AutoMigrate(&models.User{}, &models.Role{}, &models.UserRole{}, &models.Permission{}, &models.RolePermission{}); setupErr != nil {
+			return
+		}
+
+		role := models.Role{Name: "ops"}
+		user := models.User{Username: "alice", Password: "x", Email: "alice@example.com", Status: models.UserStatusActive}
+		if setupErr = db.Create(&role).Error; setupErr != nil {
+			return
+		}
+		if setupErr = db.Create(&user).Error; setupErr != nil {
+			return
+		}
+		if setupErr = db.Create(&models.UserRole{UserID: user.ID, RoleID: role.ID}).Error; setupErr != nil {
+			return
+		}
+
+		if setupErr = database.InitCasbinWithModel(benchModelPath); setupErr != nil {
+			return
+		}
+		if _, setupErr = global.Enforcer.AddPolicy("ops", models.AllTenants, benchPath, http.MethodGet, "", models.EffectAllow); setupErr != nil {
+			return
+		}
+
+		router := gin.New()
+		router.GET(benchPath, func(c *gin.Context) {
+			c.Set("username", "alice")
+			c.Set("userID", "1")
+		}, CasbinMiddleware(), func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+		benchRouter = router
+	})
+	if setupErr != nil {
+		b.Fatalf("初始化失败: %v", setupErr)
+	}
+	return benchRouter
+}
+
+// serve 执行一次请求，返回状态码
+func serve(router *gin.Engine) int {
+	req := httptest.NewRequest(http.MethodGet, benchPath, nil)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder.Code
+}
+
+// BenchmarkCasbinMiddleware 对比每个请求的权限检查开销：命中授权缓存、缓存未命中（查询用户和角色）、不缓存
+func BenchmarkCasbinMiddleware(b *testing.B) {
+	router := setupMiddleware(b)
+	previous := config.AppConfig.Permission.RoleCacheSeconds
+	b.Cleanup(func() {
+		config.AppConfig.Permission.RoleCacheSeconds = previous
+		authcache.Purge()
+	})
+
+	cases := []struct {
+		name  string
+		ttl   int
+		purge bool // 每个请求前清空缓存
+	}{
+		{name: "hit", ttl: 60},
+		{name: "miss", ttl: 60, purge: true},
+		{name: "ttl0", ttl: 0},
+	}
+	for _, tc := range cases {
+		b.Run(tc.name, func(b *testing.B) {
+			config.AppConfig.Permission.RoleCacheSeconds = tc.ttl
+			authcache.Purge()
+			if code := serve(router); code != http.StatusOK {
+				b.Fatalf("权限检查返回%d，期望200", code)
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if tc.purge {
+					authcache.Purge()
+				}
+				serve(router)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/GZ-Alinx/autops/internal/logger"
+	"github.com/GZ-Alinx/autops/internal/response"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// ImpersonatedByHeader 模拟登录时每个响应都带上真实操作人
+const ImpersonatedByHeader = "X-Impersonated-By"
+
+// setImpersonator 记录模拟登录的真实操作人
+func setImpersonator(c *gin.Context, actor *ImpersonationActor) {
+	c.Set("impersonator", actor)
+	c.Header(ImpersonatedByHeader, actor.Username)
+}
+
+// GetImpersonator 获取模拟登录的真实操作人，非模拟登录时返回false
+func GetImpersonator(c *gin.Context) (*ImpersonationActor, bool) {
+	value, exists := c.Get("impersonator")
+	if !exists {
+		return nil, false
+	}
+	actor, ok := value.(*ImpersonationActor)
+	return actor, ok
+}
+
+// impersonatorField 模拟登录时附加到日志的真实操作人，非模拟登录时不输出
+func impersonatorField(c *gin.Context) zap.Field {
+	if actor, ok := GetImpersonator(c); ok {
+		return zap.String("impersonator", actor.Username)
+	}
+	return zap.Skip()
+}
+
+// DenyImpersonation 禁止模拟登录令牌访问的接口，如修改密码、两步验证、创建令牌等只能由用户本人操作的接口
+func DenyImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if actor, ok := GetImpersonator(c); ok {
+			logger.GetBusinessLogger().Warn("模拟登录期间禁止的操作",
+				zap.String("actor", actor.Username),
+				zap.String("username", c.GetString("username")),
+				zap.String("path", c.Request.URL.Path),
+				zap.String("method", c.Request.Method))
+			response.Fail(c, http.StatusForbidden, errors.New("模拟登录期间不能执行该操作"))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -6,25 +6,68 @@ import (
 	"strings"
 	"time"
 
+	"github.com/GZ-Alinx/autops/business/repositories"
 	"github.com/GZ-Alinx/autops/internal/config"
 	"github.com/GZ-Alinx/autops/internal/logger"
 	"github.com/GZ-Alinx/autops/internal/response"
 
 	"github.com/gin-gonic/gin"
 	jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 )
 
 // JWTClaims JWT自定义声明
+// RegisteredClaims.ID 即jti，用于令牌吊销
 type JWTClaims struct {
 	UserID   string `json:"user_id"`
 	Username string `json:"username"`
+	Purpose  string `json:"purpose,omitempty"` // 非空表示挑战令牌（如两步验证），不能用于访问API
+	// SessionID 登录会话ID，会话被吊销后该会话签发的令牌立即失效
+	SessionID string `json:"sid,omitempty"`
+	// Actor 非空表示模拟登录令牌：UserID/Username为被模拟的用户，Actor为发起模拟的真实操作人
+	Actor *ImpersonationActor `json:"act,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// ImpersonationActor 模拟登录的真实操作人，对应RFC 8693的act声明
+type ImpersonationActor struct {
+	UserID   string `json:"sub"`
+	Username string `json:"username"`
+}
+
+// 挑战令牌用途
+const (
+	PurposeMFA       = "mfa"        // 已启用两步验证，等待提交验证码
+	PurposeMFAEnroll = "mfa_enroll" // 角色要求两步验证但尚未绑定，等待完成绑定
+
+	PurposePasswordChange = "password_change" // 密码已过期或被要求修改，等待设置新密码
+)
+
+// 令牌类型和audience：访问令牌与挑战令牌使用同一组签名密钥，以不同的typ头和aud区分，
+// 通过JWKS验证令牌的其他服务应要求aud为AudienceAccess，挑战令牌不会被当作登录凭据
+const (
+	TokenTypeAccess    = "at+jwt"        // 访问令牌，RFC 9068
+	TokenTypeChallenge = "challenge+jwt" // 登录流程中的挑战令牌
+
+	AudienceAccess    = "autops-api"       // 访问令牌的audience
+	AudienceChallenge = "autops-challenge" // 挑战令牌的audience
+)
+
+// ErrInvalidChallenge 挑战令牌无效、已过期或用途不符
+var ErrInvalidChallenge = errors.New("无效的挑战令牌或挑战令牌已过期")
+
 // JWTMiddleware JWT认证中间件
 func JWTMiddleware() gin.HandlerFunc {
+	tokenRepo := repositories.NewTokenRepository()
+	apiTokens := newAPITokenAuthenticator()
+	sessions := newSessionChecker()
 	return func(c *gin.Context) {
+		// 执行已批准的变更，以申请人的身份认证
+		if authenticateChangeReplay(c) {
+			return
+		}
+
 		// 获取Authorization头
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -43,13 +86,19 @@ func JWTMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// API令牌（个人访问令牌/服务账号令牌）
+		if strings.HasPrefix(parts[1], APITokenPrefix) {
+			if apiTokens.authenticate(c, parts[1]) {
+				c.Next()
+			}
+			return
+		}
+
 		logger.Logger.Info("开始解析JWT令牌")
 
 		// 解析token
 		claims := &JWTClaims{}
-		token, err := jwt.ParseWithClaims(parts[1], claims, func(token *jwt.Token) (interface{}, error) {
-			return []byte(config.AppConfig.JWT.Secret), nil
-		})
+		token, err := jwtKeys.parse(parts[1], claims, TokenTypeAccess, AudienceAccess)
 
 		// 验证token
 		if err != nil {
@@ -66,46 +115,171 @@ func JWTMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		// 将用户信息存入上下文
+		// 挑战令牌只能用于完成登录流程
+		if claims.Purpose != "" {
+			logger.Logger.Warn("JWT认证失败: 挑战令牌不能用于访问API", zap.String("username", claims.Username), zap.String("purpose", claims.Purpose))
+			response.Fail(c, http.StatusUnauthorized, errors.New("无效的token或token已过期"))
+			c.Abort()
+			return
+		}
+
+		// 模拟登录令牌必须绑定会话，保证可以随时结束
+		if claims.Actor != nil && claims.SessionID == "" {
+			logger.Logger.Warn("JWT认证失败: 模拟登录令牌缺少会话", zap.String("username", claims.Username), zap.String("actor", claims.Actor.Username))
+			response.Fail(c, http.StatusUnauthorized, errors.New("无效的token或token已过期"))
+			c.Abort()
+			return
+		}
+
+		// 检查令牌是否已被吊销（登出、强制下线等）
+		if claims.ID == "" {
+			logger.Logger.Warn("JWT令牌缺少jti", zap.String("username", claims.Username))
+			response.Fail(c, http.StatusUnauthorized, errors.New("无效的token或token已过期"))
+			c.Abort()
+			return
+		}
+		revoked, err := tokenRepo.IsAccessTokenRevoked(claims.ID)
+		if err != nil {
+			logger.Logger.Error("查询令牌吊销状态失败", zap.String("jti", claims.ID), zap.Error(err))
+			response.Fail(c, http.StatusInternalServerError, errors.New("令牌校验失败"))
+			c.Abort()
+			return
+		}
+		if revoked {
+			logger.Logger.Warn("JWT令牌已被吊销", zap.String("username", claims.Username), zap.String("jti", claims.ID))
+			response.Fail(c, http.StatusUnauthorized, errors.New("token已失效，请重新登录"))
+			c.Abort()
+			return
+		}
+
+		// 检查登录会话是否已被吊销（用户在会话列表中下线、管理员强制下线等）
+		if claims.SessionID != "" && !sessions.check(c, claims) {
+			return
+		}
+
+		// 检查账号是否被禁用、锁定或已过期
+		if !checkAccountStatus(c, claims.UserID) {
+			return
+		}
+
+		// 模拟登录时发起人的账号被停用，模拟随之失效
+		if claims.Actor != nil {
+			if !checkAccountStatus(c, claims.Actor.UserID) {
+				return
+			}
+			setImpersonator(c, claims.Actor)
+		}
+
+		// 将用户信息存入上下文，模拟登录时为被模拟的用户，权限检查以其身份进行
 		c.Set("userID", claims.UserID)
 		c.Set("username", claims.Username)
+		c.Set("claims", claims)
+		c.Set("authType", AuthTypeJWT)
 
-		logger.Logger.Info("JWT认证成功", zap.String("username", claims.Username), zap.String("userID", claims.UserID))
+		if claims.Actor != nil {
+			logger.Logger.Info("JWT认证成功（模拟登录）", zap.String("username", claims.Username), zap.String("userID", claims.UserID), zap.String("actor", claims.Actor.Username), zap.String("actorID", claims.Actor.UserID))
+		} else {
+			logger.Logger.Info("JWT认证成功", zap.String("username", claims.Username), zap.String("userID", claims.UserID))
+		}
 
 		c.Next()
 	}
 }
 
+// GetClaims 从上下文获取当前请求的JWT声明
+func GetClaims(c *gin.Context) (*JWTClaims, bool) {
+	value, exists := c.Get("claims")
+	if !exists {
+		return nil, false
+	}
+	claims, ok := value.(*JWTClaims)
+	return claims, ok
+}
+
+// AccessTokenTTL 访问令牌有效期
+func AccessTokenTTL() time.Duration {
+	if config.AppConfig.JWT.AccessExpiresMinute > 0 {
+		return config.AppConfig.JWT.AccessExpiresMinute * time.Minute
+	}
+	return config.AppConfig.JWT.ExpiresHour * time.Hour
+}
+
 // GenerateToken 生成JWT令牌
 func GenerateToken(userID, username string) (string, error) {
+	tokenString, _, err := GenerateTokenWithClaims(userID, username, "")
+	return tokenString, err
+}
+
+// GenerateTokenWithClaims 生成JWT令牌并返回其声明（包含jti与过期时间），sessionID为所属登录会话
+func GenerateTokenWithClaims(userID, username, sessionID string) (string, *JWTClaims, error) {
+	return generateAccessToken(userID, username, sessionID, nil, AccessTokenTTL())
+}
+
+// GenerateImpersonationToken 生成模拟登录令牌，以被模拟用户的身份访问，act声明记录真实操作人
+func GenerateImpersonationToken(userID, username, sessionID string, actor *ImpersonationActor, ttl time.Duration) (string, *JWTClaims, error) {
+	return generateAccessToken(userID, username, sessionID, actor, ttl)
+}
+
+// generateAccessToken 签发访问令牌
+func generateAccessToken(userID, username, sessionID string, actor *ImpersonationActor, ttl time.Duration) (string, *JWTClaims, error) {
 	logger.Logger.Info("开始生成JWT令牌", zap.String("username", username), zap.String("userID", userID))
 
 	// 设置过期时间
-	expirationTime := time.Now().Add(config.AppConfig.JWT.ExpiresHour * time.Hour)
+	expirationTime := time.Now().Add(ttl)
 	logger.Logger.Info("JWT令牌过期时间", zap.Time("expirationTime", expirationTime))
 
 	// 创建声明
 	claims := &JWTClaims{
-		UserID:   userID,
-		Username: username,
+		UserID:    userID,
+		Username:  username,
+		SessionID: sessionID,
+		Actor:     actor,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
 			Issuer:    config.AppConfig.App.Name,
+			Audience:  jwt.ClaimStrings{AudienceAccess},
 		},
 	}
 
-	// 创建token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	// 签名token
-	tokenString, err := token.SignedString([]byte(config.AppConfig.JWT.Secret))
+	// 使用当前签名密钥签名token
+	tokenString, err := jwtKeys.sign(claims, TokenTypeAccess)
 	if err != nil {
 		logger.Logger.Error("生成JWT令牌失败", zap.String("username", username), zap.Error(err))
-		return "", err
+		return "", nil, err
+	}
+
+	logger.Logger.Info("生成JWT令牌成功", zap.String("username", username), zap.String("jti", claims.ID))
+	return tokenString, claims, nil
+}
+
+// GenerateChallengeToken 生成短期挑战令牌，用于登录的第二步
+func GenerateChallengeToken(userID, username, purpose string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims := &JWTClaims{
+		UserID:   userID,
+		Username: username,
+		Purpose:  purpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Issuer:    config.AppConfig.App.Name,
+			Audience:  jwt.ClaimStrings{AudienceChallenge},
+		},
 	}
+	return jwtKeys.sign(claims, TokenTypeChallenge)
+}
 
-	logger.Logger.Info("生成JWT令牌成功", zap.String("username", username))
-	return tokenString, nil
+// ParseChallengeToken 解析挑战令牌并校验用途
+func ParseChallengeToken(tokenString, purpose string) (*JWTClaims, error) {
+	claims := &JWTClaims{}
+	token, err := jwtKeys.parse(tokenString, claims, TokenTypeChallenge, AudienceChallenge)
+	if err != nil || !token.Valid || claims.Purpose != purpose || claims.ID == "" {
+		return nil, ErrInvalidChallenge
+	}
+	return claims, nil
 }
@@ -0,0 +1,332 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/GZ-Alinx/autops/internal/config"
+	"github.com/GZ-Alinx/autops/internal/logger"
+	"github.com/gin-gonic/gin"
+	jwt "github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+)
+
+// jwtKey 单个JWT密钥
+type jwtKey struct {
+	kid     string
+	method  jwt.SigningMethod
+	private crypto.Signer    // 仅签名密钥需要，只用于验证的旧密钥为空
+	public  crypto.PublicKey // 非对称密钥的公钥
+	secret  []byte           // HS256共享密钥
+}
+
+// jwtKeySet JWT密钥集合，支持多个验证密钥同时生效以便轮换
+type jwtKeySet struct {
+	signing *jwtKey
+	keys    map[string]*jwtKey
+	methods []string
+}
+
+// jwtKeys 全局密钥集合，由InitJWTKeys初始化
+var jwtKeys *jwtKeySet
+
+// JWK JSON Web Key
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKSet JSON Web Key Set
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// InitJWTKeys 根据配置加载JWT签名和验证密钥
+func InitJWTKeys() error {
+	keySet, err := loadJWTKeys(&config.AppConfig.JWT)
+	if err != nil {
+		return err
+	}
+	jwtKeys = keySet
+	logger.Logger.Info("JWT密钥加载成功",
+		zap.String("algorithm", keySet.signing.method.Alg()),
+		zap.String("signingKid", keySet.signing.kid),
+		zap.Int("keyCount", len(keySet.keys)))
+	return nil
+}
+
+// loadJWTKeys 加载密钥集合
+func loadJWTKeys(cfg *config.JWTConfig) (*jwtKeySet, error) {
+	algorithm := cfg.Algorithm
+	if algorithm == "" {
+		algorithm = jwt.SigningMethodHS256.Alg()
+	}
+
+	// HS256 使用共享密钥，保持原有行为
+	if algorithm == jwt.SigningMethodHS256.Alg() {
+		if cfg.Secret == "" {
+			return nil, errors.New("HS256模式下jwt.secret不能为空")
+		}
+		key := &jwtKey{kid: cfg.SigningKeyID, method: jwt.SigningMethodHS256, secret: []byte(cfg.Secret)}
+		return &jwtKeySet{
+			signing: key,
+			keys:    map[string]*jwtKey{key.kid: key},
+			methods: []string{algorithm},
+		}, nil
+	}
+
+	expected, err := signingMethodByName(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.Keys) == 0 {
+		return nil, fmt.Errorf("%s模式下jwt.keys不能为空", algorithm)
+	}
+
+	keySet := &jwtKeySet{keys: make(map[string]*jwtKey)}
+	seenMethods := make(map[string]bool)
+	for _, keyCfg := range cfg.Keys {
+		if keyCfg.KID == "" {
+			return nil, errors.New("jwt.keys中的kid不能为空")
+		}
+		if _, exists := keySet.keys[keyCfg.KID]; exists {
+			return nil, fmt.Errorf("jwt.keys中的kid重复: %s", keyCfg.KID)
+		}
+		key, err := loadAsymmetricKey(keyCfg)
+		if err != nil {
+			return nil, fmt.Errorf("加载JWT密钥 %s 失败: %w", keyCfg.KID, err)
+		}
+		keySet.keys[key.kid] = key
+		if !seenMethods[key.method.Alg()] {
+			seenMethods[key.method.Alg()] = true
+			keySet.methods = append(keySet.methods, key.method.Alg())
+		}
+	}
+
+	signingKid := cfg.SigningKeyID
+	if signingKid == "" {
+		signingKid = cfg.Keys[0].KID
+	}
+	signing, ok := keySet.keys[signingKid]
+	if !ok {
+		return nil, fmt.Errorf("签名密钥不存在: %s", signingKid)
+	}
+	if signing.private == nil {
+		return nil, fmt.Errorf("签名密钥 %s 缺少私钥", signingKid)
+	}
+	if signing.method.Alg() != expected.Alg() {
+		return nil, fmt.Errorf("签名密钥 %s 的算法为 %s，与配置的 %s 不一致", signingKid, signing.method.Alg(), algorithm)
+	}
+	keySet.signing = signing
+	return keySet, nil
+}
+
+// signingMethodByName 根据名称获取非对称签名算法
+func signingMethodByName(name string) (jwt.SigningMethod, error) {
+	switch name {
+	case jwt.SigningMethodRS256.Alg():
+		return jwt.SigningMethodRS256, nil
+	case jwt.SigningMethodES256.Alg():
+		return jwt.SigningMethodES256, nil
+	case jwt.SigningMethodEdDSA.Alg():
+		return jwt.SigningMethodEdDSA, nil
+	default:
+		return nil, fmt.Errorf("不支持的JWT签名算法: %s", name)
+	}
+}
+
+// loadAsymmetricKey 从PEM文件加载非对称密钥，算法由密钥类型决定
+func loadAsymmetricKey(keyCfg config.JWTKeyConfig) (*jwtKey, error) {
+	key := &jwtKey{kid: keyCfg.KID}
+
+	if keyCfg.PrivateKeyFile != "" {
+		block, err := readPEM(keyCfg.PrivateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		signer, err := parsePrivateKey(block)
+		if err != nil {
+			return nil, err
+		}
+		key.private = signer
+		key.public = signer.Public()
+	}
+
+	if keyCfg.PublicKeyFile != "" {
+		block, err := readPEM(keyCfg.PublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		public, err := parsePublicKey(block)
+		if err != nil {
+			return nil, err
+		}
+		key.public = public
+	}
+
+	if key.public == nil {
+		return nil, errors.New("private_key_file和public_key_file至少配置一个")
+	}
+
+	switch pub := key.public.(type) {
+	case *rsa.PublicKey:
+		key.method = jwt.SigningMethodRS256
+	case *ecdsa.PublicKey:
+		if pub.Curve != elliptic.P256() {
+			return nil, errors.New("ES256仅支持P-256曲线")
+		}
+		key.method = jwt.SigningMethodES256
+	case ed25519.PublicKey:
+		key.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("不支持的公钥类型: %T", key.public)
+	}
+	return key, nil
+}
+
+// readPEM 读取PEM文件的第一个块
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("文件 %s 不是有效的PEM格式", path)
+	}
+	return block, nil
+}
+
+// parsePrivateKey 解析PKCS#8、PKCS#1或SEC1格式的私钥
+func parsePrivateKey(block *pem.Block) (crypto.Signer, error) {
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("不支持的私钥类型: %T", key)
+		}
+		return signer, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return nil, errors.New("无法解析私钥")
+}
+
+// parsePublicKey 解析PKIX或PKCS#1格式的公钥
+func parsePublicKey(block *pem.Block) (crypto.PublicKey, error) {
+	if key, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return nil, errors.New("无法解析公钥")
+}
+
+// sign 使用当前签名密钥签发令牌，typ为令牌头中的令牌类型
+func (ks *jwtKeySet) sign(claims jwt.Claims, typ string) (string, error) {
+	token := jwt.NewWithClaims(ks.signing.method, claims)
+	token.Header["typ"] = typ
+	if ks.signing.kid != "" {
+		token.Header["kid"] = ks.signing.kid
+	}
+	if ks.signing.secret != nil {
+		return token.SignedString(ks.signing.secret)
+	}
+	return token.SignedString(ks.signing.private)
+}
+
+// keyFunc 根据令牌头中的kid选择验证密钥
+func (ks *jwtKeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	key := ks.signing
+	if kid, ok := token.Header["kid"].(string); ok && kid != "" {
+		found, exists := ks.keys[kid]
+		if !exists {
+			return nil, fmt.Errorf("未知的密钥ID: %s", kid)
+		}
+		key = found
+	} else if len(ks.keys) > 1 {
+		return nil, errors.New("令牌缺少kid")
+	}
+
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("令牌算法 %s 与密钥 %s 不匹配", token.Method.Alg(), key.kid)
+	}
+	if key.secret != nil {
+		return key.secret, nil
+	}
+	return key.public, nil
+}
+
+// parse 解析并验证令牌，要求令牌类型为typ且audience包含audience
+func (ks *jwtKeySet) parse(tokenString string, claims jwt.Claims, typ, audience string) (*jwt.Token, error) {
+	token, err := jwt.ParseWithClaims(tokenString, claims, ks.keyFunc, jwt.WithValidMethods(ks.methods), jwt.WithAudience(audience))
+	if err != nil {
+		return token, err
+	}
+	if got, _ := token.Header["typ"].(string); !strings.EqualFold(got, typ) {
+		return token, fmt.Errorf("令牌类型 %s 不是 %s", got, typ)
+	}
+	return token, nil
+}
+
+// jwks 导出全部公钥，HS256模式下为空集合
+func (ks *jwtKeySet) jwks() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range ks.keys {
+		if key.public == nil {
+			continue
+		}
+		jwk := JWK{Kid: key.kid, Use: "sig", Alg: key.method.Alg()}
+		switch pub := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case *ecdsa.PublicKey:
+			size := (pub.Curve.Params().BitSize + 7) / 8
+			jwk.Kty = "EC"
+			jwk.Crv = pub.Curve.Params().Name
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, size)))
+			jwk.Y = base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, size)))
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+// JWKSHandler 公开JWKS，供其他服务验证autops签发的令牌
+func JWKSHandler(c *gin.Context) {
+	if jwtKeys == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "JWT密钥未初始化"})
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, jwtKeys.jwks())
+}
@@ -55,9 +55,7 @@ func AccessLoggerMiddleware() gin.HandlerFunc {
 		// 响应大小
 		responseSize := c.Writer.Size()
 
-		// 记录路由日志
-		routerLogger := logger.GetRouterLogger()
-		routerLogger.Info("请求访问日志",
+		fields := []zap.Field{
 			zap.String("requestID", requestID.(string)),
 			zap.String("clientIP", clientIP),
 			zap.String("method", method),
@@ -66,7 +64,18 @@ func AccessLoggerMiddleware() gin.HandlerFunc {
 			zap.Int("statusCode", statusCode),
 			zap.Int64("responseSize", int64(responseSize)),
 			zap.Duration("duration", duration),
-		)
+		}
+		// 模拟登录的请求记录真实操作人
+		if actor, ok := GetImpersonator(c); ok {
+			fields = append(fields,
+				zap.String("username", c.GetString("username")),
+				zap.String("impersonator", actor.Username),
+				zap.String("impersonatorID", actor.UserID))
+		}
+
+		// 记录路由日志
+		routerLogger := logger.GetRouterLogger()
+		routerLogger.Info("请求访问日志", fields...)
 	}
 }
 
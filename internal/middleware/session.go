@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/GZ-Alinx/autops/business/repositories"
+	"github.com/GZ-Alinx/autops/internal/logger"
+	"github.com/GZ-Alinx/autops/internal/response"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	// sessionTouchInterval 同一会话两次更新最近访问时间的最小间隔
+	sessionTouchInterval = time.Minute
+	// sessionSweepInterval 清理内存中过时的访问记录的间隔
+	sessionSweepInterval = 10 * time.Minute
+)
+
+// sessionChecker 登录会话校验
+type sessionChecker struct {
+	repo      repositories.SessionRepository
+	lastTouch sync.Map // sessionID -> time.Time
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+// newSessionChecker 创建会话校验实例
+func newSessionChecker() *sessionChecker {
+	return &sessionChecker{
+		repo:      repositories.NewSessionRepository(),
+		lastSweep: time.Now(),
+	}
+}
+
+// check 校验令牌所属会话仍然有效，失败时已写入响应
+func (s *sessionChecker) check(c *gin.Context, claims *JWTClaims) bool {
+	session, err := s.repo.GetBySessionID(claims.SessionID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		logger.Logger.Error("查询登录会话失败", zap.String("sid", claims.SessionID), zap.Error(err))
+		response.Fail(c, http.StatusInternalServerError, errors.New("令牌校验失败"))
+		c.Abort()
+		return false
+	}
+
+	now := time.Now()
+	if err != nil || !session.IsActive(now) || strconv.Itoa(int(session.UserID)) != claims.UserID || !sameImpersonator(session.ImpersonatorID, claims.Actor) {
+		logger.Logger.Warn("JWT认证失败: 登录会话已失效", zap.String("username", claims.Username), zap.String("sid", claims.SessionID))
+		s.lastTouch.Delete(claims.SessionID)
+		response.Fail(c, http.StatusUnauthorized, errors.New("会话已失效，请重新登录"))
+		c.Abort()
+		return false
+	}
+
+	s.touch(claims.SessionID, c.ClientIP(), now)
+	return true
+}
+
+// touch 按间隔更新会话最近访问信息，避免每个请求都写数据库
+func (s *sessionChecker) touch(sessionID, ip string, now time.Time) {
+	if last, ok := s.lastTouch.Load(sessionID); ok && now.Sub(last.(time.Time)) < sessionTouchInterval {
+		return
+	}
+	s.lastTouch.Store(sessionID, now)
+	if err := s.repo.Touch(sessionID, ip, now); err != nil {
+		logger.Logger.Warn("更新会话访问时间失败", zap.String("sid", sessionID), zap.Error(err))
+	}
+	s.sweep(now)
+}
+
+// sweep 定期删除超过更新间隔的记录，防止已结束的会话一直占用内存
+func (s *sessionChecker) sweep(now time.Time) {
+	s.mu.Lock()
+	if now.Sub(s.lastSweep) < sessionSweepInterval {
+		s.mu.Unlock()
+		return
+	}
+	s.lastSweep = now
+	s.mu.Unlock()
+
+	s.lastTouch.Range(func(key, value interface{}) bool {
+		if now.Sub(value.(time.Time)) >= sessionTouchInterval {
+			s.lastTouch.Delete(key)
+		}
+		return true
+	})
+}
+
+// sameImpersonator 令牌的act声明与会话记录的模拟发起人一致，普通会话两者都为空
+func sameImpersonator(impersonatorID uint, actor *ImpersonationActor) bool {
+	if actor == nil {
+		return impersonatorID == 0
+	}
+	return impersonatorID != 0 && strconv.Itoa(int(impersonatorID)) == actor.UserID
+}
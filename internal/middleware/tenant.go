@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/business/repositories"
+	"github.com/GZ-Alinx/autops/internal/logger"
+	"github.com/GZ-Alinx/autops/internal/response"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	// TenantHeader 指定当前租户的请求头，值为租户标识
+	TenantHeader = "X-Tenant"
+	// TenantParam 指定当前租户的路径参数，优先于请求头
+	TenantParam = "tenant"
+)
+
+// TenantMiddleware 解析当前请求的租户：路径参数:tenant优先，其次X-Tenant请求头，都没有时为默认租户
+func TenantMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		code := c.Param(TenantParam)
+		if code == "" {
+			code = c.GetHeader(TenantHeader)
+		}
+		if code == "" || code == models.DefaultTenantCode {
+			c.Set("tenantID", uint(0))
+			c.Set("tenant", models.DefaultTenantCode)
+			c.Next()
+			return
+		}
+
+		tenant, err := repositories.NewTenantRepository().GetByCode(code)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				response.Fail(c, http.StatusNotFound, errors.New("租户不存在"))
+			} else {
+				logger.Logger.Error("查询租户失败", zap.String("tenant", code), zap.Error(err))
+				response.Fail(c, http.StatusInternalServerError, errors.New("查询租户失败"))
+			}
+			c.Abort()
+			return
+		}
+
+		c.Set("tenantID", tenant.ID)
+		c.Set("tenant", tenant.Code)
+		c.Next()
+	}
+}
+
+// GetTenant 获取当前请求的租户ID和标识，默认租户的ID为0
+func GetTenant(c *gin.Context) (uint, string) {
+	code := c.GetString("tenant")
+	if code == "" {
+		return 0, models.DefaultTenantCode
+	}
+	return c.GetUint("tenantID"), code
+}
+
+// DefaultTenantOnly 限定接口只能在默认租户下调用，用于用户账号、角色定义等全局资源的管理，
+// 避免租户管理员借助租户内的角色修改其他租户的数据
+func DefaultTenantOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if tenantID, _ := GetTenant(c); tenantID != 0 {
+			response.Fail(c, http.StatusForbidden, errors.New("该接口只能在默认租户下调用"))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,260 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+)
+
+// jwksRefreshInterval 遇到未知kid时重新拉取JWKS的最小间隔，防止被伪造的kid放大请求
+const jwksRefreshInterval = time.Minute
+
+// Claims ID令牌中的声明
+type Claims map[string]interface{}
+
+// String 读取字符串声明
+func (c Claims) String(name string) string {
+	if v, ok := c[name].(string); ok {
+		return v
+	}
+	return ""
+}
+
+// Strings 读取字符串数组声明，单个字符串按一个元素处理
+func (c Claims) Strings(name string) []string {
+	switch v := c[name].(type) {
+	case string:
+		if v == "" {
+			return nil
+		}
+		return []string{v}
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok && s != "" {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// Bool 读取布尔声明，ok表示声明是否存在
+func (c Claims) Bool(name string) (value bool, ok bool) {
+	switch v := c[name].(type) {
+	case bool:
+		return v, true
+	case string:
+		// 部分身份提供方以字符串形式返回email_verified
+		return strings.EqualFold(v, "true"), true
+	}
+	return false, false
+}
+
+// jwk 身份提供方JWKS中的单个密钥
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// VerifyIDToken 校验ID令牌的签名、issuer、audience、有效期和nonce，返回全部声明
+func (p *Provider) VerifyIDToken(ctx context.Context, rawIDToken, nonce string) (Claims, error) {
+	claims := jwt.MapClaims{}
+	parser := jwt.NewParser(
+		jwt.WithValidMethods(p.signingAlgorithms()),
+		jwt.WithIssuer(p.metadata.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if _, err := parser.ParseWithClaims(rawIDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		return p.verificationKey(ctx, token)
+	}); err != nil {
+		return nil, fmt.Errorf("ID令牌校验失败: %v", err)
+	}
+
+	result := Claims(claims)
+	if result.String("sub") == "" {
+		return nil, errors.New("ID令牌缺少sub声明")
+	}
+	// 多个audience时azp必须是本客户端
+	aud, _ := claims.GetAudience()
+	azp := result.String("azp")
+	if (len(aud) > 1 || azp != "") && azp != p.cfg.ClientID {
+		return nil, errors.New("ID令牌的azp与client_id不一致")
+	}
+	if nonce == "" || result.String("nonce") != nonce {
+		return nil, errors.New("ID令牌的nonce不匹配")
+	}
+	return result, nil
+}
+
+// signingAlgorithms 允许的签名算法，以发现文档为准，默认RS256
+func (p *Provider) signingAlgorithms() []string {
+	algs := p.metadata.IDTokenSigningAlgValuesSupported
+	if len(algs) == 0 {
+		algs = []string{"RS256"}
+	}
+	out := make([]string, 0, len(algs))
+	for _, alg := range algs {
+		// 不接受未签名的令牌；HMAC签名以客户端密钥为密钥，公共客户端不能使用
+		if alg == "none" || (strings.HasPrefix(alg, "HS") && p.cfg.ClientSecret == "") {
+			continue
+		}
+		out = append(out, alg)
+	}
+	return out
+}
+
+// verificationKey 返回校验签名的密钥
+func (p *Provider) verificationKey(ctx context.Context, token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		return []byte(p.cfg.ClientSecret), nil
+	}
+	kid, _ := token.Header["kid"].(string)
+	return p.publicKey(ctx, kid)
+}
+
+// publicKey 按kid查找公钥，未找到时重新拉取JWKS以支持身份提供方轮换密钥
+func (p *Provider) publicKey(ctx context.Context, kid string) (interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	if !p.keysFetched.IsZero() && time.Since(p.keysFetched) < jwksRefreshInterval {
+		return nil, fmt.Errorf("未找到kid为%s的签名密钥", kid)
+	}
+
+	keys, err := p.fetchKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.keys = keys
+	p.keysFetched = time.Now()
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("未找到kid为%s的签名密钥", kid)
+}
+
+// lookupKey 查找已缓存的公钥，令牌没有kid且只有一个密钥时使用该密钥
+func (p *Provider) lookupKey(kid string) (interface{}, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+// fetchKeys 拉取并解析JWKS
+func (p *Provider) fetchKeys(ctx context.Context) (map[string]interface{}, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := p.getJSON(ctx, p.metadata.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("读取JWKS失败: %v", err)
+	}
+
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			// 不支持的密钥类型不影响其他密钥
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("JWKS中没有可用的签名密钥")
+	}
+	return keys, nil
+}
+
+// publicKey 将JWK转换为公钥
+func (k jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("RSA公钥指数无效")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("不支持的EC曲线: %s", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("EC公钥不在曲线上")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("不支持的OKP曲线: %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("Ed25519公钥无效")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("不支持的密钥类型: %s", k.Kty)
+}
+
+// decodeBigInt 解码base64url编码的大整数
+func decodeBigInt(s string) (*big.Int, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(buf) == 0 {
+		return nil, errors.New("JWK参数编码无效")
+	}
+	return new(big.Int).SetBytes(buf), nil
+}
@@ -0,0 +1,305 @@
+package oidc
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+)
+
+const testNonce = "nonce-1"
+
+func TestVerifyIDToken(t *testing.T) {
+	m := newMockIssuer(t)
+	rsaKey, rsaPub := rsaJWK(t, "rsa-1")
+	ecKey, ecPub := ecJWK(t, "ec-1")
+	otherKey, _ := rsaJWK(t, "rsa-1")
+	m.setKeys(rsaPub, ecPub)
+
+	now := time.Now()
+	// valid 返回合法的声明，modify修改后用于各个用例
+	valid := func(modify func(jwt.MapClaims)) jwt.MapClaims {
+		claims := jwt.MapClaims{
+			"iss":   m.issuer(),
+			"sub":   "user-1",
+			"aud":   testClientID,
+			"exp":   now.Add(5 * time.Minute).Unix(),
+			"iat":   now.Unix(),
+			"nonce": testNonce,
+		}
+		if modify != nil {
+			modify(claims)
+		}
+		return claims
+	}
+	rs256 := func(modify func(jwt.MapClaims)) string {
+		return sign(t, jwt.SigningMethodRS256, rsaKey, "rsa-1", valid(modify))
+	}
+
+	tests := []struct {
+		name    string
+		secret  string   // 客户端密钥，为空表示公共客户端
+		algs    []string // 发现文档中的id_token_signing_alg_values_supported
+		token   func() string
+		nonce   string
+		wantErr string
+	}{
+		{name: "RS256", token: func() string { return rs256(nil) }},
+		{name: "ES256", token: func() string { return sign(t, jwt.SigningMethodES256, ecKey, "ec-1", valid(nil)) }},
+		{name: "audience为数组且azp为本客户端", token: func() string {
+			return rs256(func(c jwt.MapClaims) { c["aud"] = []string{testClientID, "other"}; c["azp"] = testClientID })
+		}},
+		{name: "时钟偏差在一分钟内", token: func() string {
+			return rs256(func(c jwt.MapClaims) { c["exp"] = now.Add(-30 * time.Second).Unix() })
+		}},
+		{
+			name:    "issuer不一致",
+			token:   func() string { return rs256(func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }) },
+			wantErr: "校验失败",
+		},
+		{
+			name:    "audience不包含本客户端",
+			token:   func() string { return rs256(func(c jwt.MapClaims) { c["aud"] = "other" }) },
+			wantErr: "校验失败",
+		},
+		{
+			name:    "多个audience缺少azp",
+			token:   func() string { return rs256(func(c jwt.MapClaims) { c["aud"] = []string{testClientID, "other"} }) },
+			wantErr: "azp",
+		},
+		{
+			name:    "azp不是本客户端",
+			token:   func() string { return rs256(func(c jwt.MapClaims) { c["azp"] = "other" }) },
+			wantErr: "azp",
+		},
+		{
+			name:    "nonce不匹配",
+			token:   func() string { return rs256(func(c jwt.MapClaims) { c["nonce"] = "other" }) },
+			wantErr: "nonce",
+		},
+		{
+			name:    "缺少nonce",
+			token:   func() string { return rs256(func(c jwt.MapClaims) { delete(c, "nonce") }) },
+			wantErr: "nonce",
+		},
+		{
+			name:    "期望的nonce为空",
+			token:   func() string { return rs256(func(c jwt.MapClaims) { c["nonce"] = "" }) },
+			nonce:   "-",
+			wantErr: "nonce",
+		},
+		{
+			name:    "已过期",
+			token:   func() string { return rs256(func(c jwt.MapClaims) { c["exp"] = now.Add(-2 * time.Minute).Unix() }) },
+			wantErr: "校验失败",
+		},
+		{
+			name:    "缺少exp",
+			token:   func() string { return rs256(func(c jwt.MapClaims) { delete(c, "exp") }) },
+			wantErr: "校验失败",
+		},
+		{
+			name:    "签发时间在未来",
+			token:   func() string { return rs256(func(c jwt.MapClaims) { c["iat"] = now.Add(10 * time.Minute).Unix() }) },
+			wantErr: "校验失败",
+		},
+		{
+			name:    "缺少sub",
+			token:   func() string { return rs256(func(c jwt.MapClaims) { delete(c, "sub") }) },
+			wantErr: "sub",
+		},
+		{
+			name:    "签名密钥不是身份提供方的",
+			token:   func() string { return sign(t, jwt.SigningMethodRS256, otherKey, "rsa-1", valid(nil)) },
+			wantErr: "校验失败",
+		},
+		{
+			name:    "kid不存在",
+			token:   func() string { return sign(t, jwt.SigningMethodRS256, rsaKey, "unknown", valid(nil)) },
+			wantErr: "unknown",
+		},
+		{
+			name:    "算法不在发现文档允许的范围内",
+			algs:    []string{"RS256"},
+			token:   func() string { return sign(t, jwt.SigningMethodES256, ecKey, "ec-1", valid(nil)) },
+			wantErr: "校验失败",
+		},
+		{
+			name: "拒绝未签名的令牌",
+			algs: []string{"RS256", "none"},
+			token: func() string {
+				return sign(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, "rsa-1", valid(nil))
+			},
+			wantErr: "校验失败",
+		},
+		{
+			name:    "公共客户端拒绝HS256",
+			algs:    []string{"RS256", "HS256"},
+			token:   func() string { return sign(t, jwt.SigningMethodHS256, []byte(""), "", valid(nil)) },
+			wantErr: "校验失败",
+		},
+		{
+			name:   "机密客户端接受以客户端密钥签名的HS256",
+			secret: "s3cret",
+			algs:   []string{"RS256", "HS256"},
+			token:  func() string { return sign(t, jwt.SigningMethodHS256, []byte("s3cret"), "", valid(nil)) },
+		},
+		{
+			name:    "HS256令牌被以公钥伪造",
+			secret:  "s3cret",
+			algs:    []string{"RS256", "HS256"},
+			token:   func() string { return sign(t, jwt.SigningMethodHS256, []byte(rsaPub.N), "rsa-1", valid(nil)) },
+			wantErr: "校验失败",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.algs != nil {
+				m.setMetadata("id_token_signing_alg_values_supported", tt.algs)
+			} else {
+				m.setMetadata("id_token_signing_alg_values_supported", []string{"RS256", "ES256"})
+			}
+			cfg := m.config()
+			cfg.ClientSecret = tt.secret
+			p := m.discover(cfg)
+
+			nonce := testNonce
+			if tt.nonce == "-" {
+				nonce = ""
+			}
+			claims, err := p.VerifyIDToken(context.Background(), tt.token(), nonce)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("期望包含%q的错误，实际为%v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifyIDToken失败: %v", err)
+			}
+			if claims.String("sub") != "user-1" {
+				t.Errorf("sub为%q", claims.String("sub"))
+			}
+		})
+	}
+}
+
+// TestJWKSRefresh 身份提供方轮换密钥后按新kid重新拉取JWKS，伪造的kid不会在刷新间隔内反复触发拉取
+func TestJWKSRefresh(t *testing.T) {
+	m := newMockIssuer(t)
+	oldKey, oldPub := rsaJWK(t, "old")
+	m.setKeys(oldPub)
+	p := m.discover(m.config())
+
+	claims := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":   m.issuer(),
+			"sub":   "user-1",
+			"aud":   testClientID,
+			"exp":   time.Now().Add(5 * time.Minute).Unix(),
+			"iat":   time.Now().Unix(),
+			"nonce": testNonce,
+		}
+	}
+	verify := func(raw string) error {
+		_, err := p.VerifyIDToken(context.Background(), raw, testNonce)
+		return err
+	}
+
+	if err := verify(sign(t, jwt.SigningMethodRS256, oldKey, "old", claims())); err != nil {
+		t.Fatalf("首次校验失败: %v", err)
+	}
+	if err := verify(sign(t, jwt.SigningMethodRS256, oldKey, "old", claims())); err != nil {
+		t.Fatalf("使用缓存的密钥校验失败: %v", err)
+	}
+	if got := m.fetches(); got != 1 {
+		t.Fatalf("JWKS拉取%d次，期望1次", got)
+	}
+
+	// 轮换密钥，刷新间隔内遇到新kid不重新拉取
+	newKey, newPub := rsaJWK(t, "new")
+	m.setKeys(oldPub, newPub)
+	if err := verify(sign(t, jwt.SigningMethodRS256, newKey, "new", claims())); err == nil {
+		t.Fatal("刷新间隔内不应接受未缓存的kid")
+	}
+	if got := m.fetches(); got != 1 {
+		t.Fatalf("刷新间隔内JWKS拉取了%d次，期望1次", got)
+	}
+
+	// 超过刷新间隔后遇到新kid重新拉取
+	p.mu.Lock()
+	p.keysFetched = time.Now().Add(-jwksRefreshInterval - time.Second)
+	p.mu.Unlock()
+	if err := verify(sign(t, jwt.SigningMethodRS256, newKey, "new", claims())); err != nil {
+		t.Fatalf("轮换后的密钥校验失败: %v", err)
+	}
+	if got := m.fetches(); got != 2 {
+		t.Fatalf("JWKS拉取%d次，期望2次", got)
+	}
+
+	// 伪造的kid在刷新间隔内不再触发拉取
+	for i := 0; i < 3; i++ {
+		if err := verify(sign(t, jwt.SigningMethodRS256, newKey, "forged", claims())); err == nil {
+			t.Fatal("不应接受不存在的kid")
+		}
+	}
+	if got := m.fetches(); got != 2 {
+		t.Fatalf("伪造的kid触发了JWKS拉取，共%d次", got)
+	}
+}
+
+func TestJWKPublicKey(t *testing.T) {
+	_, rsaPub := rsaJWK(t, "rsa")
+	_, ecPub := ecJWK(t, "ec")
+	offCurve := ecPub
+	offCurve.Y = offCurve.X
+
+	tests := []struct {
+		name    string
+		key     jwk
+		wantErr bool
+	}{
+		{name: "RSA", key: rsaPub},
+		{name: "EC", key: ecPub},
+		{name: "EC点不在曲线上", key: offCurve, wantErr: true},
+		{name: "不支持的曲线", key: jwk{Kty: "EC", Crv: "P-192", X: ecPub.X, Y: ecPub.Y}, wantErr: true},
+		{name: "Ed25519长度错误", key: jwk{Kty: "OKP", Crv: "Ed25519", X: "AAAA"}, wantErr: true},
+		{name: "不支持的类型", key: jwk{Kty: "oct"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.key.publicKey()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("错误为%v，期望出错: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFetchKeysSkipsEncryptionKeys(t *testing.T) {
+	m := newMockIssuer(t)
+	_, sigPub := rsaJWK(t, "sig")
+	_, encPub := rsaJWK(t, "enc")
+	encPub.Use = "enc"
+	m.setKeys(sigPub, encPub)
+	p := m.discover(m.config())
+
+	keys, err := p.fetchKeys(context.Background())
+	if err != nil {
+		t.Fatalf("fetchKeys失败: %v", err)
+	}
+	if _, ok := keys["enc"]; ok {
+		t.Error("用于加密的密钥不应用于校验签名")
+	}
+	if _, ok := keys["sig"]; !ok {
+		t.Error("缺少签名密钥")
+	}
+
+	m.setKeys(encPub)
+	if _, err := p.fetchKeys(context.Background()); err == nil {
+		t.Error("没有签名密钥时应返回错误")
+	}
+}
@@ -0,0 +1,219 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GZ-Alinx/autops/internal/config"
+)
+
+// Metadata 身份提供方发现文档中用到的字段
+type Metadata struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+}
+
+// Token 令牌端点的响应
+type Token struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	IDToken      string `json:"id_token"`
+}
+
+// tokenError 令牌端点返回的错误
+type tokenError struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Provider OIDC身份提供方客户端
+type Provider struct {
+	cfg      config.OIDCConfig
+	metadata Metadata
+	client   *http.Client
+
+	mu          sync.Mutex
+	keys        map[string]interface{} // kid到公钥
+	keysFetched time.Time
+}
+
+// Discover 读取发现文档并创建身份提供方客户端
+func Discover(ctx context.Context, cfg config.OIDCConfig) (*Provider, error) {
+	if cfg.Issuer == "" || cfg.ClientID == "" || cfg.RedirectURL == "" {
+		return nil, errors.New("OIDC配置不完整: issuer、client_id、redirect_url不能为空")
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "profile", "email"}
+	}
+	if cfg.TimeoutSeconds <= 0 {
+		cfg.TimeoutSeconds = 10
+	}
+
+	p := &Provider{
+		cfg:    cfg,
+		client: &http.Client{Timeout: time.Duration(cfg.TimeoutSeconds) * time.Second},
+	}
+	wellKnown := strings.TrimSuffix(cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(ctx, wellKnown, &p.metadata); err != nil {
+		return nil, fmt.Errorf("读取OIDC发现文档失败: %v", err)
+	}
+	// 发现文档中的issuer必须与配置一致，防止被替换为其他身份提供方
+	if strings.TrimSuffix(p.metadata.Issuer, "/") != strings.TrimSuffix(cfg.Issuer, "/") {
+		return nil, fmt.Errorf("OIDC发现文档的issuer(%s)与配置(%s)不一致", p.metadata.Issuer, cfg.Issuer)
+	}
+	if p.metadata.AuthorizationEndpoint == "" || p.metadata.TokenEndpoint == "" || p.metadata.JWKSURI == "" {
+		return nil, errors.New("OIDC发现文档缺少authorization_endpoint、token_endpoint或jwks_uri")
+	}
+	return p, nil
+}
+
+// Metadata 返回发现文档
+func (p *Provider) Metadata() Metadata {
+	return p.metadata
+}
+
+// AuthCodeURL 生成授权地址，使用S256方式的PKCE
+func (p *Provider) AuthCodeURL(state, nonce, codeVerifier string) string {
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", p.cfg.ClientID)
+	q.Set("redirect_uri", p.cfg.RedirectURL)
+	q.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", CodeChallenge(codeVerifier))
+	q.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(p.metadata.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return p.metadata.AuthorizationEndpoint + sep + q.Encode()
+}
+
+// Exchange 使用授权码和PKCE校验码换取令牌
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier string) (*Token, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.cfg.RedirectURL)
+	form.Set("code_verifier", codeVerifier)
+
+	// 有客户端密钥时默认使用client_secret_basic，身份提供方只支持post方式时放在表单中
+	useBasic := p.cfg.ClientSecret != "" && !p.onlySupportsPostAuth()
+	if !useBasic {
+		form.Set("client_id", p.cfg.ClientID)
+		if p.cfg.ClientSecret != "" {
+			form.Set("client_secret", p.cfg.ClientSecret)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if useBasic {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var e tokenError
+		if json.Unmarshal(body, &e) == nil && e.Error != "" {
+			return nil, fmt.Errorf("令牌端点返回错误: %s %s", e.Error, e.ErrorDescription)
+		}
+		return nil, fmt.Errorf("令牌端点返回状态码%d", resp.StatusCode)
+	}
+
+	var token Token
+	if err := json.Unmarshal(body, &token); err != nil {
+		return nil, fmt.Errorf("解析令牌端点响应失败: %v", err)
+	}
+	if token.IDToken == "" {
+		return nil, errors.New("令牌端点未返回id_token，请检查scope是否包含openid")
+	}
+	return &token, nil
+}
+
+// onlySupportsPostAuth 身份提供方是否只支持client_secret_post
+func (p *Provider) onlySupportsPostAuth() bool {
+	methods := p.metadata.TokenEndpointAuthMethodsSupported
+	if len(methods) == 0 {
+		return false
+	}
+	for _, m := range methods {
+		if m == "client_secret_basic" {
+			return false
+		}
+	}
+	for _, m := range methods {
+		if m == "client_secret_post" {
+			return true
+		}
+	}
+	return false
+}
+
+// getJSON 请求JSON文档
+func (p *Provider) getJSON(ctx context.Context, rawURL string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s 返回状态码%d", rawURL, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+// RandomString 生成URL安全的随机字符串，用于state、nonce和PKCE校验码
+func RandomString(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// CodeChallenge 按RFC 7636的S256方式计算PKCE质询值
+func CodeChallenge(codeVerifier string) string {
+	sum := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
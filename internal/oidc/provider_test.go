@@ -0,0 +1,356 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+
+	"github.com/GZ-Alinx/autops/internal/config"
+)
+
+const (
+	testClientID    = "autops"
+	testRedirectURL = "http://localhost:8080/callback"
+)
+
+// mockIssuer 本地模拟的身份提供方，提供发现文档、JWKS和令牌端点
+type mockIssuer struct {
+	t      *testing.T
+	server *httptest.Server
+
+	mu          sync.Mutex
+	metadata    map[string]interface{} // 覆盖发现文档中的字段
+	keys        []jwk
+	jwksFetches int
+	token       func(w http.ResponseWriter, r *http.Request)
+}
+
+// newMockIssuer 启动模拟身份提供方，测试结束时关闭
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+	m := &mockIssuer{t: t, metadata: map[string]interface{}{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", m.serveDiscovery)
+	mux.HandleFunc("/jwks", m.serveJWKS)
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		handler := m.token
+		m.mu.Unlock()
+		if handler == nil {
+			http.NotFound(w, r)
+			return
+		}
+		handler(w, r)
+	})
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+// issuer 身份提供方地址
+func (m *mockIssuer) issuer() string {
+	return m.server.URL
+}
+
+func (m *mockIssuer) serveDiscovery(w http.ResponseWriter, r *http.Request) {
+	doc := map[string]interface{}{
+		"issuer":                                m.issuer(),
+		"authorization_endpoint":                m.issuer() + "/authorize",
+		"token_endpoint":                        m.issuer() + "/token",
+		"jwks_uri":                              m.issuer() + "/jwks",
+		"id_token_signing_alg_values_supported": []string{"RS256", "ES256"},
+	}
+	m.mu.Lock()
+	for k, v := range m.metadata {
+		if v == nil {
+			delete(doc, k)
+		} else {
+			doc[k] = v
+		}
+	}
+	m.mu.Unlock()
+	json.NewEncoder(w).Encode(doc)
+}
+
+func (m *mockIssuer) serveJWKS(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.jwksFetches++
+	json.NewEncoder(w).Encode(map[string]interface{}{"keys": m.keys})
+}
+
+// setKeys 替换JWKS中的密钥，模拟身份提供方轮换密钥
+func (m *mockIssuer) setKeys(keys ...jwk) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keys = keys
+}
+
+// fetches JWKS被拉取的次数
+func (m *mockIssuer) fetches() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.jwksFetches
+}
+
+// setMetadata 覆盖发现文档中的字段，值为nil时删除该字段
+func (m *mockIssuer) setMetadata(name string, value interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.metadata[name] = value
+}
+
+// setToken 设置令牌端点的处理函数
+func (m *mockIssuer) setToken(handler func(w http.ResponseWriter, r *http.Request)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.token = handler
+}
+
+// config 指向模拟身份提供方的OIDC配置
+func (m *mockIssuer) config() config.OIDCConfig {
+	return config.OIDCConfig{
+		Issuer:      m.issuer(),
+		ClientID:    testClientID,
+		RedirectURL: testRedirectURL,
+	}
+}
+
+// discover 使用cfg创建身份提供方客户端
+func (m *mockIssuer) discover(cfg config.OIDCConfig) *Provider {
+	m.t.Helper()
+	p, err := Discover(context.Background(), cfg)
+	if err != nil {
+		m.t.Fatalf("Discover失败: %v", err)
+	}
+	return p
+}
+
+// rsaJWK 生成RSA签名密钥及对应的JWK
+func rsaJWK(t *testing.T, kid string) (*rsa.PrivateKey, jwk) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("生成RSA密钥失败: %v", err)
+	}
+	return key, jwk{
+		Kty: "RSA",
+		Kid: kid,
+		Use: "sig",
+		Alg: "RS256",
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+// ecJWK 生成P-256签名密钥及对应的JWK
+func ecJWK(t *testing.T, kid string) (*ecdsa.PrivateKey, jwk) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("生成EC密钥失败: %v", err)
+	}
+	return key, jwk{
+		Kty: "EC",
+		Kid: kid,
+		Use: "sig",
+		Alg: "ES256",
+		Crv: "P-256",
+		X:   base64.RawURLEncoding.EncodeToString(key.X.Bytes()),
+		Y:   base64.RawURLEncoding.EncodeToString(key.Y.Bytes()),
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	tests := []struct {
+		name    string
+		field   string
+		value   interface{}
+		wantErr string
+	}{
+		{name: "正常"},
+		{name: "issuer不一致", field: "issuer", value: "https://evil.example.com", wantErr: "issuer"},
+		{name: "缺少jwks_uri", field: "jwks_uri", wantErr: "jwks_uri"},
+		{name: "缺少token_endpoint", field: "token_endpoint", wantErr: "token_endpoint"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMockIssuer(t)
+			if tt.field != "" {
+				m.setMetadata(tt.field, tt.value)
+			}
+			p, err := Discover(context.Background(), m.config())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("期望包含%q的错误，实际为%v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Discover失败: %v", err)
+			}
+			if got := p.Metadata().TokenEndpoint; got != m.issuer()+"/token" {
+				t.Errorf("token_endpoint为%s", got)
+			}
+		})
+	}
+
+	t.Run("配置不完整", func(t *testing.T) {
+		if _, err := Discover(context.Background(), config.OIDCConfig{Issuer: "https://sso.example.com"}); err == nil {
+			t.Fatal("缺少client_id和redirect_url时应返回错误")
+		}
+	})
+
+	t.Run("issuer末尾的斜杠不影响比较", func(t *testing.T) {
+		m := newMockIssuer(t)
+		cfg := m.config()
+		cfg.Issuer += "/"
+		m.discover(cfg)
+	})
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	m := newMockIssuer(t)
+	p := m.discover(m.config())
+
+	raw := p.AuthCodeURL("state-1", "nonce-1", "verifier-1")
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatalf("解析授权地址失败: %v", err)
+	}
+	if got := u.Scheme + "://" + u.Host + u.Path; got != m.issuer()+"/authorize" {
+		t.Errorf("授权端点为%s", got)
+	}
+	q := u.Query()
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             testClientID,
+		"redirect_uri":          testRedirectURL,
+		"scope":                 "openid profile email",
+		"state":                 "state-1",
+		"nonce":                 "nonce-1",
+		"code_challenge":        CodeChallenge("verifier-1"),
+		"code_challenge_method": "S256",
+	}
+	for k, v := range want {
+		if q.Get(k) != v {
+			t.Errorf("%s为%q，期望%q", k, q.Get(k), v)
+		}
+	}
+}
+
+func TestCodeChallenge(t *testing.T) {
+	// RFC 7636 附录B的示例
+	got := CodeChallenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk")
+	if want := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"; got != want {
+		t.Fatalf("CodeChallenge为%s，期望%s", got, want)
+	}
+}
+
+func TestExchange(t *testing.T) {
+	tests := []struct {
+		name        string
+		secret      string
+		authMethods []string
+		wantBasic   bool
+		response    func(w http.ResponseWriter)
+		wantErr     string
+	}{
+		{name: "公共客户端在表单中发送client_id"},
+		{name: "机密客户端默认使用basic认证", secret: "s3cret", wantBasic: true},
+		{name: "只支持post时在表单中发送密钥", secret: "s3cret", authMethods: []string{"client_secret_post"}},
+		{
+			name: "令牌端点返回错误",
+			response: func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error":"invalid_grant","error_description":"code expired"}`))
+			},
+			wantErr: "invalid_grant",
+		},
+		{
+			name: "未返回id_token",
+			response: func(w http.ResponseWriter) {
+				w.Write([]byte(`{"access_token":"at","token_type":"Bearer"}`))
+			},
+			wantErr: "id_token",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMockIssuer(t)
+			if tt.authMethods != nil {
+				m.setMetadata("token_endpoint_auth_methods_supported", tt.authMethods)
+			}
+			m.setToken(func(w http.ResponseWriter, r *http.Request) {
+				if err := r.ParseForm(); err != nil {
+					t.Errorf("解析表单失败: %v", err)
+				}
+				form := r.PostForm
+				if form.Get("grant_type") != "authorization_code" || form.Get("code") != "code-1" ||
+					form.Get("code_verifier") != "verifier-1" || form.Get("redirect_uri") != testRedirectURL {
+					t.Errorf("令牌请求参数错误: %v", form)
+				}
+				user, pass, basic := r.BasicAuth()
+				if basic != tt.wantBasic {
+					t.Errorf("basic认证为%v，期望%v", basic, tt.wantBasic)
+				}
+				if basic {
+					if user != testClientID || pass != tt.secret || form.Get("client_secret") != "" {
+						t.Errorf("basic认证参数错误: %s %s", user, pass)
+					}
+				} else if form.Get("client_id") != testClientID || form.Get("client_secret") != tt.secret {
+					t.Errorf("表单中的客户端参数错误: %v", form)
+				}
+				if tt.response != nil {
+					tt.response(w)
+					return
+				}
+				w.Write([]byte(`{"access_token":"at","token_type":"Bearer","id_token":"idt"}`))
+			})
+
+			cfg := m.config()
+			cfg.ClientSecret = tt.secret
+			p := m.discover(cfg)
+			token, err := p.Exchange(context.Background(), "code-1", "verifier-1")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("期望包含%q的错误，实际为%v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Exchange失败: %v", err)
+			}
+			if token.IDToken != "idt" {
+				t.Errorf("id_token为%q", token.IDToken)
+			}
+		})
+	}
+}
+
+// sign 签发令牌，kid为空时不设置kid头
+func sign(t *testing.T, method jwt.SigningMethod, key interface{}, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	raw, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("签发令牌失败: %v", err)
+	}
+	return raw
+}
@@ -0,0 +1,199 @@
+package password
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/GZ-Alinx/autops/internal/config"
+)
+
+// 默认策略参数
+const (
+	DefaultMinLength = 8
+	DefaultMaxLength = 72 // bcrypt只使用前72个字节
+)
+
+// commonPasswords 内置的常见弱密码
+var commonPasswords = []string{
+	"123456", "1234567", "12345678", "123456789", "1234567890", "111111", "000000",
+	"123123", "654321", "666666", "888888", "112233", "121212", "abc123", "abcd1234",
+	"password", "password1", "password123", "passw0rd", "p@ssw0rd", "p@ssword",
+	"qwerty", "qwerty123", "qwertyuiop", "1qaz2wsx", "1q2w3e4r", "zaq12wsx",
+	"admin", "admin123", "admin@123", "administrator", "root", "root123", "toor",
+	"letmein", "welcome", "welcome1", "iloveyou", "monkey", "dragon", "sunshine",
+	"football", "baseball", "master", "superman", "trustno1", "changeme", "secret",
+	"test123", "guest", "a123456", "aa123456", "woaini1314", "5201314",
+}
+
+// PolicyError 密码不符合策略，Reasons为全部不满足的规则
+type PolicyError struct {
+	Reasons []string
+}
+
+// Error 实现error接口
+func (e *PolicyError) Error() string {
+	return "密码不符合安全策略: " + strings.Join(e.Reasons, "；")
+}
+
+// Policy 密码策略
+type Policy struct {
+	MinLength      int
+	MaxLength      int
+	RequireUpper   bool
+	RequireLower   bool
+	RequireDigit   bool
+	RequireSymbol  bool
+	MinCharClasses int // 至少包含的字符类别数（大写、小写、数字、符号）
+	HistorySize    int // 禁止与最近N次使用过的密码相同，0表示只禁止与当前密码相同
+	MaxAge         time.Duration
+	denylist       map[string]struct{}
+}
+
+// NewPolicy 根据配置创建密码策略
+func NewPolicy(cfg config.PasswordPolicyConfig) (*Policy, error) {
+	p := &Policy{
+		MinLength:      cfg.MinLength,
+		MaxLength:      DefaultMaxLength,
+		RequireUpper:   cfg.RequireUpper,
+		RequireLower:   cfg.RequireLower,
+		RequireDigit:   cfg.RequireDigit,
+		RequireSymbol:  cfg.RequireSymbol,
+		MinCharClasses: cfg.MinCharClasses,
+		HistorySize:    cfg.HistorySize,
+		MaxAge:         time.Duration(cfg.MaxAgeDays) * 24 * time.Hour,
+		denylist:       make(map[string]struct{}, len(commonPasswords)+len(cfg.Denylist)),
+	}
+	if p.MinLength <= 0 {
+		p.MinLength = DefaultMinLength
+	}
+	if p.MinCharClasses > 4 {
+		p.MinCharClasses = 4
+	}
+	if p.HistorySize < 0 {
+		p.HistorySize = 0
+	}
+
+	for _, pw := range commonPasswords {
+		p.denylist[pw] = struct{}{}
+	}
+	for _, pw := range cfg.Denylist {
+		p.addDenied(pw)
+	}
+	if cfg.DenylistFile != "" {
+		if err := p.loadDenylistFile(cfg.DenylistFile); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// Default 使用全局配置创建密码策略，加载失败时退回内置默认值
+func Default() *Policy {
+	p, err := NewPolicy(config.AppConfig.PasswordPolicy)
+	if err != nil {
+		p, _ = NewPolicy(config.PasswordPolicyConfig{})
+	}
+	return p
+}
+
+// addDenied 添加禁用密码，不区分大小写
+func (p *Policy) addDenied(pw string) {
+	pw = strings.ToLower(strings.TrimSpace(pw))
+	if pw != "" && !strings.HasPrefix(pw, "#") {
+		p.denylist[pw] = struct{}{}
+	}
+}
+
+// loadDenylistFile 加载禁用密码文件，每行一个密码，#开头为注释
+func (p *Policy) loadDenylistFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("读取密码黑名单文件失败: %v", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		p.addDenied(scanner.Text())
+	}
+	return scanner.Err()
+}
+
+// Validate 校验密码是否符合策略，username用于禁止密码包含用户名
+func (p *Policy) Validate(password, username string) error {
+	var reasons []string
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		reasons = append(reasons, fmt.Sprintf("长度不能少于%d位", p.MinLength))
+	}
+	if len(password) > p.MaxLength {
+		reasons = append(reasons, fmt.Sprintf("长度不能超过%d个字节", p.MaxLength))
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+	if p.RequireUpper && !upper {
+		reasons = append(reasons, "必须包含大写字母")
+	}
+	if p.RequireLower && !lower {
+		reasons = append(reasons, "必须包含小写字母")
+	}
+	if p.RequireDigit && !digit {
+		reasons = append(reasons, "必须包含数字")
+	}
+	if p.RequireSymbol && !symbol {
+		reasons = append(reasons, "必须包含特殊字符")
+	}
+	if classes := countTrue(upper, lower, digit, symbol); classes < p.MinCharClasses {
+		reasons = append(reasons, fmt.Sprintf("至少包含大写字母、小写字母、数字、特殊字符中的%d类", p.MinCharClasses))
+	}
+
+	lowered := strings.ToLower(password)
+	if _, ok := p.denylist[lowered]; ok {
+		reasons = append(reasons, "属于常见弱密码")
+	}
+	if username != "" && len(username) >= 3 && strings.Contains(lowered, strings.ToLower(username)) {
+		reasons = append(reasons, "不能包含用户名")
+	}
+
+	if len(reasons) > 0 {
+		return &PolicyError{Reasons: reasons}
+	}
+	return nil
+}
+
+// Expired 密码是否已超过最长使用期限，changedAt为空表示从未记录修改时间
+func (p *Policy) Expired(changedAt time.Time, now time.Time) bool {
+	if p.MaxAge <= 0 || changedAt.IsZero() {
+		return false
+	}
+	return now.Sub(changedAt) > p.MaxAge
+}
+
+// countTrue 统计为true的个数
+func countTrue(values ...bool) int {
+	n := 0
+	for _, v := range values {
+		if v {
+			n++
+		}
+	}
+	return n
+}
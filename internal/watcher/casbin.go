@@ -0,0 +1,220 @@
+package watcher
+
+import (
+	"sync"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+	"go.uber.org/zap"
+
+	"github.com/GZ-Alinx/autops/internal/authcache"
+	"github.com/GZ-Alinx/autops/internal/logger"
+)
+
+// enforcerWatcher 实现Casbin的persist.WatcherEx：把本实例的策略变更发布出去，把其他实例的变更应用到enforcer
+type enforcerWatcher struct {
+	enforcer *casbin.SyncedEnforcer
+	watcher  Watcher
+	origin   string
+}
+
+// UserNotifier 通知其他实例用户的账号状态已变化
+type UserNotifier interface {
+	NotifyUserChanged(userIDs ...uint)
+}
+
+var (
+	userHandlersMu sync.RWMutex
+	userHandlers   []func(userID uint)
+)
+
+// OnUserChanged 注册收到其他实例的用户变化通知时的处理函数，用于清除各模块的用户缓存
+func OnUserChanged(fn func(userID uint)) {
+	userHandlersMu.Lock()
+	defer userHandlersMu.Unlock()
+	userHandlers = append(userHandlers, fn)
+}
+
+// Bind 把watcher设置到enforcer并开始接收其他实例的通知，返回用于发布用户变化的UserNotifier
+func Bind(enforcer *casbin.SyncedEnforcer, w Watcher) (UserNotifier, error) {
+	ew := &enforcerWatcher{enforcer: enforcer, watcher: w, origin: newInstanceID()}
+	if err := enforcer.SetWatcher(ew); err != nil {
+		return nil, err
+	}
+	if err := w.Subscribe(ew.apply); err != nil {
+		return nil, err
+	}
+	return ew, nil
+}
+
+// NotifyUserChanged 通知其他实例清除用户缓存，本实例的缓存由调用方清除
+func (ew *enforcerWatcher) NotifyUserChanged(userIDs ...uint) {
+	if len(userIDs) == 0 {
+		return
+	}
+	ew.publish(Message{Op: OpUserChanged, UserIDs: userIDs})
+}
+
+// publish 发布本实例的变更，失败只记录日志，不影响本实例的修改
+func (ew *enforcerWatcher) publish(msg Message) error {
+	msg.Origin = ew.origin
+	if err := ew.watcher.Publish(msg); err != nil {
+		logger.Logger.Error("发布策略变更通知失败", zap.String("op", msg.Op), zap.Error(err))
+	}
+	return nil
+}
+
+// SetUpdateCallback 收到通知时的处理由apply完成，不使用Casbin的回调
+func (ew *enforcerWatcher) SetUpdateCallback(func(string)) error {
+	return nil
+}
+
+// Update 无法增量描述的变更，通知其他实例重新加载
+func (ew *enforcerWatcher) Update() error {
+	return ew.publish(Message{Op: OpReload})
+}
+
+// Close 停止接收通知
+func (ew *enforcerWatcher) Close() {
+	if err := ew.watcher.Close(); err != nil {
+		logger.Logger.Warn("关闭watcher失败", zap.Error(err))
+	}
+}
+
+// UpdateForAddPolicy 新增一条规则
+func (ew *enforcerWatcher) UpdateForAddPolicy(sec, ptype string, params ...string) error {
+	return ew.publish(Message{Op: OpAdd, Sec: sec, Ptype: ptype, Rules: [][]string{params}})
+}
+
+// UpdateForRemovePolicy 删除一条规则
+func (ew *enforcerWatcher) UpdateForRemovePolicy(sec, ptype string, params ...string) error {
+	return ew.publish(Message{Op: OpRemove, Sec: sec, Ptype: ptype, Rules: [][]string{params}})
+}
+
+// UpdateForRemoveFilteredPolicy 按字段删除规则
+func (ew *enforcerWatcher) UpdateForRemoveFilteredPolicy(sec, ptype string, fieldIndex int, fieldValues ...string) error {
+	return ew.publish(Message{Op: OpRemoveFiltered, Sec: sec, Ptype: ptype, FieldIndex: fieldIndex, FieldValues: fieldValues})
+}
+
+// UpdateForSavePolicy 保存了全部策略，通知其他实例重新加载
+func (ew *enforcerWatcher) UpdateForSavePolicy(model.Model) error {
+	return ew.publish(Message{Op: OpReload})
+}
+
+// UpdateForAddPolicies 新增多条规则
+func (ew *enforcerWatcher) UpdateForAddPolicies(sec, ptype string, rules ...[]string) error {
+	return ew.publish(Message{Op: OpAdd, Sec: sec, Ptype: ptype, Rules: rules})
+}
+
+// UpdateForRemovePolicies 删除多条规则
+func (ew *enforcerWatcher) UpdateForRemovePolicies(sec, ptype string, rules ...[]string) error {
+	return ew.publish(Message{Op: OpRemove, Sec: sec, Ptype: ptype, Rules: rules})
+}
+
+// apply 应用其他实例的变更：只修改内存中的策略（其他实例已写入数据库），失败时重新加载
+func (ew *enforcerWatcher) apply(msg Message) {
+	if msg.Origin == ew.origin {
+		return
+	}
+	if msg.Op == OpUserChanged {
+		ew.applyUserChanged(msg.UserIDs)
+		return
+	}
+	if msg.Op != OpReload {
+		if err := ew.applyIncremental(msg); err == nil {
+			logger.Logger.Info("已应用其他实例的策略变更", zap.String("origin", msg.Origin), zap.String("op", msg.Op), zap.String("ptype", msg.Ptype), zap.Int("rules", len(msg.Rules)))
+			if msg.Sec == "g" {
+				if msg.Op == OpRemoveFiltered {
+					authcache.Purge()
+				} else {
+					authcache.InvalidateGrouping(msg.Rules)
+				}
+			}
+			return
+		} else {
+			logger.Logger.Warn("增量应用策略变更失败，重新加载全部策略", zap.String("op", msg.Op), zap.Error(err))
+		}
+	}
+	if err := ew.enforcer.LoadPolicy(); err != nil {
+		logger.Logger.Error("重新加载Casbin策略失败", zap.Error(err))
+		return
+	}
+	authcache.Purge()
+	logger.Logger.Info("已重新加载Casbin策略", zap.String("origin", msg.Origin))
+}
+
+// applyUserChanged 清除其他实例通知的用户的角色缓存，并调用注册的处理函数
+func (ew *enforcerWatcher) applyUserChanged(userIDs []uint) {
+	userHandlersMu.RLock()
+	handlers := userHandlers
+	userHandlersMu.RUnlock()
+	for _, id := range userIDs {
+		authcache.InvalidateUserID(id)
+		for _, fn := range handlers {
+			fn(id)
+		}
+	}
+	logger.Logger.Info("已清除其他实例通知变化的用户缓存", zap.Any("userIDs", userIDs))
+}
+
+// applyIncremental 在enforcer的写锁内直接修改模型，不经过适配器，也不会再次触发通知
+func (ew *enforcerWatcher) applyIncremental(msg Message) error {
+	lock := ew.enforcer.GetLock()
+	lock.Lock()
+	defer lock.Unlock()
+
+	e := ew.enforcer.Enforcer
+	m := e.GetModel()
+	var changed [][]string
+	var op model.PolicyOp
+	switch msg.Op {
+	case OpAdd:
+		op = model.PolicyAdd
+		for _, rule := range msg.Rules {
+			has, err := m.HasPolicy(msg.Sec, msg.Ptype, rule)
+			if err != nil {
+				return err
+			}
+			if has {
+				continue
+			}
+			if err := m.AddPolicy(msg.Sec, msg.Ptype, rule); err != nil {
+				return err
+			}
+			changed = append(changed, rule)
+		}
+	case OpRemove:
+		op = model.PolicyRemove
+		for _, rule := range msg.Rules {
+			ok, err := m.RemovePolicy(msg.Sec, msg.Ptype, rule)
+			if err != nil {
+				return err
+			}
+			if ok {
+				changed = append(changed, rule)
+			}
+		}
+	case OpRemoveFiltered:
+		op = model.PolicyRemove
+		_, effected, err := m.RemoveFilteredPolicy(msg.Sec, msg.Ptype, msg.FieldIndex, msg.FieldValues...)
+		if err != nil {
+			return err
+		}
+		changed = effected
+	default:
+		return errUnknownOp(msg.Op)
+	}
+
+	// g策略的变更需要更新角色关系
+	if msg.Sec == "g" && len(changed) > 0 {
+		return e.BuildIncrementalRoleLinks(op, msg.Ptype, changed)
+	}
+	return nil
+}
+
+// errUnknownOp 未知的变更操作
+type errUnknownOp string
+
+func (op errUnknownOp) Error() string {
+	return "未知的策略变更操作: " + string(op)
+}
@@ -0,0 +1,202 @@
+package watcher
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/internal/logger"
+)
+
+// dbBatchSize 每次轮询读取的最大记录数
+const dbBatchSize = 500
+
+// dbGapTimeout 等待ID空洞中晚提交的记录的最短时间
+const dbGapTimeout = 30 * time.Second
+
+// DBWatcher 通过数据库中的变更记录同步：每次变更写入一行policy_events，
+// 自增ID作为策略版本，各实例定期读取比已处理版本新的记录
+type DBWatcher struct {
+	db         *gorm.DB
+	interval   time.Duration
+	retain     time.Duration
+	gapTimeout time.Duration // 至少覆盖两次轮询
+
+	mu        sync.Mutex
+	lastClean time.Time
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// NewDBWatcher 创建数据库轮询watcher，retain为0时不清理变更记录
+func NewDBWatcher(db *gorm.DB, interval, retain time.Duration) *DBWatcher {
+	gapTimeout := dbGapTimeout
+	if gapTimeout < 2*interval {
+		gapTimeout = 2 * interval
+	}
+	return &DBWatcher{db: db, interval: interval, retain: retain, gapTimeout: gapTimeout}
+}
+
+// Publish 写入一条变更记录，并顺带清理过期的记录
+func (w *DBWatcher) Publish(msg Message) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if err := w.db.Create(&models.PolicyEvent{Origin: msg.Origin, Payload: string(payload)}).Error; err != nil {
+		return err
+	}
+	w.cleanup()
+	return nil
+}
+
+// cleanup 每分钟最多清理一次过期的变更记录
+func (w *DBWatcher) cleanup() {
+	if w.retain <= 0 {
+		return
+	}
+	w.mu.Lock()
+	if time.Since(w.lastClean) < time.Minute {
+		w.mu.Unlock()
+		return
+	}
+	w.lastClean = time.Now()
+	w.mu.Unlock()
+
+	if err := w.db.Where("created_at < ?", time.Now().Add(-w.retain)).Delete(&models.PolicyEvent{}).Error; err != nil {
+		logger.Logger.Warn("清理策略变更记录失败", zap.Error(err))
+	}
+}
+
+// Subscribe 从当前最新版本开始轮询
+func (w *DBWatcher) Subscribe(handler func(Message)) error {
+	var last uint
+	if err := w.db.Model(&models.PolicyEvent{}).Select("COALESCE(MAX(id), 0)").Scan(&last).Error; err != nil {
+		return err
+	}
+	w.stop = make(chan struct{})
+	w.done = make(chan struct{})
+	go w.poll(last, handler)
+	return nil
+}
+
+// poll 定期读取新记录并按版本顺序交给handler
+func (w *DBWatcher) poll(last uint, handler func(Message)) {
+	defer close(w.done)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	cursor := &dbCursor{last: last, gaps: make(map[uint]time.Time)}
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		}
+
+		msgs, err := w.next(cursor)
+		if err != nil {
+			logger.Logger.Warn("读取策略变更记录失败", zap.Error(err))
+			continue
+		}
+		for _, msg := range msgs {
+			handler(msg)
+		}
+	}
+}
+
+// dbCursor 轮询进度
+type dbCursor struct {
+	last uint               // 已读到的最大版本
+	gaps map[uint]time.Time // 小于last但尚未读到的ID及发现时间
+}
+
+// next 读取比已处理版本新的记录，并补读此前空洞中晚提交的记录。
+// 自增ID在插入时分配、提交后才可见，并发事务中ID较小的可能晚于ID较大的提交，
+// 因此跳过的ID先记为空洞，在gapTimeout内每次轮询重新读取；超时仍未出现的多半是回滚的事务，
+// 但无法与提交极慢的事务区分，改为全量重新加载保证不遗漏
+func (w *DBWatcher) next(c *dbCursor) ([]Message, error) {
+	query := w.db.Where("id > ?", c.last)
+	if len(c.gaps) > 0 {
+		ids := make([]uint, 0, len(c.gaps))
+		for id := range c.gaps {
+			ids = append(ids, id)
+		}
+		query = w.db.Where("id > ? OR id IN ?", c.last, ids)
+	}
+	var events []models.PolicyEvent
+	if err := query.Order("id").Limit(dbBatchSize).Find(&events).Error; err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	reload := false
+	var msgs []Message
+	for i, event := range events {
+		if event.ID < c.last {
+			delete(c.gaps, event.ID)
+			msgs = append(msgs, eventMessage(event))
+			continue
+		}
+		if event.ID > c.last+1 {
+			// 中间的记录已被清理（本实例落后太多），或空洞过多，增量变更不完整，改为全量重新加载
+			first := i == 0 || events[i-1].ID < c.last
+			if (first && w.missed(c.last)) || len(c.gaps)+int(event.ID-c.last-1) > dbBatchSize {
+				c.last = events[len(events)-1].ID
+				c.gaps = make(map[uint]time.Time)
+				return []Message{{Origin: "db", Op: OpReload}}, nil
+			}
+			for id := c.last + 1; id < event.ID; id++ {
+				c.gaps[id] = now
+			}
+		}
+		c.last = event.ID
+		msgs = append(msgs, eventMessage(event))
+	}
+
+	for id, seen := range c.gaps {
+		if now.Sub(seen) >= w.gapTimeout {
+			delete(c.gaps, id)
+			reload = true
+		}
+	}
+	if reload {
+		msgs = append(msgs, Message{Origin: "db", Op: OpReload})
+	}
+	return msgs, nil
+}
+
+// eventMessage 解析变更记录，无法解析时全量重新加载
+func eventMessage(event models.PolicyEvent) Message {
+	var msg Message
+	if err := json.Unmarshal([]byte(event.Payload), &msg); err != nil {
+		logger.Logger.Warn("解析策略变更记录失败", zap.Uint("id", event.ID), zap.Error(err))
+		return Message{Origin: "db", Op: OpReload}
+	}
+	return msg
+}
+
+// missed 版本last之后的记录是否可能已被清理。
+// 自增ID可能因回滚或未提交的事务出现空洞，只有已处理的最后一条记录也被清理了才认为中间的记录同样被清理
+func (w *DBWatcher) missed(last uint) bool {
+	if last == 0 || w.retain <= 0 {
+		return false
+	}
+	var prev models.PolicyEvent
+	err := w.db.Where("id = ?", last).First(&prev).Error
+	return errors.Is(err, gorm.ErrRecordNotFound)
+}
+
+// Close 停止轮询
+func (w *DBWatcher) Close() error {
+	if w.stop != nil {
+		close(w.stop)
+		<-w.done
+		w.stop = nil
+	}
+	return nil
+}
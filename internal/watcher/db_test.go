@@ -0,0 +1,123 @@
+package watcher
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	glog "gorm.io/gorm/logger"
+
+	"github.com/GZ-Alinx/autops/business/models"
+	"github.com/GZ-Alinx/autops/internal/logger"
+)
+
+func setupWatcherDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	logger.Logger = zap.NewNop()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: glog.Default.LogMode(glog.Silent)})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	// 内存数据库每个连接独立，只使用一个连接
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("获取连接失败: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.PolicyEvent{}); err != nil {
+		t.Fatalf("迁移失败: %v", err)
+	}
+	return db
+}
+
+// commit 以指定ID写入变更记录，模拟自增ID分配后事务才提交
+func commit(t *testing.T, db *gorm.DB, id uint, rule string) {
+	t.Helper()
+	payload, _ := json.Marshal(Message{Origin: "other", Op: OpAdd, Sec: "p", Ptype: "p", Rules: [][]string{{rule}}})
+	if err := db.Create(&models.PolicyEvent{ID: id, Origin: "other", Payload: string(payload)}).Error; err != nil {
+		t.Fatalf("写入变更记录失败: %v", err)
+	}
+}
+
+// ops 消息摘要：OpAdd取规则，其他取操作名
+func ops(msgs []Message) []string {
+	var out []string
+	for _, msg := range msgs {
+		if msg.Op == OpAdd {
+			out = append(out, msg.Rules[0][0])
+		} else {
+			out = append(out, msg.Op)
+		}
+	}
+	return out
+}
+
+func TestDBWatcherLateCommit(t *testing.T) {
+	db := setupWatcherDB(t)
+	w := NewDBWatcher(db, time.Second, time.Hour)
+	cursor := &dbCursor{gaps: make(map[uint]time.Time)}
+
+	tests := []struct {
+		name    string
+		commits map[uint]string
+		expire  bool // 轮询前让现有空洞超时
+		want    []string
+	}{
+		{name: "ID 2尚未提交", commits: map[uint]string{1: "r1", 3: "r3"}, want: []string{"r1", "r3"}},
+		{name: "ID 2晚提交后补读", commits: map[uint]string{2: "r2", 4: "r4"}, want: []string{"r2", "r4"}},
+		{name: "ID 5未提交", commits: map[uint]string{6: "r6"}, want: []string{"r6"}},
+		{name: "空洞超时后全量重新加载", expire: true, want: []string{OpReload}},
+		{name: "超时的ID不再读取", commits: map[uint]string{5: "r5", 7: "r7"}, want: []string{"r7"}},
+	}
+	for _, tt := range tests {
+		for id, rule := range tt.commits {
+			commit(t, db, id, rule)
+		}
+		if tt.expire {
+			for id := range cursor.gaps {
+				cursor.gaps[id] = time.Now().Add(-w.gapTimeout)
+			}
+		}
+		msgs, err := w.next(cursor)
+		if err != nil {
+			t.Fatalf("%s: 读取失败: %v", tt.name, err)
+		}
+		if got := ops(msgs); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: 收到%v，期望%v", tt.name, got, tt.want)
+		}
+	}
+	if cursor.last != 7 || len(cursor.gaps) != 0 {
+		t.Errorf("轮询进度为%d，空洞为%v", cursor.last, cursor.gaps)
+	}
+}
+
+// TestDBWatcherPurged 本实例落后到已处理的记录被清理时全量重新加载
+func TestDBWatcherPurged(t *testing.T) {
+	db := setupWatcherDB(t)
+	w := NewDBWatcher(db, time.Second, time.Hour)
+	commit(t, db, 1, "r1")
+	cursor := &dbCursor{gaps: make(map[uint]time.Time)}
+	if _, err := w.next(cursor); err != nil {
+		t.Fatalf("读取失败: %v", err)
+	}
+
+	commit(t, db, 2, "r2")
+	commit(t, db, 3, "r3")
+	if err := db.Where("id < ?", 3).Delete(&models.PolicyEvent{}).Error; err != nil {
+		t.Fatalf("清理失败: %v", err)
+	}
+	msgs, err := w.next(cursor)
+	if err != nil {
+		t.Fatalf("读取失败: %v", err)
+	}
+	if got := ops(msgs); !slices.Equal(got, []string{OpReload}) {
+		t.Fatalf("收到%v，期望全量重新加载", got)
+	}
+	if cursor.last != 3 || len(cursor.gaps) != 0 {
+		t.Errorf("轮询进度为%d，空洞为%v", cursor.last, cursor.gaps)
+	}
+}
@@ -0,0 +1,296 @@
+package watcher
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/GZ-Alinx/autops/internal/logger"
+)
+
+// redisDialTimeout 连接Redis的超时时间
+const redisDialTimeout = 5 * time.Second
+
+// RedisWatcher 通过Redis发布订阅同步：变更发布到频道，各实例订阅同一频道。
+// 发布订阅不保存消息，订阅连接断开重连后通知实例全量重新加载
+type RedisWatcher struct {
+	addr     string
+	password string
+	db       int
+	channel  string
+
+	mu  sync.Mutex
+	pub *redisConn // 发布使用的连接，出错时丢弃并在下次发布时重连
+
+	subMu  sync.Mutex
+	sub    *redisConn
+	closed bool
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// NewRedisWatcher 创建Redis发布订阅watcher
+func NewRedisWatcher(addr, password string, db int, channel string) *RedisWatcher {
+	return &RedisWatcher{addr: addr, password: password, db: db, channel: channel}
+}
+
+// Publish 发布一条变更
+func (w *RedisWatcher) Publish(msg Message) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.pub == nil {
+		if w.pub, err = w.dial(); err != nil {
+			return err
+		}
+	}
+	w.pub.SetDeadline(time.Now().Add(redisDialTimeout))
+	if _, err := w.pub.do("PUBLISH", w.channel, string(payload)); err != nil {
+		w.pub.Close()
+		w.pub = nil
+		return err
+	}
+	return nil
+}
+
+// Subscribe 订阅频道，连接断开时按退避间隔重连
+func (w *RedisWatcher) Subscribe(handler func(Message)) error {
+	conn, err := w.subscribe()
+	if err != nil {
+		return err
+	}
+	w.subMu.Lock()
+	w.sub = conn
+	w.stop = make(chan struct{})
+	w.done = make(chan struct{})
+	w.subMu.Unlock()
+	go w.receive(conn, handler)
+	return nil
+}
+
+// subscribe 建立订阅连接
+func (w *RedisWatcher) subscribe() (*redisConn, error) {
+	conn, err := w.dial()
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.send("SUBSCRIBE", w.channel); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// 订阅确认：["subscribe", channel, count]
+	if _, err := conn.read(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// receive 读取订阅消息，断开后重连
+func (w *RedisWatcher) receive(conn *redisConn, handler func(Message)) {
+	defer close(w.done)
+	backoff := time.Second
+	for {
+		err := w.readMessages(conn, handler)
+		if w.isClosed() {
+			return
+		}
+		logger.Logger.Warn("Redis订阅连接断开，准备重连", zap.Error(err))
+
+		for {
+			select {
+			case <-w.stop:
+				return
+			case <-time.After(backoff):
+			}
+			if conn, err = w.subscribe(); err == nil {
+				break
+			}
+			logger.Logger.Warn("重连Redis失败", zap.Duration("backoff", backoff), zap.Error(err))
+			if backoff < 30*time.Second {
+				backoff *= 2
+			}
+		}
+		backoff = time.Second
+
+		w.subMu.Lock()
+		if w.closed {
+			w.subMu.Unlock()
+			conn.Close()
+			return
+		}
+		w.sub = conn
+		w.subMu.Unlock()
+		logger.Logger.Info("已重新订阅Redis频道", zap.String("channel", w.channel))
+
+		// 断开期间的通知已经丢失
+		handler(Message{Origin: "redis", Op: OpReload})
+	}
+}
+
+// readMessages 读取订阅消息直到连接出错
+func (w *RedisWatcher) readMessages(conn *redisConn, handler func(Message)) error {
+	for {
+		reply, err := conn.read()
+		if err != nil {
+			return err
+		}
+		// 频道消息：["message", channel, payload]
+		parts, ok := reply.([]interface{})
+		if !ok || len(parts) != 3 || parts[0] != "message" {
+			continue
+		}
+		payload, _ := parts[2].(string)
+		var msg Message
+		if err := json.Unmarshal([]byte(payload), &msg); err != nil {
+			logger.Logger.Warn("解析策略变更通知失败", zap.Error(err))
+			continue
+		}
+		handler(msg)
+	}
+}
+
+// isClosed 是否已调用Close
+func (w *RedisWatcher) isClosed() bool {
+	w.subMu.Lock()
+	defer w.subMu.Unlock()
+	return w.closed
+}
+
+// Close 关闭订阅和发布连接
+func (w *RedisWatcher) Close() error {
+	w.subMu.Lock()
+	if w.closed {
+		w.subMu.Unlock()
+		return nil
+	}
+	w.closed = true
+	sub, done := w.sub, w.done
+	if w.stop != nil {
+		close(w.stop)
+	}
+	w.subMu.Unlock()
+	if sub != nil {
+		sub.Close()
+		<-done
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.pub != nil {
+		w.pub.Close()
+		w.pub = nil
+	}
+	return nil
+}
+
+// dial 建立连接并完成认证和选库
+func (w *RedisWatcher) dial() (*redisConn, error) {
+	nc, err := net.DialTimeout("tcp", w.addr, redisDialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	conn := &redisConn{Conn: nc, r: bufio.NewReader(nc)}
+	if w.password != "" {
+		if _, err := conn.do("AUTH", w.password); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("Redis认证失败: %v", err)
+		}
+	}
+	if w.db != 0 {
+		if _, err := conn.do("SELECT", strconv.Itoa(w.db)); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("选择Redis数据库失败: %v", err)
+		}
+	}
+	return conn, nil
+}
+
+// redisConn 只实现watcher用到的命令的RESP连接
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// do 发送命令并读取一个回复
+func (c *redisConn) do(args ...string) (interface{}, error) {
+	if err := c.send(args...); err != nil {
+		return nil, err
+	}
+	return c.read()
+}
+
+// send 以RESP数组发送命令
+func (c *redisConn) send(args ...string) error {
+	buf := []byte("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(arg)), 10)
+		buf = append(buf, "\r\n"...)
+		buf = append(buf, arg...)
+		buf = append(buf, "\r\n"...)
+	}
+	_, err := c.Write(buf)
+	return err
+}
+
+// read 读取一个回复：字符串、整数、数组或nil，错误回复作为error返回
+func (c *redisConn) read() (interface{}, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, errors.New("无效的Redis回复")
+	}
+	kind, body := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, errors.New(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, data); err != nil {
+			return nil, err
+		}
+		return string(data[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = c.read(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("无效的Redis回复类型: %q", kind)
+	}
+}
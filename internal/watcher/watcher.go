@@ -0,0 +1,89 @@
+// Package watcher 在多个实例之间传播Casbin策略的变更。
+//
+// 修改策略的实例发布变更通知，其他实例收到后增量地修改内存中的策略（新增或删除的规则）；
+// 无法增量处理的变更（SavePolicy重建全部策略）和可能丢失通知的情况（连接中断、轮询落后太多）
+// 通知实例从数据库重新加载全部策略。
+//
+// 用户的账号状态变化或被删除时同样通过watcher通知其他实例清除该用户的缓存，使禁用、锁定立即生效。
+package watcher
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/GZ-Alinx/autops/internal/config"
+)
+
+// 变更操作
+const (
+	OpAdd            = "add"             // 新增规则
+	OpRemove         = "remove"          // 删除规则
+	OpRemoveFiltered = "remove_filtered" // 按字段删除规则
+	OpReload         = "reload"          // 重新加载全部策略
+	OpUserChanged    = "user_changed"    // 用户状态变化或被删除，清除用户缓存
+)
+
+// Message 策略变更通知
+type Message struct {
+	Origin      string     `json:"origin"`                 // 发出通知的实例，实例忽略自己的通知
+	Op          string     `json:"op"`                     // 变更操作
+	Sec         string     `json:"sec,omitempty"`          // p或g
+	Ptype       string     `json:"ptype,omitempty"`        // 策略类型，如p、g
+	Rules       [][]string `json:"rules,omitempty"`        // OpAdd、OpRemove的规则
+	FieldIndex  int        `json:"field_index,omitempty"`  // OpRemoveFiltered的起始字段
+	FieldValues []string   `json:"field_values,omitempty"` // OpRemoveFiltered的字段值
+	UserIDs     []uint     `json:"user_ids,omitempty"`     // OpUserChanged的用户ID
+}
+
+// Watcher 变更通知的传输方式
+type Watcher interface {
+	// Publish 向所有实例（包括自己）发布通知
+	Publish(msg Message) error
+	// Subscribe 开始接收通知，handler在后台goroutine中按顺序调用；可能丢失通知时以OpReload调用
+	Subscribe(handler func(Message)) error
+	// Close 停止接收通知并释放连接
+	Close() error
+}
+
+// New 根据配置创建watcher，driver为空或none时返回nil（单实例部署不需要同步）
+func New(cfg config.WatcherConfig, db *gorm.DB) (Watcher, error) {
+	switch strings.ToLower(cfg.Driver) {
+	case "", "none":
+		return nil, nil
+	case "db", "database", "mysql":
+		return NewDBWatcher(db, seconds(cfg.PollSeconds, 5), time.Duration(cfg.RetainMinutes)*time.Minute), nil
+	case "redis":
+		if cfg.RedisAddr == "" {
+			return nil, fmt.Errorf("redis watcher需要配置redis_addr")
+		}
+		channel := cfg.Channel
+		if channel == "" {
+			channel = "autops:casbin"
+		}
+		return NewRedisWatcher(cfg.RedisAddr, cfg.RedisPassword, cfg.RedisDB, channel), nil
+	default:
+		return nil, fmt.Errorf("不支持的watcher: %s", cfg.Driver)
+	}
+}
+
+// seconds 秒数配置，未配置时使用默认值
+func seconds(n, fallback int) time.Duration {
+	if n <= 0 {
+		n = fallback
+	}
+	return time.Duration(n) * time.Second
+}
+
+// newInstanceID 生成实例标识：主机名-进程号-随机数
+func newInstanceID() string {
+	host, _ := os.Hostname()
+	buf := make([]byte, 4)
+	rand.Read(buf)
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(buf))
+}
@@ -32,7 +32,9 @@ import (
 	"github.com/GZ-Alinx/autops/internal/logger"
 	"github.com/GZ-Alinx/autops/internal/middleware"
 
+	"github.com/GZ-Alinx/autops/business/repositories"
 	"github.com/GZ-Alinx/autops/business/routes"
+	"github.com/GZ-Alinx/autops/business/services"
 )
 
 func main() {
@@ -48,12 +50,25 @@ func main() {
 	defer logger.Logger.Sync()
 	logger.Logger.Info("日志系统初始化成功")
 
+	// 加载JWT密钥
+	if err := middleware.InitJWTKeys(); err != nil {
+		logger.Logger.Fatal("JWT密钥加载失败", zap.Error(err))
+	}
+
 	// 初始化数据库
 	if err := database.InitDB(); err != nil {
 		logger.Logger.Fatal("数据库初始化失败", zap.Error(err))
 	}
 	defer database.CloseDB()
 
+	// 命令行子命令，执行完退出
+	if len(os.Args) > 1 {
+		code := runCommand(os.Args[1:])
+		database.CloseDB()
+		logger.Logger.Sync()
+		os.Exit(code)
+	}
+
 	// 初始化Casbin和角色权限
 	if err := database.InitCasbinAndPermissions(); err != nil {
 		logger.Logger.Fatal("角色权限初始化失败", zap.Error(err))
@@ -66,6 +81,21 @@ func main() {
 
 	logger.Logger.Info("权限控制和角色权限初始化成功")
 
+	// 多实例部署时同步策略变更
+	if err := database.StartPolicyWatcher(); err != nil {
+		logger.Logger.Fatal("策略watcher初始化失败", zap.Error(err))
+	}
+	defer database.StopPolicyWatcher()
+
+	// 定期检查casbin_rule与业务表是否一致
+	database.StartPolicyReconciler()
+	defer database.StopPolicyReconciler()
+
+	// 定期回收到期的临时授权
+	services.StartGrantReaper(services.NewRoleElevationService(repositories.NewRoleElevationRepository(),
+		repositories.NewUserRepository(), repositories.NewRoleRepository(), services.NewAuditService(repositories.NewAuditLogRepository())))
+	defer services.StopGrantReaper()
+
 	// 设置Gin模式
 	if config.AppConfig.App.Env == "production" {
 		gin.SetMode(gin.ReleaseMode)
@@ -96,6 +126,13 @@ func main() {
 
 	routes.RegisterRoutes(router)
 
+	// 按路由表注册权限
+	if config.AppConfig.Permission.AutoRegister {
+		if err := routes.RegisterRoutePermissions(router); err != nil {
+			logger.Logger.Error("按路由表注册权限失败", zap.Error(err))
+		}
+	}
+
 	// 创建HTTP服务器
 	srv := &http.Server{
 		Addr:    fmt.Sprintf(":%d", config.AppConfig.App.Port),